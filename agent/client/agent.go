@@ -10,12 +10,14 @@ import (
 	"net"
 	"net/http"
 	"runtime"
-	"strings"
 	"sync"
 	"time"
 	"yulong-hids/agent/collect"
 	"yulong-hids/agent/common"
+	"yulong-hids/agent/container"
 	"yulong-hids/agent/monitor"
+	"yulong-hids/agent/resource"
+	"yulong-hids/netaddr"
 
 	"github.com/smallnest/rpcx/client"
 	"github.com/smallnest/rpcx/share"
@@ -91,6 +93,9 @@ func (a *Agent) Run() {
 	// 每隔一段时间更新初始化配置,会自动更新serverlist的核心代码
 	a.configRefresh()
 
+	// 资源使用采样,按配置限制agent的CPU和内存占用
+	resource.Start()
+
 	// 开启各个监控流程 文件监控，网络监控，进程监控,并将监控所得结果通过RPC传输至Server
 	a.monitor()
 
@@ -110,7 +115,7 @@ func (a *Agent) newClient() {
 	//遍历serverlist,将每个server的ip端口以:分隔,并只取ip忽略端口?
 
 	for _, server := range a.ServerList {
-		common.ServerIPList = append(common.ServerIPList, strings.Split(server, ":")[0])
+		common.ServerIPList = append(common.ServerIPList, netaddr.Host(server))
 		//只添加Key 忽略value字段
 		s := client.KVPair{Key: server}
 		servers = append(servers, &s)
@@ -170,7 +175,7 @@ func (a Agent) setLocalIP(ip string) {
 		panic(1)
 	}
 	defer conn.Close()
-	common.LocalIP = strings.Split(conn.LocalAddr().String(), ":")[0]
+	common.LocalIP = netaddr.Host(conn.LocalAddr().String())
 }
 
 //定期更新配置等,实现定期更新serverlist的核心代码
@@ -182,11 +187,14 @@ func (a *Agent) configRefresh() {
 			ch := make(chan bool)
 			//开启协程进行RPC调用,GetInfo刷新配置信息
 			go func() {
-				err = a.Client.Call(a.ctx, "GetInfo", &common.ServerInfo, &common.Config)
+				// 出错时rpcx仍会解码空的返回值，先解码到临时变量，失败时保留上一次的配置
+				var config common.ClientConfig
+				err = a.Client.Call(a.ctx, "GetInfo", &common.ServerInfo, &config)
 				if err != nil {
 					a.log("RPC Client Call:", err.Error())
 					return
 				}
+				common.Config = config
 				ch <- true
 			}()
 			// Server集群列表获取
@@ -238,13 +246,19 @@ func (a *Agent) monitor() {
 	resultChan := make(chan map[string]string, 16)
 
 	//网络 github.com/akrennmair/gopcap,关于抓包的包
-	go monitor.StartNetSniff(resultChan)
+	go monitor.Run("connection", monitor.StartNetSniff, resultChan)
 
 	//进程监控,监听当前127.0.0.1:65530;TODO:监听本地的65530端口,如果是其他端口的UDP消息怎么办,UDP为什么能监听Process
-	go monitor.StartProcessMonitor(resultChan)
+	go monitor.Run("process", monitor.StartProcessMonitor, resultChan)
 
 	//文件监控 https://github.com/fsnotify/fsnotify 关于文件系统通知的包
-	go monitor.StartFileMonitor(resultChan)
+	go monitor.Run("file", monitor.StartFileMonitor, resultChan)
+
+	//DNS查询监控 https://github.com/miekg/dns 解析DNS报文
+	go monitor.Run("dns", monitor.StartDNSMonitor, resultChan)
+
+	//反弹shell检测,检查shell类进程的标准输入输出是否为远程连接的socket
+	go monitor.Run("reverseshell", monitor.StartShellMonitor, resultChan)
 
 	//获取结果的协程,收集以上三个协程监控获得的数据
 	go func(result chan map[string]string) {
@@ -254,7 +268,15 @@ func (a *Agent) monitor() {
 		for {
 			//取出数据,并为数据加上当前时间
 			data = <-result
+			//超出回传频率上限的事件直接丢弃,超出CPU上限时降速
+			if !resource.Allow(data["source"]) {
+				continue
+			}
+			resource.Wait()
+			recordEvent(data["source"])
 			data["time"] = fmt.Sprintf("%d", time.Now().Unix())
+			//根据进程pid添加所属容器信息
+			container.Attach(data)
 			a.log("Monitor data: ", data)
 			//将其中source字段对应的值(connection,process等)取提取到source变量,并从data中删除该字段,source即为Type
 			source := data["source"]
@@ -300,6 +322,14 @@ func (a *Agent) getInfo() {
 				historyCache[k] = v
 			}
 		}
+		//回传agent自身的资源使用情况和丢弃事件数量
+		a.Mutex.Lock()
+		a.PutData = dataInfo{common.LocalIP, "agentstat", runtime.GOOS, []map[string]string{resource.Stat()}}
+		a.put()
+		//回传agent健康状态,由server判断监控模块是否异常、程序是否被替换
+		a.PutData = dataInfo{common.LocalIP, "health", runtime.GOOS, []map[string]string{healthReport()}}
+		a.put()
+		a.Mutex.Unlock()
 		if common.Config.Cycle == 0 {
 			common.Config.Cycle = 1
 		}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"yulong-hids/agent/common"
+	"yulong-hids/agent/monitor"
+	"yulong-hids/agent/resource"
+)
+
+// 进程监控依赖的内核模块（linux）
+const kernelModuleName = "syshook_execve"
+
+var (
+	startTime  = time.Now()
+	eventLock  sync.Mutex
+	lastEvents = make(map[string]time.Time)
+)
+
+// recordEvent 记录每种事件最后一次回传的时间
+func recordEvent(source string) {
+	eventLock.Lock()
+	lastEvents[source] = time.Now()
+	eventLock.Unlock()
+}
+
+// healthReport agent健康状态，每个回传间隔回传一次，
+// restarts为daemon在一小时内重启agent的次数，由daemon通过环境变量传入
+func healthReport() map[string]string {
+	eventLock.Lock()
+	var events []string
+	for source, t := range lastEvents {
+		events = append(events, fmt.Sprintf("%s:%d", source, t.Unix()))
+	}
+	eventLock.Unlock()
+	sort.Strings(events)
+	restarts := os.Getenv("YULONG_HIDS_RESTARTS")
+	if restarts == "" {
+		restarts = "0"
+	}
+	return map[string]string{
+		"monitors":      monitor.Status(),
+		"lastevent":     strings.Join(events, "|"),
+		"kernelmodule":  kernelModule(),
+		"dropped":       resource.Stat()["droppedsum"],
+		"configversion": configVersion(),
+		"agenthash":     agentHash(),
+		"starttime":     fmt.Sprintf("%d", startTime.Unix()),
+		"restarts":      restarts,
+		"pid":           fmt.Sprintf("%d", os.Getpid()),
+	}
+}
+
+// kernelModule 内核模块是否已加载，windows下为空
+func kernelModule() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	data, err := ioutil.ReadFile("/proc/modules")
+	if err != nil {
+		return "false"
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, kernelModuleName+" ") {
+			return "true"
+		}
+	}
+	return "false"
+}
+
+// configVersion 当前生效配置的md5，不包括每次刷新都会变化的登录日志时间
+func configVersion() string {
+	config := common.Config
+	config.Lasttime = ""
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", md5.Sum(data))
+}
+
+// agentHash agent程序文件的md5，与daemon检查更新时使用的hash一致
+func agentHash() string {
+	path, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	md5h := md5.New()
+	if _, err := io.Copy(md5h, file); err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", md5h.Sum(nil))
+}
@@ -0,0 +1,10 @@
+// +build linux
+
+package collect
+
+import "yulong-hids/agent/container"
+
+// GetContainer 获取正在运行的容器（docker、containerd、cri-o）及其特权、宿主机挂载等配置
+func GetContainer() []map[string]string {
+	return container.List()
+}
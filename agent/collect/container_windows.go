@@ -0,0 +1,8 @@
+// +build windows
+
+package collect
+
+// GetContainer windows下暂不支持容器信息收集
+func GetContainer() (resultData []map[string]string) {
+	return
+}
@@ -1,9 +1,11 @@
 // Package collect 获取以下服务器关键信息
-// 监听端口，服务列表，用户列表，启动项，计划任务，登录日志
+// 监听端口，服务列表，用户列表，启动项，计划任务，登录日志，容器
 package collect
 
 import (
+	"path/filepath"
 	"regexp"
+	"sort"
 	"time"
 	"yulong-hids/agent/common"
 )
@@ -11,7 +13,7 @@ import (
 var allInfo = make(map[string][]map[string]string)
 
 var tagMap = map[string]string{
-	"web": `nginx|httpd|apache|w3wp\.exe|tomcat|weblogic|jboss|jetty`,
+	"web": `nginx|openresty|httpd|apache|w3wp\.exe|tomcat|weblogic|jboss|jetty|caddy|php-fpm`,
 	"db":  `mysql|mongo|sqlservr\.exe|oracle|elasticsearch|postgres|redis|cassandra|teradata|solr|HMaster|hbase|mariadb`,
 }
 
@@ -31,25 +33,43 @@ func GetAllInfo() map[string][]map[string]string {
 	allInfo["crontab"] = GetCrontab()
 	allInfo["loginlog"] = GetLoginLog()
 	allInfo["processlist"] = GetProcessList()
+	allInfo["container"] = GetContainer()
 	return allInfo
 }
 
+// discern 根据进程识别服务器角色，可同时为多个角色，web目录合并所有web服务的配置
 func discern(info *common.ComputerInfo) {
-	for k, v := range tagMap {
-		for _, p := range GetProcessList() {
-			if p["command"] == "" {
+	parsed := make(map[string]bool)
+	for _, p := range GetProcessList() {
+		if p["command"] == "" {
+			continue
+		}
+		for k, v := range tagMap {
+			if ok, _ := regexp.MatchString(v, p["command"]); !ok {
 				continue
 			}
-			if ok, _ := regexp.MatchString(v, p["command"]); ok {
-				info.Type = k
-				if k == "web" {
-					info.Path, _ = getWebPath(p["command"])
-					// web优先，匹配到web就退出，其他一直匹配下去
-					return
+			if !common.InArray(info.Roles, k, false) {
+				info.Roles = append(info.Roles, k)
+			}
+			// 同一服务的多个进程命令行相同，只解析一次
+			if k == "web" && !parsed[p["command"]] {
+				parsed[p["command"]] = true
+				pathList, _ := getWebPath(p["command"])
+				for _, path := range pathList {
+					info.Path = append(info.Path, filepath.Clean(path))
 				}
 			}
 		}
 	}
+	sort.Strings(info.Roles)
+	// web优先作为主要类型
+	if common.InArray(info.Roles, "web", false) {
+		info.Type = "web"
+	} else if len(info.Roles) != 0 {
+		info.Type = info.Roles[0]
+	}
+	sort.Strings(info.Path)
+	info.Path = removeDuplicatesAndEmpty(info.Path)
 }
 
 func removeDuplicatesAndEmpty(list []string) (ret []string) {
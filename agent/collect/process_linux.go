@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"strconv"
 	"strings"
+	"yulong-hids/agent/resource"
 )
 
 func GetProcessList() (resultData []map[string]string) {
@@ -16,7 +17,11 @@ func GetProcessList() (resultData []map[string]string) {
 	if err != nil || len(dirs) == 0 {
 		return
 	}
-	for _, v := range dirs {
+	for i, v := range dirs {
+		// 超出CPU上限时分批遍历
+		if i%100 == 99 {
+			resource.Wait()
+		}
 		pid, err := strconv.Atoi(v)
 		if err != nil {
 			continue
@@ -0,0 +1,320 @@
+package collect
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 配置文件include的最大层数，防止循环引用
+const maxIncludeDepth = 8
+
+var (
+	nginxDirective  = regexp.MustCompile(`(?:^|[;{}\s])(include|root|alias)\s+("[^"]*"|'[^']*'|[^;\s]+)\s*;`)
+	apacheDirective = regexp.MustCompile(`(?im)^\s*(ServerRoot|Include|IncludeOptional|DocumentRoot|Alias|ScriptAlias)\s+(.+?)\s*$`)
+	tomcatAppBase   = regexp.MustCompile(`<Host\s[^>]*appBase="([^"]*)"`)
+	tomcatDocBase   = regexp.MustCompile(`<Context\s[^>]*docBase="([^"]*)"`)
+	caddyRoot       = regexp.MustCompile(`(?m)^\s*root\s+(.+?)\s*$`)
+	caddyImport     = regexp.MustCompile(`(?m)^\s*import\s+(\S+)`)
+	phpfpmDirective = regexp.MustCompile(`(?m)^\s*(include|chroot|chdir)\s*=\s*(.+?)\s*$`)
+)
+
+// confReader 递归读取配置文件，相同文件只读取一次
+type confReader struct {
+	visited map[string]bool
+}
+
+func newConfReader() *confReader {
+	return &confReader{visited: make(map[string]bool)}
+}
+
+// files 展开通配符，相对路径基于base目录
+func (r *confReader) files(pattern string, base string) []string {
+	pattern = unquote(pattern)
+	if pattern == "" || strings.Contains(pattern, "$") {
+		return nil
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(base, pattern)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil
+	}
+	// 目录表示包含目录下的所有文件(apache)
+	var fileList []string
+	for _, m := range matches {
+		if dirList, err := ioutil.ReadDir(m); err == nil {
+			for _, f := range dirList {
+				if !f.IsDir() {
+					fileList = append(fileList, filepath.Join(m, f.Name()))
+				}
+			}
+			continue
+		}
+		fileList = append(fileList, m)
+	}
+	return fileList
+}
+
+func (r *confReader) read(path string, depth int) (string, bool) {
+	if depth > maxIncludeDepth || r.visited[path] {
+		return "", false
+	}
+	r.visited[path] = true
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	return string(dat), true
+}
+
+// nginxRoots 解析nginx配置及include的文件，返回root和alias目录
+func nginxRoots(confPath string) []string {
+	return newConfReader().nginx(confPath, filepath.Dir(confPath), 0)
+}
+
+func (r *confReader) nginx(path string, prefix string, depth int) []string {
+	dat, ok := r.read(path, depth)
+	if !ok {
+		return nil
+	}
+	var pathList []string
+	for _, m := range nginxDirective.FindAllStringSubmatch(stripComment(dat), -1) {
+		switch m[1] {
+		case "include":
+			// 相对路径基于主配置文件所在目录
+			for _, f := range r.files(m[2], prefix) {
+				pathList = append(pathList, r.nginx(f, prefix, depth+1)...)
+			}
+		default:
+			if p := unquote(m[2]); filepath.IsAbs(p) && !strings.Contains(p, "$") {
+				pathList = append(pathList, p)
+			}
+		}
+	}
+	return pathList
+}
+
+// apacheRoots 解析apache配置及Include的文件，返回DocumentRoot和Alias目录
+func apacheRoots(confPath string, serverRoot string) []string {
+	return newConfReader().apache(confPath, &serverRoot, 0)
+}
+
+func (r *confReader) apache(path string, serverRoot *string, depth int) []string {
+	dat, ok := r.read(path, depth)
+	if !ok {
+		return nil
+	}
+	var pathList []string
+	// 环境变量如${APACHE_ROOT}无法确定
+	addPath := func(p string) {
+		if p = absPath(p, *serverRoot); !strings.Contains(p, "$") {
+			pathList = append(pathList, p)
+		}
+	}
+	for _, m := range apacheDirective.FindAllStringSubmatch(stripComment(dat), -1) {
+		args := splitArgs(m[2])
+		if len(args) == 0 {
+			continue
+		}
+		switch strings.ToLower(m[1]) {
+		case "serverroot":
+			*serverRoot = args[0]
+		case "include", "includeoptional":
+			for _, f := range r.files(args[0], *serverRoot) {
+				pathList = append(pathList, r.apache(f, serverRoot, depth+1)...)
+			}
+		case "documentroot":
+			addPath(args[0])
+		case "alias", "scriptalias":
+			if len(args) >= 2 {
+				addPath(args[1])
+			}
+		}
+	}
+	return pathList
+}
+
+// tomcatRoots 解析server.xml中Host的appBase、Context的docBase以及conf/Catalina下的Context配置
+func tomcatRoots(catalinaBase string) []string {
+	var pathList []string
+	dat, err := ioutil.ReadFile(filepath.Join(catalinaBase, "conf", "server.xml"))
+	if err != nil {
+		return pathList
+	}
+	content := stripXMLComment(string(dat))
+	appBase := filepath.Join(catalinaBase, "webapps")
+	for _, m := range tomcatAppBase.FindAllStringSubmatch(content, -1) {
+		appBase = absPath(m[1], catalinaBase)
+		pathList = append(pathList, appBase)
+	}
+	contextFiles, _ := filepath.Glob(filepath.Join(catalinaBase, "conf", "Catalina", "*", "*.xml"))
+	for _, f := range contextFiles {
+		if dat, err := ioutil.ReadFile(f); err == nil {
+			content += stripXMLComment(string(dat))
+		}
+	}
+	for _, m := range tomcatDocBase.FindAllStringSubmatch(content, -1) {
+		pathList = append(pathList, absPath(m[1], appBase))
+	}
+	return pathList
+}
+
+// caddyRoots 解析Caddyfile及import的文件中的root目录，兼容 root <path> 和 root <matcher> <path>
+func caddyRoots(confPath string) []string {
+	return newConfReader().caddy(confPath, 0)
+}
+
+func (r *confReader) caddy(path string, depth int) []string {
+	dat, ok := r.read(path, depth)
+	if !ok {
+		return nil
+	}
+	dat = stripComment(dat)
+	var pathList []string
+	for _, m := range caddyImport.FindAllStringSubmatch(dat, -1) {
+		for _, f := range r.files(m[1], filepath.Dir(path)) {
+			pathList = append(pathList, r.caddy(f, depth+1)...)
+		}
+	}
+	for _, m := range caddyRoot.FindAllStringSubmatch(dat, -1) {
+		// 引号中为空的参数（如 root ""）没有目录
+		args := splitArgs(m[1])
+		if len(args) == 0 {
+			continue
+		}
+		if p := args[len(args)-1]; filepath.IsAbs(p) {
+			pathList = append(pathList, p)
+		}
+	}
+	return pathList
+}
+
+// phpfpmRoots 解析php-fpm主配置及include的pool配置，返回chroot和chdir目录
+func phpfpmRoots(confPath string) []string {
+	return newConfReader().phpfpm(confPath, 0)
+}
+
+func (r *confReader) phpfpm(path string, depth int) []string {
+	dat, ok := r.read(path, depth)
+	if !ok {
+		return nil
+	}
+	var pathList []string
+	for _, m := range phpfpmDirective.FindAllStringSubmatch(stripIniComment(dat), -1) {
+		value := unquote(m[2])
+		if m[1] == "include" {
+			for _, f := range r.files(value, filepath.Dir(path)) {
+				pathList = append(pathList, r.phpfpm(f, depth+1)...)
+			}
+			continue
+		}
+		// 变量如$pool无法确定，根目录不作为web目录
+		if filepath.IsAbs(value) && value != "/" && !strings.Contains(value, "$") {
+			pathList = append(pathList, value)
+		}
+	}
+	return pathList
+}
+
+// tomcatBase 优先使用catalina.base，windows服务方式运行时取程序所在bin目录的上级目录
+func tomcatBase(webCommand string) string {
+	if base := cmdArg(webCommand, "-Dcatalina.base", "-Dcatalina.home"); base != "" {
+		return base
+	}
+	for _, f := range splitArgs(webCommand) {
+		if filepath.IsAbs(f) && strings.EqualFold(filepath.Base(filepath.Dir(f)), "bin") {
+			return filepath.Dir(filepath.Dir(f))
+		}
+	}
+	return ""
+}
+
+// cmdArg 获取命令行参数的值，支持 -c path、-c=path、--config path 等形式
+func cmdArg(command string, names ...string) string {
+	fields := splitArgs(command)
+	for i, f := range fields {
+		for _, name := range names {
+			if f == name && i+1 < len(fields) {
+				return unquote(fields[i+1])
+			}
+			if strings.HasPrefix(f, name+"=") {
+				return unquote(strings.TrimPrefix(f, name+"="))
+			}
+		}
+	}
+	return ""
+}
+
+func absPath(path string, base string) string {
+	path = unquote(path)
+	if filepath.IsAbs(path) || base == "" {
+		return path
+	}
+	return filepath.Join(base, path)
+}
+
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// splitArgs 按空格分割参数，引号内的空格保留
+func splitArgs(s string) []string {
+	var args []string
+	var quote byte
+	var cur []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && (c == ' ' || c == '\t'):
+			if len(cur) != 0 {
+				args = append(args, string(cur))
+				cur = nil
+			}
+		default:
+			cur = append(cur, c)
+		}
+	}
+	if len(cur) != 0 {
+		args = append(args, string(cur))
+	}
+	return args
+}
+
+// stripComment 去除#开头的注释
+func stripComment(dat string) string {
+	lines := strings.Split(dat, "\n")
+	for i, line := range lines {
+		if j := strings.Index(line, "#"); j >= 0 {
+			lines[i] = line[:j]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stripIniComment 去除;开头的注释行
+func stripIniComment(dat string) string {
+	lines := strings.Split(dat, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), ";") {
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var xmlComment = regexp.MustCompile(`(?s)<!--.*?-->`)
+
+func stripXMLComment(dat string) string {
+	return xmlComment.ReplaceAllString(dat, "")
+}
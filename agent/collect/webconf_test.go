@@ -0,0 +1,155 @@
+package collect
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeConf(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNginxRoots(t *testing.T) {
+	dir := t.TempDir()
+	writeConf(t, dir, map[string]string{
+		"nginx.conf": `
+http {
+    include conf.d/*.conf;
+    # root /commented;
+    server { root /var/www/html; location /static/ { alias "/srv/static"; } }
+    include nginx.conf;
+}`,
+		"conf.d/a.conf": `server { root /var/www/a; root $document_root; root relative; }`,
+	})
+	got := nginxRoots(filepath.Join(dir, "nginx.conf"))
+	want := []string{"/var/www/a", "/var/www/html", "/srv/static"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("nginxRoots = %v, want %v", got, want)
+	}
+}
+
+func TestApacheRoots(t *testing.T) {
+	dir := t.TempDir()
+	writeConf(t, dir, map[string]string{
+		"httpd.conf": `ServerRoot "` + dir + `"
+DocumentRoot "/var/www/html"
+IncludeOptional sites/*.conf
+Alias /icons/ "/usr/share/icons/"
+#DocumentRoot /commented
+DocumentRoot ${APACHE_ROOT}/www
+`,
+		"sites/a.conf": `<VirtualHost *:80>
+    DocumentRoot htdocs
+    ScriptAlias /cgi-bin/ /usr/lib/cgi-bin/
+</VirtualHost>`,
+	})
+	got := apacheRoots(filepath.Join(dir, "httpd.conf"), "/etc/httpd")
+	want := []string{"/var/www/html", filepath.Join(dir, "htdocs"), "/usr/lib/cgi-bin/", "/usr/share/icons/"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("apacheRoots = %v, want %v", got, want)
+	}
+}
+
+func TestTomcatRoots(t *testing.T) {
+	dir := t.TempDir()
+	writeConf(t, dir, map[string]string{
+		"conf/server.xml": `<Server><Service><Engine>
+<Host name="localhost" appBase="apps">
+  <Context path="/x" docBase="/opt/x"/>
+  <!-- <Context path="/y" docBase="/opt/y"/> -->
+</Host></Engine></Service></Server>`,
+		"conf/Catalina/localhost/z.xml": `<Context docBase="z"/>`,
+	})
+	got := tomcatRoots(dir)
+	want := []string{filepath.Join(dir, "apps"), "/opt/x", filepath.Join(dir, "apps", "z")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tomcatRoots = %v, want %v", got, want)
+	}
+}
+
+func TestCaddyRoots(t *testing.T) {
+	dir := t.TempDir()
+	writeConf(t, dir, map[string]string{
+		"Caddyfile": `import sites/*
+example.com {
+    root * /srv/www
+    # root /commented
+}`,
+		"sites/b": `b.com {
+    root /srv/b
+    root relative
+    root ""
+    root '' ""
+}`,
+	})
+	got := caddyRoots(filepath.Join(dir, "Caddyfile"))
+	want := []string{"/srv/b", "/srv/www"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("caddyRoots = %v, want %v", got, want)
+	}
+}
+
+func TestPhpfpmRoots(t *testing.T) {
+	dir := t.TempDir()
+	writeConf(t, dir, map[string]string{
+		"php-fpm.conf": `[global]
+include=pool.d/*.conf
+`,
+		"pool.d/www.conf": `[www]
+chdir = /var/www
+;chroot = /commented
+chroot = /
+chroot = /srv/$pool
+`,
+	})
+	got := phpfpmRoots(filepath.Join(dir, "php-fpm.conf"))
+	want := []string{"/var/www"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("phpfpmRoots = %v, want %v", got, want)
+	}
+}
+
+func TestCmdArg(t *testing.T) {
+	tests := []struct {
+		command string
+		names   []string
+		want    string
+	}{
+		{`nginx -c /etc/nginx/nginx.conf`, []string{"-c"}, "/etc/nginx/nginx.conf"},
+		{`httpd -f "/opt/apache conf/httpd.conf"`, []string{"-f"}, "/opt/apache conf/httpd.conf"},
+		{`java -Dcatalina.base=/opt/tomcat -cp x`, []string{"-Dcatalina.base", "-Dcatalina.home"}, "/opt/tomcat"},
+		{`nginx`, []string{"-c"}, ""},
+	}
+	for _, tt := range tests {
+		if got := cmdArg(tt.command, tt.names...); got != tt.want {
+			t.Errorf("cmdArg(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestTomcatBase(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{`java -Dcatalina.home=/opt/tomcat org.apache.catalina.startup.Bootstrap`, "/opt/tomcat"},
+		{`/opt/tomcat8/bin/tomcat8 //RS//Tomcat8`, "/opt/tomcat8"},
+		{`java -jar app.jar`, ""},
+	}
+	for _, tt := range tests {
+		if got := tomcatBase(tt.command); got != tt.want {
+			t.Errorf("tomcatBase(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
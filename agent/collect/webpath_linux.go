@@ -4,66 +4,117 @@ package collect
 
 import (
 	"errors"
-	"io/ioutil"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"yulong-hids/agent/common"
 )
 
-// 待支持其他webserver
+var (
+	tomcatReg     = regexp.MustCompile(`tomcat|catalina`)
+	apacheReg     = regexp.MustCompile(`httpd|apache`)
+	nginxReg      = regexp.MustCompile(`nginx|openresty`)
+	phpfpmConfReg = regexp.MustCompile(`\((/[^)]+)\)`)
+	nginxConfReg  = regexp.MustCompile(`\-\-conf\-path\=(.*?)(?:\s|$)`)
+	apacheRootReg = regexp.MustCompile(`HTTPD_ROOT="(.*?)"`)
+	apacheConfReg = regexp.MustCompile(`SERVER_CONFIG_FILE="(.*?)"`)
+)
+
+// getWebPath 根据web服务进程的命令行找到配置文件，解析出所有web目录
 func getWebPath(webCommand string) ([]string, error) {
+	var confPath string
 	var pathList []string
-	if ok, _ := regexp.MatchString(`httpd|apache`, webCommand); ok {
-		out := common.Cmdexec("apachectl -V")
-		if !strings.Contains(string(out), "SERVER_CONFIG_FILE") {
-			return pathList, errors.New("Get ConfigFilePath Error!")
+	switch {
+	// tomcat的命令行中包含org.apache.catalina，需要在apache之前判断
+	case tomcatReg.MatchString(webCommand):
+		confPath = tomcatBase(webCommand)
+		pathList = tomcatRoots(confPath)
+	case strings.Contains(webCommand, "php-fpm"):
+		confPath = phpfpmConfPath(webCommand)
+		pathList = phpfpmRoots(confPath)
+	case apacheReg.MatchString(webCommand):
+		var serverRoot string
+		confPath, serverRoot = apacheConfPath(webCommand)
+		pathList = apacheRoots(confPath, serverRoot)
+	case nginxReg.MatchString(webCommand):
+		confPath = nginxConfPath(webCommand)
+		pathList = nginxRoots(confPath)
+	case strings.Contains(webCommand, "caddy"):
+		confPath = cmdArg(webCommand, "--config", "-conf")
+		if confPath == "" {
+			confPath = "/etc/caddy/Caddyfile"
 		}
-		reg2 := regexp.MustCompile(`HTTPD_ROOT="(.*?)"`)
-		reg := regexp.MustCompile(`SERVER_CONFIG_FILE="(.*?)"`)
-		configFilePath := reg2.FindStringSubmatch(string(out))[1] + "/" + reg.FindStringSubmatch(string(out))[1]
-		if configFilePath != "/" {
-			dat, err := ioutil.ReadFile(configFilePath)
-			if err != nil {
-				return pathList, err
-			}
-			reg = regexp.MustCompile(`<Directory "(.*?)">`)
-			pathM := reg.FindAllSubmatch([]byte(dat), -1)
-			for _, info := range pathM {
-				pathList = append(pathList, string(info[1]))
-			}
+		pathList = caddyRoots(confPath)
+	}
+	if confPath == "" {
+		return pathList, errors.New("Get ConfigFilePath Error!")
+	}
+	return pathList, nil
+}
+
+// apacheConfPath 返回主配置文件和ServerRoot
+func apacheConfPath(webCommand string) (string, string) {
+	if confPath := cmdArg(webCommand, "-f"); filepath.IsAbs(confPath) {
+		return confPath, filepath.Dir(filepath.Dir(confPath))
+	}
+	for _, ctl := range []string{"apachectl", "apache2ctl", "httpd"} {
+		out := common.Cmdexec(ctl + " -V")
+		root := apacheRootReg.FindStringSubmatch(out)
+		conf := apacheConfReg.FindStringSubmatch(out)
+		if len(root) < 2 || len(conf) < 2 {
+			continue
 		}
-	} else if strings.Contains(webCommand, "nginx") {
-		out := common.Cmdexec("nginx -V")
-		regex, _ := regexp.Compile(`\-\-conf\-path\=(.*?)[ |$]`)
-		result := regex.FindStringSubmatch(out)
+		return absPath(conf[1], root[1]), root[1]
+	}
+	if confPath := firstExist("/etc/httpd/conf/httpd.conf", "/etc/apache2/apache2.conf"); confPath != "" {
+		return confPath, filepath.Dir(confPath)
+	}
+	return "", ""
+}
+
+// nginxConfPath 优先使用-c参数，其次使用nginx -V编译参数中的conf-path
+func nginxConfPath(webCommand string) string {
+	if confPath := cmdArg(webCommand, "-c"); filepath.IsAbs(confPath) {
+		return confPath
+	}
+	bins := []string{"nginx", "openresty"}
+	// 命令行为 nginx: master process /usr/local/openresty/nginx/sbin/nginx 时使用该程序
+	for _, f := range strings.Fields(webCommand) {
+		if filepath.IsAbs(f) && nginxReg.MatchString(filepath.Base(f)) {
+			bins = append([]string{f}, bins...)
+			break
+		}
+	}
+	for _, bin := range bins {
+		result := nginxConfReg.FindStringSubmatch(common.Cmdexec(bin + " -V"))
 		if len(result) >= 2 {
-			configFilePath := result[1]
-			dat, err := ioutil.ReadFile(configFilePath)
-			if err != nil {
-				return pathList, err
-			}
-			pathRegex, _ := regexp.Compile(`root (.*?)\;`)
-			pathResult := pathRegex.FindStringSubmatch(string(dat))
-			if len(pathResult) >= 2 {
-				pathList = append(pathList, pathResult[1])
-			}
-			sitePath := filepath.Dir(configFilePath) + "/sites-available/"
-			dirList, _ := ioutil.ReadDir(sitePath)
-			for _, v := range dirList {
-				if v.IsDir() {
-					continue
-				}
-				dat, err := ioutil.ReadFile(sitePath + v.Name())
-				if err != nil {
-					continue
-				}
-				pathResult = pathRegex.FindStringSubmatch(string(dat))
-				if len(pathResult) >= 2 {
-					pathList = append(pathList, pathResult[1])
-				}
-			}
+			return result[1]
 		}
 	}
-	return pathList, nil
+	return firstExist("/etc/nginx/nginx.conf", "/usr/local/nginx/conf/nginx.conf",
+		"/usr/local/openresty/nginx/conf/nginx.conf")
+}
+
+// phpfpmConfPath 主进程命令行为 php-fpm: master process (/etc/php/7.4/fpm/php-fpm.conf)
+func phpfpmConfPath(webCommand string) string {
+	if result := phpfpmConfReg.FindStringSubmatch(webCommand); len(result) >= 2 {
+		return result[1]
+	}
+	if confPath := cmdArg(webCommand, "-y", "--fpm-config"); filepath.IsAbs(confPath) {
+		return confPath
+	}
+	if confList, _ := filepath.Glob("/etc/php/*/fpm/php-fpm.conf"); len(confList) != 0 {
+		return confList[len(confList)-1]
+	}
+	return firstExist("/etc/php-fpm.conf", "/usr/local/etc/php-fpm.conf")
+}
+
+func firstExist(pathList ...string) string {
+	for _, path := range pathList {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
 }
@@ -5,6 +5,7 @@ package collect
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
@@ -39,7 +40,7 @@ func getWebPath(webCommand string) ([]string, error) {
 		reg := regexp.MustCompile(`Path="(.*?)"\s`)
 		pathM := reg.FindAllSubmatch([]byte(dat), -1)
 		for _, info := range pathM {
-			if common.InArray(pathList, string(info[1]), false) {
+			if !common.InArray(pathList, string(info[1]), false) {
 				pathList = append(pathList, string(info[1]))
 			}
 		}
@@ -58,5 +59,15 @@ func getWebPath(webCommand string) ([]string, error) {
 			}
 		}
 	}
+	// IIS以外的web服务
+	if ok, _ := regexp.MatchString(`tomcat|catalina`, webCommand); ok {
+		pathList = append(pathList, tomcatRoots(tomcatBase(webCommand))...)
+	} else if strings.Contains(webCommand, "nginx") {
+		confPath := cmdArg(webCommand, "-c")
+		if args := splitArgs(webCommand); confPath == "" && len(args) != 0 && filepath.IsAbs(args[0]) {
+			confPath = filepath.Join(filepath.Dir(args[0]), "conf", "nginx.conf")
+		}
+		pathList = append(pathList, nginxRoots(confPath)...)
+	}
 	return pathList, nil
 }
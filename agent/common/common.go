@@ -23,6 +23,16 @@ type ClientConfig struct {
 	} // 直接过滤不回传的规则
 	MonitorPath []string // 监控目录列表
 	Lasttime    string   // 最后一条登录日志时间
+	Fanotify    bool     // 是否使用fanotify监控文件写入(linux)，可获取写入进程
+	Webshell    struct {
+		Switch bool     // 是否开启
+		Rules  []string // 特征规则，格式为 名称:正则
+	} // web目录下文件的webshell静态检测
+	Resource struct {
+		CPU    int // CPU使用上限，单核的百分比，0为不限制
+		Memory int // 内存使用上限，单位MB，0为不限制
+		Rate   int // 每种事件每分钟的回传上限，0为不限制
+	} // agent资源限制
 }
 
 // ComputerInfo 计算机信息结构
@@ -32,6 +42,7 @@ type ComputerInfo struct {
 	Hostname string   // 计算机名
 	Type     string   // 服务器类型
 	Path     []string // WEB目录
+	Roles    []string // 服务器角色，可同时为多个，如web、db
 }
 
 var (
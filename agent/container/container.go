@@ -0,0 +1,74 @@
+// Package container 容器识别，根据进程的cgroup和挂载信息找到所属容器，
+// 并读取本机容器运行时（docker、containerd、cri-o）的元数据获取镜像和Kubernetes pod
+package container
+
+import (
+	"sync"
+	"time"
+)
+
+// 容器元数据的缓存时间
+const cacheTime = time.Minute * 5
+
+// Info 容器信息
+type Info struct {
+	ID      string // 容器ID
+	Name    string // 容器名
+	Image   string // 镜像
+	Pod     string // Kubernetes pod，格式为 namespace/name
+	Runtime string // 容器运行时：docker、containerd、cri-o
+}
+
+type cacheItem struct {
+	info Info
+	time time.Time
+}
+
+var (
+	cacheLock sync.Mutex
+	cache     = make(map[string]cacheItem)
+)
+
+// ByPid 获取进程所属的容器，不在容器中时返回false
+func ByPid(pid string) (Info, bool) {
+	id := pidContainerID(pid)
+	if id == "" {
+		return Info{}, false
+	}
+	return ByID(id), true
+}
+
+// ByID 获取容器信息，没有找到运行时元数据时只有ID
+func ByID(id string) Info {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	now := time.Now()
+	if item, ok := cache[id]; ok && now.Sub(item.time) < cacheTime {
+		return item.info
+	}
+	for k, item := range cache {
+		if now.Sub(item.time) >= cacheTime {
+			delete(cache, k)
+		}
+	}
+	info := metadata(id)
+	info.ID = id
+	cache[id] = cacheItem{info, now}
+	return info
+}
+
+// Attach 为带有pid的事件添加container_id、container_image、pod字段，
+// 进程已退出时（如短命令）使用父进程，不在容器中的进程不添加
+func Attach(data map[string]string) {
+	for _, key := range []string{"pid", "ppid"} {
+		if data[key] == "" {
+			continue
+		}
+		if info, ok := ByPid(data[key]); ok {
+			data["container_id"] = info.ID
+			data["container_image"] = info.Image
+			data["pod"] = info.Pod
+			return
+		}
+	}
+}
@@ -0,0 +1,184 @@
+//go:build linux
+// +build linux
+
+package container
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// cgroup路径中的容器ID，如 /docker/<id>、/system.slice/docker-<id>.scope、
+	// /kubepods/burstable/pod<uid>/<id>、cri-containerd-<id>.scope、crio-<id>.scope
+	cgroupReg = regexp.MustCompile(`(?:^|[/-])([0-9a-f]{64})(?:\.scope)?$`)
+	// docker挂载到容器中的 /etc/hostname、/etc/hosts、/etc/resolv.conf 来自容器目录
+	mountReg = regexp.MustCompile(`/containers/([0-9a-f]{64})/`)
+)
+
+const dockerRoot = "/var/lib/docker/containers"
+
+// ociConfigList 容器运行时保存的OCI配置文件，%s为容器ID
+var ociConfigList = []struct {
+	runtime string
+	pattern string
+}{
+	{"containerd", "/run/containerd/io.containerd.runtime.v2.task/*/%s/config.json"},
+	{"containerd", "/run/containerd/io.containerd.runtime.v1.linux/*/%s/config.json"},
+	{"cri-o", "/run/containers/storage/overlay-containers/%s/userdata/config.json"},
+	{"cri-o", "/var/lib/containers/storage/overlay-containers/%s/userdata/config.json"},
+}
+
+// pidContainerID 从 /proc/<pid>/cgroup 获取容器ID，cgroup中没有时（如agent运行在独立cgroup namespace中）
+// 从 /proc/<pid>/mountinfo 中查找
+func pidContainerID(pid string) string {
+	if f, err := os.Open(filepath.Join("/proc", pid, "cgroup")); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			// hierarchy-ID:controller-list:cgroup-path
+			fields := strings.SplitN(scanner.Text(), ":", 3)
+			if len(fields) != 3 {
+				continue
+			}
+			if m := cgroupReg.FindStringSubmatch(fields[2]); m != nil {
+				return m[1]
+			}
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join("/proc", pid, "mountinfo"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// 第4列为挂载源在其文件系统中的路径
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		if m := mountReg.FindStringSubmatch(fields[3]); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// metadata 读取容器运行时的元数据文件，docker优先（docker的容器在containerd中没有镜像信息）
+func metadata(id string) Info {
+	if info, ok := dockerMetadata(id); ok {
+		return info
+	}
+	for _, c := range ociConfigList {
+		matches, _ := filepath.Glob(strings.Replace(c.pattern, "%s", id, 1))
+		if len(matches) == 0 {
+			continue
+		}
+		if info, ok := ociMetadata(matches[0]); ok {
+			info.Runtime = c.runtime
+			return info
+		}
+	}
+	return Info{}
+}
+
+// dockerMetadata 读取 /var/lib/docker/containers/<id>/config.v2.json
+func dockerMetadata(id string) (Info, bool) {
+	data, err := ioutil.ReadFile(filepath.Join(dockerRoot, id, "config.v2.json"))
+	if err != nil {
+		return Info{}, false
+	}
+	var config struct {
+		Name   string
+		Config struct {
+			Image  string
+			Labels map[string]string
+		}
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Info{}, false
+	}
+	info := Info{
+		Name:    strings.TrimPrefix(config.Name, "/"),
+		Image:   config.Config.Image,
+		Runtime: "docker",
+	}
+	// dockershim创建的Kubernetes容器
+	info.Pod = podName(config.Config.Labels["io.kubernetes.pod.namespace"], config.Config.Labels["io.kubernetes.pod.name"])
+	return info, true
+}
+
+// ociSpec OCI运行时配置中用到的部分
+type ociSpec struct {
+	Annotations map[string]string `json:"annotations"`
+	Process     struct {
+		Args         []string `json:"args"`
+		Capabilities struct {
+			Effective []string `json:"effective"`
+		} `json:"capabilities"`
+	} `json:"process"`
+	Mounts []struct {
+		Destination string   `json:"destination"`
+		Type        string   `json:"type"`
+		Source      string   `json:"source"`
+		Options     []string `json:"options"`
+	} `json:"mounts"`
+	Linux struct {
+		Namespaces []struct {
+			Type string `json:"type"`
+		} `json:"namespaces"`
+		MaskedPaths []string `json:"maskedPaths"`
+	} `json:"linux"`
+}
+
+func readSpec(path string) (*ociSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var spec ociSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// ociMetadata 从OCI配置的annotations中获取镜像和pod，containerd(CRI)和cri-o使用的key不同
+func ociMetadata(path string) (Info, bool) {
+	spec, err := readSpec(path)
+	if err != nil {
+		return Info{}, false
+	}
+	return specInfo(spec), true
+}
+
+func specInfo(spec *ociSpec) Info {
+	a := spec.Annotations
+	info := Info{
+		Name:  first(a["io.kubernetes.cri.container-name"], a["io.kubernetes.container.name"]),
+		Image: first(a["io.kubernetes.cri.image-name"], a["io.kubernetes.cri-o.ImageName"], a["io.kubernetes.cri-o.Image"]),
+		Pod: podName(first(a["io.kubernetes.cri.sandbox-namespace"], a["io.kubernetes.pod.namespace"]),
+			first(a["io.kubernetes.cri.sandbox-name"], a["io.kubernetes.pod.name"])),
+	}
+	return info
+}
+
+func podName(namespace string, name string) string {
+	if name == "" {
+		return ""
+	}
+	return namespace + "/" + name
+}
+
+func first(list ...string) string {
+	for _, v := range list {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
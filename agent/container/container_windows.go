@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package container
+
+// pidContainerID windows下暂不支持容器识别
+func pidContainerID(pid string) string {
+	return ""
+}
+
+func metadata(id string) Info {
+	return Info{}
+}
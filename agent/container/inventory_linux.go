@@ -0,0 +1,244 @@
+//go:build linux
+// +build linux
+
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const dockerSock = "/var/run/docker.sock"
+
+// defaultCaps 容器默认拥有的capabilities，只上报在此之外添加的
+var defaultCaps = []string{"CHOWN", "DAC_OVERRIDE", "FSETID", "FOWNER", "MKNOD", "NET_RAW", "SETGID", "SETUID",
+	"SETFCAP", "SETPCAP", "NET_BIND_SERVICE", "SYS_CHROOT", "KILL", "AUDIT_WRITE"}
+
+// runtimeMountPrefix 运行时和kubelet自己管理的挂载（hosts、resolv.conf、secret、emptyDir等），不属于宿主机目录挂载
+var runtimeMountPrefix = []string{"/var/lib/docker/", "/var/lib/containerd/", "/run/containerd/",
+	"/var/lib/kubelet/pods/", "/var/lib/containers/", "/run/containers/", "/var/run/containers/"}
+
+var dockerClient = &http.Client{
+	Timeout: time.Second * 5,
+	Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", dockerSock)
+		},
+	},
+}
+
+// List 列出正在运行的容器，docker通过本地unix socket调用Docker Engine API，
+// containerd和cri-o读取运行时保存的OCI配置（不包括Kubernetes的pause容器）
+func List() (resultData []map[string]string) {
+	listed := make(map[string]bool)
+	dockerList, dockerErr := dockerContainers()
+	if dockerErr == nil {
+		for _, m := range dockerList {
+			listed[m["id"]] = true
+			resultData = append(resultData, m)
+		}
+	}
+	for _, c := range ociConfigList {
+		pathList, _ := filepath.Glob(strings.Replace(c.pattern, "%s", "*", 1))
+		for _, path := range pathList {
+			id := filepath.Base(filepath.Dir(path))
+			if c.runtime == "cri-o" {
+				id = filepath.Base(filepath.Dir(filepath.Dir(path)))
+			}
+			// docker的容器在containerd的moby命名空间中，docker API可用时已经获取
+			if listed[id] || (dockerErr == nil && strings.Contains(path, "/moby/")) {
+				continue
+			}
+			spec, err := readSpec(path)
+			if err != nil || isSandbox(spec) {
+				continue
+			}
+			listed[id] = true
+			resultData = append(resultData, specContainer(id, c.runtime, spec))
+		}
+	}
+	sort.Slice(resultData, func(i, j int) bool {
+		return resultData[i]["id"] < resultData[j]["id"]
+	})
+	return
+}
+
+func dockerGet(path string, v interface{}) error {
+	resp, err := dockerClient.Get("http://docker" + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("docker api " + path + ": " + resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// dockerContainers 通过 /containers/json 和 /containers/<id>/json 获取容器详细配置
+func dockerContainers() ([]map[string]string, error) {
+	var idList []struct {
+		ID string `json:"Id"`
+	}
+	if err := dockerGet("/containers/json", &idList); err != nil {
+		return nil, err
+	}
+	var resultData []map[string]string
+	for _, c := range idList {
+		var inspect struct {
+			ID     string `json:"Id"`
+			Name   string
+			Path   string
+			Args   []string
+			Config struct {
+				Image  string
+				Labels map[string]string
+			}
+			HostConfig struct {
+				Privileged  bool
+				NetworkMode string
+				PidMode     string
+				IpcMode     string
+				CapAdd      []string
+			}
+			Mounts []struct {
+				Type        string
+				Source      string
+				Destination string
+				RW          bool
+			}
+		}
+		if err := dockerGet("/containers/"+c.ID+"/json", &inspect); err != nil {
+			continue
+		}
+		var mounts []string
+		for _, m := range inspect.Mounts {
+			if m.Type == "bind" {
+				mounts = append(mounts, mountString(m.Source, m.Destination, !m.RW))
+			}
+		}
+		var caps []string
+		for _, v := range inspect.HostConfig.CapAdd {
+			caps = append(caps, capName(v))
+		}
+		labels := inspect.Config.Labels
+		resultData = append(resultData, map[string]string{
+			"id":           inspect.ID,
+			"name":         strings.TrimPrefix(inspect.Name, "/"),
+			"image":        inspect.Config.Image,
+			"command":      strings.TrimSpace(inspect.Path + " " + strings.Join(inspect.Args, " ")),
+			"runtime":      "docker",
+			"pod":          podName(labels["io.kubernetes.pod.namespace"], labels["io.kubernetes.pod.name"]),
+			"privileged":   boolString(inspect.HostConfig.Privileged),
+			"hostnetwork":  boolString(inspect.HostConfig.NetworkMode == "host"),
+			"hostpid":      boolString(inspect.HostConfig.PidMode == "host"),
+			"hostipc":      boolString(inspect.HostConfig.IpcMode == "host"),
+			"capabilities": strings.Join(caps, "|"),
+			"mounts":       strings.Join(mounts, "|"),
+		})
+	}
+	return resultData, nil
+}
+
+// isSandbox Kubernetes pod的pause容器
+func isSandbox(spec *ociSpec) bool {
+	return spec.Annotations["io.kubernetes.cri.container-type"] == "sandbox" ||
+		spec.Annotations["io.kubernetes.cri-o.ContainerType"] == "sandbox"
+}
+
+// specContainer 从OCI配置获取容器信息，没有对应namespace时表示使用宿主机的namespace，
+// 没有屏蔽/proc下敏感路径且拥有SYS_ADMIN时认为是特权容器
+func specContainer(id string, runtime string, spec *ociSpec) map[string]string {
+	info := specInfo(spec)
+	if info.Name == "" {
+		info.Name = id
+		if len(id) > 12 {
+			info.Name = id[:12]
+		}
+	}
+	namespaces := make(map[string]bool)
+	for _, ns := range spec.Linux.Namespaces {
+		namespaces[ns.Type] = true
+	}
+	var caps []string
+	sysAdmin := false
+	for _, c := range spec.Process.Capabilities.Effective {
+		name := capName(c)
+		if name == "SYS_ADMIN" {
+			sysAdmin = true
+		}
+		if !inList(defaultCaps, name) {
+			caps = append(caps, name)
+		}
+	}
+	var mounts []string
+	for _, m := range spec.Mounts {
+		if m.Type != "bind" && !inList(m.Options, "bind") && !inList(m.Options, "rbind") {
+			continue
+		}
+		if hasPrefix(m.Source, runtimeMountPrefix) {
+			continue
+		}
+		mounts = append(mounts, mountString(m.Source, m.Destination, inList(m.Options, "ro")))
+	}
+	return map[string]string{
+		"id":           id,
+		"name":         info.Name,
+		"image":        info.Image,
+		"command":      strings.Join(spec.Process.Args, " "),
+		"runtime":      runtime,
+		"pod":          info.Pod,
+		"privileged":   boolString(sysAdmin && len(spec.Linux.MaskedPaths) == 0),
+		"hostnetwork":  boolString(!namespaces["network"]),
+		"hostpid":      boolString(!namespaces["pid"]),
+		"hostipc":      boolString(!namespaces["ipc"]),
+		"capabilities": strings.Join(caps, "|"),
+		"mounts":       strings.Join(mounts, "|"),
+	}
+}
+
+// mountString 宿主机路径:容器内路径，只读挂载加上:ro
+func mountString(source string, destination string, readonly bool) string {
+	s := source + ":" + destination
+	if readonly {
+		s += ":ro"
+	}
+	return s
+}
+
+func capName(c string) string {
+	return strings.TrimPrefix(strings.ToUpper(c), "CAP_")
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+func inList(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefix(path string, prefixList []string) bool {
+	for _, prefix := range prefixList {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
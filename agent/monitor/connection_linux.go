@@ -1,294 +1,359 @@
+//go:build linux
 // +build linux
-package monitor
-
-/*
-#include <arpa/inet.h>
-#include <stdio.h>
-#include <stdlib.h>
-#include <string.h>
-#include <ctype.h>
-#include <fcntl.h>
-#include <pwd.h>
-#include <errno.h>
-#include <dirent.h>
-#include <sys/socket.h>
-#include <sys/types.h>
-#include <sys/stat.h>
-
-typedef union iaddr iaddr;
-
-union iaddr {
-    unsigned u;
-    unsigned char b[4];
-};
 
-#define PRG_LOCAL_ADDRESS "local_address"
-#define PRG_INODE	 "inode"
-#define PRG_SOCKET_PFX    "socket:["
-#define PRG_SOCKET_PFXl (strlen(PRG_SOCKET_PFX))
-#define PRG_SOCKET_PFX2   "[0000]:"
-#define PRG_SOCKET_PFX2l  (strlen(PRG_SOCKET_PFX2))
-
-#ifndef LINE_MAX
-#define LINE_MAX 4096
-#endif
-
-#define PATH_PROC	   "/proc"
-#define PATH_FD_SUFF	"fd"
-#define PATH_FD_SUFFl       strlen(PATH_FD_SUFF)
-#define PATH_PROC_X_FD      PATH_PROC "/%s/" PATH_FD_SUFF
-#define PATH_CMDLINE	"cmdline"
-#define PATH_CMDLINEl       strlen(PATH_CMDLINE)
+package monitor
 
-#undef  DIRENT_HAVE_D_TYPE_WORKS
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"yulong-hids/agent/common"
+	"yulong-hids/netaddr"
 
+	"golang.org/x/sys/unix"
+)
 
-#define ADDR_LEN INET6_ADDRSTRLEN + 1 + 5 + 1
+const (
+	// sock_diag轮询间隔
+	connPollWait = time.Second
+	// 超过这个时间没再出现的连接从记录中移除
+	connForget = time.Second * 10
+	// UDP报文只截取IP头和UDP头
+	udpSnapLen = 128
+)
 
-static void addr2str(int af, const void *addr, unsigned port, char *buf)
-{
-    if (inet_ntop(af, addr, buf, ADDR_LEN) == NULL) {
-        *buf = '\0';
-        return;
-    }
+// udpFilter 只接收UDP报文（不含IP分片和IPv6扩展头），SOCK_DGRAM类型的AF_PACKET socket收到的报文从IP头开始
+var udpFilter = []unix.SockFilter{
+	{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: 0},
+	{Code: unix.BPF_ALU | unix.BPF_AND | unix.BPF_K, K: 0xf0},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 4, K: 0x40},
+	// IPv4
+	{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: 9},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 6, K: unix.IPPROTO_UDP},
+	{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_ABS, K: 6},
+	{Code: unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K, Jt: 4, Jf: 3, K: 0x1fff},
+	// IPv6
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 3, K: 0x60},
+	{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: 6},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 1, K: unix.IPPROTO_UDP},
+	{Code: unix.BPF_RET | unix.BPF_K, K: udpSnapLen},
+	{Code: unix.BPF_RET | unix.BPF_K, K: 0},
 }
-#define PROGNAME_WIDTH 20
-
-#define PRG_HASH_SIZE 211
-#define PRG_HASHIT(x) ((x) % PRG_HASH_SIZE)
 
-static char finbuf[PROGNAME_WIDTH];
-
-static void extract_type_1_socket_inode(const char lname[], long * inode_p) {
+// ownerCache socket inode与进程的对应关系缓存
+type ownerCache struct {
+	inodes  map[uint32]sockOwner
+	scanned time.Time
+}
 
-    if (lname[strlen(lname) - 1] != ']') *inode_p = -1;
-	else {
-		char inode_str[strlen(lname + 1)];
-		const int inode_str_len = strlen(lname) - PRG_SOCKET_PFXl - 1;
-		char *serr;
+// connTracker 通过sock_diag轮询和socket销毁事件跟踪新建的TCP连接，
+// 通过AF_PACKET获取UDP报文跟踪UDP通信，支持所有网卡和IPv6
+type connTracker struct {
+	sync.Mutex
+	known  map[string]time.Time // 已出现的连接及最后出现时间
+	listen map[int]bool         // 监听中的TCP端口，用于判断连接方向
+	owners ownerCache
+}
 
-		strncpy(inode_str, lname + PRG_SOCKET_PFXl, inode_str_len);
-		inode_str[inode_str_len] = '\0';
-		*inode_p = strtol(inode_str, &serr, 0);
-		if (!serr || *serr || *inode_p < 0 || *inode_p >= 2147483647)
-			*inode_p = -1;
+// StartNetSniff 开始网络行为监控
+func StartNetSniff(resultChan chan map[string]string) {
+	log.Println("StartConnMonitor")
+	t := &connTracker{
+		known:  make(map[string]time.Time),
+		listen: make(map[int]bool),
+	}
+	// agent启动前已存在的连接不上报
+	t.poll(nil)
+	// 销毁事件不可用时只能靠轮询发现连接，持续时间短于轮询间隔的连接会漏掉
+	if fd, err := diagDestroyEvents(); err != nil {
+		log.Println("Sock diag destroy events unavailable:", err)
+		setFailed("connection", "destroy events unavailable")
+	} else {
+		runPart("connection", "destroy events", func() error { return t.destroyThread(fd, resultChan) })
+	}
+	runPart("connection", "udp capture", func() error { return t.udpThread(resultChan) })
+	ticker := time.NewTicker(connPollWait)
+	defer ticker.Stop()
+	for range ticker.C {
+		t.poll(resultChan)
 	}
 }
 
-
-static char * pget(unsigned uid,long inode) {
-    DIR *d = opendir("/proc");
-    if(NULL == d) return "";
-	long inode_p;
-    char statline[1024];
-    char cmdline[1024];
-    struct dirent *de;
-    struct stat stats;
-    struct passwd *pw;
-	int fd, i = 0; int procfdlen, fd_last, cmdllen, lnamelen;
-	char line[LINE_MAX], eacces = 0;
-	char lname[30], cmdlbuf[512];
-	DIR *dirproc = NULL, *dirfd = NULL;
-	struct dirent *direproc, *direfd;
-	cmdlbuf[sizeof(cmdlbuf)-1] = '\0';
-	const char *cs, *cmdlp;
-	if (!(dirproc = opendir(PATH_PROC)))
-	{
-		printf("error");
-		return "";
+func (t *connTracker) poll(resultChan chan map[string]string) {
+	var sockets []diagSocket
+	tcpStates := uint32(1<<tcpEstablished | 1<<tcpSynSent | 1<<tcpSynRecv | 1<<tcpListen)
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		list, err := diagDump(family, unix.IPPROTO_TCP, tcpStates, nil)
+		if err != nil {
+			log.Println("Sock diag error:", err)
+		}
+		sockets = append(sockets, list...)
+	}
+	var resultList []map[string]string
+	now := time.Now()
+	t.Lock()
+	listen := make(map[int]bool)
+	for _, s := range sockets {
+		if s.protocol == "tcp" && s.state == tcpListen {
+			listen[s.localPort] = true
+		}
 	}
-	while (direproc = readdir(dirproc)) {
-		for (cs = direproc->d_name; *cs; cs++)
-		if (!isdigit(*cs))
-			break;
-		if (*cs)
-			continue;
+	t.listen = listen
+	for _, s := range sockets {
+		if s.protocol == "tcp" && s.state == tcpListen {
+			continue
+		}
+		key := s.key()
+		_, ok := t.known[key]
+		t.known[key] = now
+		if ok || resultChan == nil {
+			continue
+		}
+		if resultdata, ok := t.event(s, t.dir(s)); ok {
+			resultList = append(resultList, resultdata)
+		}
+	}
+	for key, last := range t.known {
+		if now.Sub(last) > connForget {
+			delete(t.known, key)
+		}
+	}
+	t.Unlock()
+	for _, resultdata := range resultList {
+		resultChan <- resultdata
+	}
+}
 
-		procfdlen = snprintf(line, sizeof(line), PATH_PROC_X_FD, direproc->d_name);
-		if (procfdlen <= 0 || procfdlen >= sizeof(line)-5)
-			continue;
-		errno = 0;
-		dirfd = opendir(line);
-		if (!dirfd) {
-			if (errno ==1 )
-				eacces = 1;
-			continue;
+// destroyThread 上报轮询时没有出现过的已关闭TCP连接
+func (t *connTracker) destroyThread(fd int, resultChan chan map[string]string) error {
+	defer unix.Close(fd)
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if err == unix.EINTR || err == unix.ENOBUFS {
+				continue
+			}
+			return err
 		}
-		line[procfdlen] = '/';
-		cmdlp = NULL;
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+		var resultList []map[string]string
+		t.Lock()
+		for _, m := range msgs {
+			if m.Header.Type != sockDiagByFamily {
+				continue
+			}
+			s, ok := parseDiagMsg(m.Data, unix.IPPROTO_TCP)
+			if !ok || s.remote.IsUnspecified() {
+				continue
+			}
+			key := s.key()
+			if _, ok := t.known[key]; ok {
+				continue
+			}
+			t.known[key] = time.Now()
+			if resultdata, ok := t.event(s, t.dir(s)); ok {
+				resultList = append(resultList, resultdata)
+			}
+		}
+		t.Unlock()
+		for _, resultdata := range resultList {
+			resultChan <- resultdata
+		}
+	}
+}
 
-		while ((direfd = readdir(dirfd))) {
-			if (procfdlen + 1 + strlen(direfd->d_name) + 1>sizeof(line))
-				continue;
-			memcpy(line + procfdlen - PATH_FD_SUFFl, PATH_FD_SUFF "/",
-				PATH_FD_SUFFl + 1);
-			strcpy(line + procfdlen + 1, direfd->d_name);
-			lnamelen = readlink(line, lname, sizeof(lname)-1);
-			lname[lnamelen] = '\0';
-			extract_type_1_socket_inode(lname, &inode_p);
-			if (inode_p == inode)
-			{
-				if (!cmdlp) {
-					if (procfdlen - PATH_FD_SUFFl + PATH_CMDLINEl >=
-						sizeof(line)-5)
-						continue;
-					strcpy(line + procfdlen - PATH_FD_SUFFl, PATH_CMDLINE);
-					fd = open(line, O_RDONLY);
-					if (fd < 0)
-						continue;
-					cmdllen = read(fd, cmdlbuf, sizeof(cmdlbuf)-1);
-					if (close(fd))
-						continue;
-					if (cmdllen == -1)
-						continue;
-					if (cmdllen < sizeof(cmdlbuf)-1)
-						cmdlbuf[cmdllen] = '\0';
-					if ((cmdlp = strrchr(cmdlbuf, '/')))
-						cmdlp++;
-					else
-						cmdlp = cmdlbuf;
-				}
+// udpThread 开启记录UDP时获取所有网卡上收发的UDP报文。未connect的UDP socket（sendto发送）
+// 在sock_diag中没有对端地址，只能从报文中获取
+func (t *connTracker) udpThread(resultChan chan map[string]string) error {
+	for {
+		if !common.Config.UDP {
+			time.Sleep(connPollWait)
+			continue
+		}
+		if err := t.captureUDP(resultChan); err != nil {
+			return err
+		}
+	}
+}
 
-				snprintf(finbuf, sizeof(finbuf), "%s/%s", direproc->d_name, cmdlp);
-				return finbuf;
+// captureUDP 读取UDP报文，关闭记录UDP后返回
+func (t *connTracker) captureUDP(resultChan chan map[string]string) error {
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, int(htons(unix.ETH_P_ALL)))
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	prog := unix.SockFprog{Len: uint16(len(udpFilter)), Filter: &udpFilter[0]}
+	if err := unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &prog); err != nil {
+		return err
+	}
+	// 定时超时返回，用于检查配置是否关闭了记录UDP
+	tv := unix.NsecToTimeval(int64(connPollWait))
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		return err
+	}
+	buf := make([]byte, udpSnapLen)
+	for common.Config.UDP {
+		n, from, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if err == unix.EINTR || err == unix.EAGAIN || err == unix.ENOBUFS {
+				continue
 			}
+			return err
+		}
+		ll, ok := from.(*unix.SockaddrLinklayer)
+		if !ok {
+			continue
+		}
+		src, dst, srcPort, dstPort, _, ok := parseUDP(buf[:n])
+		if !ok {
+			continue
+		}
+		s := diagSocket{protocol: "udp"}
+		dir := "in"
+		if ll.Pkttype == unix.PACKET_OUTGOING {
+			dir = "out"
+			s.local, s.localPort, s.remote, s.remotePort = src, srcPort, dst, dstPort
+		} else {
+			s.local, s.localPort, s.remote, s.remotePort = dst, dstPort, src, srcPort
+		}
+		// buf会被复用
+		s.local = append(net.IP(nil), s.local...)
+		s.remote = append(net.IP(nil), s.remote...)
+		if resultdata, ok := t.udpEvent(s, dir); ok {
+			resultChan <- resultdata
 		}
 	}
-    return "";
+	return nil
 }
-char *s;
-static char * filter(char *host, int port) {
-	char *filename = "/proc/net/tcp";
-	char *label = "tcp";
-    memset(finbuf,0,PROGNAME_WIDTH);
-    FILE *fp = fopen(filename, "r");
-    if (fp == NULL) return;
-	long inode;
-    char buf[BUFSIZ];
-    fgets(buf, BUFSIZ, fp);
-    while (fgets(buf, BUFSIZ, fp)){
-        char lip[ADDR_LEN];
-        char rip[ADDR_LEN];
-		char more[512];
-        iaddr laddr, raddr;
-        unsigned lport, rport, state, txq, rxq, num, tr, tm_when, retrnsmt, uid;
-		int timeout;
-        int n = sscanf(buf, " %d: %x:%x %x:%x %x %x:%x %x:%x %x %d %d %ld %512s",
-                       &num, &laddr.u, &lport, &raddr.u, &rport,
-					   &state, &txq, &rxq, &tr, &tm_when, &retrnsmt, &uid, &timeout, &inode, more);
-        if (n == 15) {
-            addr2str(AF_INET, &laddr, lport, lip);
-            addr2str(AF_INET, &raddr, rport, rip);
-			if ( (int)rport == port)
-			{
-				pget(uid, inode);
-				fclose(fp);
-				return finbuf;
-			}
-        }
-    }
-    fclose(fp);
-	return "";
+
+// udpEvent 同一本地和远程地址的UDP通信在connForget内只上报一次
+func (t *connTracker) udpEvent(s diagSocket, dir string) (map[string]string, bool) {
+	key := s.key()
+	t.Lock()
+	_, ok := t.known[key]
+	t.known[key] = time.Now()
+	t.Unlock()
+	if ok {
+		return nil, false
+	}
+	s.inode = udpInode(s.local, s.localPort)
+	t.Lock()
+	defer t.Unlock()
+	return t.event(s, dir)
 }
-*/
-import "C"
-import (
-	"fmt"
-	"strings"
-	"yulong-hids/agent/common"
 
-	"github.com/akrennmair/gopcap"
-)
+// dir TCP连接的本地端口在监听中为入方向
+func (t *connTracker) dir(s diagSocket) string {
+	if s.protocol == "tcp" && t.listen[s.localPort] {
+		return "in"
+	}
+	return "out"
+}
 
-// StartNetSniff 开始网络行为监控
-func StartNetSniff(resultChan chan map[string]string) {
-	var pkt *pcap.Packet
-	var resultdata map[string]string
-	h, err := getPcapHandle(common.LocalIP)
+// event 组装连接事件，返回false表示被过滤
+func (t *connTracker) event(s diagSocket, dir string) (map[string]string, bool) {
+	// 不记录本机回环和跟安全中心的连接
+	if s.remote.IsLoopback() || s.remote.IsUnspecified() {
+		return nil, false
+	}
+	ip := s.remote.String()
+	if netaddr.InList(common.ServerIPList, ip) {
+		return nil, false
+	}
+	if common.ServerInfo.Type == "web" && dir == "in" {
+		return nil, false
+	}
+	//如果内网记录为关闭则进行IP判断
+	if !common.Config.LAN && netaddr.IsLan(ip) {
+		return nil, false
+	}
+	//白名单
+	if netaddr.InList(common.Config.Filter.IP, ip) {
+		return nil, false
+	}
+	if isFilterPort(s.remotePort) || isFilterPort(s.localPort) {
+		return nil, false
+	}
+	localIP := s.local.String()
+	if s.local.IsUnspecified() {
+		localIP = common.LocalIP
+	}
+	owner := t.owners.owner(s.inode)
+	return map[string]string{
+		"source":   "connection",
+		"dir":      dir,
+		"protocol": s.protocol,
+		"remote":   netaddr.JoinHostPort(ip, s.remotePort),
+		"local":    netaddr.JoinHostPort(localIP, s.localPort),
+		"pid":      owner.pid,
+		"name":     owner.name,
+	}, true
+}
+
+// owner 根据socket inode查找所属进程，缓存中没有时重新扫描/proc，每个轮询周期最多扫描一次
+func (c *ownerCache) owner(inode uint32) sockOwner {
+	if inode == 0 {
+		return sockOwner{}
+	}
+	if o, ok := c.inodes[inode]; ok {
+		return o
+	}
+	if time.Since(c.scanned) < connPollWait/2 {
+		return sockOwner{}
+	}
+	c.scanned = time.Now()
+	c.inodes = scanSocketInodes()
+	return c.inodes[inode]
+}
+
+// scanSocketInodes 遍历/proc/*/fd建立socket inode到进程的索引
+func scanSocketInodes() map[uint32]sockOwner {
+	inodes := make(map[uint32]sockOwner)
+	procList, err := ioutil.ReadDir("/proc")
 	if err != nil {
-		return
+		return inodes
 	}
-	for {
-		pkt = h.Next()
-		if pkt == nil {
+	for _, p := range procList {
+		pid := p.Name()
+		if _, err := strconv.Atoi(pid); err != nil {
 			continue
 		}
-		pkt.Decode()
-		var port int
-		var ip string
-		var localPort int
-		resultdata = map[string]string{
-			"source":   "",
-			"dir":      "",
-			"protocol": "",
-			"remote":   "",
-			"local":    "",
-			"pid":      "",
-			"name":     "",
+		fdDir := filepath.Join("/proc", pid, "fd")
+		fdList, err := ioutil.ReadDir(fdDir)
+		if err != nil {
+			continue
 		}
-		//不记录跟安全中心的连接记录
-		if pkt.IP != nil && (common.LocalIP == pkt.IP.SrcAddr() || common.LocalIP == pkt.IP.DestAddr()) &&
-			!common.InArray(common.ServerIPList, pkt.IP.SrcAddr(), false) &&
-			!common.InArray(common.ServerIPList, pkt.IP.DestAddr(), false) {
-			resultdata["source"] = "connection"
-			if common.LocalIP == pkt.IP.SrcAddr() {
-				ip = pkt.IP.DestAddr()
-				resultdata["dir"] = "out"
-			} else {
-				ip = pkt.IP.SrcAddr()
-				resultdata["dir"] = "in"
-			}
-			if common.ServerInfo.Type == "web" && resultdata["dir"] == "in" {
+		var owner *sockOwner
+		for _, fd := range fdList {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
 				continue
 			}
-			//如果内网记录为关闭则进行IP判断
-			if !common.Config.LAN && isLan(ip) {
+			inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]"), 10, 32)
+			if err != nil {
 				continue
 			}
-			//白名单
-			if common.InArray(common.Config.Filter.IP, ip, false) {
-				continue
-			}
-			if pkt.IP.Protocol == UDP {
-				if common.Config.UDP == false {
-					continue
-				}
-				resultdata["protocol"] = "udp"
-				if resultdata["dir"] == "out" {
-					port = int(pkt.UDP.DestPort)
-					localPort = int(pkt.UDP.SrcPort)
-				} else {
-					port = int(pkt.UDP.SrcPort)
-					localPort = int(pkt.UDP.DestPort)
+			if owner == nil {
+				owner = &sockOwner{pid: pid}
+				if comm, err := ioutil.ReadFile(fmt.Sprintf("/proc/%s/comm", pid)); err == nil {
+					owner.name = strings.TrimSpace(string(comm))
 				}
-				if isFilterPort(port) || isFilterPort(localPort) {
-					continue
-				}
-				resultdata["remote"] = fmt.Sprintf("%s:%d", ip, port) //UDP
-				resultdata["local"] = fmt.Sprintf("%s:%d", common.LocalIP, localPort)
-			} else if pkt.IP.Protocol == TCP && strings.Contains(pkt.String(), "[syn]") {
-				resultdata["protocol"] = "tcp"
-				if resultdata["dir"] == "out" {
-					port = int(pkt.TCP.DestPort)
-					localPort = int(pkt.TCP.SrcPort)
-				} else {
-					port = int(pkt.TCP.SrcPort)
-					localPort = int(pkt.TCP.DestPort)
-				}
-				if isFilterPort(port) || isFilterPort(localPort) {
-					continue
-				}
-				resultdata["remote"] = fmt.Sprintf("%s:%d", ip, port) //TCP
-				conName := C.GoString(C.filter(C.CString(ip), C.int(port)))
-				if conName != "" {
-					resultdata["pid"] = strings.SplitN(conName, "/", 2)[0]
-					resultdata["name"] = strings.SplitN(conName, "/", 2)[1]
-				}
-				resultdata["local"] = fmt.Sprintf("%s:%d", common.LocalIP, localPort)
-			} else {
-				continue
 			}
-			resultChan <- resultdata
+			inodes[uint32(inode)] = *owner
 		}
 	}
+	return inodes
 }
@@ -186,8 +186,10 @@ int filter(char *ip, DWORD port)
 import "C"
 import (
 	"fmt"
+	"log"
 	"strings"
 	"yulong-hids/agent/common"
+	"yulong-hids/netaddr"
 
 	"github.com/akrennmair/gopcap"
 )
@@ -198,8 +200,10 @@ import (
 func StartNetSniff(resultChan chan map[string]string) {
 	var pkt *pcap.Packet
 	var resultdata map[string]string
-	h, err := getPcapHandle(common.LocalIP)
+	log.Println("StartConnMonitor")
+	h, err := getPcapHandle(common.LocalIP, "tcp or udp and (not broadcast and not multicast)")
 	if err != nil {
+		setFailed("connection", "pcap unavailable")
 		return
 	}
 	for {
@@ -223,8 +227,8 @@ func StartNetSniff(resultChan chan map[string]string) {
 		var localPort int
 		//不记录跟安全中心的连接记录
 		if pkt.IP != nil && (common.LocalIP == pkt.IP.SrcAddr() || common.LocalIP == pkt.IP.DestAddr()) &&
-			!common.InArray(common.ServerIPList, pkt.IP.SrcAddr(), false) &&
-			!common.InArray(common.ServerIPList, pkt.IP.DestAddr(), false) {
+			!netaddr.InList(common.ServerIPList, pkt.IP.SrcAddr()) &&
+			!netaddr.InList(common.ServerIPList, pkt.IP.DestAddr()) {
 			resultdata["source"] = "connection"
 			if common.LocalIP == pkt.IP.SrcAddr() {
 				ip = pkt.IP.DestAddr()
@@ -237,11 +241,11 @@ func StartNetSniff(resultChan chan map[string]string) {
 				continue
 			}
 			//如果内网记录为关闭则进行IP判断
-			if !common.Config.LAN && isLan(ip) {
+			if !common.Config.LAN && netaddr.IsLan(ip) {
 				continue
 			}
 			//白名单
-			if common.InArray(common.Config.Filter.IP, ip, false) {
+			if netaddr.InList(common.Config.Filter.IP, ip) {
 				continue
 			}
 			if pkt.IP.Protocol == UDP {
@@ -260,8 +264,8 @@ func StartNetSniff(resultChan chan map[string]string) {
 				if isFilterPort(port) || isFilterPort(localPort) {
 					continue
 				}
-				resultdata["remote"] = fmt.Sprintf("%s:%d", ip, port) //UDP
-				resultdata["local"] = fmt.Sprintf("%s:%d", common.LocalIP, localPort)
+				resultdata["remote"] = netaddr.JoinHostPort(ip, port) //UDP
+				resultdata["local"] = netaddr.JoinHostPort(common.LocalIP, localPort)
 			} else if pkt.IP.Protocol == TCP && strings.Contains(pkt.String(), "[syn]") {
 				resultdata["protocol"] = "tcp"
 				if resultdata["dir"] == "out" {
@@ -274,14 +278,14 @@ func StartNetSniff(resultChan chan map[string]string) {
 				if isFilterPort(port) || isFilterPort(localPort) {
 					continue
 				}
-				resultdata["remote"] = fmt.Sprintf("%s:%d", ip, port) //TCP
+				resultdata["remote"] = netaddr.JoinHostPort(ip, port) //TCP
 				if pid := C.filter(C.CString(ip), C.DWORD(port)); pid != 0 {
 					resultdata["pid"] = fmt.Sprintf("%d", pid)
 					if processInfo, ok := getProcessInfo(resultdata["pid"]); ok {
 						resultdata["name"] = processInfo.Name
 					}
 				}
-				resultdata["local"] = fmt.Sprintf("%s:%d", common.LocalIP, localPort)
+				resultdata["local"] = netaddr.JoinHostPort(common.LocalIP, localPort)
 			} else {
 				continue
 			}
@@ -0,0 +1,163 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"yulong-hids/agent/common"
+	"yulong-hids/netaddr"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// 超过这个时间没有应答的查询以TIMEOUT上报
+	dnsTimeout = time.Second * 5
+	// 已完成查询的上报间隔，同一批次中经本机DNS缓存转发的查询优先使用应用程序的查询
+	dnsFlushWait = time.Second
+)
+
+// dnsQuery 一次DNS查询及其应答
+type dnsQuery struct {
+	domain  string
+	qtype   string
+	server  string
+	owner   sockOwner
+	answers []string
+	rcode   string
+	start   time.Time
+	done    bool
+}
+
+// dnsTracker 将查询和应答按 服务器|客户端端口|ID 关联，同一域名、类型和结果在上报间隔内只上报一次
+type dnsTracker struct {
+	sync.Mutex
+	pending map[string]*dnsQuery
+	seen    map[string]time.Time
+}
+
+func newDNSTracker() *dnsTracker {
+	return &dnsTracker{
+		pending: make(map[string]*dnsQuery),
+		seen:    make(map[string]time.Time),
+	}
+}
+
+// parseDNS 解析UDP负载中的DNS报文，只处理包含问题的报文
+func parseDNS(payload []byte) (*dns.Msg, bool) {
+	msg := new(dns.Msg)
+	if err := msg.Unpack(payload); err != nil || len(msg.Question) == 0 {
+		return nil, false
+	}
+	return msg, true
+}
+
+func newDNSQuery(msg *dns.Msg, server string) *dnsQuery {
+	q := msg.Question[0]
+	return &dnsQuery{
+		domain: strings.ToLower(strings.TrimSuffix(q.Name, ".")),
+		qtype:  dns.TypeToString[q.Qtype],
+		server: netaddr.Host(server),
+		start:  time.Now(),
+	}
+}
+
+// query 记录本机发出的查询，owner为发出查询的进程
+func (t *dnsTracker) query(msg *dns.Msg, server string, port int, owner sockOwner) {
+	key := fmt.Sprintf("%s|%d|%d", netaddr.Host(server), port, msg.Id)
+	t.Lock()
+	defer t.Unlock()
+	if _, ok := t.pending[key]; ok {
+		return
+	}
+	q := newDNSQuery(msg, server)
+	q.owner = owner
+	t.pending[key] = q
+}
+
+// answer 记录收到的应答，没有对应的查询时（如agent启动前发出）单独记录
+func (t *dnsTracker) answer(msg *dns.Msg, server string, port int) {
+	key := fmt.Sprintf("%s|%d|%d", netaddr.Host(server), port, msg.Id)
+	t.Lock()
+	defer t.Unlock()
+	q, ok := t.pending[key]
+	if !ok {
+		q = newDNSQuery(msg, server)
+		t.pending[key] = q
+	}
+	if q.done {
+		return
+	}
+	q.done = true
+	q.rcode = dns.RcodeToString[msg.Rcode]
+	for _, rr := range msg.Answer {
+		// 去掉记录头部，只保留记录内容，如A记录的IP、CNAME的域名
+		data := strings.TrimSpace(strings.TrimPrefix(rr.String(), rr.Header().String()))
+		q.answers = append(q.answers, strings.TrimSuffix(data, "."))
+	}
+}
+
+// flushThread 定期上报已完成和超时的查询
+func (t *dnsTracker) flushThread(resultChan chan map[string]string) {
+	ticker := time.NewTicker(dnsFlushWait)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, resultdata := range t.flush() {
+			resultChan <- resultdata
+		}
+	}
+}
+
+func (t *dnsTracker) flush() []map[string]string {
+	t.Lock()
+	defer t.Unlock()
+	now := time.Now()
+	var queryList []*dnsQuery
+	for key, q := range t.pending {
+		if !q.done && now.Sub(q.start) < dnsTimeout {
+			continue
+		}
+		if !q.done {
+			q.rcode = "TIMEOUT"
+		}
+		delete(t.pending, key)
+		queryList = append(queryList, q)
+	}
+	// 发往本机DNS缓存（如127.0.0.53）的查询带有真正发起查询的进程
+	sort.SliceStable(queryList, func(i, j int) bool {
+		return netaddr.IsLoopback(queryList[i].server) && !netaddr.IsLoopback(queryList[j].server)
+	})
+	window := time.Minute * time.Duration(common.Config.Cycle)
+	if window < time.Minute {
+		window = time.Minute
+	}
+	for key, last := range t.seen {
+		if now.Sub(last) > window {
+			delete(t.seen, key)
+		}
+	}
+	var resultList []map[string]string
+	for _, q := range queryList {
+		if q.domain == "" {
+			continue
+		}
+		key := q.domain + "|" + q.qtype + "|" + q.rcode
+		if _, ok := t.seen[key]; ok {
+			continue
+		}
+		t.seen[key] = now
+		resultList = append(resultList, map[string]string{
+			"source":  "dns",
+			"domain":  q.domain,
+			"qtype":   q.qtype,
+			"rcode":   q.rcode,
+			"answers": strings.Join(q.answers, "|"),
+			"server":  q.server,
+			"pid":     q.owner.pid,
+			"name":    q.owner.name,
+		})
+	}
+	return resultList
+}
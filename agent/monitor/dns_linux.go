@@ -0,0 +1,150 @@
+//go:build linux
+// +build linux
+
+package monitor
+
+import (
+	"encoding/binary"
+	"log"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// dnsFilter 只接收源或目的端口为53的UDP报文（不含IP分片和IPv6扩展头），
+// SOCK_DGRAM类型的AF_PACKET socket收到的报文从IP头开始
+var dnsFilter = []unix.SockFilter{
+	{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: 0},
+	{Code: unix.BPF_ALU | unix.BPF_AND | unix.BPF_K, K: 0xf0},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 9, K: 0x40},
+	// IPv4
+	{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: 9},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 15, K: unix.IPPROTO_UDP},
+	{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_ABS, K: 6},
+	{Code: unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K, Jt: 13, Jf: 0, K: 0x1fff},
+	{Code: unix.BPF_LDX | unix.BPF_B | unix.BPF_MSH, K: 0},
+	{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_IND, K: 0},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 9, Jf: 0, K: 53},
+	{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_IND, K: 2},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 7, Jf: 8, K: 53},
+	// IPv6
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 7, K: 0x60},
+	{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: 6},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 5, K: unix.IPPROTO_UDP},
+	{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_ABS, K: 40},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 2, Jf: 0, K: 53},
+	{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_ABS, K: 42},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 1, K: 53},
+	{Code: unix.BPF_RET | unix.BPF_K, K: 0xffff},
+	{Code: unix.BPF_RET | unix.BPF_K, K: 0},
+}
+
+// StartDNSMonitor 开始DNS查询监控，通过AF_PACKET获取所有网卡上的DNS报文
+func StartDNSMonitor(resultChan chan map[string]string) {
+	log.Println("StartDNSMonitor")
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, int(htons(unix.ETH_P_ALL)))
+	if err != nil {
+		log.Println("DNS monitor socket error:", err)
+		setFailed("dns", "packet socket unavailable")
+		return
+	}
+	defer unix.Close(fd)
+	prog := unix.SockFprog{Len: uint16(len(dnsFilter)), Filter: &dnsFilter[0]}
+	if err := unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &prog); err != nil {
+		log.Println("DNS monitor filter error:", err)
+		setFailed("dns", "packet filter unavailable")
+		return
+	}
+	t := newDNSTracker()
+	runPart("dns", "flush", func() error { t.flushThread(resultChan); return nil })
+	var owners ownerCache
+	buf := make([]byte, 65536)
+	for {
+		n, from, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if err == unix.EINTR || err == unix.ENOBUFS {
+				continue
+			}
+			log.Println("DNS monitor recv error:", err)
+			setFailed("dns", "packet recv error")
+			return
+		}
+		ll, ok := from.(*unix.SockaddrLinklayer)
+		if !ok {
+			continue
+		}
+		src, dst, srcPort, dstPort, payload, ok := parseUDP(buf[:n])
+		if !ok {
+			continue
+		}
+		msg, ok := parseDNS(payload)
+		if !ok {
+			continue
+		}
+		// 只处理本机发出的查询和收到的应答，本机作为DNS服务器时收到的查询不记录
+		outgoing := ll.Pkttype == unix.PACKET_OUTGOING
+		switch {
+		case !msg.Response && outgoing && dstPort == 53:
+			t.query(msg, dst.String(), srcPort, owners.owner(udpInode(src, srcPort)))
+		case msg.Response && !outgoing && srcPort == 53:
+			t.answer(msg, src.String(), dstPort)
+		}
+	}
+}
+
+// parseUDP 解析IPv4/IPv6报文中的UDP头
+func parseUDP(pkt []byte) (src, dst net.IP, srcPort, dstPort int, payload []byte, ok bool) {
+	if len(pkt) < 1 {
+		return
+	}
+	var udp []byte
+	switch pkt[0] >> 4 {
+	case 4:
+		ihl := int(pkt[0]&0x0f) * 4
+		if len(pkt) < ihl+8 || ihl < 20 {
+			return
+		}
+		src, dst = net.IP(pkt[12:16]), net.IP(pkt[16:20])
+		udp = pkt[ihl:]
+	case 6:
+		if len(pkt) < 48 {
+			return
+		}
+		src, dst = net.IP(pkt[8:24]), net.IP(pkt[24:40])
+		udp = pkt[40:]
+	default:
+		return
+	}
+	srcPort = int(binary.BigEndian.Uint16(udp[0:2]))
+	dstPort = int(binary.BigEndian.Uint16(udp[2:4]))
+	return src, dst, srcPort, dstPort, udp[8:], true
+}
+
+// udpInode 通过sock_diag查找本机端口对应的UDP socket inode，查询时socket还在等待应答，
+// IPv4的查询也可能由IPv6 socket发出。由内核按端口过滤，不需要每次导出全部UDP socket
+func udpInode(local net.IP, port int) uint32 {
+	families := []uint8{unix.AF_INET6}
+	if local.To4() != nil {
+		families = []uint8{unix.AF_INET, unix.AF_INET6}
+	}
+	for _, family := range families {
+		sockets, err := diagDump(family, unix.IPPROTO_UDP, ^uint32(0), sportFilter(port))
+		if err != nil {
+			continue
+		}
+		for _, s := range sockets {
+			// 未绑定地址的socket本地地址为0.0.0.0或::
+			if s.localPort == port && (s.local.IsUnspecified() || s.local.Equal(local)) {
+				return s.inode
+			}
+		}
+	}
+	return 0
+}
+
+func htons(v uint16) uint16 {
+	if nativeEndian == binary.BigEndian {
+		return v
+	}
+	return v<<8 | v>>8
+}
@@ -0,0 +1,74 @@
+//go:build linux
+// +build linux
+
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestDNSFilter(t *testing.T) {
+	tests := []struct {
+		name string
+		pkt  []byte
+		want int
+	}{
+		{"ipv4 query", ipv4Packet(unix.IPPROTO_UDP, 20, 0, 40000, 53), 0xffff},
+		{"ipv4 answer", ipv4Packet(unix.IPPROTO_UDP, 20, 0, 53, 40000), 0xffff},
+		{"ipv4 query with options", ipv4Packet(unix.IPPROTO_UDP, 28, 0x4000, 40000, 53), 0xffff},
+		{"ipv4 other port", ipv4Packet(unix.IPPROTO_UDP, 20, 0, 40000, 5353), 0},
+		{"ipv4 fragment", ipv4Packet(unix.IPPROTO_UDP, 20, 0x2000|0x0100, 40000, 53), 0},
+		{"ipv4 tcp", ipv4Packet(unix.IPPROTO_TCP, 20, 0, 40000, 53), 0},
+		{"ipv6 query", ipv6Packet(unix.IPPROTO_UDP, 40000, 53), 0xffff},
+		{"ipv6 answer", ipv6Packet(unix.IPPROTO_UDP, 53, 40000), 0xffff},
+		{"ipv6 other port", ipv6Packet(unix.IPPROTO_UDP, 40000, 443), 0},
+		{"ipv6 tcp", ipv6Packet(unix.IPPROTO_TCP, 40000, 53), 0},
+		{"not ip", []byte{0x00, 0x01, 0x02}, 0},
+	}
+	for _, tt := range tests {
+		if got := runFilter(t, dnsFilter, tt.pkt); got != tt.want {
+			t.Errorf("%s: dnsFilter = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUDPInode(t *testing.T) {
+	if _, err := diagDump(unix.AF_INET, unix.IPPROTO_UDP, ^uint32(0), nil); err != nil {
+		t.Skip("sock_diag unavailable:", err)
+	}
+	var conns []*net.UDPConn
+	for i := 0; i < 3; i++ {
+		c, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		conns = append(conns, c)
+	}
+	c := conns[1]
+	f, err := c.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	link, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := c.LocalAddr().(*net.UDPAddr).Port
+	if got := fmt.Sprintf("socket:[%d]", udpInode(net.ParseIP("127.0.0.1"), port)); got != link {
+		t.Errorf("udpInode = %s, want %s", got, link)
+	}
+	sockets, err := diagDump(unix.AF_INET, unix.IPPROTO_UDP, ^uint32(0), sportFilter(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sockets) != 1 || sockets[0].localPort != port {
+		t.Errorf("sportFilter(%d) returned %+v", port, sockets)
+	}
+}
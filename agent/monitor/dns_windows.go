@@ -0,0 +1,53 @@
+//go:build windows
+// +build windows
+
+package monitor
+
+import (
+	"log"
+	"yulong-hids/agent/common"
+
+	pcap "github.com/akrennmair/gopcap"
+)
+
+// StartDNSMonitor 开始DNS查询监控，windows下通过pcap获取本机网卡上的DNS报文，不记录查询进程
+func StartDNSMonitor(resultChan chan map[string]string) {
+	log.Println("StartDNSMonitor")
+	h, err := getPcapHandle(common.LocalIP, "udp port 53")
+	if err != nil {
+		log.Println("DNS monitor pcap error:", err)
+		setFailed("dns", "pcap unavailable")
+		return
+	}
+	t := newDNSTracker()
+	runPart("dns", "flush", func() error { t.flushThread(resultChan); return nil })
+	for {
+		pkt := h.Next()
+		if pkt == nil {
+			continue
+		}
+		pkt.Decode()
+		if pkt.UDP == nil {
+			continue
+		}
+		var src, dst string
+		for _, hdr := range pkt.Headers {
+			switch ip := hdr.(type) {
+			case *pcap.Iphdr:
+				src, dst = ip.SrcAddr(), ip.DestAddr()
+			case *pcap.Ip6hdr:
+				src, dst = ip.SrcAddr(), ip.DestAddr()
+			}
+		}
+		msg, ok := parseDNS(pkt.Payload)
+		if !ok {
+			continue
+		}
+		switch {
+		case !msg.Response && src == common.LocalIP && pkt.UDP.DestPort == 53:
+			t.query(msg, dst, int(pkt.UDP.SrcPort), sockOwner{})
+		case msg.Response && dst == common.LocalIP && pkt.UDP.SrcPort == 53:
+			t.answer(msg, src, int(pkt.UDP.DestPort))
+		}
+	}
+}
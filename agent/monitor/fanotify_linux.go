@@ -0,0 +1,257 @@
+//go:build linux
+// +build linux
+
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	fanotifyMask = unix.FAN_MODIFY | unix.FAN_CLOSE_WRITE | unix.FAN_OPEN_EXEC
+	// 只有MODIFY没有CLOSE_WRITE的文件(长时间打开写入)，超过这个时间也上报一次
+	modifyWait = time.Second * 60
+	// 同一进程对同一文件的相同行为在这个时间内只上报一次
+	fanotifyDedup = time.Second
+)
+
+// writerInfo 写入文件的进程信息
+type writerInfo struct {
+	pid     int32
+	name    string
+	command string
+	ppid    string
+	time    time.Time
+}
+
+// fanotifyMonitor 基于fanotify的文件监控，能获取操作文件的进程
+type fanotifyMonitor struct {
+	fd       int
+	dw       *dirWatcher
+	mu       sync.Mutex
+	modified map[string]writerInfo // 已修改未关闭的文件
+	lastSeen map[string]time.Time  // 去重
+	done     chan struct{}         // 读取线程退出时关闭
+	reason   string                // 读取线程退出的原因，done关闭后可读
+}
+
+// startFanotify 以挂载点为单位添加fanotify监控，需要CAP_SYS_ADMIN
+func startFanotify(resultChan chan map[string]string, dw *dirWatcher) (*fanotifyMonitor, error) {
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_CLOEXEC|unix.FAN_UNLIMITED_QUEUE,
+		unix.O_RDONLY|unix.O_LARGEFILE|unix.O_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify_init: %v", err)
+	}
+	m := &fanotifyMonitor{
+		fd:       fd,
+		dw:       dw,
+		modified: make(map[string]writerInfo),
+		lastSeen: make(map[string]time.Time),
+		done:     make(chan struct{}),
+	}
+	dw.RLock()
+	marked := m.mark(dw.roots)
+	dw.RUnlock()
+	if marked == 0 {
+		unix.Close(fd)
+		return nil, fmt.Errorf("fanotify_mark: no path marked")
+	}
+	log.Println("StartFanotifyMonitor")
+	go m.flushThread(resultChan)
+	go m.readThread(resultChan)
+	return m, nil
+}
+
+// mark 为监控目录所在的挂载点添加监控，返回成功数量
+func (m *fanotifyMonitor) mark(roots []watchRoot) int {
+	marked := 0
+	for _, r := range roots {
+		err := unix.FanotifyMark(m.fd, unix.FAN_MARK_ADD|unix.FAN_MARK_MOUNT, fanotifyMask, unix.AT_FDCWD, r.path)
+		if err != nil {
+			log.Println("fanotify_mark:", r.path, err)
+			continue
+		}
+		marked++
+	}
+	return marked
+}
+
+// close 读取线程退出后由StartFileMonitor关闭fanotify
+func (m *fanotifyMonitor) close() {
+	unix.Close(m.fd)
+}
+
+// readThread 读取fanotify事件，出错退出时记录原因并关闭done，由StartFileMonitor改回inotify上报写入
+func (m *fanotifyMonitor) readThread(resultChan chan map[string]string) {
+	defer close(m.done)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := unix.Read(m.fd, buf)
+		if err != nil {
+			if err == unix.EINTR || err == unix.EAGAIN {
+				continue
+			}
+			log.Println("fanotify read error:", err)
+			m.reason = "fanotify read error"
+			return
+		}
+		for offset := 0; offset+unix.FAN_EVENT_METADATA_LEN <= n; {
+			event := (*unix.FanotifyEventMetadata)(unsafe.Pointer(&buf[offset]))
+			if event.Vers != unix.FANOTIFY_METADATA_VERSION || event.Event_len < unix.FAN_EVENT_METADATA_LEN {
+				log.Println("fanotify metadata version mismatch")
+				m.reason = "fanotify metadata version mismatch"
+				return
+			}
+			offset += int(event.Event_len)
+			if event.Fd < 0 {
+				continue
+			}
+			path, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", event.Fd))
+			unix.Close(int(event.Fd))
+			if err != nil {
+				continue
+			}
+			if resultdata, ok := m.handle(event.Mask, event.Pid, path); ok {
+				resultChan <- resultdata
+			}
+		}
+	}
+}
+
+// handle MODIFY先记录写入进程，等CLOSE_WRITE时上报WRITE，OPEN_EXEC上报EXEC
+func (m *fanotifyMonitor) handle(mask uint64, pid int32, path string) (map[string]string, bool) {
+	root, ok := m.dw.root(path)
+	if !ok || isAgentProcess(pid) {
+		return nil, false
+	}
+	action, writer, ok := m.track(mask, pid, path, root)
+	if !ok {
+		return nil, false
+	}
+	// 计算hash和webshell检测较慢，不持有锁
+	return m.event(action, path, writer)
+}
+
+// track 更新写入记录和去重缓存，返回需要上报的行为和进程
+func (m *fanotifyMonitor) track(mask uint64, pid int32, path string, root watchRoot) (string, writerInfo, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var action string
+	var writer writerInfo
+	switch {
+	case mask&unix.FAN_CLOSE_WRITE != 0:
+		action = "WRITE"
+		if w, ok := m.modified[path]; ok && w.pid == pid {
+			writer = w
+		} else {
+			writer = getWriterInfo(pid)
+		}
+		delete(m.modified, path)
+	case mask&unix.FAN_MODIFY != 0:
+		if _, ok := m.modified[path]; !ok {
+			m.modified[path] = getWriterInfo(pid)
+		}
+		return "", writer, false
+	case mask&unix.FAN_OPEN_EXEC != 0:
+		// 系统目录的程序执行由进程监控覆盖，这里只关注web目录等递归监控的目录
+		if !root.recursive {
+			return "", writer, false
+		}
+		action = "EXEC"
+		writer = getWriterInfo(pid)
+	default:
+		return "", writer, false
+	}
+	key := fmt.Sprintf("%s|%d|%s", action, pid, path)
+	if t, ok := m.lastSeen[key]; ok && time.Since(t) < fanotifyDedup {
+		return "", writer, false
+	}
+	m.lastSeen[key] = time.Now()
+	return action, writer, true
+}
+
+func (m *fanotifyMonitor) event(action string, path string, writer writerInfo) (map[string]string, bool) {
+	resultdata, ok := fileEvent(action, path, m.dw)
+	if !ok {
+		return nil, false
+	}
+	resultdata["pid"] = fmt.Sprintf("%d", writer.pid)
+	resultdata["name"] = writer.name
+	resultdata["command"] = writer.command
+	resultdata["ppid"] = writer.ppid
+	return resultdata, true
+}
+
+// flushThread 上报长时间未关闭的写入，并清理去重缓存，读取线程退出时结束
+func (m *fanotifyMonitor) flushThread(resultChan chan map[string]string) {
+	ticker := time.NewTicker(modifyWait)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+		}
+		expired := make(map[string]writerInfo)
+		m.mu.Lock()
+		for path, w := range m.modified {
+			if time.Since(w.time) < modifyWait {
+				continue
+			}
+			delete(m.modified, path)
+			expired[path] = w
+		}
+		for key, t := range m.lastSeen {
+			if time.Since(t) >= fanotifyDedup {
+				delete(m.lastSeen, key)
+			}
+		}
+		m.mu.Unlock()
+		for path, w := range expired {
+			if resultdata, ok := m.event("WRITE", path, w); ok {
+				resultChan <- resultdata
+			}
+		}
+	}
+}
+
+// getWriterInfo 读取进程名、命令行和父进程，进程已退出时为空
+func getWriterInfo(pid int32) writerInfo {
+	w := writerInfo{pid: pid, time: time.Now()}
+	if comm, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/comm", pid)); err == nil {
+		w.name = strings.TrimSpace(string(comm))
+	}
+	if cmdline, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid)); err == nil {
+		w.command = strings.TrimSpace(strings.Replace(string(cmdline), "\x00", " ", -1))
+	}
+	w.ppid = getPPid(pid)
+	return w
+}
+
+func getPPid(pid int32) string {
+	status, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if strings.HasPrefix(line, "PPid:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "PPid:"))
+		}
+	}
+	return ""
+}
+
+// isAgentProcess agent自身及其执行的命令不记录
+func isAgentProcess(pid int32) bool {
+	self := os.Getpid()
+	return int(pid) == self || getPPid(pid) == fmt.Sprintf("%d", self)
+}
@@ -22,7 +22,9 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 	"yulong-hids/agent/common"
 
 	"github.com/fsnotify/fsnotify"
@@ -46,67 +48,137 @@ func getFileUser(path string) (string, error) {
 	return "", errors.New("error")
 }
 
-// StartFileMonitor 开始文件行为监控
-func StartFileMonitor(resultChan chan map[string]string) {
-	log.Println("StartFileMonitor")
-	var pathList []string
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return
-	}
-	defer watcher.Close()
+// pathKey 监控目录的统一格式
+func pathKey(path string) string {
+	return filepath.Clean(path)
+}
+
+// monitorRoots 根据配置生成监控目录，%web%为web目录，以*结尾的递归监控子目录
+func monitorRoots() []watchRoot {
+	var roots []watchRoot
 	for _, path := range common.Config.MonitorPath {
 		if path == "%web%" {
-			iterationWatcher(common.ServerInfo.Path, watcher, pathList)
+			for _, webPath := range common.ServerInfo.Path {
+				roots = append(roots, watchRoot{pathKey(webPath), true})
+			}
 			continue
 		}
 		if strings.HasPrefix(path, "/") {
-			pathList = append(pathList, path)
 			if strings.HasSuffix(path, "*") {
-				iterationWatcher([]string{strings.Replace(path, "*", "", 1)}, watcher, pathList)
+				roots = append(roots, watchRoot{pathKey(strings.Replace(path, "*", "", 1)), true})
 			} else {
-				watcher.Add(path)
+				roots = append(roots, watchRoot{pathKey(path), false})
 			}
 		}
 	}
-	var resultdata map[string]string
+	return roots
+}
+
+// StartFileMonitor 开始文件行为监控
+func StartFileMonitor(resultChan chan map[string]string) {
+	log.Println("StartFileMonitor")
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		setFailed("file", "inotify unavailable")
+		return
+	}
+	defer watcher.Close()
+	dw := newDirWatcher(watcher, resultChan, fileStates.seed, fileStates.forget)
+	dw.reconcile(monitorRoots())
+	// fanotify可以获取写入文件的进程，开启后由fanotify上报写入和执行事件，
+	// 创建、删除、重命名、权限变化仍由inotify上报
+	var fan *fanotifyMonitor
+	var fanDone chan struct{}
+	if common.Config.Fanotify {
+		if fan, err = startFanotify(resultChan, dw); err != nil {
+			log.Println("Fanotify unavailable, fallback to fsnotify:", err)
+			fan = nil
+		} else {
+			fanDone = fan.done
+		}
+	}
+	// 定时上报未能配对的重命名事件
+	ticker := time.NewTicker(renameWait)
+	defer ticker.Stop()
+	// 配置刷新后同步监控目录
+	refresh := time.NewTicker(rootRefreshWait)
+	defer refresh.Stop()
 	for {
 		select {
-		case event := <-watcher.Events:
-			resultdata = make(map[string]string)
-			if common.InArray(filter.File, strings.ToLower(event.Name), false) ||
-				common.InArray(pathList, strings.ToLower(event.Name), false) ||
-				common.InArray(common.Config.Filter.File, strings.ToLower(event.Name), true) {
-				continue
+		case <-ticker.C:
+			for _, resultdata := range fileStates.expired() {
+				if isFileWhite(resultdata) {
+					continue
+				}
+				resultChan <- resultdata
 			}
-			if len(event.Name) == 0 {
-				continue
+		case <-fanDone:
+			// fanotify读取线程异常退出，写入事件改回由inotify上报
+			log.Println("Fanotify stopped, fallback to fsnotify:", fan.reason)
+			setFailed("file", fan.reason)
+			fan.close()
+			fan, fanDone = nil, nil
+		case <-refresh.C:
+			added := dw.reconcile(monitorRoots())
+			if fan != nil {
+				fan.mark(added)
 			}
-			resultdata["source"] = "file"
-			resultdata["action"] = event.Op.String()
-			resultdata["path"] = event.Name
-			resultdata["hash"] = ""
-			resultdata["user"] = ""
-			f, err := os.Stat(event.Name)
-			if err == nil && !f.IsDir() {
-				if f.Size() <= fileSize {
-					if hash, err := getFileMD5(event.Name); err == nil {
-						resultdata["hash"] = hash
-						if common.InArray(common.Config.Filter.File, strings.ToLower(hash), false) {
-							continue
-						}
-					}
-				}
-				if user, err := getFileUser(event.Name); err == nil {
-					resultdata["user"] = user
+		case event := <-watcher.Events:
+			if fan == nil || event.Op != fsnotify.Write {
+				if resultdata, ok := fileEvent(event.Op.String(), event.Name, dw); ok {
+					resultChan <- resultdata
 				}
 			}
-			if isFileWhite(resultdata) {
-				continue
-			}
-			resultChan <- resultdata
+			dw.handle(event)
 		case err := <-watcher.Errors:
 			log.Println("error:", err)
 		}
 	}
 }
+
+// fileEvent 组装文件事件，返回false表示被过滤或暂不上报
+func fileEvent(action string, name string, dw *dirWatcher) (map[string]string, bool) {
+	if common.InArray(filter.File, strings.ToLower(name), false) ||
+		dw.isRoot(name) ||
+		common.InArray(common.Config.Filter.File, strings.ToLower(name), true) {
+		return nil, false
+	}
+	if len(name) == 0 {
+		return nil, false
+	}
+	resultdata := make(map[string]string)
+	resultdata["source"] = "file"
+	resultdata["action"] = action
+	resultdata["path"] = name
+	resultdata["hash"] = ""
+	resultdata["user"] = ""
+	// 权限、属主、大小、inode变化以及重命名配对
+	if !fileStates.apply(action, resultdata) {
+		return nil, false
+	}
+	path := resultdata["path"]
+	f, err := os.Stat(path)
+	if err == nil && !f.IsDir() {
+		if f.Size() <= fileSize {
+			if hash, err := getFileMD5(path); err == nil {
+				resultdata["hash"] = hash
+				if common.InArray(common.Config.Filter.File, strings.ToLower(hash), false) {
+					return nil, false
+				}
+			}
+		}
+		if user, err := getFileUser(path); err == nil {
+			resultdata["user"] = user
+		}
+		// 权限变化不涉及内容，不做webshell检测
+		if action != "CHMOD" {
+			if scan := scanWebshell(path); scan != "" {
+				resultdata["scan"] = scan
+			}
+		}
+	}
+	if isFileWhite(resultdata) {
+		return nil, false
+	}
+	return resultdata, true
+}
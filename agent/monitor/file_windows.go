@@ -125,20 +125,21 @@ import (
 	"yulong-hids/agent/common"
 
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
-// StartFileMonitor 开始文件行为监控
-func StartFileMonitor(resultChan chan map[string]string) {
-	log.Println("StartFileMonitor")
-	var pathList []string
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return
-	}
-	defer watcher.Close()
+// pathKey 监控目录的统一格式，windows下不区分大小写
+func pathKey(path string) string {
+	return strings.ToLower(filepath.Clean(path))
+}
+
+// monitorRoots 根据配置生成监控目录，%web%为web目录，以*结尾的递归监控子目录
+func monitorRoots() []watchRoot {
+	var roots []watchRoot
 	//从配置文件中获取需监视的文件目录
 	for _, path := range common.Config.MonitorPath {
 		if strings.HasPrefix(path, "/") {
@@ -146,7 +147,9 @@ func StartFileMonitor(resultChan chan map[string]string) {
 		}
 		// web目录 循环添加子目录
 		if path == "%web%" {
-			iterationWatcher(common.ServerInfo.Path, watcher, pathList)
+			for _, webPath := range common.ServerInfo.Path {
+				roots = append(roots, watchRoot{pathKey(webPath), true})
+			}
 			continue
 		}
 		if strings.Contains(path, "%windows%") {
@@ -158,19 +161,39 @@ func StartFileMonitor(resultChan chan map[string]string) {
 				path = strings.Replace(path, "%system32%", os.Getenv("SystemDrive")+`\windows\System32`, 1)
 			}
 		}
-		pathList = append(pathList, strings.ToLower(path))
 		if strings.HasSuffix(path, "*") {
-			iterationWatcher([]string{strings.Replace(path, "*", "", 1)}, watcher, pathList)
+			roots = append(roots, watchRoot{pathKey(strings.Replace(path, "*", "", 1)), true})
+		} else {
+			roots = append(roots, watchRoot{pathKey(path), false})
 		}
-		watcher.Add(strings.ToLower(path))
 	}
+	return roots
+}
+
+// StartFileMonitor 开始文件行为监控
+func StartFileMonitor(resultChan chan map[string]string) {
+	log.Println("StartFileMonitor")
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		setFailed("file", "fsnotify unavailable")
+		return
+	}
+	defer watcher.Close()
+	dw := newDirWatcher(watcher, resultChan, nil, nil)
+	dw.reconcile(monitorRoots())
+	// 配置刷新后同步监控目录
+	refresh := time.NewTicker(rootRefreshWait)
+	defer refresh.Stop()
 	var resultdata map[string]string
 	for {
 		select {
+		case <-refresh.C:
+			dw.reconcile(monitorRoots())
 		case event := <-watcher.Events:
+			dw.handle(event)
 			resultdata = make(map[string]string)
 			if common.InArray(filter.File, strings.ToLower(event.Name), false) ||
-				common.InArray(pathList, strings.ToLower(event.Name), false) ||
+				dw.isRoot(event.Name) ||
 				common.InArray(common.Config.Filter.File, strings.ToLower(event.Name), true) {
 				continue
 			}
@@ -194,6 +217,11 @@ func StartFileMonitor(resultChan chan map[string]string) {
 				}
 				user := C.getprocessowner(C.CString(event.Name))
 				resultdata["user"] = C.GoString(user)
+				if event.Op != fsnotify.Chmod {
+					if scan := scanWebshell(event.Name); scan != "" {
+						resultdata["scan"] = scan
+					}
+				}
 			}
 			if isFileWhite(resultdata) {
 				continue
@@ -0,0 +1,230 @@
+//go:build linux
+// +build linux
+
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 重命名配对等待时间，超过这个时间没有等到新文件名就单独上报
+const renameWait = time.Second
+
+// fileState 文件属性快照
+type fileState struct {
+	Mode  os.FileMode
+	UID   uint32
+	GID   uint32
+	Size  int64
+	Inode uint64
+}
+
+// pendingRename 等待配对的重命名事件
+type pendingRename struct {
+	path  string
+	state fileState
+	time  time.Time
+}
+
+// fileStateCache 记录监控目录下文件的属性，用于计算变化前后的差异
+type fileStateCache struct {
+	sync.Mutex
+	states  map[string]fileState
+	renames map[uint64]pendingRename
+}
+
+var fileStates = fileStateCache{
+	states:  make(map[string]fileState),
+	renames: make(map[uint64]pendingRename),
+}
+
+func getFileState(path string) (fileState, error) {
+	var state fileState
+	f, err := os.Lstat(path)
+	if err != nil {
+		return state, err
+	}
+	state.Mode = f.Mode()
+	state.Size = f.Size()
+	if st, ok := f.Sys().(*syscall.Stat_t); ok {
+		state.UID = st.Uid
+		state.GID = st.Gid
+		state.Inode = st.Ino
+	}
+	return state, nil
+}
+
+// modeString 转换为 chmod 使用的八进制格式，例如 4755
+func modeString(mode os.FileMode) string {
+	perm := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 01000
+	}
+	return fmt.Sprintf("%04o", perm)
+}
+
+// attrFlags 新增的敏感权限位：setuid、setgid、其他用户可写
+func attrFlags(old *fileState, now fileState) string {
+	var flags []string
+	gained := func(bit os.FileMode) bool {
+		return now.Mode&bit != 0 && (old == nil || old.Mode&bit == 0)
+	}
+	if gained(os.ModeSetuid) {
+		flags = append(flags, "setuid")
+	}
+	if gained(os.ModeSetgid) {
+		flags = append(flags, "setgid")
+	}
+	if now.Mode&os.ModeSymlink == 0 && gained(0002) {
+		flags = append(flags, "world-writable")
+	}
+	return strings.Join(flags, "|")
+}
+
+// seed 记录目录下已有文件的属性，不递归
+func (c *fileStateCache) seed(dir string) {
+	fileList, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	for _, f := range fileList {
+		path := filepath.Join(dir, f.Name())
+		if state, err := getFileState(path); err == nil {
+			c.states[path] = state
+		}
+	}
+}
+
+// forget 清理不再监控的目录下文件的属性，seed按目录记录，这里也按所在目录清理
+func (c *fileStateCache) forget(dirs []string) {
+	removed := make(map[string]bool)
+	for _, dir := range dirs {
+		removed[dir] = true
+	}
+	c.Lock()
+	defer c.Unlock()
+	for path := range c.states {
+		if removed[filepath.Dir(path)] {
+			delete(c.states, path)
+		}
+	}
+}
+
+// apply 根据事件更新属性缓存，并把变化前后的属性写入resultdata
+// 返回false表示该事件暂不上报(等待重命名配对)
+func (c *fileStateCache) apply(action string, resultdata map[string]string) bool {
+	path := resultdata["path"]
+	c.Lock()
+	defer c.Unlock()
+	old, hasOld := c.states[path]
+	if strings.Contains(action, "RENAME") && hasOld {
+		// 旧文件名已不存在，等待同一inode的CREATE事件配对
+		delete(c.states, path)
+		c.renames[old.Inode] = pendingRename{path, old, time.Now()}
+		return false
+	}
+	now, err := getFileState(path)
+	if err != nil {
+		// 文件已删除
+		if hasOld {
+			delete(c.states, path)
+			setOldState(resultdata, old)
+		}
+		return true
+	}
+	c.states[path] = now
+	if strings.Contains(action, "CREATE") {
+		if r, ok := c.renames[now.Inode]; ok {
+			delete(c.renames, now.Inode)
+			resultdata["action"] = "RENAME"
+			resultdata["from"] = r.path
+			resultdata["to"] = path
+			old, hasOld = r.state, true
+		}
+	}
+	setNewState(resultdata, now)
+	if hasOld {
+		setOldState(resultdata, old)
+		resultdata["flags"] = attrFlags(&old, now)
+		resultdata["changed"] = attrChanged(old, now)
+	} else {
+		resultdata["flags"] = attrFlags(nil, now)
+	}
+	return true
+}
+
+// expired 返回超时未配对的重命名事件，一般是移出了监控目录
+func (c *fileStateCache) expired() []map[string]string {
+	var resultList []map[string]string
+	c.Lock()
+	defer c.Unlock()
+	for inode, r := range c.renames {
+		if time.Since(r.time) < renameWait {
+			continue
+		}
+		delete(c.renames, inode)
+		resultdata := map[string]string{
+			"source": "file",
+			"action": "RENAME",
+			"path":   r.path,
+			"hash":   "",
+			"user":   "",
+			"from":   r.path,
+			"to":     "",
+		}
+		setOldState(resultdata, r.state)
+		resultList = append(resultList, resultdata)
+	}
+	return resultList
+}
+
+func setNewState(resultdata map[string]string, state fileState) {
+	resultdata["mode"] = modeString(state.Mode)
+	resultdata["uid"] = fmt.Sprintf("%d", state.UID)
+	resultdata["gid"] = fmt.Sprintf("%d", state.GID)
+	resultdata["size"] = fmt.Sprintf("%d", state.Size)
+	resultdata["inode"] = fmt.Sprintf("%d", state.Inode)
+}
+
+func setOldState(resultdata map[string]string, state fileState) {
+	resultdata["oldmode"] = modeString(state.Mode)
+	resultdata["olduid"] = fmt.Sprintf("%d", state.UID)
+	resultdata["oldgid"] = fmt.Sprintf("%d", state.GID)
+	resultdata["oldsize"] = fmt.Sprintf("%d", state.Size)
+	if _, ok := resultdata["inode"]; !ok {
+		resultdata["inode"] = fmt.Sprintf("%d", state.Inode)
+	}
+}
+
+// attrChanged 发生变化的属性列表 mode|owner|size
+func attrChanged(old fileState, now fileState) string {
+	var changed []string
+	if old.Mode != now.Mode {
+		changed = append(changed, "mode")
+	}
+	if old.UID != now.UID || old.GID != now.GID {
+		changed = append(changed, "owner")
+	}
+	if old.Size != now.Size {
+		changed = append(changed, "size")
+	}
+	if old.Inode != now.Inode {
+		changed = append(changed, "inode")
+	}
+	return strings.Join(changed, "|")
+}
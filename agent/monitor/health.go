@@ -0,0 +1,72 @@
+package monitor
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 监控模块状态
+const (
+	statusRunning     = "running"
+	statusStopped     = "stopped"
+	statusUnsupported = "unsupported"
+)
+
+var monitorStatus = struct {
+	sync.Mutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+func setStatus(name string, status string) {
+	monitorStatus.Lock()
+	monitorStatus.m[name] = status
+	monitorStatus.Unlock()
+}
+
+// setFailed 监控模块部分功能失败（如进程监控连接内核模块失败），记录为 failed:原因
+func setFailed(name string, reason string) {
+	setStatus(name, "failed:"+reason)
+}
+
+// Run 运行监控模块并记录状态，监控函数返回（启动失败或异常退出）时记录为stopped
+func Run(name string, start func(chan map[string]string), resultChan chan map[string]string) {
+	setStatus(name, statusRunning)
+	start(resultChan)
+	monitorStatus.Lock()
+	defer monitorStatus.Unlock()
+	// 已记录失败原因或不支持时保留
+	if monitorStatus.m[name] == statusRunning {
+		monitorStatus.m[name] = statusStopped
+	}
+}
+
+// runPart 在子goroutine中运行监控模块的一部分（如销毁事件监听、DNS上报），返回错误或panic时
+// 将模块记录为 failed:part stopped，模块的主循环继续运行
+func runPart(name string, part string, f func() error) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Println(name, part, "panic:", r)
+				setFailed(name, part+" stopped")
+			}
+		}()
+		if err := f(); err != nil {
+			log.Println(name, part, "error:", err)
+			setFailed(name, part+" stopped")
+		}
+	}()
+}
+
+// Status 所有监控模块的状态，格式为 名称:状态，多个以|分隔
+func Status() string {
+	monitorStatus.Lock()
+	defer monitorStatus.Unlock()
+	var list []string
+	for name, status := range monitorStatus.m {
+		list = append(list, name+":"+status)
+	}
+	sort.Strings(list)
+	return strings.Join(list, "|")
+}
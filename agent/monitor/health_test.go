@@ -0,0 +1,55 @@
+package monitor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func waitStatus(name string, want string) string {
+	for i := 0; i < 100; i++ {
+		monitorStatus.Lock()
+		status := monitorStatus.m[name]
+		monitorStatus.Unlock()
+		if status == want {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	monitorStatus.Lock()
+	defer monitorStatus.Unlock()
+	return monitorStatus.m[name]
+}
+
+func TestRunPart(t *testing.T) {
+	setStatus("test-ok", statusRunning)
+	done := make(chan struct{})
+	runPart("test-ok", "part", func() error { close(done); return nil })
+	<-done
+	if got := waitStatus("test-ok", statusRunning); got != statusRunning {
+		t.Errorf("status after nil return = %q, want %q", got, statusRunning)
+	}
+
+	setStatus("test-err", statusRunning)
+	runPart("test-err", "part", func() error { return errors.New("closed") })
+	if got := waitStatus("test-err", "failed:part stopped"); got != "failed:part stopped" {
+		t.Errorf("status after error = %q, want failed:part stopped", got)
+	}
+
+	setStatus("test-panic", statusRunning)
+	runPart("test-panic", "part", func() error { panic("boom") })
+	if got := waitStatus("test-panic", "failed:part stopped"); got != "failed:part stopped" {
+		t.Errorf("status after panic = %q, want failed:part stopped", got)
+	}
+}
+
+func TestRunKeepsFailure(t *testing.T) {
+	Run("test-run", func(chan map[string]string) {}, nil)
+	if got := waitStatus("test-run", statusStopped); got != statusStopped {
+		t.Errorf("status = %q, want %q", got, statusStopped)
+	}
+	Run("test-run-failed", func(chan map[string]string) { setFailed("test-run-failed", "x") }, nil)
+	if got := waitStatus("test-run-failed", "failed:x"); got != "failed:x" {
+		t.Errorf("status = %q, want failed:x", got)
+	}
+}
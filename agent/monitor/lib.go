@@ -5,19 +5,24 @@ import (
 	"encoding/hex"
 	"errors"
 	"io"
-	"log"
 	"os"
-	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
 	"yulong-hids/agent/common"
-
-	pcap "github.com/akrennmair/gopcap"
-	"github.com/fsnotify/fsnotify"
+	"yulong-hids/agent/resource"
 )
 
+// sockOwner socket所属进程
+type sockOwner struct {
+	pid  string
+	name string
+}
+
 func getFileMD5(path string) (string, error) {
+	// 资源紧张时跳过hash计算
+	if resource.SkipHash() {
+		return "", errors.New("resource pressure")
+	}
 	fileinfo, err := os.Stat(path)
 	// log.Println(fileinfo.Size())
 	if fileinfo.Size() >= fileSize {
@@ -39,27 +44,6 @@ func getFileMD5(path string) (string, error) {
 	return hex.EncodeToString(cipherStr), nil
 }
 
-func ipToInt(ip string) int64 {
-	bits := strings.Split(ip, ".")
-	b0, _ := strconv.Atoi(bits[0])
-	b1, _ := strconv.Atoi(bits[1])
-	b2, _ := strconv.Atoi(bits[2])
-	b3, _ := strconv.Atoi(bits[3])
-	var sum int64
-	sum += int64(b0) << 24
-	sum += int64(b1) << 16
-	sum += int64(b2) << 8
-	sum += int64(b3)
-	return sum
-}
-
-func isLan(ip string) bool {
-	ipInt := ipToInt(ip)
-	if (ipInt >= 167772160 && ipInt <= 184549375) || (ipInt >= 2886729728 && ipInt <= 2887778303) || (ipInt >= 3232235520 && ipInt <= 3232301055) {
-		return true
-	}
-	return false
-}
 func isFilterPort(port int) bool {
 	for _, v := range filter.Port {
 		if v == port {
@@ -69,54 +53,6 @@ func isFilterPort(port int) bool {
 	return false
 }
 
-func getPcapHandle(ip string) (*pcap.Pcap, error) {
-	devs, err := pcap.Findalldevs()
-	if err != nil {
-		return nil, err
-	}
-	var device string
-	for _, dev := range devs {
-		for _, v := range dev.Addresses {
-			if v.IP.String() == ip {
-				device = dev.Name
-				break
-			}
-		}
-	}
-	if device == "" {
-		return nil, errors.New("find device error")
-	}
-	h, err := pcap.Openlive(device, 65535, true, 0)
-	if err != nil {
-		return nil, err
-	}
-	log.Println("StartConnMonitor")
-	err = h.Setfilter("tcp or udp and (not broadcast and not multicast)")
-	if err != nil {
-		return nil, err
-	}
-	return h, nil
-}
-
-func iterationWatcher(monList []string, watcher *fsnotify.Watcher, pathList []string) {
-	for _, p := range monList {
-		filepath.Walk(p, func(path string, f os.FileInfo, err error) error {
-			if err != nil {
-				log.Println(err.Error())
-				return err
-			}
-			if f.IsDir() {
-				pathList = append(pathList, path)
-				err = watcher.Add(strings.ToLower(path))
-				if err != nil {
-					log.Println(err)
-				}
-			}
-			return nil
-		})
-	}
-}
-
 // isFileWhite param @resultdata key list: [source, action, path, hash, user]
 func isFileWhite(resultdata map[string]string) bool {
 	for _, v := range common.Config.Filter.File {
@@ -0,0 +1,39 @@
+//go:build windows
+// +build windows
+
+package monitor
+
+import (
+	"errors"
+
+	pcap "github.com/akrennmair/gopcap"
+)
+
+// getPcapHandle 打开本机IP所在网卡并设置过滤条件
+func getPcapHandle(ip string, filter string) (*pcap.Pcap, error) {
+	devs, err := pcap.Findalldevs()
+	if err != nil {
+		return nil, err
+	}
+	var device string
+	for _, dev := range devs {
+		for _, v := range dev.Addresses {
+			if v.IP.String() == ip {
+				device = dev.Name
+				break
+			}
+		}
+	}
+	if device == "" {
+		return nil, errors.New("find device error")
+	}
+	h, err := pcap.Openlive(device, 65535, true, 0)
+	if err != nil {
+		return nil, err
+	}
+	err = h.Setfilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
@@ -101,6 +101,7 @@ func StartProcessMonitor(resultChan chan map[string]string) {
 		ok := C.CapturePrecess()
 		if ok < 0 {
 			log.Println("connect syshook netlink error")
+			setFailed("process", "syshook netlink error")
 		}
 	}()
 	localaddress, _ := net.ResolveUDPAddr("udp", "127.0.0.1:65530")
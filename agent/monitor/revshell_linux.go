@@ -0,0 +1,151 @@
+//go:build linux
+// +build linux
+
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"yulong-hids/agent/common"
+	"yulong-hids/netaddr"
+
+	"golang.org/x/sys/unix"
+)
+
+// 反弹shell检测的扫描间隔
+const shellScanWait = time.Second * 3
+
+// shellReg 可作为交互式shell使用的程序，反弹shell时这些进程的标准输入输出会被重定向到socket
+var shellReg = regexp.MustCompile(`^(sh|bash|dash|zsh|ksh|mksh|csh|tcsh|ash|busybox|python[0-9.]*|perl[0-9.]*|ruby[0-9.]*|php[0-9.]*|lua[0-9.]*|node|nc|ncat|netcat|nc\.traditional|nc\.openbsd|socat|telnet|awk|gawk)$`)
+
+// StartShellMonitor 开始反弹shell检测，定期检查shell类进程的标准输入、输出、错误是否为连接到远程地址的socket
+func StartShellMonitor(resultChan chan map[string]string) {
+	log.Println("StartShellMonitor")
+	// 已上报的进程，key为pid|socket inode
+	reported := make(map[string]bool)
+	ticker := time.NewTicker(shellScanWait)
+	defer ticker.Stop()
+	for range ticker.C {
+		current := make(map[string]bool)
+		for _, resultdata := range scanShells(reported, current) {
+			resultChan <- resultdata
+		}
+		reported = current
+	}
+}
+
+// scanShells 扫描/proc，返回新发现的反弹shell事件，current记录本次仍存在的进程
+func scanShells(reported map[string]bool, current map[string]bool) []map[string]string {
+	procList, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	var resultList []map[string]string
+	var sockets map[uint32]diagSocket
+	for _, p := range procList {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil {
+			continue
+		}
+		comm, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+		if err != nil || !shellReg.MatchString(strings.TrimSpace(string(comm))) {
+			continue
+		}
+		fds, inodes := stdFds(pid)
+		if len(inodes) == 0 {
+			continue
+		}
+		// 只有存在shell类进程使用socket作为标准输入输出时才获取连接信息
+		if sockets == nil {
+			sockets = remoteSockets()
+		}
+		for _, inode := range inodes {
+			s, ok := sockets[inode]
+			if !ok {
+				continue
+			}
+			key := fmt.Sprintf("%d|%d", pid, inode)
+			current[key] = true
+			if reported[key] || isAgentProcess(int32(pid)) {
+				break
+			}
+			if resultdata, ok := shellEvent(pid, fds, s); ok {
+				resultList = append(resultList, resultdata)
+			}
+			break
+		}
+	}
+	return resultList
+}
+
+// stdFds 读取进程0、1、2号文件描述符的指向，返回 fd:目标 的列表和其中socket的inode
+func stdFds(pid int) ([]string, []uint32) {
+	var fds []string
+	var inodes []uint32
+	for fd := 0; fd <= 2; fd++ {
+		link, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "fd", strconv.Itoa(fd)))
+		if err != nil {
+			continue
+		}
+		fds = append(fds, fmt.Sprintf("%d:%s", fd, link))
+		if !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]"), 10, 32)
+		if err == nil {
+			inodes = append(inodes, uint32(inode))
+		}
+	}
+	return fds, inodes
+}
+
+// remoteSockets 获取已建立连接的TCP和UDP socket，key为inode
+func remoteSockets() map[uint32]diagSocket {
+	sockets := make(map[uint32]diagSocket)
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		for _, protocol := range []uint8{unix.IPPROTO_TCP, unix.IPPROTO_UDP} {
+			list, err := diagDump(family, protocol, 1<<tcpEstablished, nil)
+			if err != nil {
+				log.Println("Sock diag error:", err)
+			}
+			for _, s := range list {
+				if s.inode != 0 && !s.remote.IsUnspecified() {
+					sockets[s.inode] = s
+				}
+			}
+		}
+	}
+	return sockets
+}
+
+// shellEvent 组装反弹shell事件，返回false表示被过滤
+func shellEvent(pid int, fds []string, s diagSocket) (map[string]string, bool) {
+	info := getWriterInfo(int32(pid))
+	if common.InArray(common.Config.Filter.Process, strings.ToLower(info.name), true) ||
+		common.InArray(common.Config.Filter.Process, strings.ToLower(info.command), true) {
+		return nil, false
+	}
+	var parentName string
+	if comm, err := ioutil.ReadFile(fmt.Sprintf("/proc/%s/comm", info.ppid)); err == nil {
+		parentName = strings.TrimSpace(string(comm))
+	}
+	return map[string]string{
+		"source":     "reverseshell",
+		"pid":        strconv.Itoa(pid),
+		"name":       info.name,
+		"command":    info.command,
+		"ppid":       info.ppid,
+		"parentname": parentName,
+		"fds":        strings.Join(fds, "|"),
+		"protocol":   s.protocol,
+		"remote":     netaddr.JoinHostPort(s.remote.String(), s.remotePort),
+		"local":      netaddr.JoinHostPort(s.local.String(), s.localPort),
+	}, true
+}
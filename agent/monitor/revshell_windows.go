@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package monitor
+
+import "log"
+
+// StartShellMonitor 反弹shell检测，windows下暂不支持
+func StartShellMonitor(resultChan chan map[string]string) {
+	log.Println("StartShellMonitor: not supported on windows")
+	setStatus("reverseshell", statusUnsupported)
+}
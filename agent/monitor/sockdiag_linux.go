@@ -0,0 +1,178 @@
+//go:build linux
+// +build linux
+
+package monitor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// linux/sock_diag.h、linux/inet_diag.h
+const (
+	sockDiagByFamily = 20
+	inetDiagReqLen   = 56
+	inetDiagMsgLen   = 72
+
+	inetDiagReqBytecode = 1
+	inetDiagBcSGE       = 2
+	inetDiagBcSLE       = 3
+
+	tcpEstablished = 1
+	tcpSynSent     = 2
+	tcpSynRecv     = 3
+	tcpListen      = 10
+
+	// socket销毁时的广播组，需要CAP_NET_ADMIN
+	sknlgrpInetTCPDestroy  = 1
+	sknlgrpInet6TCPDestroy = 3
+)
+
+// nativeEndian netlink消息头和inet_diag_msg中除地址端口外的字段为主机字节序
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// diagSocket sock_diag返回的socket信息
+type diagSocket struct {
+	protocol   string
+	state      uint8
+	local      net.IP
+	localPort  int
+	remote     net.IP
+	remotePort int
+	uid        uint32
+	inode      uint32
+}
+
+// key 连接的唯一标识，销毁事件中inode已为0，所以不包含inode
+func (s diagSocket) key() string {
+	return fmt.Sprintf("%s|%s|%s", s.protocol,
+		net.JoinHostPort(s.local.String(), fmt.Sprint(s.localPort)),
+		net.JoinHostPort(s.remote.String(), fmt.Sprint(s.remotePort)))
+}
+
+// sportFilter inet_diag过滤字节码，只返回本地端口为port的socket。用S_GE和S_LE组合
+// 而不是S_EQ（4.16才支持），条件不满足时跳到字节码末尾之后即为丢弃
+func sportFilter(port int) []byte {
+	bc := make([]byte, 16)
+	// inet_diag_bc_op: code, yes, no，比较的端口放在紧随其后的op的no字段
+	bc[0] = inetDiagBcSGE
+	bc[1] = 8
+	nativeEndian.PutUint16(bc[2:4], 20)
+	nativeEndian.PutUint16(bc[6:8], uint16(port))
+	bc[8] = inetDiagBcSLE
+	bc[9] = 8
+	nativeEndian.PutUint16(bc[10:12], 12)
+	nativeEndian.PutUint16(bc[14:16], uint16(port))
+	return bc
+}
+
+// diagDump 通过NETLINK_SOCK_DIAG获取指定协议族、协议和状态的所有socket，bytecode不为空时
+// 作为INET_DIAG_REQ_BYTECODE属性由内核过滤
+func diagDump(family uint8, protocol uint8, states uint32, bytecode []byte) ([]diagSocket, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_INET_DIAG)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(fd)
+	size := unix.SizeofNlMsghdr + inetDiagReqLen
+	if len(bytecode) > 0 {
+		size += unix.SizeofNlAttr + len(bytecode)
+	}
+	req := make([]byte, size)
+	nativeEndian.PutUint32(req[0:4], uint32(len(req)))
+	nativeEndian.PutUint16(req[4:6], sockDiagByFamily)
+	nativeEndian.PutUint16(req[6:8], unix.NLM_F_REQUEST|unix.NLM_F_DUMP)
+	// inet_diag_req_v2: family, protocol, ext, pad, states, 其余的sockid为0表示不过滤
+	req[16] = family
+	req[17] = protocol
+	nativeEndian.PutUint32(req[20:24], states)
+	if len(bytecode) > 0 {
+		attr := req[unix.SizeofNlMsghdr+inetDiagReqLen:]
+		nativeEndian.PutUint16(attr[0:2], uint16(unix.SizeofNlAttr+len(bytecode)))
+		nativeEndian.PutUint16(attr[2:4], inetDiagReqBytecode)
+		copy(attr[unix.SizeofNlAttr:], bytecode)
+	}
+	if err := unix.Sendto(fd, req, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+	var sockets []diagSocket
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return sockets, err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return sockets, err
+		}
+		for _, m := range msgs {
+			switch m.Header.Type {
+			case unix.NLMSG_DONE:
+				return sockets, nil
+			case unix.NLMSG_ERROR:
+				if len(m.Data) >= 4 {
+					if errno := int32(nativeEndian.Uint32(m.Data[0:4])); errno != 0 {
+						return sockets, syscall.Errno(-errno)
+					}
+				}
+				return sockets, nil
+			}
+			if s, ok := parseDiagMsg(m.Data, protocol); ok {
+				sockets = append(sockets, s)
+			}
+		}
+	}
+}
+
+// diagDestroyEvents 订阅TCP socket销毁事件，用于发现两次轮询之间建立又关闭的短连接
+func diagDestroyEvents() (int, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_INET_DIAG)
+	if err != nil {
+		return -1, err
+	}
+	groups := uint32(1<<(sknlgrpInetTCPDestroy-1) | 1<<(sknlgrpInet6TCPDestroy-1))
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: groups}); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// parseDiagMsg 解析inet_diag_msg，端口和地址为网络字节序
+func parseDiagMsg(data []byte, protocol uint8) (diagSocket, bool) {
+	var s diagSocket
+	if len(data) < inetDiagMsgLen {
+		return s, false
+	}
+	switch protocol {
+	case unix.IPPROTO_TCP:
+		s.protocol = "tcp"
+	case unix.IPPROTO_UDP:
+		s.protocol = "udp"
+	}
+	s.state = data[1]
+	s.localPort = int(binary.BigEndian.Uint16(data[4:6]))
+	s.remotePort = int(binary.BigEndian.Uint16(data[6:8]))
+	if data[0] == unix.AF_INET {
+		s.local = net.IP(append([]byte(nil), data[8:12]...))
+		s.remote = net.IP(append([]byte(nil), data[24:28]...))
+	} else {
+		s.local = net.IP(append([]byte(nil), data[8:24]...))
+		s.remote = net.IP(append([]byte(nil), data[24:40]...))
+	}
+	s.uid = nativeEndian.Uint32(data[64:68])
+	s.inode = nativeEndian.Uint32(data[68:72])
+	return s, true
+}
@@ -0,0 +1,163 @@
+//go:build linux
+// +build linux
+
+package monitor
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+func diagMsg(family uint8, state uint8, local net.IP, localPort uint16, remote net.IP, remotePort uint16, inode uint32) []byte {
+	data := make([]byte, inetDiagMsgLen)
+	data[0] = family
+	data[1] = state
+	binary.BigEndian.PutUint16(data[4:6], localPort)
+	binary.BigEndian.PutUint16(data[6:8], remotePort)
+	if family == unix.AF_INET {
+		copy(data[8:12], local.To4())
+		copy(data[24:28], remote.To4())
+	} else {
+		copy(data[8:24], local.To16())
+		copy(data[24:40], remote.To16())
+	}
+	nativeEndian.PutUint32(data[64:68], 1000)
+	nativeEndian.PutUint32(data[68:72], inode)
+	return data
+}
+
+func TestParseDiagMsg(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		protocol uint8
+		ok       bool
+		want     diagSocket
+		key      string
+	}{
+		{
+			name:     "ipv4 tcp",
+			data:     diagMsg(unix.AF_INET, tcpEstablished, net.ParseIP("10.0.0.1"), 51000, net.ParseIP("8.8.8.8"), 443, 1234),
+			protocol: unix.IPPROTO_TCP,
+			ok:       true,
+			want:     diagSocket{protocol: "tcp", state: tcpEstablished, local: net.ParseIP("10.0.0.1"), localPort: 51000, remote: net.ParseIP("8.8.8.8"), remotePort: 443, uid: 1000, inode: 1234},
+			key:      "tcp|10.0.0.1:51000|8.8.8.8:443",
+		},
+		{
+			name:     "ipv6 udp",
+			data:     diagMsg(unix.AF_INET6, 7, net.ParseIP("2001:db8::1"), 5353, net.ParseIP("2001:db8::2"), 53, 99),
+			protocol: unix.IPPROTO_UDP,
+			ok:       true,
+			want:     diagSocket{protocol: "udp", state: 7, local: net.ParseIP("2001:db8::1"), localPort: 5353, remote: net.ParseIP("2001:db8::2"), remotePort: 53, uid: 1000, inode: 99},
+			key:      "udp|[2001:db8::1]:5353|[2001:db8::2]:53",
+		},
+		{
+			name:     "short message",
+			data:     make([]byte, inetDiagMsgLen-1),
+			protocol: unix.IPPROTO_TCP,
+		},
+	}
+	for _, tt := range tests {
+		s, ok := parseDiagMsg(tt.data, tt.protocol)
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if s.protocol != tt.want.protocol || s.state != tt.want.state || !s.local.Equal(tt.want.local) ||
+			s.localPort != tt.want.localPort || !s.remote.Equal(tt.want.remote) || s.remotePort != tt.want.remotePort ||
+			s.uid != tt.want.uid || s.inode != tt.want.inode {
+			t.Errorf("%s: parseDiagMsg = %+v, want %+v", tt.name, s, tt.want)
+		}
+		if s.key() != tt.key {
+			t.Errorf("%s: key = %q, want %q", tt.name, s.key(), tt.key)
+		}
+	}
+}
+
+// runFilter 用bpf虚拟机执行socket filter，返回截取长度，0为丢弃
+func runFilter(t *testing.T, filter []unix.SockFilter, pkt []byte) int {
+	raw := make([]bpf.RawInstruction, len(filter))
+	for i, f := range filter {
+		raw[i] = bpf.RawInstruction{Op: f.Code, Jt: f.Jt, Jf: f.Jf, K: f.K}
+	}
+	insts, ok := bpf.Disassemble(raw)
+	if !ok {
+		t.Fatal("disassemble filter failed")
+	}
+	vm, err := bpf.NewVM(insts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := vm.Run(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// ipv4Packet IPv4报文，ihl为首部长度（字节），frag为标志和片偏移字段
+func ipv4Packet(protocol uint8, ihl int, frag uint16, srcPort uint16, dstPort uint16) []byte {
+	pkt := make([]byte, ihl+8+32)
+	pkt[0] = 0x40 | byte(ihl/4)
+	binary.BigEndian.PutUint16(pkt[6:8], frag)
+	pkt[9] = protocol
+	copy(pkt[12:16], net.ParseIP("10.0.0.1").To4())
+	copy(pkt[16:20], net.ParseIP("10.0.0.2").To4())
+	binary.BigEndian.PutUint16(pkt[ihl:ihl+2], srcPort)
+	binary.BigEndian.PutUint16(pkt[ihl+2:ihl+4], dstPort)
+	return pkt
+}
+
+func ipv6Packet(next uint8, srcPort uint16, dstPort uint16) []byte {
+	pkt := make([]byte, 40+8+32)
+	pkt[0] = 0x60
+	pkt[6] = next
+	copy(pkt[8:24], net.ParseIP("2001:db8::1").To16())
+	copy(pkt[24:40], net.ParseIP("2001:db8::2").To16())
+	binary.BigEndian.PutUint16(pkt[40:42], srcPort)
+	binary.BigEndian.PutUint16(pkt[42:44], dstPort)
+	return pkt
+}
+
+func TestUDPFilter(t *testing.T) {
+	tests := []struct {
+		name string
+		pkt  []byte
+		want int
+	}{
+		{"ipv4 udp", ipv4Packet(unix.IPPROTO_UDP, 20, 0, 40000, 123), udpSnapLen},
+		{"ipv4 udp with options", ipv4Packet(unix.IPPROTO_UDP, 24, 0x4000, 40000, 123), udpSnapLen},
+		{"ipv4 udp fragment", ipv4Packet(unix.IPPROTO_UDP, 20, 0x0010, 40000, 123), 0},
+		{"ipv4 tcp", ipv4Packet(unix.IPPROTO_TCP, 20, 0, 40000, 443), 0},
+		{"ipv6 udp", ipv6Packet(unix.IPPROTO_UDP, 40000, 443), udpSnapLen},
+		{"ipv6 tcp", ipv6Packet(unix.IPPROTO_TCP, 40000, 443), 0},
+		{"ipv6 extension header", ipv6Packet(0, 40000, 443), 0},
+		{"not ip", []byte{0x00, 0x01, 0x02}, 0},
+	}
+	for _, tt := range tests {
+		if got := runFilter(t, udpFilter, tt.pkt); got != tt.want {
+			t.Errorf("%s: udpFilter = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseUDP(t *testing.T) {
+	src, dst, srcPort, dstPort, _, ok := parseUDP(ipv4Packet(unix.IPPROTO_UDP, 24, 0, 40000, 123))
+	if !ok || !src.Equal(net.ParseIP("10.0.0.1")) || !dst.Equal(net.ParseIP("10.0.0.2")) || srcPort != 40000 || dstPort != 123 {
+		t.Errorf("parseUDP ipv4 = %v %v %d %d %v", src, dst, srcPort, dstPort, ok)
+	}
+	src, dst, srcPort, dstPort, _, ok = parseUDP(ipv6Packet(unix.IPPROTO_UDP, 40000, 443))
+	if !ok || !src.Equal(net.ParseIP("2001:db8::1")) || !dst.Equal(net.ParseIP("2001:db8::2")) || srcPort != 40000 || dstPort != 443 {
+		t.Errorf("parseUDP ipv6 = %v %v %d %d %v", src, dst, srcPort, dstPort, ok)
+	}
+	if _, _, _, _, _, ok := parseUDP([]byte{0x45, 0x00}); ok {
+		t.Error("parseUDP accepted a truncated packet")
+	}
+}
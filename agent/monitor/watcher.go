@@ -0,0 +1,273 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// 监控目录配置的检查间隔，与agent配置刷新间隔一致
+	rootRefreshWait = time.Second * 60
+	// 监控数量达到上限时，这个时间内只上报一次
+	watchLimitWait = time.Hour
+)
+
+// watchRoot 监控目录，recursive为true时包含所有子目录
+type watchRoot struct {
+	path      string
+	recursive bool
+}
+
+// contains 判断文件是否在监控目录下
+func (r watchRoot) contains(path string) bool {
+	if r.recursive {
+		sep := string(filepath.Separator)
+		return path != r.path && strings.HasPrefix(path, strings.TrimRight(r.path, sep)+sep)
+	}
+	return filepath.Dir(path) == r.path
+}
+
+// dirWatcher 维护fsnotify的监控目录：递归目录下新建的子目录自动加入监控，
+// 删除或移走的目录移除监控，配置的监控目录变化时增量调整
+type dirWatcher struct {
+	sync.RWMutex
+	watcher    *fsnotify.Watcher
+	resultChan chan map[string]string
+	roots      []watchRoot
+	dirs       map[string]bool     // 已添加监控的目录
+	seed       func(dir string)    // 新增监控目录时记录文件属性
+	forget     func(dirs []string) // 移除监控目录时清理文件属性
+	limitTime  time.Time
+	limitEvent map[string]string // 待上报的监控数量上限事件，释放锁后发送
+}
+
+func newDirWatcher(watcher *fsnotify.Watcher, resultChan chan map[string]string, seed func(dir string), forget func(dirs []string)) *dirWatcher {
+	return &dirWatcher{
+		watcher:    watcher,
+		resultChan: resultChan,
+		dirs:       make(map[string]bool),
+		seed:       seed,
+		forget:     forget,
+	}
+}
+
+// isRoot 是否为配置的监控目录，监控目录本身的事件不上报
+func (w *dirWatcher) isRoot(path string) bool {
+	w.RLock()
+	defer w.RUnlock()
+	path = pathKey(path)
+	for _, r := range w.roots {
+		if r.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// root 返回文件所在的监控目录
+func (w *dirWatcher) root(path string) (watchRoot, bool) {
+	w.RLock()
+	defer w.RUnlock()
+	path = pathKey(path)
+	for _, r := range w.roots {
+		if r.contains(path) {
+			return r, true
+		}
+	}
+	return watchRoot{}, false
+}
+
+// reconcile 按新的监控目录列表调整监控，返回新增的监控目录
+func (w *dirWatcher) reconcile(roots []watchRoot) []watchRoot {
+	w.Lock()
+	defer w.unlock()
+	old := w.roots
+	w.roots = roots
+	for _, r := range old {
+		if !hasRoot(roots, r) {
+			w.removeRoot(r)
+		}
+	}
+	var added []watchRoot
+	for _, r := range roots {
+		// 已有的监控目录被删除后重建或之前因数量上限未添加成功的，重新添加
+		if hasRoot(old, r) {
+			if _, err := os.Stat(r.path); err != nil || w.dirs[r.path] {
+				continue
+			}
+		}
+		if r.recursive {
+			w.addTree(r.path)
+		} else {
+			w.addDir(r.path)
+		}
+		if !hasRoot(old, r) {
+			added = append(added, r)
+		}
+	}
+	if len(added) != 0 || len(old) != len(roots) {
+		log.Println("File monitor watching", len(w.dirs), "directories")
+	}
+	return added
+}
+
+// handle 跟踪目录的新建、删除和移动
+func (w *dirWatcher) handle(event fsnotify.Event) {
+	name := pathKey(event.Name)
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		w.Lock()
+		if w.dirs[name] {
+			w.removeTree(name)
+		}
+		w.unlock()
+		return
+	}
+	if event.Op&fsnotify.Create == 0 {
+		return
+	}
+	r, ok := w.root(name)
+	if !ok || !r.recursive {
+		return
+	}
+	// 不跟随软链接，避免监控到目录外或形成循环
+	if f, err := os.Lstat(event.Name); err != nil || !f.IsDir() {
+		return
+	}
+	w.Lock()
+	w.addTree(name)
+	w.unlock()
+}
+
+// unlock 释放写锁后再上报监控数量上限事件，避免resultChan阻塞时isRoot、root等待锁
+func (w *dirWatcher) unlock() {
+	event := w.limitEvent
+	w.limitEvent = nil
+	w.Unlock()
+	if event != nil {
+		w.resultChan <- event
+	}
+}
+
+func (w *dirWatcher) addTree(root string) {
+	filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			log.Println(err.Error())
+			return nil
+		}
+		if !f.IsDir() {
+			return nil
+		}
+		// 达到上限后剩余目录也无法添加，直接结束
+		return w.addDir(pathKey(path))
+	})
+}
+
+func (w *dirWatcher) addDir(dir string) error {
+	if w.dirs[dir] {
+		return nil
+	}
+	if err := w.watcher.Add(dir); err != nil {
+		// inotify监控数量超过fs.inotify.max_user_watches时返回ENOSPC
+		if errors.Is(err, syscall.ENOSPC) {
+			w.watchLimit(dir)
+			return err
+		}
+		log.Println(err)
+		return nil
+	}
+	w.dirs[dir] = true
+	if w.seed != nil {
+		w.seed(dir)
+	}
+	return nil
+}
+
+// removeTree 移除目录及其子目录的监控
+func (w *dirWatcher) removeTree(dir string) {
+	sep := string(filepath.Separator)
+	prefix := strings.TrimRight(dir, sep) + sep
+	var removed []string
+	for d := range w.dirs {
+		if d == dir || strings.HasPrefix(d, prefix) {
+			// 已删除的目录内核会自动移除监控，这里忽略错误
+			w.watcher.Remove(d)
+			delete(w.dirs, d)
+			removed = append(removed, d)
+		}
+	}
+	w.forgetDirs(removed)
+}
+
+// removeRoot 移除不再配置的监控目录，仍被其他监控目录包含的保留
+func (w *dirWatcher) removeRoot(r watchRoot) {
+	var removed []string
+	if !r.recursive {
+		if w.dirs[r.path] && !w.covered(r.path) {
+			w.watcher.Remove(r.path)
+			delete(w.dirs, r.path)
+			removed = append(removed, r.path)
+		}
+		w.forgetDirs(removed)
+		return
+	}
+	sep := string(filepath.Separator)
+	prefix := strings.TrimRight(r.path, sep) + sep
+	for d := range w.dirs {
+		if (d == r.path || strings.HasPrefix(d, prefix)) && !w.covered(d) {
+			w.watcher.Remove(d)
+			delete(w.dirs, d)
+			removed = append(removed, d)
+		}
+	}
+	w.forgetDirs(removed)
+}
+
+func (w *dirWatcher) forgetDirs(dirs []string) {
+	if w.forget != nil && len(dirs) != 0 {
+		w.forget(dirs)
+	}
+}
+
+func (w *dirWatcher) covered(dir string) bool {
+	for _, r := range w.roots {
+		if r.path == dir || (r.recursive && r.contains(dir)) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchLimit 监控数量达到系统上限，记录事件，由unlock上报给server
+func (w *dirWatcher) watchLimit(dir string) {
+	if time.Since(w.limitTime) < watchLimitWait {
+		return
+	}
+	w.limitTime = time.Now()
+	log.Println("File monitor watch limit reached:", len(w.dirs), "directories watched, skip", dir)
+	w.limitEvent = map[string]string{
+		"source":  "file",
+		"action":  "WATCHLIMIT",
+		"path":    dir,
+		"hash":    "",
+		"user":    "",
+		"watches": fmt.Sprintf("%d", len(w.dirs)),
+	}
+}
+
+func hasRoot(roots []watchRoot, r watchRoot) bool {
+	for _, v := range roots {
+		if v == r {
+			return true
+		}
+	}
+	return false
+}
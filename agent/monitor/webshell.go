@@ -0,0 +1,165 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"yulong-hids/agent/common"
+)
+
+const (
+	// 超过这个大小的文件不做webshell检测
+	webshellSize int64 = 2048000
+	// 脚本文件的字节熵超过该值且有超长行时认为经过混淆
+	obfuscatedEntropy = 5.5
+	obfuscatedLine    = 1000
+)
+
+var (
+	// 脚本文件后缀，熵值和长编码串只对脚本文件检测
+	scriptExt = regexp.MustCompile(`(?i)\.(php[1-5]?|phtml|inc|jsp|jspx|jspf|asp|aspx|ashx|asmx|asa|cer|cfm)$`)
+	// 执行解码后的内容，如 eval(base64_decode(...))、assert(gzinflate(...))
+	decodeChain = regexp.MustCompile(`(?i)(eval|assert|create_function|call_user_func)\s*\(\s*@?\s*(base64_decode|gzinflate|gzuncompress|gzdecode|str_rot13|strrev|rawurldecode|hex2bin|convert_uudecode)\s*\(`)
+	longBase64  = regexp.MustCompile(`[A-Za-z0-9+/]{1000,}={0,2}`)
+)
+
+// webshellRule 编译后的特征规则，reg为nil表示规则错误
+type webshellRule struct {
+	name string
+	reg  *regexp.Regexp
+}
+
+// webshellRules 编译后的特征规则缓存，配置中的规则列表变化时重新编译
+var webshellRules = struct {
+	sync.Mutex
+	source []string
+	rules  []webshellRule
+}{}
+
+// scanWebshell 对web目录下的文件做静态特征和启发式检测，返回命中的规则名，多个以|分隔
+func scanWebshell(path string) string {
+	if !common.Config.Webshell.Switch || !isWebPath(path) {
+		return ""
+	}
+	f, err := os.Stat(path)
+	if err != nil || f.IsDir() || f.Size() == 0 || f.Size() > webshellSize {
+		return ""
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	var result []string
+	for _, rule := range compiledWebshellRules(common.Config.Webshell.Rules) {
+		if rule.reg != nil && rule.reg.Match(content) {
+			result = append(result, rule.name)
+		}
+	}
+	if decodeChain.Match(content) {
+		result = append(result, "decode-chain")
+	}
+	if scriptExt.MatchString(path) {
+		if longBase64.Match(content) {
+			result = append(result, "long-base64")
+		}
+		if maxLineLen(content) >= obfuscatedLine && entropy(content) >= obfuscatedEntropy {
+			result = append(result, "obfuscated")
+		}
+	}
+	return strings.Join(result, "|")
+}
+
+// compiledWebshellRules 返回规则列表编译后的结果，列表与上次相同时使用缓存，
+// 不同时整体重新编译，旧的规则随之释放
+func compiledWebshellRules(source []string) []webshellRule {
+	webshellRules.Lock()
+	defer webshellRules.Unlock()
+	if sameRules(webshellRules.source, source) && webshellRules.rules != nil {
+		return webshellRules.rules
+	}
+	rules := make([]webshellRule, 0, len(source))
+	for _, rule := range source {
+		rules = append(rules, parseWebshellRule(rule))
+	}
+	// 错误的规则也缓存，避免重复输出日志
+	webshellRules.source = append([]string(nil), source...)
+	webshellRules.rules = rules
+	return rules
+}
+
+// parseWebshellRule 解析 名称:正则 格式的特征规则，正则不区分大小写
+func parseWebshellRule(rule string) webshellRule {
+	i := strings.Index(rule, ":")
+	if i <= 0 {
+		log.Println("Webshell rule error:", rule)
+		return webshellRule{name: rule}
+	}
+	reg, err := regexp.Compile("(?i)" + rule[i+1:])
+	if err != nil {
+		log.Println("Webshell rule error:", rule, err)
+		reg = nil
+	}
+	return webshellRule{name: rule[:i], reg: reg}
+}
+
+func sameRules(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isWebPath 判断文件是否在识别出的web目录下
+func isWebPath(path string) bool {
+	path = pathKey(path)
+	sep := string(filepath.Separator)
+	for _, webPath := range common.ServerInfo.Path {
+		if strings.HasPrefix(path, strings.TrimRight(pathKey(webPath), sep)+sep) {
+			return true
+		}
+	}
+	return false
+}
+
+// entropy 字节的香农熵，正常代码一般在4.5~5.2之间，编码或加密后的内容接近6
+func entropy(content []byte) float64 {
+	var count [256]float64
+	for _, b := range content {
+		count[b]++
+	}
+	var e float64
+	total := float64(len(content))
+	for _, c := range count {
+		if c == 0 {
+			continue
+		}
+		p := c / total
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+func maxLineLen(content []byte) int {
+	max, n := 0, 0
+	for _, b := range content {
+		if b == '\n' {
+			n = 0
+			continue
+		}
+		n++
+		if n > max {
+			max = n
+		}
+	}
+	return max
+}
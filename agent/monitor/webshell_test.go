@@ -0,0 +1,142 @@
+package monitor
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"yulong-hids/agent/common"
+)
+
+// randomText 固定种子的随机内容，chars为可用的字符
+func randomText(seed int64, n int, chars string) string {
+	r := rand.New(rand.NewSource(seed))
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = chars[r.Intn(len(chars))]
+	}
+	return string(b)
+}
+
+func randomBase64(seed int64, n int) string {
+	r := rand.New(rand.NewSource(seed))
+	b := make([]byte, n)
+	r.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func TestScanWebshell(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webshell")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	webDir := filepath.Join(dir, "www")
+	if err := os.Mkdir(webDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	config, serverInfo := common.Config, common.ServerInfo
+	defer func() { common.Config, common.ServerInfo = config, serverInfo }()
+	common.Config.Webshell.Switch = true
+	common.Config.Webshell.Rules = []string{`post-eval:eval\s*\(\s*\$_(post|get|request)`, `bad-rule:(`}
+	common.ServerInfo.Path = []string{webDir}
+
+	printable := "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!#$%&()*+,-./:;<=>?@[]^_{|}~"
+	// 压缩成一行的框架代码，行很长但熵不高
+	minified := "<?php " + strings.Repeat(`namespace Vendor\Lib;class Cache{private $items=array();public function get($key,$default=null){return isset($this->items[$key])?$this->items[$key]:$default;}public function set($key,$value){$this->items[$key]=$value;return $this;}}`, 20)
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{"benign php", "index.php", "<?php\n$name = htmlspecialchars($_GET['name']);\necho \"Hello, $name\";\n", ""},
+		{"benign jsp", "index.jsp", "<%@ page contentType=\"text/html\" %>\n<% out.println(request.getParameter(\"id\")); %>\n", ""},
+		{"minified vendor php", "vendor.php", minified, ""},
+		// 非脚本文件中的长编码串（如字体的data URI）不算
+		{"vendor js with data uri", "font.js", "var font='data:font/woff2;base64," + randomBase64(1, 3000) + "';", ""},
+		{"image", "logo.png", randomText(2, 5000, printable), ""},
+		{"rule", "a.php", "<?php @eval($_POST['cmd']); ?>", "post-eval"},
+		{"decode chain", "b.php", "<?php eval(base64_decode('ZWNobyAxOw==')); ?>", "decode-chain"},
+		{"decode chain with spaces", "b2.php", "<?php assert ( @gzinflate(base64_decode($x))); ?>", "decode-chain"},
+		// 编码串本身熵值高且为超长行，同时命中混淆
+		{"long base64", "c.php", "<?php $a='" + randomBase64(3, 1500) + "';\n$f=$a;", "long-base64|obfuscated"},
+		{"obfuscated", "d.php", "<?php $x=\"" + randomText(4, 3000, printable) + "\";", "obfuscated"},
+		{"obfuscated jspx", "e.jspx", randomText(5, 3000, printable), "obfuscated"},
+		{"several", "f.php", "<?php eval(str_rot13($_POST['x'])); eval($_POST['y']);", "post-eval|decode-chain"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(webDir, tt.file)
+		if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := scanWebshell(path); got != tt.want {
+			t.Errorf("%s: scanWebshell = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// web目录外、关闭检测时不检测
+	outside := filepath.Join(dir, "shell.php")
+	if err := ioutil.WriteFile(outside, []byte("<?php @eval($_POST['cmd']); ?>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := scanWebshell(outside); got != "" {
+		t.Errorf("scanWebshell(outside web dir) = %q", got)
+	}
+	common.Config.Webshell.Switch = false
+	if got := scanWebshell(filepath.Join(webDir, "a.php")); got != "" {
+		t.Errorf("scanWebshell(switch off) = %q", got)
+	}
+}
+
+func TestCompiledWebshellRules(t *testing.T) {
+	source := []string{`a:eval`, `b:assert`, `bad`, `c:(`}
+	rules := compiledWebshellRules(source)
+	if len(rules) != 4 || rules[0].name != "a" || rules[0].reg == nil || rules[2].reg != nil || rules[3].name != "c" || rules[3].reg != nil {
+		t.Fatalf("compiledWebshellRules = %+v", rules)
+	}
+	if !rules[0].reg.MatchString("EVAL(") {
+		t.Error("rule is case sensitive")
+	}
+	// 列表相同时使用缓存，修改调用方的列表不影响缓存
+	if again := compiledWebshellRules(append([]string(nil), source...)); &again[0] != &rules[0] {
+		t.Error("same rules were compiled again")
+	}
+	source[1] = `b:system`
+	changed := compiledWebshellRules(source)
+	if &changed[0] == &rules[0] || changed[1].reg.String() != "(?i)system" {
+		t.Errorf("changed rules were not compiled again: %+v", changed)
+	}
+	if shorter := compiledWebshellRules(source[:1]); len(shorter) != 1 {
+		t.Errorf("compiledWebshellRules(shorter) = %+v", shorter)
+	}
+	if empty := compiledWebshellRules(nil); len(empty) != 0 {
+		t.Errorf("compiledWebshellRules(nil) = %+v", empty)
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	tests := []struct {
+		content string
+		want    float64
+	}{
+		{"aaaa", 0},
+		{"abab", 1},
+		{"abcd", 2},
+	}
+	for _, tt := range tests {
+		if got := entropy([]byte(tt.content)); got != tt.want {
+			t.Errorf("entropy(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+	code := []byte("<?php\nfunction add($a, $b) {\n    return $a + $b;\n}\necho add(1, 2);\n")
+	if got := entropy(code); got >= obfuscatedEntropy {
+		t.Errorf("entropy(code) = %v, want < %v", got, obfuscatedEntropy)
+	}
+	if got := maxLineLen([]byte("ab\nabcd\nabc")); got != 4 {
+		t.Errorf("maxLineLen = %d, want 4", got)
+	}
+}
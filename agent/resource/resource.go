@@ -0,0 +1,157 @@
+// Package resource agent自身的资源控制，根据配置的CPU、内存上限限制agent的资源占用：
+// linux下支持cgroup v2时将agent放入独立的cgroup由内核限制，否则根据采样的CPU使用率自适应降速；
+// 同时对每种事件的回传频率限速，资源紧张时跳过文件hash计算，并统计丢弃的事件数量
+package resource
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"yulong-hids/agent/common"
+)
+
+const (
+	// 资源使用采样间隔
+	sampleWait = time.Second * 5
+	// 超出CPU上限时每次处理前的最大等待时间
+	maxDelay = time.Second
+	// 事件回传限速的统计周期
+	rateWindow = time.Minute
+)
+
+var (
+	lock        sync.Mutex
+	cpuUsage    float64 // 最近一次采样的CPU使用率，单核百分比
+	rss         uint64  // 最近一次采样的常驻内存，单位字节
+	delay       time.Duration
+	inCgroup    bool // 是否已由cgroup限制
+	lastCPU     time.Duration
+	lastSample  time.Time
+	window      time.Time
+	counter     = make(map[string]int)
+	dropped     = make(map[string]int)
+	hashSkipped int
+)
+
+// Start 开始资源采样，根据配置调整cgroup限制和降速等待时间
+func Start() {
+	go func() {
+		for {
+			sample()
+			time.Sleep(sampleWait)
+		}
+	}()
+}
+
+func sample() {
+	cpuTime := processCPUTime()
+	memory := processRSS()
+	limit := common.Config.Resource
+	cgroup := applyCgroup(limit.CPU, limit.Memory)
+	lock.Lock()
+	defer lock.Unlock()
+	now := time.Now()
+	if !lastSample.IsZero() && now.After(lastSample) {
+		cpuUsage = float64(cpuTime-lastCPU) / float64(now.Sub(lastSample)) * 100
+	}
+	lastCPU, lastSample, rss, inCgroup = cpuTime, now, memory, cgroup
+	// cgroup生效时由内核限制CPU，不再自行降速
+	if !inCgroup && limit.CPU > 0 && cpuUsage > float64(limit.CPU) {
+		delay = delay * 2
+		if delay < time.Millisecond*10 {
+			delay = time.Millisecond * 10
+		}
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	} else {
+		delay = delay / 2
+		if delay < time.Millisecond {
+			delay = 0
+		}
+	}
+	// 超出内存上限时尽快归还空闲内存
+	if limit.Memory > 0 && rss > uint64(limit.Memory)<<20 {
+		go debug.FreeOSMemory()
+	}
+}
+
+// Wait 超出CPU上限时在处理事件、遍历进程等循环中等待，降低agent的CPU占用
+func Wait() {
+	lock.Lock()
+	d := delay
+	lock.Unlock()
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// Pressure CPU或内存超出上限
+func Pressure() bool {
+	limit := common.Config.Resource
+	lock.Lock()
+	defer lock.Unlock()
+	return (limit.CPU > 0 && cpuUsage > float64(limit.CPU)) ||
+		(limit.Memory > 0 && rss > uint64(limit.Memory)<<20)
+}
+
+// SkipHash 资源紧张时跳过文件hash计算，返回true表示应跳过
+func SkipHash() bool {
+	if !Pressure() {
+		return false
+	}
+	lock.Lock()
+	hashSkipped++
+	lock.Unlock()
+	return true
+}
+
+// Allow 事件回传限速，每种事件每分钟超过上限的部分丢弃并计数
+func Allow(source string) bool {
+	rate := common.Config.Resource.Rate
+	lock.Lock()
+	defer lock.Unlock()
+	now := time.Now()
+	if now.Sub(window) >= rateWindow {
+		window = now
+		counter = make(map[string]int)
+	}
+	counter[source]++
+	if rate > 0 && counter[source] > rate {
+		dropped[source]++
+		return false
+	}
+	return true
+}
+
+// Stat agent自身的资源使用情况，作为agentstat类型回传，丢弃和跳过的数量为agent启动后的累计值
+func Stat() map[string]string {
+	limit := common.Config.Resource
+	lock.Lock()
+	defer lock.Unlock()
+	var droppedList []string
+	total := 0
+	for source, n := range dropped {
+		droppedList = append(droppedList, fmt.Sprintf("%s:%d", source, n))
+		total += n
+	}
+	sort.Strings(droppedList)
+	return map[string]string{
+		"cpu":         strconv.FormatFloat(cpuUsage, 'f', 1, 64),
+		"rss":         strconv.FormatUint(rss>>20, 10),
+		"cpulimit":    strconv.Itoa(limit.CPU),
+		"memorylimit": strconv.Itoa(limit.Memory),
+		"ratelimit":   strconv.Itoa(limit.Rate),
+		"cgroup":      strconv.FormatBool(inCgroup),
+		"throttle":    strconv.FormatInt(int64(delay/time.Millisecond), 10),
+		"dropped":     strings.Join(droppedList, "|"),
+		"droppedsum":  strconv.Itoa(total),
+		"hashskipped": strconv.Itoa(hashSkipped),
+		"goroutine":   strconv.Itoa(runtime.NumGoroutine()),
+	}
+}
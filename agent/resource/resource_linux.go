@@ -0,0 +1,208 @@
+//go:build linux
+// +build linux
+
+package resource
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	cgroupRoot = "/sys/fs/cgroup"
+	// agent的子cgroup，创建在agent原来所在的cgroup（通常为daemon服务的cgroup）下。cgroup v2中
+	// 有进程的cgroup不能给子cgroup开启控制器，所以daemon也移入同级的子cgroup
+	cgroupName       = "yulong-hids-agent"
+	cgroupDaemonName = "yulong-hids-daemon"
+	// cpu.max的周期，单位微秒
+	cpuPeriod = 100000
+)
+
+var (
+	cgroupApplied string // 已写入cgroup的限制，配置变化时才重新写入
+	cgroupPlaced  bool
+	cgroupDir     string // agent所在的子cgroup目录
+	cgroupFailed  bool
+)
+
+func processCPUTime() time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+// processRSS 从 /proc/self/statm 读取常驻内存页数
+func processRSS() uint64 {
+	data, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, _ := strconv.ParseUint(fields[1], 10, 64)
+	return pages * uint64(os.Getpagesize())
+}
+
+// applyCgroup 支持cgroup v2时将agent放入独立的cgroup，通过cpu.max限制CPU、memory.high限制内存
+// （超出时内核回收内存而不是直接kill），返回CPU是否由cgroup限制
+func applyCgroup(cpu int, memory int) bool {
+	if cgroupFailed {
+		return false
+	}
+	limit := strconv.Itoa(cpu) + "|" + strconv.Itoa(memory)
+	if limit == cgroupApplied {
+		return cgroupPlaced && cpu > 0
+	}
+	// 未配置限制且未放入cgroup时不做处理
+	if !cgroupPlaced && cpu <= 0 && memory <= 0 {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		log.Println("cgroup v2 not available, use adaptive throttling")
+		cgroupFailed = true
+		return false
+	}
+	if !cgroupPlaced {
+		dir, err := placeCgroup()
+		if err != nil {
+			log.Println("cgroup placement error, use adaptive throttling:", err)
+			cgroupFailed = true
+			return false
+		}
+		cgroupDir, cgroupPlaced = dir, true
+	}
+	dir := cgroupDir
+	cpuMax := "max " + strconv.Itoa(cpuPeriod)
+	if cpu > 0 {
+		cpuMax = strconv.Itoa(cpu*cpuPeriod/100) + " " + strconv.Itoa(cpuPeriod)
+	}
+	memoryHigh := "max"
+	if memory > 0 {
+		memoryHigh = strconv.Itoa(memory << 20)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "cpu.max"), []byte(cpuMax), 0644); err != nil {
+		log.Println("cgroup cpu.max error:", err)
+		cgroupFailed = true
+		return false
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "memory.high"), []byte(memoryHigh), 0644); err != nil {
+		log.Println("cgroup memory.high error:", err)
+	}
+	cgroupApplied = limit
+	return cpu > 0
+}
+
+// selfCgroup 从 /proc/self/cgroup 读取agent所在的cgroup v2路径（0::开头的行）
+func selfCgroup() string {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if path := strings.TrimPrefix(scanner.Text(), "0::"); path != scanner.Text() {
+			return path
+		}
+	}
+	return ""
+}
+
+// cgroupProcs cgroup中的进程
+func cgroupProcs(dir string) []string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(data))
+}
+
+// cgroupDelegated systemd管理的cgroup（.service、.scope）需要设置Delegate=yes才能创建子cgroup，
+// 否则违反systemd对cgroup的单一写入者规则。systemd 251以上会在委派的cgroup上设置trusted.delegate
+// 属性，低版本通过systemctl查询；不是systemd管理的cgroup只检查控制器
+func cgroupDelegated(self string, dir string) bool {
+	unit := filepath.Base(self)
+	if !strings.HasSuffix(unit, ".service") && !strings.HasSuffix(unit, ".scope") {
+		return true
+	}
+	for _, attr := range []string{"trusted.delegate", "user.delegate"} {
+		if _, err := unix.Getxattr(dir, attr, nil); err == nil {
+			return true
+		}
+	}
+	out, err := exec.Command("systemctl", "show", "--property=Delegate", "--value", unit).Output()
+	return err == nil && strings.TrimSpace(string(out)) == "yes"
+}
+
+// placeCgroup 在agent所在的cgroup下创建子cgroup并移入agent，返回子cgroup目录。不修改根cgroup，
+// 所在cgroup需要已委派cpu和memory控制器（如systemd服务设置Delegate=yes），且只能有agent和
+// 启动agent的daemon两个进程，daemon移入同级的子cgroup
+func placeCgroup() (string, error) {
+	self := selfCgroup()
+	// daemon重启agent时，新的agent继承daemon所在的子cgroup
+	if name := filepath.Base(self); name == cgroupName || name == cgroupDaemonName {
+		self = filepath.Dir(self)
+	}
+	if self == "" || self == "/" {
+		return "", errors.New("agent is in the root cgroup")
+	}
+	parent := filepath.Join(cgroupRoot, self)
+	data, err := ioutil.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+	if err != nil {
+		return "", err
+	}
+	controllers := strings.Fields(string(data))
+	if !inSlice("cpu", controllers) || !inSlice("memory", controllers) || !cgroupDelegated(self, parent) {
+		return "", errors.New("cpu and memory controllers are not delegated to " + self)
+	}
+	pid, ppid := strconv.Itoa(os.Getpid()), strconv.Itoa(os.Getppid())
+	for _, p := range cgroupProcs(parent) {
+		if p != pid && p != ppid {
+			return "", errors.New(self + " has other processes")
+		}
+	}
+	dir := filepath.Join(parent, cgroupName)
+	daemonDir := filepath.Join(parent, cgroupDaemonName)
+	for _, d := range []string{dir, daemonDir} {
+		if err := os.Mkdir(d, 0755); err != nil && !os.IsExist(err) {
+			return "", err
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(pid), 0644); err != nil {
+		return "", err
+	}
+	if inSlice(ppid, cgroupProcs(parent)) {
+		if err := ioutil.WriteFile(filepath.Join(daemonDir, "cgroup.procs"), []byte(ppid), 0644); err != nil {
+			return "", err
+		}
+	}
+	// 已开启时再次写入不会出错
+	if err := ioutil.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+cpu +memory"), 0644); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func inSlice(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -10,6 +10,7 @@ build 目录下文件如下:
 ├── agent|agent.exe    当前平台的agent可执行文件
 ├── daemon|daemon.exe  当前平台的daemon可执行文件
 ├── server|server.exe  当前平台的server可执行文件
+├── sigma|sigma.exe    sigma规则转换工具
 ├── rules.json         默认规则，供web安装时上传
 ├── web                web文件文件夹，包含web可执行文件和静态文件
 ├── linux-64.zip       包含着agent，daemon和依赖文件的压缩包，供web安装时上传
@@ -32,6 +33,7 @@ main_function_lst = {
     'agent': 'agent/agent.go',
     'daemon': 'daemon/daemon.go',
     'server': 'server/server.go',
+    'sigma': 'sigma/sigma.go',
     'web': 'web/main.go'
 }
 web_dir_lst = ['conf', 'https_cert', 'static', 'upload_files', 'views']
@@ -15,6 +15,7 @@ Task结构体,再执行Task的run方法,根据Type的类型不同执行处理(sw
 */
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/exec"
@@ -35,6 +36,38 @@ var (
 	registeredBool *bool
 )
 
+// systemdScript 在service包默认的systemd服务模板上增加Delegate=yes，
+// 委派cgroup后agent才能在服务的cgroup下创建子cgroup限制CPU和内存
+const systemdScript = `[Unit]
+Description={{.Description}}
+ConditionFileIsExecutable={{.Path|cmdEscape}}
+{{range $i, $dep := .Dependencies}} 
+{{$dep}} {{end}}
+
+[Service]
+StartLimitInterval=5
+StartLimitBurst=10
+ExecStart={{.Path|cmdEscape}}{{range .Arguments}} {{.|cmd}}{{end}}
+{{if .ChRoot}}RootDirectory={{.ChRoot|cmd}}{{end}}
+{{if .WorkingDirectory}}WorkingDirectory={{.WorkingDirectory|cmdEscape}}{{end}}
+{{if .UserName}}User={{.UserName}}{{end}}
+{{if .ReloadSignal}}ExecReload=/bin/kill -{{.ReloadSignal}} "$MAINPID"{{end}}
+{{if .PIDFile}}PIDFile={{.PIDFile|cmd}}{{end}}
+{{if and .LogOutput .HasOutputFileSupport -}}
+StandardOutput=file:/var/log/{{.Name}}.out
+StandardError=file:/var/log/{{.Name}}.err
+{{- end}}
+{{if gt .LimitNOFILE -1 }}LimitNOFILE={{.LimitNOFILE}}{{end}}
+{{if .Restart}}Restart={{.Restart}}{{end}}
+{{if .SuccessExitStatus}}SuccessExitStatus={{.SuccessExitStatus}}{{end}}
+RestartSec=120
+Delegate=yes
+EnvironmentFile=-/etc/sysconfig/{{.Name}}
+
+[Install]
+WantedBy=multi-user.target
+`
+
 //创建服务Service,以及Start run 方法
 type program struct{}
 
@@ -54,12 +87,24 @@ func (p *program) run() {
 	} else {
 		agentFilePath = common.InstallPath + "agent"
 	}
+	// 最近一小时内启动agent的时间，用于统计重启次数
+	var startList []time.Time
 	for {
+		now := time.Now()
+		var recent []time.Time
+		for _, t := range startList {
+			if now.Sub(t) < time.Hour {
+				recent = append(recent, t)
+			}
+		}
+		startList = append(recent, now)
 		common.M.Lock()
 		log.Println("Start Agent")
 		/*Command函数返回一个*Cmd，用于使用给出的参数执行name指定的程序。返回值只设定了Path和Args两个参数。
 		如果name不含路径分隔符，将使用LookPath获取完整路径；否则直接使用name。参数arg不应包含命令名。*/
 		common.Cmd = exec.Command(agentFilePath, common.ServerIP)
+		// 一小时内的重启次数传给agent，随健康状态回传，频繁重启时server产生告警
+		common.Cmd.Env = append(os.Environ(), fmt.Sprintf("YULONG_HIDS_RESTARTS=%d", len(startList)-1))
 		err := common.Cmd.Start() //开始执行Cmd中包含的命令,但并不会等待该命令完成即返回。Wait方法会返回命令的返回状态码并在命令返回后释放相关的资源。
 		common.M.Unlock()
 		if err == nil {
@@ -102,6 +147,7 @@ func main() {
 		DisplayName: "yulong-hids",
 		Description: "集实时监控、异常检测、集中管理为一体的主机安全监测系统",
 		Arguments:   []string{"-netloc", common.ServerIP}, //从命令行获取的ServerIP
+		Option:      service.KeyValue{"SystemdScript": systemdScript},
 	}
 	//生成daemon服务,TODO:将prg相应的方法注册给Service?
 	prg := &program{}
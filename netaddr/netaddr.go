@@ -0,0 +1,169 @@
+// Package netaddr IP地址的解析、分类和名单匹配，agent和server共用，同时支持IPv4和IPv6
+package netaddr
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	privateNets   = mustCIDR("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+	linkLocalNets = mustCIDR("169.254.0.0/16", "fe80::/10")
+	cgnatNets     = mustCIDR("100.64.0.0/10")
+)
+
+func mustCIDR(cidrList ...string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range cidrList {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// SplitHostPort 拆分地址和端口，兼容 ip、ip:port、[v6]:port、v6 及带zone的地址，没有端口时port为空
+func SplitHostPort(addr string) (string, string) {
+	addr = strings.TrimSpace(addr)
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		return stripZone(host), port
+	}
+	// 不带端口的IPv6地址包含多个冒号，不能按冒号拆分
+	if strings.Count(addr, ":") > 1 {
+		return stripZone(strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")), ""
+	}
+	return addr, ""
+}
+
+// Host 返回地址中的主机部分，IP地址统一为标准格式（IPv4映射的IPv6地址转为IPv4）
+func Host(addr string) string {
+	host, _ := SplitHostPort(addr)
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// Parse 解析地址中的IP，不是IP时返回nil
+func Parse(addr string) net.IP {
+	host, _ := SplitHostPort(addr)
+	return net.ParseIP(host)
+}
+
+// JoinHostPort 组合IP和端口，IPv6格式为[v6]:port
+func JoinHostPort(host string, port int) string {
+	return net.JoinHostPort(Host(host), strconv.Itoa(port))
+}
+
+func stripZone(host string) string {
+	if i := strings.LastIndex(host, "%"); i > 0 {
+		return host[:i]
+	}
+	return host
+}
+
+func inNets(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPrivate 私有地址，RFC1918和IPv6的fc00::/7
+func IsPrivate(addr string) bool {
+	ip := Parse(addr)
+	return ip != nil && inNets(ip, privateNets)
+}
+
+// IsLoopback 回环地址
+func IsLoopback(addr string) bool {
+	ip := Parse(addr)
+	return ip != nil && ip.IsLoopback()
+}
+
+// IsLinkLocal 链路本地地址，169.254.0.0/16和fe80::/10
+func IsLinkLocal(addr string) bool {
+	ip := Parse(addr)
+	return ip != nil && inNets(ip, linkLocalNets)
+}
+
+// IsCGNAT 运营商级NAT地址100.64.0.0/10
+func IsCGNAT(addr string) bool {
+	ip := Parse(addr)
+	return ip != nil && inNets(ip, cgnatNets)
+}
+
+// IsLan 是否为内网地址，包括私有、回环、链路本地和CGNAT地址，无法解析的地址返回false
+func IsLan(addr string) bool {
+	switch Class(addr) {
+	case "private", "loopback", "linklocal", "cgnat":
+		return true
+	}
+	return false
+}
+
+// Class 地址分类：loopback、private、linklocal、cgnat、unspecified、multicast、public，无法解析时为空
+func Class(addr string) string {
+	ip := Parse(addr)
+	switch {
+	case ip == nil:
+		return ""
+	case ip.IsUnspecified():
+		return "unspecified"
+	case ip.IsLoopback():
+		return "loopback"
+	case inNets(ip, privateNets):
+		return "private"
+	case inNets(ip, linkLocalNets):
+		return "linklocal"
+	case inNets(ip, cgnatNets):
+		return "cgnat"
+	case ip.IsMulticast():
+		return "multicast"
+	}
+	return "public"
+}
+
+// InList 判断地址是否在名单中，名单项可以是IP或CIDR网段，非IP的项按字符串比较（不区分大小写）
+func InList(list []string, addr string) bool {
+	ip := Parse(addr)
+	host := Host(addr)
+	for _, v := range list {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if strings.Contains(v, "/") {
+			if _, n, err := net.ParseCIDR(v); err == nil {
+				if ip != nil && n.Contains(ip) {
+					return true
+				}
+				continue
+			}
+		}
+		if vip := net.ParseIP(v); vip != nil {
+			if ip != nil && vip.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(v, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid 名单项是否为合法的IP或CIDR网段
+func Valid(item string) bool {
+	item = strings.TrimSpace(item)
+	if _, _, err := net.ParseCIDR(item); err == nil {
+		return true
+	}
+	return net.ParseIP(item) != nil
+}
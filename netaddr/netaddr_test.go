@@ -0,0 +1,154 @@
+package netaddr
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSplitHostPort(t *testing.T) {
+	tests := []struct {
+		addr string
+		host string
+		port string
+	}{
+		{"10.0.0.1", "10.0.0.1", ""},
+		{"10.0.0.1:80", "10.0.0.1", "80"},
+		{" 10.0.0.1:80 ", "10.0.0.1", "80"},
+		{"2001:db8::1", "2001:db8::1", ""},
+		{"[2001:db8::1]:443", "2001:db8::1", "443"},
+		{"[2001:db8::1]", "2001:db8::1", ""},
+		{"fe80::1%eth0", "fe80::1", ""},
+		{"[fe80::1%eth0]:22", "fe80::1", "22"},
+		{"example.com:8080", "example.com", "8080"},
+	}
+	for _, tt := range tests {
+		host, port := SplitHostPort(tt.addr)
+		if host != tt.host || port != tt.port {
+			t.Errorf("SplitHostPort(%q) = %q, %q, want %q, %q", tt.addr, host, port, tt.host, tt.port)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		addr string
+		want net.IP
+	}{
+		{"10.0.0.1", net.ParseIP("10.0.0.1")},
+		{"10.0.0.1:80", net.ParseIP("10.0.0.1")},
+		{"::ffff:10.0.0.1", net.ParseIP("10.0.0.1")},
+		{"[2001:db8::1]:443", net.ParseIP("2001:db8::1")},
+		{"fe80::1%eth0", net.ParseIP("fe80::1")},
+		{"example.com", nil},
+		{"10.0.0.256", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.addr); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestHostAndJoin(t *testing.T) {
+	if got := Host("::ffff:10.0.0.1"); got != "10.0.0.1" {
+		t.Errorf("Host = %q, want 10.0.0.1", got)
+	}
+	if got := Host("[2001:DB8:0::1]:80"); got != "2001:db8::1" {
+		t.Errorf("Host = %q, want 2001:db8::1", got)
+	}
+	if got := JoinHostPort("10.0.0.1", 80); got != "10.0.0.1:80" {
+		t.Errorf("JoinHostPort = %q, want 10.0.0.1:80", got)
+	}
+	if got := JoinHostPort("2001:db8::1", 443); got != "[2001:db8::1]:443" {
+		t.Errorf("JoinHostPort = %q, want [2001:db8::1]:443", got)
+	}
+}
+
+func TestClass(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+		lan  bool
+	}{
+		{"127.0.0.1", "loopback", true},
+		{"::1", "loopback", true},
+		{"10.1.2.3:22", "private", true},
+		{"172.31.255.255", "private", true},
+		{"172.32.0.1", "public", false},
+		{"192.168.1.1", "private", true},
+		{"fd00::1", "private", true},
+		{"169.254.1.1", "linklocal", true},
+		{"[fe80::1%eth0]:22", "linklocal", true},
+		{"100.64.0.1", "cgnat", true},
+		{"100.128.0.1", "public", false},
+		{"0.0.0.0", "unspecified", false},
+		{"::", "unspecified", false},
+		{"224.0.0.1", "multicast", false},
+		{"ff02::1", "multicast", false},
+		{"8.8.8.8", "public", false},
+		{"2001:4860:4860::8888", "public", false},
+		{"example.com", "", false},
+	}
+	for _, tt := range tests {
+		if got := Class(tt.addr); got != tt.want {
+			t.Errorf("Class(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+		if got := IsLan(tt.addr); got != tt.lan {
+			t.Errorf("IsLan(%q) = %v, want %v", tt.addr, got, tt.lan)
+		}
+	}
+}
+
+func TestInList(t *testing.T) {
+	list := []string{"10.0.0.0/8", " 192.168.1.1 ", "2001:db8::/32", "::ffff:172.16.0.1", "Example.com", "", "bad/cidr"}
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"10.255.0.1", true},
+		{"10.0.0.1:8080", true},
+		{"11.0.0.1", false},
+		{"192.168.1.1", true},
+		{"192.168.1.2", false},
+		{"[2001:db8:1::5]:443", true},
+		{"2001:db9::1", false},
+		{"172.16.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"example.COM", true},
+		{"example.com:80", true},
+		{"bad/cidr", true},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := InList(list, tt.addr); got != tt.want {
+			t.Errorf("InList(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+	if InList(nil, "10.0.0.1") {
+		t.Error("InList(nil) = true")
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		item string
+		want bool
+	}{
+		{"10.0.0.1", true},
+		{" 10.0.0.0/8 ", true},
+		{"2001:db8::1", true},
+		{"2001:db8::/32", true},
+		{"10.0.0.0/33", false},
+		{"2001:db8::/129", false},
+		{"10.0.0.1-10.0.0.9", false},
+		{"10.0.0.1:80", false},
+		{"example.com", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.item); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.item, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+// Package profile 按主机分组下发的agent配置模板，server和web共用：
+// 全局配置（config中的client、filter、webshell、resource）为默认值，
+// 匹配主机的配置模板按优先级从低到高依次覆盖，得到每台主机最终生效的配置
+package profile
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"yulong-hids/netaddr"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Types 可被配置模板覆盖的配置类型，即agent配置的组成部分
+var Types = []string{"client", "filter", "webshell", "resource"}
+
+// Match 主机分组条件，不同条件之间为且，同一条件的多个值之间为或，没有任何条件时匹配所有主机
+type Match struct {
+	Tags   []string `bson:"tags"   json:"tags"`   // 主机标签
+	IP     []string `bson:"ip"     json:"ip"`     // IP、CIDR网段或 起始IP-结束IP 范围
+	System []string `bson:"system" json:"system"` // 系统，windows、linux或系统名称的一部分
+	Type   []string `bson:"type"   json:"type"`   // 主机类型或角色，如web、db
+}
+
+// Profile 配置模板，Config的键为配置类型，值为需要覆盖的配置项
+type Profile struct {
+	ID       bson.ObjectId `bson:"_id,omitempty" json:"_id,omitempty"`
+	Name     string        `bson:"name"     json:"name"`
+	Priority int           `bson:"priority" json:"priority"` // 优先级，数值大的后覆盖
+	Enabled  bool          `bson:"enabled"  json:"enabled"`
+	Match    Match         `bson:"match"    json:"match"`
+	Config   bson.M        `bson:"config"   json:"config"`
+}
+
+// Host 用于匹配配置模板的主机信息，来自client表
+type Host struct {
+	IP     string   `bson:"ip"`
+	System string   `bson:"system"`
+	Type   string   `bson:"type"`
+	Roles  []string `bson:"roles"`
+	Tags   []string `bson:"tags"`
+}
+
+// Matches 主机是否属于配置模板的分组
+func (m Match) Matches(host Host) bool {
+	if len(m.IP) > 0 && !matchIP(m.IP, host.IP) {
+		return false
+	}
+	if len(m.System) > 0 && !matchSystem(m.System, host.System) {
+		return false
+	}
+	if len(m.Type) > 0 && !matchAny(m.Type, append([]string{host.Type}, host.Roles...)) {
+		return false
+	}
+	if len(m.Tags) > 0 && !matchAny(m.Tags, host.Tags) {
+		return false
+	}
+	return true
+}
+
+func matchAny(list []string, values []string) bool {
+	for _, v := range list {
+		for _, value := range values {
+			if value != "" && strings.EqualFold(strings.TrimSpace(v), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchSystem linux匹配所有非windows主机，其它值匹配系统名称的一部分
+func matchSystem(list []string, system string) bool {
+	system = strings.ToLower(system)
+	for _, v := range list {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "" {
+			continue
+		}
+		if v == "linux" && system != "" && !strings.Contains(system, "windows") {
+			return true
+		}
+		if strings.Contains(system, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchIP(list []string, addr string) bool {
+	ip := netaddr.Parse(addr)
+	for _, v := range list {
+		if start, end, ok := parseRange(v); ok {
+			if ip != nil && inRange(ip, start, end) {
+				return true
+			}
+			continue
+		}
+		if netaddr.InList([]string{v}, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRange 解析 起始IP-结束IP 格式的范围
+func parseRange(item string) (net.IP, net.IP, bool) {
+	parts := strings.SplitN(item, "-", 2)
+	if len(parts) != 2 {
+		return nil, nil, false
+	}
+	start := net.ParseIP(strings.TrimSpace(parts[0]))
+	end := net.ParseIP(strings.TrimSpace(parts[1]))
+	if start == nil || end == nil || (start.To4() == nil) != (end.To4() == nil) {
+		return nil, nil, false
+	}
+	return start.To16(), end.To16(), true
+}
+
+func inRange(ip net.IP, start net.IP, end net.IP) bool {
+	ip = ip.To16()
+	return bytes.Compare(ip, start) >= 0 && bytes.Compare(ip, end) <= 0
+}
+
+// ValidIP 分组条件中的IP是否合法，支持IP、CIDR网段和 起始IP-结束IP 范围
+func ValidIP(item string) bool {
+	if _, _, ok := parseRange(item); ok {
+		return true
+	}
+	return netaddr.Valid(item)
+}
+
+// Resolve 按优先级从低到高（相同时按名称）依次将匹配主机的配置模板覆盖到默认配置上，
+// 配置项为对象时合并其中的键，为列表或其它值时整体替换，返回最终配置和生效的模板名称
+func Resolve(base map[string]bson.M, profiles []Profile, host Host) (map[string]bson.M, []string) {
+	resolved := make(map[string]bson.M)
+	for _, t := range Types {
+		resolved[t] = merge(bson.M{}, base[t])
+	}
+	sort.SliceStable(profiles, func(i, j int) bool {
+		if profiles[i].Priority != profiles[j].Priority {
+			return profiles[i].Priority < profiles[j].Priority
+		}
+		return profiles[i].Name < profiles[j].Name
+	})
+	applied := []string{}
+	for _, p := range profiles {
+		if !p.Enabled || !p.Match.Matches(host) {
+			continue
+		}
+		for _, t := range Types {
+			if dic, ok := toMap(p.Config[t]); ok {
+				resolved[t] = merge(resolved[t], dic)
+			}
+		}
+		applied = append(applied, p.Name)
+	}
+	return resolved, applied
+}
+
+// merge 将src合并到dst，两边都为对象的键递归合并
+func merge(dst bson.M, src bson.M) bson.M {
+	for k, v := range src {
+		if sub, ok := toMap(v); ok {
+			if old, ok := toMap(dst[k]); ok {
+				dst[k] = merge(merge(bson.M{}, old), sub)
+				continue
+			}
+			dst[k] = merge(bson.M{}, sub)
+			continue
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+func toMap(v interface{}) (bson.M, bool) {
+	switch m := v.(type) {
+	case bson.M:
+		return m, true
+	case map[string]interface{}:
+		return bson.M(m), true
+	}
+	return nil, false
+}
+
+// LoadBase 从数据库读取全局配置（config中各配置类型的dic），即没有配置模板时的默认配置
+func LoadBase(db *mgo.Database) (map[string]bson.M, error) {
+	base := make(map[string]bson.M)
+	for _, t := range Types {
+		var res struct {
+			Dic bson.M `bson:"dic"`
+		}
+		if err := db.C("config").Find(bson.M{"type": t}).One(&res); err != nil && err != mgo.ErrNotFound {
+			return nil, err
+		}
+		base[t] = res.Dic
+	}
+	return base, nil
+}
+
+// Load 从数据库读取默认配置、主机信息和配置模板，返回主机最终生效的配置和生效的模板名称
+func Load(db *mgo.Database, ip string) (map[string]bson.M, []string, error) {
+	base, err := LoadBase(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	host := Host{IP: ip}
+	if err := db.C("client").Find(bson.M{"ip": ip}).One(&host); err != nil && err != mgo.ErrNotFound {
+		return nil, nil, err
+	}
+	var profiles []Profile
+	if err := db.C("profile").Find(bson.M{"enabled": true}).All(&profiles); err != nil {
+		return nil, nil, err
+	}
+	resolved, applied := Resolve(base, profiles, host)
+	return resolved, applied, nil
+}
+
+// Decode 将合并后的配置项转换为对应的配置结构（result为结构体指针）。bson会忽略类型不符的字段，
+// 使agent得到零值，所以先按结构的字段类型检查配置项，类型不符时返回错误，结构中没有的配置项不检查
+func Decode(dic bson.M, result interface{}) error {
+	if len(dic) == 0 {
+		return nil
+	}
+	t := reflect.TypeOf(result).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := strings.Split(field.Tag.Get("bson"), ",")[0]
+		if key == "" {
+			key = strings.ToLower(field.Name)
+		}
+		if v, ok := dic[key]; ok && v != nil && !typeMatches(field.Type, v) {
+			return fmt.Errorf("config %s should be %s, got %T", key, field.Type, v)
+		}
+	}
+	data, err := bson.Marshal(dic)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, result)
+}
+
+// typeMatches 配置项的值是否能转换为字段的类型，json导入的整数为float64
+func typeMatches(t reflect.Type, v interface{}) bool {
+	switch t.Kind() {
+	case reflect.Int:
+		switch n := v.(type) {
+		case int, int32, int64:
+			return true
+		case float64:
+			return n == math.Trunc(n)
+		}
+		return false
+	case reflect.Bool:
+		_, ok := v.(bool)
+		return ok
+	case reflect.String:
+		_, ok := v.(string)
+		return ok
+	case reflect.Slice:
+		switch list := v.(type) {
+		case []string:
+			return true
+		case []interface{}:
+			for _, item := range list {
+				if _, ok := item.(string); !ok {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	}
+	return true
+}
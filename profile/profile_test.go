@@ -0,0 +1,152 @@
+package profile
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		item  string
+		ok    bool
+		start string
+		end   string
+	}{
+		{"10.0.0.1-10.0.0.9", true, "10.0.0.1", "10.0.0.9"},
+		{" 10.0.0.1 - 10.0.0.9 ", true, "10.0.0.1", "10.0.0.9"},
+		{"2001:db8::1-2001:db8::ff", true, "2001:db8::1", "2001:db8::ff"},
+		{"10.0.0.1-2001:db8::1", false, "", ""},
+		{"10.0.0.1", false, "", ""},
+		{"10.0.0.0/8", false, "", ""},
+		{"10.0.0.1-x", false, "", ""},
+	}
+	for _, tt := range tests {
+		start, end, ok := parseRange(tt.item)
+		if ok != tt.ok {
+			t.Errorf("parseRange(%q) ok = %v, want %v", tt.item, ok, tt.ok)
+			continue
+		}
+		if ok && (!start.Equal(net.ParseIP(tt.start)) || !end.Equal(net.ParseIP(tt.end))) {
+			t.Errorf("parseRange(%q) = %v-%v, want %s-%s", tt.item, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestValidIP(t *testing.T) {
+	for _, item := range []string{"10.0.0.1", "10.0.0.0/8", "10.0.0.1-10.0.0.9", "2001:db8::/32"} {
+		if !ValidIP(item) {
+			t.Errorf("ValidIP(%q) = false", item)
+		}
+	}
+	for _, item := range []string{"", "web", "10.0.0.1-2001:db8::1", "10.0.0.0/40"} {
+		if ValidIP(item) {
+			t.Errorf("ValidIP(%q) = true", item)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	web := Host{IP: "10.0.0.5", System: "CentOS Linux 7", Type: "web", Roles: []string{"nginx"}, Tags: []string{"prod"}}
+	win := Host{IP: "192.168.1.20", System: "Windows Server 2016", Type: "db", Tags: []string{"test"}}
+	tests := []struct {
+		name  string
+		match Match
+		host  Host
+		want  bool
+	}{
+		{"empty matches all", Match{}, win, true},
+		{"ip range", Match{IP: []string{"10.0.0.1-10.0.0.9"}}, web, true},
+		{"ip range miss", Match{IP: []string{"10.0.0.6-10.0.0.9"}}, web, false},
+		{"cidr", Match{IP: []string{"192.168.0.0/16"}}, win, true},
+		{"ip or", Match{IP: []string{"172.16.0.1", "10.0.0.5"}}, web, true},
+		{"linux", Match{System: []string{"linux"}}, web, true},
+		{"linux excludes windows", Match{System: []string{"linux"}}, win, false},
+		{"system substring", Match{System: []string{"windows server"}}, win, true},
+		{"type", Match{Type: []string{"WEB"}}, web, true},
+		{"role", Match{Type: []string{"nginx"}}, web, true},
+		{"type miss", Match{Type: []string{"db"}}, web, false},
+		{"tags", Match{Tags: []string{"prod"}}, web, true},
+		{"and", Match{IP: []string{"10.0.0.0/8"}, Tags: []string{"test"}}, web, false},
+	}
+	for _, tt := range tests {
+		if got := tt.match.Matches(tt.host); got != tt.want {
+			t.Errorf("%s: Matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	base := map[string]bson.M{
+		"client":   {"cycle": 1, "udp": false, "monitorPath": []interface{}{"/tmp"}},
+		"filter":   {"ip": []interface{}{"10.0.0.1"}},
+		"resource": {"cpu": 0, "limits": bson.M{"a": 1, "b": 2}},
+	}
+	profiles := []Profile{
+		{Name: "b-high", Priority: 10, Enabled: true, Config: bson.M{"client": bson.M{"cycle": 5}}},
+		{Name: "disabled", Priority: 20, Enabled: false, Config: bson.M{"client": bson.M{"cycle": 9}}},
+		{Name: "other", Priority: 30, Enabled: true, Match: Match{Tags: []string{"other"}}, Config: bson.M{"client": bson.M{"cycle": 9}}},
+		{Name: "a-low", Priority: 1, Enabled: true, Config: bson.M{
+			"client":   bson.M{"cycle": 3, "monitorPath": []interface{}{"/var/www"}},
+			"resource": map[string]interface{}{"limits": bson.M{"b": 3}},
+		}},
+		{Name: "a-high", Priority: 10, Enabled: true, Config: bson.M{"client": bson.M{"udp": true}}},
+	}
+	resolved, applied := Resolve(base, profiles, Host{IP: "10.0.0.5"})
+	if want := []string{"a-low", "a-high", "b-high"}; !reflect.DeepEqual(applied, want) {
+		t.Errorf("applied = %v, want %v", applied, want)
+	}
+	want := map[string]bson.M{
+		"client":   {"cycle": 5, "udp": true, "monitorPath": []interface{}{"/var/www"}},
+		"filter":   {"ip": []interface{}{"10.0.0.1"}},
+		"webshell": {},
+		"resource": {"cpu": 0, "limits": bson.M{"a": 1, "b": 3}},
+	}
+	if !reflect.DeepEqual(resolved, want) {
+		t.Errorf("resolved = %v, want %v", resolved, want)
+	}
+	// 合并不能修改全局配置
+	if base["resource"]["limits"].(bson.M)["b"] != 2 || base["client"]["cycle"] != 1 {
+		t.Errorf("base modified: %v", base)
+	}
+
+	resolved, applied = Resolve(base, nil, Host{})
+	if len(applied) != 0 || resolved["client"]["cycle"] != 1 {
+		t.Errorf("Resolve without profiles = %v %v", resolved, applied)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	type client struct {
+		Cycle       int      `bson:"cycle"`
+		UDP         bool     `bson:"udp"`
+		Mode        string   `bson:"mode"`
+		MonitorPath []string `bson:"monitorPath"`
+		Lasttime    string
+	}
+	var c client
+	err := Decode(bson.M{"cycle": 5.0, "udp": true, "mode": "x", "monitorPath": []interface{}{"/tmp"}, "lasttime": "all", "other": 1}, &c)
+	if want := (client{5, true, "x", []string{"/tmp"}, "all"}); err != nil || !reflect.DeepEqual(c, want) {
+		t.Errorf("Decode = %+v %v, want %+v", c, err, want)
+	}
+	tests := []bson.M{
+		{"cycle": "5"},
+		{"cycle": 1.5},
+		{"udp": "yes"},
+		{"mode": 1},
+		{"monitorPath": "/tmp"},
+		{"monitorPath": []interface{}{"/tmp", 1}},
+	}
+	for _, dic := range tests {
+		c := client{Cycle: 2, UDP: true}
+		if err := Decode(dic, &c); err == nil {
+			t.Errorf("Decode(%v) = %+v, want error", dic, c)
+		}
+	}
+	c = client{Cycle: 2}
+	if err := Decode(nil, &c); err != nil || c.Cycle != 2 {
+		t.Errorf("Decode(nil) = %+v %v", c, err)
+	}
+}
@@ -0,0 +1,94 @@
+package rule
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Tactic ATT&CK战术
+type Tactic struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	ShortName string `json:"shortname"` // sigma规则中的标签名，如attack.execution
+}
+
+// Tactics ATT&CK Enterprise的战术，按攻击阶段排序
+var Tactics = []Tactic{
+	{"TA0043", "Reconnaissance", "reconnaissance"},
+	{"TA0042", "Resource Development", "resource_development"},
+	{"TA0001", "Initial Access", "initial_access"},
+	{"TA0002", "Execution", "execution"},
+	{"TA0003", "Persistence", "persistence"},
+	{"TA0004", "Privilege Escalation", "privilege_escalation"},
+	{"TA0005", "Defense Evasion", "defense_evasion"},
+	{"TA0006", "Credential Access", "credential_access"},
+	{"TA0007", "Discovery", "discovery"},
+	{"TA0008", "Lateral Movement", "lateral_movement"},
+	{"TA0009", "Collection", "collection"},
+	{"TA0011", "Command and Control", "command_and_control"},
+	{"TA0010", "Exfiltration", "exfiltration"},
+	{"TA0040", "Impact", "impact"},
+}
+
+var techniqueID = regexp.MustCompile(`^T\d{4}(\.\d{3})?$`)
+
+// ValidTechnique 技术ID格式是否正确，如T1059、T1059.004
+func ValidTechnique(id string) bool {
+	return techniqueID.MatchString(id)
+}
+
+// ValidTactic 是否为ATT&CK的战术ID
+func ValidTactic(id string) bool {
+	for _, t := range Tactics {
+		if t.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAttack 校验规则中的ATT&CK技术和战术ID
+func validateAttack(m Meta) error {
+	for _, id := range m.Technique {
+		if !ValidTechnique(id) {
+			return fmt.Errorf("meta.technique 中的 %s 格式错误，应为T1059或T1059.004", id)
+		}
+	}
+	for _, id := range m.Tactic {
+		if !ValidTactic(id) {
+			return fmt.Errorf("meta.tactic 中的 %s 不是ATT&CK的战术ID（TA0001-TA0043）", id)
+		}
+	}
+	return nil
+}
+
+// attackFromTags 从sigma规则的标签中解析ATT&CK技术和战术，如attack.t1059.001、attack.execution
+func attackFromTags(tags []string) ([]string, []string) {
+	var techniques, tactics []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !strings.HasPrefix(tag, "attack.") {
+			continue
+		}
+		name := strings.TrimPrefix(tag, "attack.")
+		if id := strings.ToUpper(name); ValidTechnique(id) {
+			techniques = appendUnique(techniques, id)
+			continue
+		}
+		name = strings.Replace(name, "-", "_", -1)
+		for _, t := range Tactics {
+			if t.ShortName == name {
+				tactics = appendUnique(tactics, t.ID)
+			}
+		}
+	}
+	return techniques, tactics
+}
+
+func appendUnique(list []string, value string) []string {
+	if inList(list, value) {
+		return list
+	}
+	return append(list, value)
+}
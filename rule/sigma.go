@@ -0,0 +1,630 @@
+package rule
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// sigmaField sigma字段对应的规则字段，Prefix、Suffix为完全匹配时值前后的正则，默认为^和$
+type sigmaField struct {
+	Key    string
+	Prefix string
+	Suffix string
+}
+
+// sigmaCategory sigma的logsource.category对应的数据来源和字段
+type sigmaCategory struct {
+	Source string
+	Fields map[string]sigmaField
+}
+
+// SigmaCategories 支持转换的sigma日志类型
+var SigmaCategories = map[string]sigmaCategory{
+	"process_creation": {
+		Source: "process",
+		Fields: map[string]sigmaField{
+			"Image":           {Key: "name"},
+			"CommandLine":     {Key: "command"},
+			"ParentImage":     {Key: "parentname"},
+			"ProcessId":       {Key: "pid"},
+			"ParentProcessId": {Key: "ppid"},
+		},
+	},
+	"network_connection": {
+		Source: "connection",
+		Fields: map[string]sigmaField{
+			"Image":           {Key: "name"},
+			"DestinationIp":   {Key: "remote", Prefix: `^\[?`, Suffix: `\]?:\d+$`},
+			"DestinationPort": {Key: "remote", Prefix: `:`},
+			"SourceIp":        {Key: "local", Prefix: `^\[?`, Suffix: `\]?:\d+$`},
+			"SourcePort":      {Key: "local", Prefix: `:`},
+			"Protocol":        {Key: "protocol"},
+			"ProcessId":       {Key: "pid"},
+		},
+	},
+	"file_event": {
+		Source: "file",
+		Fields: map[string]sigmaField{
+			"TargetFilename": {Key: "path"},
+			"Image":          {Key: "name"},
+			"ProcessId":      {Key: "pid"},
+		},
+	},
+	"authentication": {
+		Source: "loginlog",
+		Fields: map[string]sigmaField{
+			"User":            {Key: "username"},
+			"TargetUserName":  {Key: "username"},
+			"SourceIp":        {Key: "remote"},
+			"IpAddress":       {Key: "remote"},
+			"SourceHostname":  {Key: "hostname"},
+			"WorkstationName": {Key: "hostname"},
+			"Status":          {Key: "status"},
+		},
+	},
+}
+
+const (
+	// sigmaMaxRules 一条sigma规则的条件展开后最多生成的规则数量
+	sigmaMaxRules = 16
+	// sigmaMaxAll contains|all 最多支持的值的数量
+	sigmaMaxAll = 4
+)
+
+// sigmaLevels sigma的level对应的风险等级
+var sigmaLevels = map[string]int{"critical": 0, "high": 0, "medium": 1, "low": 2, "informational": 2}
+
+// SigmaError sigma规则无法转换的原因，Problems列出所有不支持的内容
+type SigmaError struct {
+	Title    string
+	Problems []string
+}
+
+func (e *SigmaError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Title, strings.Join(e.Problems, "; "))
+}
+
+// sigmaDoc sigma规则中用到的字段
+type sigmaDoc struct {
+	Title       string                 `yaml:"title"`
+	ID          string                 `yaml:"id"`
+	Description string                 `yaml:"description"`
+	Author      string                 `yaml:"author"`
+	Level       string                 `yaml:"level"`
+	Tags        []string               `yaml:"tags"`
+	Action      string                 `yaml:"action"`
+	Logsource   map[string]string      `yaml:"logsource"`
+	Detection   map[string]interface{} `yaml:"detection"`
+}
+
+// sigmaLit 单个字段的判断，Neg为取反
+type sigmaLit struct {
+	Key   string
+	Regex string
+	Neg   bool
+}
+
+// sigmaTerm 且关系的判断，对应一条规则
+type sigmaTerm []sigmaLit
+
+// sigmaDNF 或关系的多条规则
+type sigmaDNF []sigmaTerm
+
+type sigmaConverter struct {
+	cat      sigmaCategory
+	problems []string
+}
+
+func (s *sigmaConverter) fail(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	for _, p := range s.problems {
+		if p == msg {
+			return
+		}
+	}
+	s.problems = append(s.problems, msg)
+}
+
+// ConvertSigma 将sigma规则文件（可包含多个以---分隔的规则）转换为告警规则，
+// 一条sigma规则的或条件会展开为多条规则，转换后的规则默认关闭并保存sigma原文，
+// 返回的错误为每条无法转换的sigma规则的*SigmaError
+func ConvertSigma(src []byte) ([]Rule, []error) {
+	var rules []Rule
+	var errs []error
+	docs := splitYAML(src)
+	for i, doc := range docs {
+		res, err := convertSigmaDoc(doc)
+		if err != nil {
+			if se, ok := err.(*SigmaError); ok && se.Title == "" {
+				se.Title = fmt.Sprintf("第%d个规则", i+1)
+			}
+			errs = append(errs, err)
+			continue
+		}
+		rules = append(rules, res...)
+	}
+	return rules, errs
+}
+
+// splitYAML 按---分隔多个yaml文档，保留每个文档的原文
+func splitYAML(src []byte) [][]byte {
+	var docs [][]byte
+	for _, doc := range regexp.MustCompile(`(?m)^---\s*$`).Split(string(src), -1) {
+		if strings.TrimSpace(doc) != "" {
+			docs = append(docs, []byte(strings.TrimSpace(doc)+"\n"))
+		}
+	}
+	return docs
+}
+
+func convertSigmaDoc(src []byte) ([]Rule, error) {
+	var doc sigmaDoc
+	dec := yaml.NewDecoder(bytes.NewReader(src))
+	if err := dec.Decode(&doc); err != nil && err != io.EOF {
+		return nil, &SigmaError{Problems: []string{"YAML格式错误: " + err.Error()}}
+	}
+	e := &SigmaError{Title: doc.Title}
+	if doc.Title == "" {
+		e.Problems = append(e.Problems, "缺少title")
+	}
+	if doc.Action != "" {
+		e.Problems = append(e.Problems, "不支持规则集合(action: "+doc.Action+")，请先展开为单独的规则")
+	}
+	cat, ok := SigmaCategories[doc.Logsource["category"]]
+	if !ok {
+		e.Problems = append(e.Problems, fmt.Sprintf("不支持的logsource.category %q，只支持%s",
+			doc.Logsource["category"], strings.Join(sigmaCategoryNames(), "、")))
+	}
+	if len(e.Problems) > 0 {
+		return nil, e
+	}
+
+	s := &sigmaConverter{cat: cat}
+	condition := ""
+	switch v := doc.Detection["condition"].(type) {
+	case string:
+		condition = v
+	case []interface{}:
+		// 多个条件为或
+		var list []string
+		for _, c := range v {
+			list = append(list, fmt.Sprintf("(%v)", c))
+		}
+		condition = strings.Join(list, " or ")
+	}
+	if condition == "" {
+		s.fail("缺少detection.condition")
+	}
+	var names []string
+	for name := range doc.Detection {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	selections := make(map[string]sigmaDNF)
+	for _, name := range names {
+		switch name {
+		case "condition":
+		case "timeframe":
+			s.fail("不支持timeframe")
+		default:
+			selections[name] = s.selection(name, doc.Detection[name])
+		}
+	}
+	var dnf sigmaDNF
+	if condition != "" {
+		dnf = s.condition(condition, selections)
+	}
+	if len(s.problems) > 0 {
+		e.Problems = s.problems
+		return nil, e
+	}
+
+	system := "all"
+	if doc.Logsource["product"] == "windows" || doc.Logsource["product"] == "linux" {
+		system = doc.Logsource["product"]
+	}
+	level, ok := sigmaLevels[strings.ToLower(doc.Level)]
+	if !ok {
+		level = 1
+	}
+	description := strings.TrimSpace(doc.Description)
+	if doc.ID != "" {
+		description = strings.TrimSpace(description + " (sigma: " + doc.ID + ")")
+	}
+	technique, tactic := attackFromTags(doc.Tags)
+	var rules []Rule
+	for i, term := range dnf {
+		r := Rule{
+			Meta: Meta{Name: doc.Title, Author: doc.Author, Description: description, Level: level,
+				Technique: technique, Tactic: tactic},
+			Source: cat.Source,
+			System: system,
+			Tags:   []string{},
+			Rules:  make(map[string]Item),
+			And:    true,
+			Sigma:  string(src),
+		}
+		if len(dnf) > 1 {
+			r.Meta.Name = fmt.Sprintf("%s #%d", doc.Title, i+1)
+		}
+		for _, lit := range term {
+			// sigma中字段不存在时not条件成立，空值也算作不匹配
+			t := "regex"
+			if lit.Neg {
+				t = "not-regex"
+			}
+			r.Rules[lit.Key] = Item{Type: t, Data: lit.Regex}
+		}
+		if err := Validate(r); err != nil {
+			s.fail("%v", err)
+			continue
+		}
+		rules = append(rules, r)
+	}
+	if len(s.problems) > 0 {
+		e.Problems = s.problems
+		return nil, e
+	}
+	return rules, nil
+}
+
+func sigmaCategoryNames() []string {
+	var names []string
+	for name := range SigmaCategories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selection 转换detection中的一个搜索条件，对象中的字段为且，列表中的对象为或
+func (s *sigmaConverter) selection(name string, v interface{}) sigmaDNF {
+	switch sel := v.(type) {
+	case map[interface{}]interface{}:
+		return s.fieldMap(sel)
+	case []interface{}:
+		var dnf sigmaDNF
+		for _, item := range sel {
+			m, ok := item.(map[interface{}]interface{})
+			if !ok {
+				s.fail("%s: 不支持无字段的关键字搜索", name)
+				return nil
+			}
+			dnf = s.or(dnf, s.fieldMap(m))
+		}
+		return dnf
+	}
+	s.fail("%s: 格式错误", name)
+	return nil
+}
+
+// fieldMap 对象中每个字段的多个值为或（使用all修饰符时为且），不同字段为且
+func (s *sigmaConverter) fieldMap(m map[interface{}]interface{}) sigmaDNF {
+	var keys []string
+	for k := range m {
+		keys = append(keys, fmt.Sprint(k))
+	}
+	sort.Strings(keys)
+	dnf := sigmaDNF{sigmaTerm{}}
+	for _, k := range keys {
+		parts := strings.Split(k, "|")
+		field, ok := s.cat.Fields[parts[0]]
+		if !ok {
+			s.fail("不支持的字段 %s，%s只支持%s", parts[0], s.cat.Source, strings.Join(s.fieldNames(), "、"))
+			continue
+		}
+		mode, all := "", false
+		for _, mod := range parts[1:] {
+			switch mod {
+			case "contains", "startswith", "endswith", "re":
+				if mode != "" {
+					s.fail("字段 %s 不支持同时使用修饰符 %s 和 %s", parts[0], mode, mod)
+				}
+				mode = mod
+			case "all":
+				all = true
+			default:
+				s.fail("不支持的修饰符 %s（字段 %s）", mod, parts[0])
+			}
+		}
+		var values []string
+		switch v := m[k].(type) {
+		case []interface{}:
+			for _, item := range v {
+				values = append(values, sigmaValue(item))
+			}
+		default:
+			values = []string{sigmaValue(v)}
+		}
+		for _, v := range values {
+			if v == "\x00" {
+				s.fail("字段 %s 不支持null值", parts[0])
+				return nil
+			}
+		}
+		if len(values) == 0 {
+			s.fail("字段 %s 没有值", parts[0])
+			continue
+		}
+		var regs []string
+		for _, v := range values {
+			regs = append(regs, sigmaRegex(v, mode, field))
+		}
+		if all && len(values) > 1 {
+			// 一个字段只能有一个正则且不支持零宽断言，只有contains可以用各种顺序的组合表示
+			if mode != "contains" || len(values) > sigmaMaxAll {
+				s.fail("字段 %s 的all修饰符只支持与contains同时使用且最多%d个值", parts[0], sigmaMaxAll)
+				continue
+			}
+			var perms []string
+			for _, perm := range permutations(regs) {
+				perms = append(perms, strings.Join(perm, ".*"))
+			}
+			dnf = s.and(dnf, sigmaDNF{sigmaTerm{{Key: field.Key, Regex: joinRegex(perms)}}})
+			continue
+		}
+		dnf = s.and(dnf, sigmaDNF{sigmaTerm{{Key: field.Key, Regex: joinRegex(regs)}}})
+	}
+	return dnf
+}
+
+// permutations 所有排列
+func permutations(list []string) [][]string {
+	if len(list) <= 1 {
+		return [][]string{list}
+	}
+	var res [][]string
+	for i := range list {
+		rest := append(append([]string{}, list[:i]...), list[i+1:]...)
+		for _, perm := range permutations(rest) {
+			res = append(res, append([]string{list[i]}, perm...))
+		}
+	}
+	return res
+}
+
+func (s *sigmaConverter) fieldNames() []string {
+	var names []string
+	for name := range s.cat.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sigmaValue(v interface{}) string {
+	if v == nil {
+		return "\x00"
+	}
+	return fmt.Sprint(v)
+}
+
+// sigmaRegex 将sigma的值转换为正则，规则匹配时数据已转为小写，
+// 值中的*和?为通配符，endswith的值以路径分隔符开头时也匹配只有文件名的数据（windows的进程名）
+func sigmaRegex(value string, mode string, field sigmaField) string {
+	if mode == "re" {
+		return "(?i)" + value
+	}
+	prefix, suffix := field.Prefix, field.Suffix
+	if prefix == "" {
+		prefix = "^"
+	}
+	if suffix == "" {
+		suffix = "$"
+	}
+	var b strings.Builder
+	lower := strings.ToLower(value)
+	for i := 0; i < len(lower); i++ {
+		c := lower[i]
+		switch {
+		case c == '\\' && i+1 < len(lower) && (lower[i+1] == '*' || lower[i+1] == '?' || lower[i+1] == '\\'):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(lower[i])))
+		case c == '*':
+			b.WriteString(".*")
+		case c == '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	reg := b.String()
+	switch mode {
+	case "contains":
+		return reg
+	case "startswith":
+		return prefix + reg
+	case "endswith":
+		if strings.HasPrefix(lower, `\`) || strings.HasPrefix(lower, "/") {
+			reg = `(^|[\\/])` + strings.TrimPrefix(strings.TrimPrefix(reg, `\\`), "/")
+		}
+		return reg + suffix
+	}
+	return prefix + reg + suffix
+}
+
+// joinRegex 多个值为或
+func joinRegex(regs []string) string {
+	if len(regs) == 1 {
+		return regs[0]
+	}
+	return "(" + strings.Join(regs, ")|(") + ")"
+}
+
+// limit 展开后的规则超过sigmaMaxRules条时转换失败，只保留前面的部分，
+// 避免not等条件指数级展开耗尽CPU和内存
+func (s *sigmaConverter) limit(dnf sigmaDNF) sigmaDNF {
+	if len(dnf) > sigmaMaxRules {
+		s.fail("条件展开后超过%d条规则，请简化条件", sigmaMaxRules)
+		return dnf[:sigmaMaxRules]
+	}
+	return dnf
+}
+
+// and 两组条件相乘，同一字段的两个取反条件合并为一个，其它情况同一字段不能出现两次
+func (s *sigmaConverter) and(a sigmaDNF, b sigmaDNF) sigmaDNF {
+	var res sigmaDNF
+	for _, x := range a {
+		for _, y := range b {
+			term := append(sigmaTerm{}, x...)
+			for _, lit := range y {
+				term = s.addLit(term, lit)
+			}
+			res = append(res, term)
+			if len(res) > sigmaMaxRules {
+				return s.limit(res)
+			}
+		}
+	}
+	return res
+}
+
+func (s *sigmaConverter) addLit(term sigmaTerm, lit sigmaLit) sigmaTerm {
+	for i, old := range term {
+		if old.Key != lit.Key {
+			continue
+		}
+		if old.Neg && lit.Neg {
+			if old.Regex != lit.Regex {
+				term[i].Regex = joinRegex([]string{old.Regex, lit.Regex})
+			}
+			return term
+		}
+		if old == lit {
+			return term
+		}
+		s.fail("字段 %s 在同一条件中出现多次，无法转换", lit.Key)
+		return term
+	}
+	return append(term, lit)
+}
+
+func (s *sigmaConverter) or(a sigmaDNF, b sigmaDNF) sigmaDNF {
+	return s.limit(append(append(sigmaDNF{}, a...), b...))
+}
+
+// not 取反：非(A或B)=非A且非B，非(A且B)=非A或非B
+func (s *sigmaConverter) not(a sigmaDNF) sigmaDNF {
+	res := sigmaDNF{sigmaTerm{}}
+	for _, term := range a {
+		var alt sigmaDNF
+		for _, lit := range term {
+			lit.Neg = !lit.Neg
+			alt = append(alt, sigmaTerm{lit})
+		}
+		res = s.and(res, alt)
+	}
+	return res
+}
+
+var sigmaToken = regexp.MustCompile(`\(|\)|\||[^\s()|]+`)
+
+// condition 解析detection.condition，支持and、or、not、括号、1 of、all of和them
+func (s *sigmaConverter) condition(cond string, selections map[string]sigmaDNF) sigmaDNF {
+	p := &sigmaParser{tokens: sigmaToken.FindAllString(cond, -1), s: s, selections: selections}
+	res := p.or()
+	if p.pos < len(p.tokens) {
+		if p.tokens[p.pos] == "|" {
+			s.fail("不支持聚合条件（| count() 等）")
+		} else {
+			s.fail("无法解析的条件 %q", strings.Join(p.tokens[p.pos:], " "))
+		}
+	}
+	return res
+}
+
+type sigmaParser struct {
+	tokens     []string
+	pos        int
+	s          *sigmaConverter
+	selections map[string]sigmaDNF
+}
+
+func (p *sigmaParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return strings.ToLower(p.tokens[p.pos])
+	}
+	return ""
+}
+
+func (p *sigmaParser) or() sigmaDNF {
+	res := p.and()
+	for p.peek() == "or" {
+		p.pos++
+		res = p.s.or(res, p.and())
+	}
+	return res
+}
+
+func (p *sigmaParser) and() sigmaDNF {
+	res := p.unary()
+	for p.peek() == "and" {
+		p.pos++
+		res = p.s.and(res, p.unary())
+	}
+	return res
+}
+
+func (p *sigmaParser) unary() sigmaDNF {
+	switch tok := p.peek(); tok {
+	case "not":
+		p.pos++
+		return p.s.not(p.unary())
+	case "(":
+		p.pos++
+		res := p.or()
+		if p.peek() != ")" {
+			p.s.fail("条件中的括号不匹配")
+			return res
+		}
+		p.pos++
+		return res
+	case "1", "all":
+		p.pos++
+		if p.peek() != "of" || p.pos+1 >= len(p.tokens) {
+			p.s.fail("无法解析的条件 %s of", tok)
+			return nil
+		}
+		p.pos++
+		pattern := p.tokens[p.pos]
+		p.pos++
+		var names []string
+		for name := range p.selections {
+			if ok, _ := path.Match(pattern, name); ok || pattern == "them" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			p.s.fail("条件 %s of %s 没有匹配的搜索条件", tok, pattern)
+			return nil
+		}
+		res := p.selections[names[0]]
+		for _, name := range names[1:] {
+			if tok == "all" {
+				res = p.s.and(res, p.selections[name])
+			} else {
+				res = p.s.or(res, p.selections[name])
+			}
+		}
+		return res
+	case "", ")", "and", "or", "|":
+		p.s.fail("条件不完整")
+		return nil
+	default:
+		p.pos++
+		name := p.tokens[p.pos-1]
+		sel, ok := p.selections[name]
+		if !ok {
+			p.s.fail("条件中的 %s 未定义", name)
+		}
+		return sel
+	}
+}
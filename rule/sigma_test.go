@@ -0,0 +1,256 @@
+package rule
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sigmaHeader = `title: Test
+id: 0a1b
+author: tester
+level: high
+tags:
+  - attack.execution
+  - attack.t1059.004
+logsource:
+  product: linux
+  category: process_creation
+`
+
+func convertOne(t *testing.T, detection string) []Rule {
+	t.Helper()
+	rules, errs := ConvertSigma([]byte(sigmaHeader + detection))
+	if len(errs) > 0 {
+		t.Fatalf("ConvertSigma = %v", errs)
+	}
+	return rules
+}
+
+func TestConvertSigmaMeta(t *testing.T) {
+	rules := convertOne(t, `detection:
+  sel:
+    Image|endswith: /bash
+  condition: sel
+`)
+	if len(rules) != 1 {
+		t.Fatalf("got %d rules, want 1", len(rules))
+	}
+	r := rules[0]
+	if r.Meta.Name != "Test" || r.Meta.Author != "tester" || r.Meta.Level != 0 || r.Source != "process" || r.System != "linux" {
+		t.Errorf("rule = %+v", r)
+	}
+	if !reflect.DeepEqual(r.Meta.Technique, []string{"T1059.004"}) || !reflect.DeepEqual(r.Meta.Tactic, []string{"TA0002"}) {
+		t.Errorf("technique = %v, tactic = %v", r.Meta.Technique, r.Meta.Tactic)
+	}
+	if !strings.Contains(r.Meta.Description, "sigma: 0a1b") || r.Sigma == "" || !r.And {
+		t.Errorf("description = %q, and = %v", r.Meta.Description, r.And)
+	}
+}
+
+func TestConvertSigmaModifiers(t *testing.T) {
+	tests := []struct {
+		name      string
+		detection string
+		key       string
+		match     []string
+		miss      []string
+	}{
+		{"exact", "Image: /bin/bash", "name", []string{"/BIN/BASH"}, []string{"/bin/bash2", "x/bin/bash"}},
+		{"wildcard", "Image: /bin/*sh", "name", []string{"/bin/bash", "/bin/sh"}, []string{"/usr/bin/bash"}},
+		{"contains", "CommandLine|contains: ' -i '", "command", []string{"bash -i >&"}, []string{"bash -c id"}},
+		{"startswith", "CommandLine|startswith: curl", "command", []string{"curl http://x"}, []string{"/usr/bin/curl"}},
+		{"endswith path", "Image|endswith: /nc", "name", []string{"/usr/bin/nc", "nc"}, []string{"/usr/bin/ncat"}},
+		{"re", "CommandLine|re: 'base64 +-d'", "command", []string{"BASE64  -d"}, []string{"base64"}},
+		{"list is or", "Image|endswith: ['/nc', '/ncat']", "name", []string{"/bin/nc", "/bin/ncat"}, []string{"/bin/netcat"}},
+		{"contains all", "CommandLine|contains|all: ['-e', '/bin/sh']", "command", []string{"nc -e /bin/sh", "/bin/sh -e"}, []string{"nc -e /bin/bash"}},
+	}
+	for _, tt := range tests {
+		detection := "detection:\n  sel:\n    " + tt.detection + "\n  condition: sel\n"
+		rules := convertOne(t, detection)
+		if len(rules) != 1 {
+			t.Fatalf("%s: got %d rules", tt.name, len(rules))
+		}
+		for _, v := range tt.match {
+			if ok, _ := rules[0].Match(map[string]string{tt.key: v}, nil); !ok {
+				t.Errorf("%s: %q not matched by %v", tt.name, v, rules[0].Rules)
+			}
+		}
+		for _, v := range tt.miss {
+			if ok, _ := rules[0].Match(map[string]string{tt.key: v}, nil); ok {
+				t.Errorf("%s: %q matched by %v", tt.name, v, rules[0].Rules)
+			}
+		}
+	}
+
+	// 端口只匹配地址中:后的部分
+	src := strings.Replace(sigmaHeader, "process_creation", "network_connection", 1) +
+		"detection:\n  sel:\n    DestinationPort: 4444\n  condition: sel\n"
+	rules, errs := ConvertSigma([]byte(src))
+	if len(errs) > 0 || len(rules) != 1 {
+		t.Fatalf("ConvertSigma(port) = %v %v", rules, errs)
+	}
+	if ok, _ := rules[0].Match(map[string]string{"remote": "10.0.0.1:4444"}, nil); !ok {
+		t.Error("port not matched")
+	}
+	if ok, _ := rules[0].Match(map[string]string{"remote": "10.0.0.1:44445"}, nil); ok {
+		t.Error("other port matched")
+	}
+}
+
+func TestConvertSigmaCondition(t *testing.T) {
+	tests := []struct {
+		name      string
+		detection string
+		rules     int
+		match     []map[string]string
+		miss      []map[string]string
+	}{
+		{
+			name: "and",
+			detection: `  sel1:
+    Image|endswith: /nc
+  sel2:
+    CommandLine|contains: ' -e '
+  condition: sel1 and sel2`,
+			rules: 1,
+			match: []map[string]string{{"name": "/bin/nc", "command": "nc -e /bin/sh"}},
+			miss:  []map[string]string{{"name": "/bin/nc", "command": "nc -l"}},
+		},
+		{
+			name: "1 of",
+			detection: `  sel_nc:
+    Image|endswith: /nc
+  sel_socat:
+    Image|endswith: /socat
+  condition: 1 of sel_*`,
+			rules: 2,
+		},
+		{
+			name: "all of them",
+			detection: `  sel1:
+    Image|endswith: /nc
+  sel2:
+    CommandLine|contains: ' -e '
+  condition: all of them`,
+			rules: 1,
+		},
+		{
+			name: "not",
+			detection: `  sel:
+    Image|endswith: /bash
+  filter:
+    ParentImage|endswith: /sshd
+  condition: sel and not filter`,
+			rules: 1,
+			match: []map[string]string{
+				{"name": "/bin/bash", "parentname": "/usr/sbin/nginx"},
+				// 字段为空时not条件成立
+				{"name": "/bin/bash", "parentname": ""},
+				{"name": "/bin/bash"},
+			},
+			miss: []map[string]string{{"name": "/bin/bash", "parentname": "/usr/sbin/sshd"}},
+		},
+		{
+			name: "not or",
+			detection: `  sel:
+    Image|endswith: /bash
+  filter1:
+    ParentImage|endswith: /sshd
+  filter2:
+    ParentImage|endswith: /login
+  condition: sel and not (filter1 or filter2)`,
+			rules: 1,
+			miss:  []map[string]string{{"name": "/bin/bash", "parentname": "/bin/login"}},
+		},
+		{
+			name: "condition list",
+			detection: `  sel1:
+    Image|endswith: /nc
+  sel2:
+    Image|endswith: /socat
+  condition:
+    - sel1
+    - sel2`,
+			rules: 2,
+		},
+	}
+	for _, tt := range tests {
+		rules := convertOne(t, "detection:\n"+tt.detection+"\n")
+		if len(rules) != tt.rules {
+			t.Errorf("%s: got %d rules, want %d", tt.name, len(rules), tt.rules)
+			continue
+		}
+		if tt.rules > 1 && rules[1].Meta.Name != "Test #2" {
+			t.Errorf("%s: name = %q, want Test #2", tt.name, rules[1].Meta.Name)
+		}
+		for _, v := range tt.match {
+			if ok, _ := rules[0].Match(v, nil); !ok {
+				t.Errorf("%s: %v not matched by %v", tt.name, v, rules[0].Rules)
+			}
+		}
+		for _, v := range tt.miss {
+			if ok, _ := rules[0].Match(v, nil); ok {
+				t.Errorf("%s: %v matched by %v", tt.name, v, rules[0].Rules)
+			}
+		}
+	}
+}
+
+func TestConvertSigmaErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"title", "logsource:\n  category: process_creation\n", "缺少title"},
+		{"category", "title: x\nlogsource:\n  category: registry_event\n", "不支持的logsource.category"},
+		{"action", "title: x\naction: global\nlogsource:\n  category: process_creation\n", "不支持规则集合"},
+		{"field", sigmaHeader + "detection:\n  sel:\n    Hashes: abc\n  condition: sel\n", "不支持的字段 Hashes"},
+		{"modifier", sigmaHeader + "detection:\n  sel:\n    CommandLine|base64: abc\n  condition: sel\n", "不支持的修饰符 base64"},
+		{"null", sigmaHeader + "detection:\n  sel:\n    CommandLine: null\n  condition: sel\n", "不支持null值"},
+		{"keywords", sigmaHeader + "detection:\n  keywords:\n    - whoami\n  condition: keywords\n", "不支持无字段的关键字搜索"},
+		{"timeframe", sigmaHeader + "detection:\n  sel:\n    Image: /bin/nc\n  timeframe: 5m\n  condition: sel\n", "不支持timeframe"},
+		{"aggregation", sigmaHeader + "detection:\n  sel:\n    Image: /bin/nc\n  condition: sel | count() > 5\n", "不支持聚合条件"},
+		{"no condition", sigmaHeader + "detection:\n  sel:\n    Image: /bin/nc\n", "缺少detection.condition"},
+		{"undefined", sigmaHeader + "detection:\n  sel:\n    Image: /bin/nc\n  condition: other\n", "other 未定义"},
+		{"startswith all", sigmaHeader + "detection:\n  sel:\n    CommandLine|startswith|all: [a, b]\n  condition: sel\n", "all修饰符只支持与contains同时使用"},
+		{"contains all too many", sigmaHeader + "detection:\n  sel:\n    CommandLine|contains|all: [a, b, c, d, e]\n  condition: sel\n", "all修饰符只支持与contains同时使用且最多4个值"},
+		{"same field", sigmaHeader + "detection:\n  sel1:\n    Image: /bin/nc\n  sel2:\n    Image|endswith: nc\n  condition: sel1 and sel2\n", "字段 name 在同一条件中出现多次"},
+		{"yaml", "title: [", "YAML格式错误"},
+	}
+	for _, tt := range tests {
+		rules, errs := ConvertSigma([]byte(tt.src))
+		if len(rules) != 0 || len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.want) {
+			t.Errorf("%s: ConvertSigma = %v %v, want error containing %q", tt.name, rules, errs, tt.want)
+		}
+	}
+
+	// 条件展开超过上限时立即失败，not (A或B或...) 不能指数级展开
+	var sel strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&sel, "    - Image: /bin/a%d\n      CommandLine: b%d\n      ParentImage: c%d\n", i, i, i)
+	}
+	start := time.Now()
+	rules, errs := ConvertSigma([]byte(sigmaHeader + "detection:\n  sel:\n" + sel.String() + "  condition: not sel\n"))
+	if len(rules) != 0 || len(errs) != 1 || !strings.Contains(errs[0].Error(), "超过16条规则") {
+		t.Errorf("ConvertSigma(not 40 maps) = %v %v", rules, errs)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("ConvertSigma(not 40 maps) took %v", d)
+	}
+	rules, errs = ConvertSigma([]byte(sigmaHeader + "detection:\n  sel:\n" + sel.String() + "  condition: sel\n"))
+	if len(rules) != 0 || len(errs) != 1 || !strings.Contains(errs[0].Error(), "超过16条规则") {
+		t.Errorf("ConvertSigma(40 maps) = %v %v", rules, errs)
+	}
+
+	// 多个规则时只跳过无法转换的规则
+	src := sigmaHeader + "detection:\n  sel:\n    Image: /bin/nc\n  condition: sel\n---\n" +
+		sigmaHeader + "detection:\n  sel:\n    Hashes: abc\n  condition: sel\n"
+	rules, errs = ConvertSigma([]byte(src))
+	if len(rules) != 1 || len(errs) != 1 {
+		t.Errorf("ConvertSigma(two docs) = %d rules, %v", len(rules), errs)
+	}
+}
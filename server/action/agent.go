@@ -3,15 +3,12 @@ package action
 import (
 	"log"
 	"time"
+	"yulong-hids/profile"
 	"yulong-hids/server/models"
 
 	"gopkg.in/mgo.v2/bson"
 )
 
-type client struct {
-	TYPE string
-	DIC  ClientConfig
-}
 type monitorInfo struct {
 	IP   string
 	Type string
@@ -27,27 +24,51 @@ type ClientConfig struct {
 	Filter      filter   // 直接过滤不回传的数据
 	MonitorPath []string `bson:"monitorPath"` // 监控目录列表
 	Lasttime    string   // 最后一条登录日志时间
-}
-type filterres struct {
-	Type string `bson:"type"`
-	Dic  filter `bson:"dic"`
+	Fanotify    bool     `bson:"fanotify"` // 是否使用fanotify监控文件写入(linux)
+	Webshell    webshell // web目录下文件的webshell检测规则
+	Resource    resource // agent资源限制
 }
 type filter struct {
 	File    []string `bson:"file"`    // 文件hash、文件名
 	IP      []string `bson:"ip"`      // IP地址
 	Process []string `bson:"process"` // 进程名、参数
 }
+type webshell struct {
+	Switch bool     `bson:"switch"` // 是否开启
+	Rules  []string `bson:"rules"`  // 特征规则，格式为 名称:正则
+}
+type resource struct {
+	CPU    int `bson:"cpu"`    // CPU使用上限，单核的百分比
+	Memory int `bson:"memory"` // 内存使用上限，单位MB
+	Rate   int `bson:"rate"`   // 每种事件每分钟的回传上限
+}
 
-// GetAgentConfig 返回客户端的配置信息
-func GetAgentConfig(ip string) ClientConfig {
-	var clientRes client
-	c := models.DB.C("config")
-	c.Find(bson.M{"type": "client"}).One(&clientRes)
-	config := clientRes.DIC
-
-	var res filterres
-	c.Find(bson.M{"type": "filter"}).One(&res)
-	config.Filter = res.Dic
+// GetAgentConfig 返回客户端的配置信息，全局配置按主机所属分组的配置模板覆盖后下发。
+// 读取配置模板失败或模板中的配置项类型错误时下发全局配置，全局配置也有错误时返回错误，
+// agent保留上一次的配置
+func GetAgentConfig(ip string) (ClientConfig, error) {
+	resolved, applied, err := profile.Load(models.DB, ip)
+	if err != nil {
+		log.Println("profile load error:", err.Error())
+		applied = nil
+		if resolved, err = profile.LoadBase(models.DB); err != nil {
+			return ClientConfig{}, err
+		}
+	}
+	config, err := decodeConfig(resolved)
+	if err != nil && len(applied) > 0 {
+		log.Println("profile config error:", ip, applied, err.Error())
+		applied = nil
+		if resolved, err = profile.LoadBase(models.DB); err == nil {
+			config, err = decodeConfig(resolved)
+		}
+	}
+	if err != nil {
+		return ClientConfig{}, err
+	}
+	if len(applied) > 0 {
+		log.Println("profile:", ip, applied)
+	}
 	lastTime, err := models.QueryLogLastTime(ip)
 	if err != nil {
 		log.Println(err.Error())
@@ -55,5 +76,23 @@ func GetAgentConfig(ip string) ClientConfig {
 	} else {
 		config.Lasttime = lastTime
 	}
-	return config
+	return config, nil
+}
+
+// decodeConfig 将合并后的各类配置转换为客户端配置
+func decodeConfig(resolved map[string]bson.M) (ClientConfig, error) {
+	var config ClientConfig
+	if err := profile.Decode(resolved["client"], &config); err != nil {
+		return config, err
+	}
+	if err := profile.Decode(resolved["filter"], &config.Filter); err != nil {
+		return config, err
+	}
+	if err := profile.Decode(resolved["webshell"], &config.Webshell); err != nil {
+		return config, err
+	}
+	if err := profile.Decode(resolved["resource"], &config.Resource); err != nil {
+		return config, err
+	}
+	return config, nil
 }
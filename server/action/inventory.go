@@ -0,0 +1,43 @@
+package action
+
+import (
+	"log"
+	"time"
+	"yulong-hids/server/inventory"
+	"yulong-hids/server/models"
+)
+
+// inventoryChange 主机信息中新增、删除或修改的条目
+type inventoryChange struct {
+	IP     string            `bson:"ip"`
+	Type   string            `bson:"type"`
+	Action string            `bson:"action"` // add、remove、change
+	Data   map[string]string `bson:"data"`
+	Prev   map[string]string `bson:"prev,omitempty"` // 修改前的条目
+	Time   time.Time         `bson:"time"`
+}
+
+// saveInventoryChange 记录主机信息的变化，首次回传时没有上一次的信息，不记录
+func saveInventoryChange(datainfo models.DataInfo, prev []map[string]string) {
+	keys, ok := inventory.Keys[datainfo.Type]
+	if !ok {
+		return
+	}
+	added, removed, changed := inventory.Diff(prev, datainfo.Data, keys, inventory.Ignore[datainfo.Type])
+	var changes []interface{}
+	for _, item := range added {
+		changes = append(changes, inventoryChange{datainfo.IP, datainfo.Type, "add", item, nil, datainfo.Uptime})
+	}
+	for _, item := range removed {
+		changes = append(changes, inventoryChange{datainfo.IP, datainfo.Type, "remove", item, nil, datainfo.Uptime})
+	}
+	for _, item := range changed {
+		changes = append(changes, inventoryChange{datainfo.IP, datainfo.Type, "change", item[1], item[0], datainfo.Uptime})
+	}
+	if len(changes) == 0 {
+		return
+	}
+	if err := models.DB.C("info_change").Insert(changes...); err != nil {
+		log.Println(err.Error())
+	}
+}
@@ -3,6 +3,7 @@ package action
 import (
 	"strconv"
 	"time"
+	"yulong-hids/netaddr"
 	"yulong-hids/server/models"
 
 	"gopkg.in/mgo.v2/bson"
@@ -14,6 +15,7 @@ type ComputerInfo struct {
 	Hostname string
 	Type     string
 	Path     []string
+	Roles    []string
 
 	Uptime time.Time
 }
@@ -21,8 +23,9 @@ type ComputerInfo struct {
 //ResultSave 保存结果到info表
 func ResultSave(datainfo models.DataInfo) error {
 	var err error
-	// 登录日志、网络连接、进程创建、文件操作 存放在es，其余保存在mongodb
-	if datainfo.Type == "loginlog" || datainfo.Type == "connection" || datainfo.Type == "process" || datainfo.Type == "file" {
+	// 登录日志、网络连接、进程创建、文件操作、DNS查询、反弹shell 存放在es，其余保存在mongodb
+	if datainfo.Type == "loginlog" || datainfo.Type == "connection" || datainfo.Type == "process" || datainfo.Type == "file" ||
+		datainfo.Type == "dns" || datainfo.Type == "reverseshell" {
 		if datainfo.Type == "loginlog" {
 			//对于登录日志,遍历Data操作数据
 			for _, logininfo := range datainfo.Data {
@@ -39,7 +42,7 @@ func ResultSave(datainfo models.DataInfo) error {
 				models.InsertEs(datainfo.Type, esdata)
 			}
 		} else {
-			//connection,process,file类型的
+			//connection,process,file,dns,reverseshell类型的
 			//TODO:将转化为int
 			//A:上传的datainfo中的时间推断是一个时间戳(从1970年到现在多少秒)
 			dataTimeInt, err := strconv.Atoi(datainfo.Data[0]["time"])
@@ -47,6 +50,11 @@ func ResultSave(datainfo models.DataInfo) error {
 				return err
 			}
 			delete(datainfo.Data[0], "time")
+			if datainfo.Type == "connection" {
+				// 单独保存不带端口的IP，便于在es中按IP和网段查询
+				datainfo.Data[0]["remote_ip"] = netaddr.Host(datainfo.Data[0]["remote"])
+				datainfo.Data[0]["local_ip"] = netaddr.Host(datainfo.Data[0]["local"])
+			}
 			esdata := models.ESSave{
 				IP:   datainfo.IP,
 				Data: datainfo.Data[0],
@@ -57,8 +65,9 @@ func ResultSave(datainfo models.DataInfo) error {
 	} else {
 		//其余要放在MongoDB的数据操作
 		c := models.DB.C("info")
-		count, _ := c.Find(bson.M{"ip": datainfo.IP, "type": datainfo.Type}).Count()
-		if count >= 1 {
+		var prev models.DataInfo
+		if c.Find(bson.M{"ip": datainfo.IP, "type": datainfo.Type}).One(&prev) == nil {
+			saveInventoryChange(datainfo, prev.Data)
 			err = c.Update(bson.M{"ip": datainfo.IP, "type": datainfo.Type},
 				bson.M{"$set": bson.M{"data": datainfo.Data, "uptime": datainfo.Uptime}})
 		} else {
@@ -1,7 +1,7 @@
 package action
 
 import (
-	"strings"
+	"yulong-hids/netaddr"
 	"yulong-hids/server/models"
 
 	"gopkg.in/mgo.v2/bson"
@@ -16,10 +16,12 @@ func ResultStat(datainfo models.DataInfo) error {
 		"userlist":   "name",
 		"listening":  "address",
 		"connection": "remote",
+		"dns":        "domain",
 		"loginlog":   "remote",
 		"startup":    "name",
 		"crontab":    "command",
 		"service":    "name",
+		"container":  "image",
 		// "processlist": "name",
 	}
 	//根据DataInfo的Type来匹配事先创建的map,不存在该类型则返回
@@ -31,20 +33,21 @@ func ResultStat(datainfo models.DataInfo) error {
 	ip := datainfo.IP
 	//遍历数据[]map[string]string
 	for _, v := range datainfo.Data {
+		info := v[k]
 		if datainfo.Type == "connection" {
-			//以:分隔为字符串切片
-			v[k] = strings.Split(v[k], ":")[0]
+			//只统计IP，去掉端口，不修改原数据，es和安全检测中仍为ip:port
+			info = netaddr.Host(info)
 		}
 		//TODO:学习完Go操作MongoDB再看,这里逻辑是?将统计结果也放入DB?
-		count, _ := c.Find(bson.M{"info": v[k], "type": datainfo.Type}).Count()
+		count, _ := c.Find(bson.M{"info": info, "type": datainfo.Type}).Count()
 		if count >= 1 {
-			err = c.Update(bson.M{"info": v[k], "type": datainfo.Type}, bson.M{
+			err = c.Update(bson.M{"info": info, "type": datainfo.Type}, bson.M{
 				"$set":      bson.M{"uptime": datainfo.Uptime},
 				"$inc":      bson.M{"count": 1},
 				"$addToSet": bson.M{"server_list": ip}})
 		} else {
 			serverList := []string{ip}
-			err = c.Insert(bson.M{"type": datainfo.Type, "info": v[k], "count": 1,
+			err = c.Insert(bson.M{"type": datainfo.Type, "info": info, "count": 1,
 				"server_list": serverList, "uptime": datainfo.Uptime})
 		}
 	}
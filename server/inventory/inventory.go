@@ -0,0 +1,82 @@
+// Package inventory 主机信息（账号、监听端口、计划任务等）两次回传之间的变化比较
+package inventory
+
+import "strings"
+
+// Keys 需要记录变化的主机信息类型，及用于识别同一条目的字段
+var Keys = map[string][]string{
+	"userlist":    {"name"},
+	"listening":   {"proto", "address"},
+	"crontab":     {"user", "name", "command", "arg"},
+	"startup":     {"name", "location", "user"},
+	"service":     {"name"},
+	"processlist": {"name", "command"},
+}
+
+// Ignore 比较条目是否修改时忽略的字段，进程号等每次重启都会变化
+var Ignore = map[string][]string{
+	"listening":   {"pid"},
+	"processlist": {"pid", "ppid", "starttime"},
+}
+
+// itemKey 条目中识别字段的值
+func itemKey(item map[string]string, keys []string) string {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = item[key]
+	}
+	return strings.Join(values, "\x00")
+}
+
+// itemChanged 识别字段相同的两个条目，除忽略的字段外是否有不同
+func itemChanged(prev map[string]string, cur map[string]string, ignore map[string]bool) bool {
+	for k, v := range cur {
+		if prev[k] != v && !ignore[k] {
+			return true
+		}
+	}
+	for k := range prev {
+		if _, ok := cur[k]; !ok && !ignore[k] {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff 与上一次回传的条目比较，返回新增、删除和修改的条目，修改的条目为[修改前, 修改后]
+func Diff(prev []map[string]string, cur []map[string]string, keys []string, ignore []string) ([]map[string]string, []map[string]string, [][2]map[string]string) {
+	ignoreKeys := make(map[string]bool)
+	for _, k := range ignore {
+		ignoreKeys[k] = true
+	}
+	prevItems := make(map[string]map[string]string)
+	for _, item := range prev {
+		key := itemKey(item, keys)
+		if _, ok := prevItems[key]; !ok {
+			prevItems[key] = item
+		}
+	}
+	curKeys := make(map[string]bool)
+	var added, removed []map[string]string
+	var changed [][2]map[string]string
+	for _, item := range cur {
+		key := itemKey(item, keys)
+		if curKeys[key] {
+			continue
+		}
+		curKeys[key] = true
+		if p, ok := prevItems[key]; !ok {
+			added = append(added, item)
+		} else if itemChanged(p, item, ignoreKeys) {
+			changed = append(changed, [2]map[string]string{p, item})
+		}
+	}
+	for _, item := range prev {
+		key := itemKey(item, keys)
+		if !curKeys[key] {
+			removed = append(removed, item)
+			curKeys[key] = true
+		}
+	}
+	return added, removed, changed
+}
@@ -0,0 +1,68 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	prev := []map[string]string{
+		{"name": "nginx", "command": "nginx -g daemon off;", "pid": "10"},
+		{"name": "sshd", "command": "/usr/sbin/sshd -D", "pid": "20"},
+		{"name": "cron", "command": "cron -f", "pid": "30"},
+		{"name": "cron", "command": "cron -f", "pid": "31", "user": "root"},
+	}
+	cur := []map[string]string{
+		// pid变化为忽略的字段
+		{"name": "nginx", "command": "nginx -g daemon off;", "pid": "11"},
+		{"name": "sshd", "command": "/usr/sbin/sshd -D", "pid": "20", "user": "root"},
+		{"name": "nc", "command": "nc -l 4444", "pid": "40"},
+		{"name": "nc", "command": "nc -l 4444", "pid": "41"},
+	}
+	added, removed, changed := Diff(prev, cur, Keys["processlist"], Ignore["processlist"])
+	if want := []map[string]string{cur[2]}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+	if want := []map[string]string{prev[2]}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+	if want := [][2]map[string]string{{prev[1], cur[1]}}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+
+	// 字段被删除也算修改
+	added, removed, changed = Diff(cur[1:2], prev[1:2], Keys["processlist"], Ignore["processlist"])
+	if len(added) != 0 || len(removed) != 0 || len(changed) != 1 {
+		t.Errorf("Diff(remove field) = %v %v %v", added, removed, changed)
+	}
+}
+
+func TestDiffIgnore(t *testing.T) {
+	prev := []map[string]string{{"proto": "tcp", "address": "0.0.0.0:22", "pid": "1", "name": "sshd"}}
+	cur := []map[string]string{{"proto": "tcp", "address": "0.0.0.0:22", "pid": "2", "name": "sshd"}}
+	if added, removed, changed := Diff(prev, cur, Keys["listening"], Ignore["listening"]); len(added)+len(removed)+len(changed) != 0 {
+		t.Errorf("Diff(ignored pid) = %v %v %v", added, removed, changed)
+	}
+	// 没有忽略字段时pid变化为修改
+	if _, _, changed := Diff(prev, cur, Keys["listening"], nil); len(changed) != 1 {
+		t.Errorf("Diff(no ignore) changed = %v", changed)
+	}
+	// 识别字段不同为删除和新增
+	cur[0]["proto"] = "udp"
+	if added, removed, changed := Diff(prev, cur, Keys["listening"], Ignore["listening"]); len(added) != 1 || len(removed) != 1 || len(changed) != 0 {
+		t.Errorf("Diff(key changed) = %v %v %v", added, removed, changed)
+	}
+}
+
+func TestDiffEmpty(t *testing.T) {
+	items := []map[string]string{{"name": "root"}, {"name": "guest"}}
+	if added, removed, changed := Diff(nil, items, Keys["userlist"], nil); len(added) != 2 || len(removed) != 0 || len(changed) != 0 {
+		t.Errorf("Diff(nil, items) = %v %v %v", added, removed, changed)
+	}
+	if added, removed, changed := Diff(items, nil, Keys["userlist"], nil); len(added) != 0 || len(removed) != 2 || len(changed) != 0 {
+		t.Errorf("Diff(items, nil) = %v %v %v", added, removed, changed)
+	}
+	if added, removed, changed := Diff(items, items, Keys["userlist"], nil); len(added)+len(removed)+len(changed) != 0 {
+		t.Errorf("Diff(items, items) = %v %v %v", added, removed, changed)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"os"
 	"strings"
 	"time"
+	"yulong-hids/netaddr"
+	"yulong-hids/rule"
 
 	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -23,7 +25,9 @@ var (
 	LocalIP string
 	err     error
 	// RuleDB 存放在mongodb rule 的规则库
-	RuleDB = []ruleInfo{}
+	RuleDB = []rule.Rule{}
+	// HostTags 主机IP对应的标签，用于按标签限定规则的范围
+	HostTags = map[string][]string{}
 )
 
 // DataInfo 从agent接收数据的结构
@@ -66,6 +70,7 @@ type blackList struct {
 	File    []string `bson:"file"`    // 文件hash值
 	IP      []string `bson:"ip"`      // IP地址
 	Process []string `bson:"process"` // 进程名称或者完整命令
+	Domain  []string `bson:"domain"`  // 域名，包含其子域名
 	Other   []string `bson:"other"`   // 其他name
 }
 type whiteListres struct {
@@ -76,6 +81,7 @@ type whiteList struct {
 	File    []string `bson:"file"`    // 文件hash、文件名
 	IP      []string `bson:"ip"`      // IP地址
 	Process []string `bson:"process"` // 进程名、参数
+	Domain  []string `bson:"domain"`  // 域名，包含其子域名
 	Other   []string `bson:"other"`   // 其他name
 }
 
@@ -90,24 +96,6 @@ type serverConfig struct {
 	Notice       notice       // 通知
 }
 
-type rule struct {
-	Type string `json:"type" bson:"type"`
-	Data string `json:"data" bson:"data"`
-}
-
-type ruleInfo struct {
-	Meta struct {
-		Name        string `json:"name" bson:"name"`               // 名称
-		Author      string `json:"author" bson:"author"`           // 编写人
-		Description string `json:"description" bson:"description"` // 描述
-		Level       int    `json:"level" bson:"level"`             // 风险等级
-	} `json:"meta" bson:"meta"` // 规则信息
-	Source string          `json:"source" bson:"source"` // 选择判断来源
-	System string          `json:"system" bson:"system"` // 匹配系统
-	Rules  map[string]rule `json:"rules" bson:"rules"`   // 具体匹配规则
-	And    bool            `json:"and" bson:"and"`       // 规则逻辑
-}
-
 func init() {
 	mongodb = flag.String("db", "", "mongodb ip:port")
 	es = flag.String("es", "", "elasticsearch ip:port")
@@ -134,6 +122,7 @@ func init() {
 	log.Println("Get Config")
 	setConfig()
 	setRules()
+	setHostTags()
 	go esCheckThread()
 }
 func getLocalIP(ip string) (string, error) {
@@ -142,7 +131,7 @@ func getLocalIP(ip string) (string, error) {
 		return "", err
 	}
 	defer conn.Close()
-	return strings.Split(conn.LocalAddr().String(), ":")[0], nil
+	return netaddr.Host(conn.LocalAddr().String()), nil
 }
 
 // setConfig 获取配置文件
@@ -170,16 +159,39 @@ func setConfig() {
 	Config.Notice = res5.Dic
 }
 
-// setRules 获取异常规则集
+// setRules 获取异常规则集，跳过校验失败的规则
 func setRules() {
-	c := DB.C("rules")
-	c.Find(bson.M{"enabled": true}).All(&RuleDB)
+	var rules []rule.Rule
+	DB.C("rules").Find(bson.M{"enabled": true}).All(&rules)
+	valid := []rule.Rule{}
+	for _, r := range rules {
+		if err := rule.Validate(r); err != nil {
+			log.Println("Rule invalid, skipped:", r.Meta.Name, err.Error())
+			continue
+		}
+		valid = append(valid, r)
+	}
+	RuleDB = valid
+}
+
+// setHostTags 获取设置了标签的主机
+func setHostTags() {
+	var clients []struct {
+		IP   string   `bson:"ip"`
+		Tags []string `bson:"tags"`
+	}
+	DB.C("client").Find(bson.M{"tags.0": bson.M{"$exists": true}}).Select(bson.M{"ip": 1, "tags": 1}).All(&clients)
+	tags := make(map[string][]string)
+	for _, c := range clients {
+		tags[c.IP] = c.Tags
+	}
+	HostTags = tags
 }
 
 // regServer 注册为服务，Agent才知道发给谁
 func regServer() {
 	c := DB.C("server")
-	_, err := c.Upsert(bson.M{"netloc": LocalIP + ":33433"}, bson.M{"$set": bson.M{"uptime": time.Now()}})
+	_, err := c.Upsert(bson.M{"netloc": netaddr.JoinHostPort(LocalIP, 33433)}, bson.M{"$set": bson.M{"uptime": time.Now()}})
 	if err != nil {
 		log.Println(err.Error())
 	}
@@ -198,6 +210,7 @@ func Heartbeat() {
 		//TODO:怎么更新的,我只看到查找,没有修改?
 		setConfig()
 		setRules()
+		setHostTags()
 		time.Sleep(time.Second * 30)
 	}
 }
@@ -15,6 +15,15 @@ var processMapping = `
 	"properties": {
 		"data": {
 			"properties": {
+				"container_id": {
+					"type": "keyword"
+				},
+				"container_image": {
+					"type": "keyword"
+				},
+				"pod": {
+					"type": "keyword"
+				},
 				"command": {
 					"type": "text",
 					"fields": {
@@ -63,6 +72,15 @@ var fileMapping = `
 	"properties": {
 		"data": {
 			"properties": {
+				"container_id": {
+					"type": "keyword"
+				},
+				"container_image": {
+					"type": "keyword"
+				},
+				"pod": {
+					"type": "keyword"
+				},
 				"action": {
 					"type": "keyword"
 				},
@@ -86,6 +104,87 @@ var fileMapping = `
 							"type": "keyword"
 						}
 					}
+				},
+				"mode": {
+					"type": "keyword"
+				},
+				"oldmode": {
+					"type": "keyword"
+				},
+				"uid": {
+					"type": "keyword"
+				},
+				"olduid": {
+					"type": "keyword"
+				},
+				"gid": {
+					"type": "keyword"
+				},
+				"oldgid": {
+					"type": "keyword"
+				},
+				"size": {
+					"type": "long"
+				},
+				"oldsize": {
+					"type": "long"
+				},
+				"inode": {
+					"type": "keyword"
+				},
+				"from": {
+					"type": "text",
+					"fields": {
+						"keyword": {
+							"ignore_above": 256,
+							"type": "keyword"
+						}
+					}
+				},
+				"to": {
+					"type": "text",
+					"fields": {
+						"keyword": {
+							"ignore_above": 256,
+							"type": "keyword"
+						}
+					}
+				},
+				"flags": {
+					"type": "keyword"
+				},
+				"changed": {
+					"type": "keyword"
+				},
+				"pid": {
+					"type": "keyword"
+				},
+				"ppid": {
+					"type": "keyword"
+				},
+				"name": {
+					"type": "text",
+					"fields": {
+						"keyword": {
+							"ignore_above": 128,
+							"type": "keyword"
+						}
+					}
+				},
+				"command": {
+					"type": "text",
+					"fields": {
+						"keyword": {
+							"ignore_above": 256,
+							"type": "keyword"
+						}
+					}
+				},
+				"scan": {
+					"type": "keyword"
+				},
+				"watches": {
+					"type": "long"
 				}
 			}
 		},
@@ -149,6 +248,15 @@ var connectionMapping = `
 	"properties": {
 		"data": {
 			"properties": {
+				"container_id": {
+					"type": "keyword"
+				},
+				"container_image": {
+					"type": "keyword"
+				},
+				"pod": {
+					"type": "keyword"
+				},
 				"dir": {
 					"type": "keyword"
 				},
@@ -156,13 +264,25 @@ var connectionMapping = `
 					"type": "text",
 					"fields": {
 						"keyword": {
-							"ignore_above": 25,
+							"ignore_above": 64,
 							"type": "keyword"
 						}
 					}
 				},
 				"local": {
-					"type": "text"
+					"type": "text",
+					"fields": {
+						"keyword": {
+							"ignore_above": 64,
+							"type": "keyword"
+						}
+					}
+				},
+				"remote_ip": {
+					"type": "ip"
+				},
+				"local_ip": {
+					"type": "ip"
 				},
 				"name":{
 					"type":"text",
@@ -190,6 +310,134 @@ var connectionMapping = `
 	}
 }`
 
+var dnsMapping = `
+{
+	"properties": {
+		"data": {
+			"properties": {
+				"container_id": {
+					"type": "keyword"
+				},
+				"container_image": {
+					"type": "keyword"
+				},
+				"pod": {
+					"type": "keyword"
+				},
+				"domain": {
+					"type": "text",
+					"fields": {
+						"keyword": {
+							"ignore_above": 256,
+							"type": "keyword"
+						}
+					}
+				},
+				"qtype": {
+					"type": "keyword"
+				},
+				"rcode": {
+					"type": "keyword"
+				},
+				"answers": {
+					"type": "text"
+				},
+				"server": {
+					"type": "keyword"
+				},
+				"name": {
+					"type": "text",
+					"fields": {
+						"keyword": {
+							"ignore_above": 40,
+							"type": "keyword"
+						}
+					}
+				},
+				"pid": {
+					"type": "keyword"
+				}
+			}
+		},
+		"ip": {
+			"type": "ip"
+		},
+		"time": {
+			"type": "date"
+		}
+	}
+}`
+
+var reverseshellMapping = `
+{
+	"properties": {
+		"data": {
+			"properties": {
+				"container_id": {
+					"type": "keyword"
+				},
+				"container_image": {
+					"type": "keyword"
+				},
+				"pod": {
+					"type": "keyword"
+				},
+				"command": {
+					"type": "text",
+					"fields": {
+						"keyword": {
+							"ignore_above": 256,
+							"type": "keyword"
+						}
+					}
+				},
+				"name": {
+					"type": "keyword"
+				},
+				"parentname": {
+					"type": "keyword"
+				},
+				"pid": {
+					"type": "keyword"
+				},
+				"ppid": {
+					"type": "keyword"
+				},
+				"fds": {
+					"type": "text"
+				},
+				"protocol": {
+					"type": "keyword"
+				},
+				"remote": {
+					"type": "text",
+					"fields": {
+						"keyword": {
+							"ignore_above": 64,
+							"type": "keyword"
+						}
+					}
+				},
+				"local": {
+					"type": "text",
+					"fields": {
+						"keyword": {
+							"ignore_above": 64,
+							"type": "keyword"
+						}
+					}
+				}
+			}
+		},
+		"ip": {
+			"type": "ip"
+		},
+		"time": {
+			"type": "date"
+		}
+	}
+}`
+
 // ESSave 插入es记录结构
 type ESSave struct {
 	IP   string            `json:"ip"`
@@ -283,6 +531,8 @@ func newIndex(name string) {
 	Client.PutMapping().Index(name).Type("connection").BodyString(connectionMapping).Do(context.Background())
 	Client.PutMapping().Index(name).Type("loginlog").BodyString(loginlogMapping).Do(context.Background())
 	Client.PutMapping().Index(name).Type("file").BodyString(fileMapping).Do(context.Background())
+	Client.PutMapping().Index(name).Type("dns").BodyString(dnsMapping).Do(context.Background())
+	Client.PutMapping().Index(name).Type("reverseshell").BodyString(reverseshellMapping).Do(context.Background())
 }
 
 // QueryLogLastTime 查询ip最后一条登录日志的时间
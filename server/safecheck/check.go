@@ -7,10 +7,9 @@ import (
 	"log"
 	"net/http"
 	"regexp"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
+	"yulong-hids/netaddr"
 	"yulong-hids/server/models"
 
 	"gopkg.in/mgo.v2"
@@ -34,6 +33,8 @@ type Check struct {
 	Description string            // 规则简介信息
 	Source      string            // 警报来源
 	Level       int               // 警报等级
+	Technique   []string          // 规则的ATT&CK技术ID
+	Tactic      []string          // 规则的ATT&CK战术ID
 	CStatistics *mgo.Collection   // 统计表
 	CNoice      *mgo.Collection   // 警报表
 }
@@ -42,23 +43,23 @@ type Check struct {
 func (c *Check) BlackFilter() {
 	var keyword string
 	var blackList []string
-	regex := true
+	match := "regex"
 	switch c.Info.Type {
 	case "process":
 		blackList = models.Config.BlackList.Process
 		keyword = c.V["name"]
-	case "connection":
+	case "connection", "loginlog", "reverseshell":
 		blackList = models.Config.BlackList.IP
-		keyword = strings.Split(c.V["remote"], ":")[0]
-		regex = false
-	case "loginlog":
-		blackList = models.Config.BlackList.IP
-		keyword = c.V["remote"]
-		regex = false
+		keyword = netaddr.Host(c.V["remote"])
+		match = "ip"
+	case "dns":
+		blackList = models.Config.BlackList.Domain
+		keyword = c.V["domain"]
+		match = "domain"
 	case "file":
 		blackList = models.Config.BlackList.File
 		keyword = c.V["hash"]
-		regex = false
+		match = "string"
 	case "crontab":
 		blackList = models.Config.BlackList.File
 		keyword = c.V["command"]
@@ -66,8 +67,9 @@ func (c *Check) BlackFilter() {
 		blackList = models.Config.BlackList.Other
 		keyword = c.V["name"]
 	}
-	if len(blackList) >= 1 && inArray(blackList, strings.ToLower(keyword), regex) {
+	if len(blackList) >= 1 && inList(blackList, strings.ToLower(keyword), match) {
 		c.Source = "blacklist"
+		c.Technique, c.Tactic = nil, nil
 		c.Level = 0
 		c.Description = "存在于黑名单列表中"
 		c.Value = keyword
@@ -79,23 +81,23 @@ func (c *Check) BlackFilter() {
 func (c *Check) WhiteFilter() bool {
 	var keyword string
 	var whiteList []string
-	regex := true
+	match := "regex"
 	switch c.Info.Type {
 	case "process":
 		whiteList = models.Config.WhiteList.Process
 		keyword = c.V["name"]
-	case "connection":
-		whiteList = models.Config.WhiteList.IP
-		keyword = strings.Split(c.V["remote"], ":")[0]
-		regex = false
-	case "loginlog":
+	case "connection", "loginlog", "reverseshell":
 		whiteList = models.Config.WhiteList.IP
-		keyword = c.V["remote"]
-		regex = false
+		keyword = netaddr.Host(c.V["remote"])
+		match = "ip"
+	case "dns":
+		whiteList = models.Config.WhiteList.Domain
+		keyword = c.V["domain"]
+		match = "domain"
 	case "file":
 		whiteList = models.Config.WhiteList.File
 		keyword = c.V["hash"]
-		regex = false
+		match = "string"
 	case "crontab":
 		whiteList = models.Config.WhiteList.File
 		keyword = c.V["command"]
@@ -103,7 +105,7 @@ func (c *Check) WhiteFilter() bool {
 		whiteList = models.Config.WhiteList.Other
 		keyword = c.V["name"]
 	}
-	if len(whiteList) >= 1 && inArray(whiteList, strings.ToLower(keyword), regex) {
+	if len(whiteList) >= 1 && inList(whiteList, strings.ToLower(keyword), match) {
 		return true
 	}
 	return false
@@ -112,88 +114,47 @@ func (c *Check) WhiteFilter() bool {
 // Rules 对预定规则解析匹配
 func (c *Check) Rules() {
 	for _, r := range models.RuleDB {
-		var vulInfo []string
-		if (c.Info.System != r.System && r.System != "all") || c.Info.Type != r.Source {
+		if !r.Applies(c.Info.System, c.Info.Type, models.HostTags[c.Info.IP]) {
 			continue
 		}
-		i := len(r.Rules)
-		// log.Println(r.Rules)
-		for k, rule := range r.Rules {
-			switch rule.Type {
-			case "regex":
-				reg := regexp.MustCompile(rule.Data)
-				if reg.MatchString(strings.ToLower(c.V[k])) {
-					i--
-					vulInfo = append(vulInfo, c.V[k])
-				}
-			case "non-regex":
-				reg := regexp.MustCompile(rule.Data)
-				if c.V[k] != "" && !reg.MatchString(strings.ToLower(c.V[k])) {
-					i--
-					vulInfo = append(vulInfo, c.V[k])
-				}
-			case "string":
-				if strings.ToLower(c.V[k]) == strings.ToLower(rule.Data) {
-					i--
-					vulInfo = append(vulInfo, c.V[k])
-				}
-			case "count":
-				if models.Config.Learn {
-					i--
-					vulInfo = append(vulInfo, c.V[k])
-					continue
-				}
-				var statsinfo stats
-				var keyword string
-				if c.Info.Type == "connection" {
-					keyword = strings.Split(c.V[k], ":")[0]
-				} else {
-					keyword = c.V[k]
-				}
-				err := c.CStatistics.Find(bson.M{"type": r.Source, "info": keyword}).One(&statsinfo)
-				if err != nil {
-					log.Println(err.Error(), r.Source, keyword)
-					break
-				}
-				n, err := strconv.Atoi(rule.Data)
-				if err != nil {
-					log.Println(err.Error())
-					break
-				}
-				if statsinfo.Count == n {
-					i--
-					vulInfo = append(vulInfo, c.V[k])
-				}
-			}
-		}
-		if r.And {
-			if i == 0 {
-				c.Source = r.Meta.Name
-				c.Level = r.Meta.Level
-				c.Description = r.Meta.Description
-				sort.Strings(vulInfo)
-				c.Value = strings.Join(vulInfo, "|")
-				c.warning()
-			}
-		} else if i < len(r.Rules) {
+		if ok, value := r.Match(c.V, c.count); ok {
 			c.Source = r.Meta.Name
+			c.Technique, c.Tactic = r.Meta.Technique, r.Meta.Tactic
 			c.Level = r.Meta.Level
 			c.Description = r.Meta.Description
-			sort.Strings(vulInfo)
-			c.Value = strings.Join(vulInfo, "|")
+			c.Value = value
 			c.warning()
 		}
 	}
 }
 
+// count 出现次数等于判断值，观察模式下都视为符合
+func (c *Check) count(source string, key string, value string, n int) bool {
+	if models.Config.Learn {
+		return true
+	}
+	var statsinfo stats
+	keyword := value
+	if c.Info.Type == "connection" {
+		keyword = netaddr.Host(value)
+	}
+	err := c.CStatistics.Find(bson.M{"type": source, "info": keyword}).One(&statsinfo)
+	if err != nil {
+		log.Println(err.Error(), source, keyword)
+		return false
+	}
+	return statsinfo.Count == n
+}
+
 // Intelligence 威胁情报接口检测
 func (c *Check) Intelligence() {
 	if !models.Config.Intelligence.Switch {
 		return
 	}
 	if c.Info.Type == "connection" || c.Info.Type == "loginlog" {
-		ip := strings.Split(c.V["remote"], ":")[0]
-		if isLan(ip) {
+		ip := netaddr.Host(c.V["remote"])
+		// 主机名等无法解析的地址和内网地址不查询
+		if netaddr.Parse(ip) == nil || netaddr.IsLan(ip) {
 			return
 		}
 		if inArray(cache, c.Info.Type+c.Info.IP+ip, false) {
@@ -210,6 +171,7 @@ func (c *Check) Intelligence() {
 		reg := regexp.MustCompile(models.Config.Intelligence.Regex)
 		if reg.Match(body) {
 			c.Source = "威胁情报接口"
+			c.Technique, c.Tactic = nil, nil
 			c.Level = 0
 			c.Description = "威胁情报接口显示此IP存在风险"
 			c.Value = ip
@@ -231,6 +193,7 @@ func (c *Check) Intelligence() {
 			reg := regexp.MustCompile(models.Config.Intelligence.Regex)
 			if reg.Match(body) {
 				c.Source = "威胁情报接口"
+				c.Technique, c.Tactic = nil, nil
 				c.Level = 0
 				c.Description = "威胁情报接口显示此文件存在风险"
 				c.Value = c.V["hash"]
@@ -255,8 +218,16 @@ func (c *Check) warning() {
 		if err != nil {
 			log.Println(err.Error())
 		}
-		err = c.CNoice.Insert(bson.M{"type": c.Info.Type, "ip": c.Info.IP, "source": c.Source, "level": c.Level,
-			"info": c.Value, "description": c.Description, "status": 0, "raw": string(raw), "time": c.Info.Uptime})
+		notice := bson.M{"type": c.Info.Type, "ip": c.Info.IP, "source": c.Source, "level": c.Level,
+			"info": c.Value, "description": c.Description, "status": 0, "raw": string(raw), "time": c.Info.Uptime}
+		// ATT&CK技术和战术，用于按战术统计告警
+		if len(c.Technique) > 0 {
+			notice["technique"] = c.Technique
+		}
+		if len(c.Tactic) > 0 {
+			notice["tactic"] = c.Tactic
+		}
+		err = c.CNoice.Insert(notice)
 		if err == nil {
 			msg := fmt.Sprintf("IP:%s,Type:%s,Info:%s %s", c.Info.IP, c.Info.Type, c.Value, c.Description)
 			sendNotice(c.Level, msg)
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"strconv"
+	"strings"
 	"time"
 	"yulong-hids/server/models"
 
@@ -130,3 +132,73 @@ func firewallCheckThread() {
 		}
 	}
 }
+
+// 一小时内重启次数达到此值时告警
+const restartLimit = 3
+
+// AgentHealth 比较agent本次与上一次回传的健康状态，监控模块停止、内核模块被卸载、
+// agent程序被替换（不是web上传的版本）、频繁重启时产生异常告警
+func AgentHealth(datainfo models.DataInfo) {
+	if len(datainfo.Data) == 0 {
+		return
+	}
+	now := datainfo.Data[0]
+	var prevInfo struct {
+		Data []map[string]string `bson:"data"`
+	}
+	models.DB.C("info").Find(bson.M{"ip": datainfo.IP, "type": "health"}).One(&prevInfo)
+	prev := map[string]string{}
+	if len(prevInfo.Data) != 0 {
+		prev = prevInfo.Data[0]
+	}
+	prevStatus := monitorStatusMap(prev["monitors"])
+	for name, status := range monitorStatusMap(now["monitors"]) {
+		if status == "running" || status == "unsupported" || prevStatus[name] == status {
+			continue
+		}
+		abnormal(datainfo.IP, 1, name+":"+status, fmt.Sprintf("Agent的%s监控未正常运行（%s），可能被入侵者破坏或系统环境不支持。", name, status))
+	}
+	if prev["kernelmodule"] == "true" && now["kernelmodule"] == "false" {
+		abnormal(datainfo.IP, 0, "kernelmodule", "进程监控内核模块被卸载，可能为被入侵者卸载。")
+	}
+	if prev["agenthash"] != "" && now["agenthash"] != "" && prev["agenthash"] != now["agenthash"] {
+		// web上传的agent为正常更新
+		var hashList []string
+		models.DB.C("file").Find(bson.M{"system": datainfo.System, "type": "agent"}).Distinct("hash", &hashList)
+		if !inArray(hashList, now["agenthash"], false) {
+			abnormal(datainfo.IP, 0, now["agenthash"], "Agent程序文件被替换且不是已上传的版本，可能被入侵者篡改。")
+		}
+	}
+	restarts, _ := strconv.Atoi(now["restarts"])
+	prevRestarts, _ := strconv.Atoi(prev["restarts"])
+	if restarts >= restartLimit && prevRestarts < restartLimit {
+		abnormal(datainfo.IP, 1, "restarts:"+now["restarts"], "Agent在一小时内被daemon重启多次，可能运行异常或被反复结束。")
+	}
+}
+
+// monitorStatusMap 解析 名称:状态|名称:状态 格式的监控状态
+func monitorStatusMap(monitors string) map[string]string {
+	statusMap := make(map[string]string)
+	for _, item := range strings.Split(monitors, "|") {
+		if kv := strings.SplitN(item, ":", 2); len(kv) == 2 {
+			statusMap[kv[0]] = kv[1]
+		}
+	}
+	return statusMap
+}
+
+// abnormal 写入异常告警，相同的未处理告警不重复写入
+func abnormal(ip string, level int, info string, description string) {
+	c := models.DB.C("notice")
+	n, _ := c.Find(bson.M{"type": "abnormal", "ip": ip, "info": info, "status": 0}).Count()
+	if n >= 1 {
+		return
+	}
+	err := c.Insert(bson.M{"type": "abnormal", "ip": ip, "source": "服务异常", "level": level,
+		"info": info, "description": description, "status": 0, "time": time.Now()})
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+	sendNotice(level, fmt.Sprintf("IP:%s,Type:%s,Info:%s", ip, "abnormal", description))
+}
@@ -5,34 +5,39 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
-	"strconv"
 	"strings"
+	"yulong-hids/netaddr"
 	"yulong-hids/server/models"
 )
 
-func isLan(ip string) bool {
-	if strings.Count(ip, ".") != 3 {
-		return true
+// inList 名单匹配，match为regex、string、ip（支持IPv4、IPv6和CIDR网段）或domain（包含子域名）
+func inList(list []string, value string, match string) bool {
+	switch match {
+	case "ip":
+		return netaddr.InList(list, value)
+	case "domain":
+		return inDomainList(list, value)
+	case "string":
+		return inArray(list, value, false)
 	}
-	ipInt := ipToInt(ip)
-	if (ipInt >= 167772160 && ipInt <= 184549375) || (ipInt >= 2886729728 && ipInt <= 2887778303) || (ipInt >= 3232235520 && ipInt <= 3232301055) {
-		return true
+	return inArray(list, value, true)
+}
+
+// inDomainList 判断域名是否为名单中的域名或其子域名
+func inDomainList(list []string, domain string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	for _, v := range list {
+		v = strings.TrimPrefix(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(v)), "."), "*.")
+		if v == "" {
+			continue
+		}
+		if domain == v || strings.HasSuffix(domain, "."+v) {
+			return true
+		}
 	}
 	return false
 }
-func ipToInt(ip string) int64 {
-	bits := strings.Split(ip, ".")
-	b0, _ := strconv.Atoi(bits[0])
-	b1, _ := strconv.Atoi(bits[1])
-	b2, _ := strconv.Atoi(bits[2])
-	b3, _ := strconv.Atoi(bits[3])
-	var sum int64
-	sum += int64(b0) << 24
-	sum += int64(b1) << 16
-	sum += int64(b2) << 8
-	sum += int64(b3)
-	return sum
-}
+
 func inArray(list []string, value string, regex bool) bool {
 	for _, v := range list {
 		if regex {
@@ -52,6 +57,7 @@ func inArray(list []string, value string, regex bool) bool {
 	}
 	return false
 }
+
 func sendNotice(level int, info string) error {
 	log.Println(info)
 	if models.Config.Notice.Switch {
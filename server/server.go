@@ -41,7 +41,11 @@ func (w *Watcher) GetInfo(ctx context.Context, info *action.ComputerInfo, result
 	//将ComputerInfo存入MongoDB
 	action.ComputerInfoSave(*info)
 	//根据ComputerInfo的Ip来获取Agent 的信息
-	config := action.GetAgentConfig(info.IP)
+	config, err := action.GetAgentConfig(info.IP)
+	if err != nil {
+		log.Println("getconfig error:", info.IP, err.Error())
+		return err
+	}
 	log.Println("getconfig:", info.IP)
 	*result = config
 	return nil
@@ -55,6 +59,10 @@ func (w *Watcher) PutInfo(ctx context.Context, datainfo *models.DataInfo, result
 	}
 	datainfo.Uptime = time.Now()
 	log.Println("putinfo:", datainfo.IP, datainfo.Type)
+	//健康状态需要与上一次回传的比较,在保存前检测
+	if datainfo.Type == "health" {
+		safecheck.AgentHealth(*datainfo)
+	}
 	//存储信息,根据DataInfo的Type来区分放在es还是MongoDB
 	err := action.ResultSave(*datainfo)
 	if err != nil {
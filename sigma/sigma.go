@@ -0,0 +1,80 @@
+// sigma 将sigma规则转换为驭龙的规则文件，可在web控制台的规则引擎中添加或在安装时上传
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"yulong-hids/rule"
+)
+
+var (
+	output = flag.String("o", "", "输出的规则文件，默认输出到标准输出")
+	enable = flag.Bool("enable", false, "转换后的规则默认启用")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sigma [-o rules.json] [-enable] <sigma规则文件或目录>...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var files []string
+	for _, arg := range flag.Args() {
+		err := filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			ext := strings.ToLower(filepath.Ext(path))
+			if !info.IsDir() && (ext == ".yml" || ext == ".yaml" || path == arg) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	rules := []rule.Rule{}
+	failed := 0
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
+			continue
+		}
+		converted, errs := rule.ConvertSigma(data)
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "[-] %s %v\n", file, err)
+			failed++
+		}
+		for _, r := range converted {
+			r.Enabled = *enable
+			rules = append(rules, r)
+		}
+	}
+
+	res, _ := json.MarshalIndent(rules, "", "  ")
+	if *output == "" {
+		fmt.Println(string(res))
+	} else if err := ioutil.WriteFile(*output, res, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "[*] 转换 %d 条规则，%d 条sigma规则无法转换\n", len(rules), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"yulong-hids/web/models"
+	"yulong-hids/web/settings"
+	"yulong-hids/web/utils"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// AuditController /audit, only admin
+type AuditController struct {
+	BaseController
+}
+
+// Get HTTP method GET, search audit logs, action=export to download
+func (c *AuditController) Get() {
+	auditModel := models.NewAudit()
+	query := c.auditQuery()
+
+	if c.GetString("action") == "export" {
+		res := auditModel.Search(query, 0, settings.AuditExportLimit)
+		filename := "audit-" + time.Now().Format("20060102150405")
+		if c.GetString("format") == "csv" {
+			c.Ctx.Output.Header("Content-Type", "text/csv; charset=utf-8")
+			c.Ctx.Output.Header("Content-Disposition", "attachment; filename="+filename+".csv")
+			c.Ctx.Output.Body(auditCSV(res))
+			return
+		}
+		c.Ctx.Output.Header("Content-Disposition", "attachment; filename="+filename+".json")
+		c.Ctx.Output.JSON(res, true, false)
+		return
+	}
+
+	paginator := c.InitPaginator()
+	start, limit := paginator.ToParameter()
+	c.Data["json"] = auditModel.Search(query, start, limit)
+	c.ServeJSON()
+	return
+}
+
+// auditQuery filter by user, source ip, method, endpoint, time range and keyword
+func (c *AuditController) auditQuery() bson.M {
+	query := bson.M{}
+	for _, key := range []string{"user", "ip", "method"} {
+		if v := c.GetString(key); v != "" {
+			query[key] = v
+		}
+	}
+	if endpoint := c.GetString("endpoint"); endpoint != "" {
+		query["endpoint"] = bson.M{"$regex": regexp.QuoteMeta(endpoint), "$options": "$i"}
+	}
+	timeRange := bson.M{}
+	if start, ok := parseAuditTime(c.GetString("start")); ok {
+		timeRange["$gte"] = start
+	}
+	if end, ok := parseAuditTime(c.GetString("end")); ok {
+		timeRange["$lte"] = end
+	}
+	if len(timeRange) > 0 {
+		query["time"] = timeRange
+	}
+	if q := c.GetString("q"); q != "" {
+		regex := bson.M{"$regex": regexp.QuoteMeta(q), "$options": "$i"}
+		var filterlst []bson.M
+		for _, key := range []string{"user", "ip", "endpoint", "query", "body", "targets", "msg", "changes.name"} {
+			filterlst = append(filterlst, bson.M{key: regex})
+		}
+		query["$or"] = filterlst
+	}
+	return query
+}
+
+// parseAuditTime unix timestamp or date like 2006-01-02 or 2006-01-02 15:04:05
+func parseAuditTime(s string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(ts, 0), true
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func auditCSV(list []models.Audit) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"time", "user", "role", "ip", "method", "endpoint", "query", "body", "targets", "changes", "success", "status", "msg"})
+	for _, a := range list {
+		changes, _ := json.Marshal(a.Changes)
+		w.Write([]string{a.Time.Format("2006-01-02 15:04:05"), a.User, a.Role, a.IP, a.Method, a.Endpoint,
+			a.Query, a.Body, strings.Join(a.Targets, ","), string(changes), strconv.FormatBool(a.Success),
+			strconv.Itoa(a.Status), a.Msg})
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// newAudit audit log of the request, parameters in AuditMaskKeys will be masked
+func newAudit(ctx *context.Context, username string, role string) *models.Audit {
+	audit := models.NewAudit()
+	audit.Time = time.Now()
+	audit.User = username
+	audit.Role = role
+	audit.IP = ctx.Input.IP()
+	audit.Method = ctx.Input.Method()
+	audit.Endpoint = ctx.Input.URL()
+
+	audit.Query = utils.MaskValues(ctx.Request.URL.Query())
+
+	body := ctx.Input.RequestBody
+	var obj interface{}
+	if strings.Contains(ctx.Input.Header("Content-Type"), "application/x-www-form-urlencoded") {
+		values, _ := url.ParseQuery(string(body))
+		body = []byte(utils.MaskValues(values))
+	} else if json.Unmarshal(body, &obj) == nil {
+		obj = utils.MaskBody(obj)
+		body, _ = json.Marshal(obj)
+		audit.Targets = bodyTargets(obj)
+	}
+	if utf8.Valid(body) {
+		if len(body) > settings.AuditBodyLimit {
+			body = body[:settings.AuditBodyLimit]
+		}
+		audit.Body = string(body)
+	}
+	return &audit
+}
+
+// bodyTargets hosts in task host_list or host tag ip list
+func bodyTargets(obj interface{}) []string {
+	v, ok := obj.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var targets []string
+	for _, key := range []string{"host_list", "ip"} {
+		if list, ok := v[key].([]interface{}); ok {
+			for _, item := range list {
+				if s, ok := item.(string); ok {
+					targets = append(targets, s)
+				}
+			}
+		}
+	}
+	return targets
+}
+
+// auditLogin login and logout are recorded without BaseController
+func auditLogin(ctx *context.Context, username string, success bool) {
+	audit := newAudit(ctx, username, "")
+	audit.Status = 200
+	audit.Success = success
+	audit.Append()
+}
+
+// startAudit record the request and snapshot the documents it touches for diff
+func (c *BaseController) startAudit() {
+	c.audit = newAudit(c.Ctx, c.User.Username, c.User.Role)
+	if c.Token != nil {
+		c.audit.Token = c.Token.Name + " " + c.Token.Prefix
+	}
+	for uri, collection := range settings.AuditDiffLst {
+		if matchRoute([]string{uri}, c.Ctx.Input.URL()) != "" {
+			c.auditCollection = collection
+			c.auditIDs = requestIDs(c.Ctx)
+			c.auditBefore = models.AuditSnapshot(collection, c.auditIDs)
+			break
+		}
+	}
+}
+
+// requestIDs id and _id in the json body and the id parameter
+func requestIDs(ctx *context.Context) []string {
+	var ids []string
+	var body map[string]interface{}
+	if json.Unmarshal(ctx.Input.RequestBody, &body) == nil {
+		for _, key := range []string{"id", "_id"} {
+			if id, ok := body[key].(string); ok && id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	if id := ctx.Input.Query("id"); id != "" {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// AuditDocs add the documents created by the request to the diff
+func (c *BaseController) AuditDocs(ids ...bson.ObjectId) {
+	for _, id := range ids {
+		c.auditIDs = append(c.auditIDs, id.Hex())
+	}
+}
+
+// AuditTargets set the final target hosts, such as the task host list after tags are expanded
+func (c *BaseController) AuditTargets(targets []string) {
+	if c.audit != nil {
+		c.audit.Targets = targets
+	}
+}
+
+// finishAudit result of the request and diff of the collection
+func (c *BaseController) finishAudit() {
+	audit := c.audit
+	audit.Status = c.Ctx.Output.Status
+	if audit.Status == 0 {
+		audit.Status = 200
+	}
+	audit.Success = audit.Status < 400
+	switch res := c.Data["json"].(type) {
+	case *models.ErrorInfo:
+		audit.Success = false
+		audit.Msg = res.Msg
+	case bson.M:
+		if msg, ok := res["msg"].(string); ok {
+			audit.Msg = msg
+		}
+	}
+	if c.auditCollection != "" && audit.Success && len(c.auditIDs) > 0 {
+		audit.Changes = models.AuditChanges(c.auditCollection, c.auditIDs, c.auditBefore, audit.Time, audit.User)
+	}
+	audit.Append()
+	beego.Info("Audit:", audit.User, audit.Method, audit.Endpoint, audit.Success)
+}
@@ -2,6 +2,8 @@ package controllers
 
 import (
 	"strings"
+	"sync"
+	"yulong-hids/web/models"
 	"yulong-hids/web/settings"
 	"yulong-hids/web/utils"
 
@@ -13,8 +15,21 @@ import (
 type BaseController struct {
 	beego.Controller
 	IsRoot bool
+	User   models.User   // current login user
+	Token  *models.Token // API token of the request, nil for browser session
+
+	audit           *models.Audit
+	auditCollection string
+	auditIDs        []string // documents touched by the request
+	auditBefore     map[string]bson.M
 }
 
+// tfaHistory the latest TFAMaxTries two factor passwords tried by each user
+var tfaHistory = struct {
+	sync.Mutex
+	m map[string][]uint32
+}{m: make(map[string][]uint32)}
+
 // Prepare access Control, 2FA, csrf check and other security options
 func (c *BaseController) Prepare() {
 
@@ -23,9 +38,7 @@ func (c *BaseController) Prepare() {
 	allowHosts := strings.Split(hostname, ",")
 	if hostname != "" && !utils.StringInSlice(c.Ctx.Input.Host(), allowHosts) {
 		beego.Error("Hostname not correct.")
-		c.Ctx.Output.SetStatus(403)
-		c.Data["json"] = "Forbidden"
-		c.ServeJSON()
+		c.ErrorJSON(403, "Forbidden")
 		return
 	}
 
@@ -38,47 +51,72 @@ func (c *BaseController) Prepare() {
 		return
 	}
 
-	// user login check
-	if !utils.IsDevMode() {
-		username := c.GetSession("user")
-		if username != beego.AppConfig.String("username") {
+	// api token or session login check, disabled or deleted user will be logged out
+	if token := bearerToken(c.Ctx.Input.Header("Authorization")); token != "" {
+		if !c.tokenAuth(token) {
+			beego.Warn("API token invalid:", c.Ctx.Input.IP(), c.Ctx.Input.URL())
+			c.ErrorJSON(401, settings.TokenInvalidFailure)
+			return
+		}
+	} else if utils.IsDevMode() {
+		c.User = models.User{Username: "dev", Role: settings.RoleAdmin, Enabled: true,
+			TOTP: beego.AppConfig.String("TwoFactorAuthKey")}
+	} else {
+		username, _ := c.GetSession("user").(string)
+		var user *models.User
+		if username != "" {
+			userModel := models.NewUser()
+			user = userModel.FindByName(username)
+		}
+		if user == nil || !user.Enabled {
+			c.DelSession("user")
+			// automation api without token gets json instead of the login page
+			if strings.HasPrefix(c.Ctx.Input.URL(), "/api/") {
+				c.ErrorJSON(401, settings.TokenInvalidFailure)
+				return
+			}
 			c.Ctx.Redirect(302, beego.URLFor("LoginController.Get"))
 			return
 		}
+		c.User = *user
+	}
+	c.IsRoot = c.User.Role == settings.RoleAdmin
+
+	// all state-changing requests will be recorded in audit log
+	if c.Ctx.Input.Method() != "GET" {
+		c.startAudit()
+	}
+
+	// role permission check
+	if !c.hasPermission() {
+		beego.Warn("Permission denied:", c.User.Username, c.User.Role, c.Ctx.Input.Method(), c.Ctx.Input.URL())
+		c.ErrorJSON(403, settings.PermissionFailure)
+		return
+	}
+	if c.Token != nil && !c.tokenAllowed() {
+		beego.Warn("API token scope denied:", c.Token.Name, c.User.Username, c.Ctx.Input.Method(), c.Ctx.Input.URL())
+		c.ErrorJSON(403, settings.TokenScopeFailure)
+		return
 	}
 
-	// two factor auth check
+	// two factor auth check, only for browser session
 	tfaSwitch, _ := beego.AppConfig.Bool("TwoFactorAuth")
-	var first uint32
-	if c.Ctx.Input.Method() != "GET" &&
-		tfaSwitch && !WatchModeExempt(c) &&
+	if c.Ctx.Input.Method() != "GET" && c.Token == nil &&
+		tfaSwitch && !WatchModeExempt(c) && !RuleDryRun(c) &&
 		utils.FindSub(settings.AuthURILst, c.Ctx.Input.URL()) != "" {
-		serverside := utils.GetPassword(beego.AppConfig.String("TwoFactorAuthKey"))
-		beego.Debug("GetPassword: ", serverside)
-		// push
-		settings.TFAPassHistorys = append(settings.TFAPassHistorys, serverside)
-		// pop
-		first, settings.TFAPassHistorys = settings.TFAPassHistorys[0], settings.TFAPassHistorys[1:]
-		// only allow to try 6 times
-		if first == serverside {
-			c.Data["json"] = bson.M{"status": false, "msg": "尝试次数太多，请等待30秒后再进行验证"}
-			c.ServeJSON()
-			return
-		}
-		clientside, err := c.GetUint32("pass")
-		if err != nil || serverside != clientside {
-			c.Data["json"] = bson.M{"status": false, "msg": "验证密码为空或者验证密码不正确，请重新输入双因子验证密码"}
+		if msg := c.TFACheck(true); msg != "" {
+			c.Data["json"] = &models.ErrorInfo{Status: false, Code: 403, Msg: msg}
 			c.ServeJSON()
 			return
 		}
 	}
 
-	// csrf check protection
-	if c.Ctx.Input.Method() != "GET" && !utils.IsDevMode() {
+	// csrf check protection, API token is not sent by browser automatically
+	if c.Ctx.Input.Method() != "GET" && c.Token == nil && !utils.IsDevMode() {
 		cookietoken := c.Ctx.GetCookie("request_token")
 		headertoken := c.Ctx.Input.Header("RequestToken")
 		if headertoken != cookietoken {
-			c.Data["json"] = bson.M{"status": false, "msg": "CSRF检测错误，请刷新页面重试。"}
+			c.Data["json"] = &models.ErrorInfo{Status: false, Code: 403, Msg: "CSRF检测错误，请刷新页面重试。"}
 			c.ServeJSON()
 			return
 		}
@@ -102,6 +140,111 @@ func (c *BaseController) Prepare() {
 	beego.Info("Url:", c.Ctx.Request.RequestURI)
 }
 
+// Finish write the audit log after the request
+func (c *BaseController) Finish() {
+	if c.audit != nil {
+		c.finishAudit()
+	}
+}
+
+// hasPermission admin can access all api, others can only access the api in RolePermissions with non-GET method
+func (c *BaseController) hasPermission() bool {
+	return utils.HasPermission(c.User.Role, c.Ctx.Input.Method(), c.Ctx.Input.URL(), routePrefixes()...)
+}
+
+// matchRoute which route of the api namespaces (ApiVer and APIVersion) or the top level
+// pages is the url in
+func matchRoute(routes []string, url string) string {
+	return utils.MatchRoute(routes, url, routePrefixes()...)
+}
+
+// routePrefixes the api namespaces and the top level pages
+func routePrefixes() []string {
+	return []string{"/" + beego.AppConfig.String("ApiVer"), settings.APIVersion, ""}
+}
+
+// ServeJSON failed responses are wrapped in the ErrorInfo envelope, API token requests
+// also get the error code as http status, browser requests keep 200 for the web pages
+func (c *BaseController) ServeJSON(encoding ...bool) {
+	if res := errorEnvelope(c.Data["json"], c.Ctx.Output.Status); res != nil {
+		c.Data["json"] = res
+		if c.Token != nil {
+			c.Ctx.Output.SetStatus(res.Code)
+		}
+	}
+	c.Controller.ServeJSON(encoding...)
+}
+
+// ErrorJSON response the error envelope with the http status code
+func (c *BaseController) ErrorJSON(code int, msg string) {
+	c.Ctx.Output.SetStatus(code)
+	c.Data["json"] = &models.ErrorInfo{Status: false, Code: code, Msg: msg}
+	c.ServeJSON()
+}
+
+// errorEnvelope convert the failed responses of controllers to ErrorInfo, return nil if not failed
+func errorEnvelope(data interface{}, status int) *models.ErrorInfo {
+	code := status
+	if code < 400 {
+		code = 400
+	}
+	switch res := data.(type) {
+	case *models.ErrorInfo:
+		if res.Code == 0 {
+			res.Code = code
+		}
+		return res
+	case *models.CodeInfo:
+		if res.Status == 0 {
+			return &models.ErrorInfo{Status: false, Code: code, Msg: res.Msg}
+		}
+	case bson.M:
+		msg, _ := res["msg"].(string)
+		if err, ok := res["err"].(error); ok {
+			return &models.ErrorInfo{Status: false, Code: code, Msg: err.Error()}
+		}
+		if status, ok := res["status"]; ok && (status == false || status == 0) {
+			return &models.ErrorInfo{Status: false, Code: code, Msg: msg}
+		}
+	}
+	return nil
+}
+
+// TFACheck check the two factor auth password of current user, return the error message
+func (c *BaseController) TFACheck(limit bool) string {
+	// API token requests are authorized by token scopes
+	if c.Token != nil {
+		return ""
+	}
+	if c.User.TOTP == "" {
+		return settings.TOTPEmptyFailure
+	}
+	serverside := utils.GetPassword(c.User.TOTP)
+	beego.Debug("GetPassword: ", serverside)
+	if limit && tfaTooMany(c.User.Username, serverside) {
+		return "尝试次数太多，请等待30秒后再进行验证"
+	}
+	clientside, err := c.GetUint32("pass")
+	if err != nil || serverside != clientside {
+		return "验证密码为空或者验证密码不正确，请重新输入双因子验证密码"
+	}
+	return ""
+}
+
+// tfaTooMany push the password to the history of the user, the oldest one is popped,
+// the same password popped means it has been tried TFAMaxTries times
+func tfaTooMany(username string, pass uint32) bool {
+	tfaHistory.Lock()
+	defer tfaHistory.Unlock()
+	history, ok := tfaHistory.m[username]
+	if !ok {
+		history = make([]uint32, settings.TFAMaxTries)
+	}
+	first := history[0]
+	tfaHistory.m[username] = append(history[1:], pass)
+	return first == pass
+}
+
 // Options : chrome "preflighted" requests first send an HTTP request by the OPTIONS method to the resource on the other domain
 func (c *BaseController) Options() {
 	c.Data["json"] = bson.M{"status": false, "msg": "allow browers look at my CORS HEADERs"}
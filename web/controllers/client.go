@@ -1,10 +1,13 @@
 package controllers
 
 import (
+	"encoding/json"
+	"strings"
 	"yulong-hids/web/models"
 	"yulong-hids/web/settings"
 	"yulong-hids/web/utils"
 
+	"github.com/astaxie/beego"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -21,6 +24,7 @@ func (c *ClientController) Get() {
 	ip := c.GetString("ip")     // client ip for monitor data
 	timeout, _ := c.GetInt("t") // timeout for last seconds
 	filter := c.GetString("q")  // filter for client list, find in mongodb
+	tag := c.GetString("tag")   // tags split by comma, hosts must have all of them
 
 	// when open monitor modal dialog
 	if ip != "" {
@@ -32,19 +36,100 @@ func (c *ClientController) Get() {
 	paginator := c.InitPaginator()
 	start, limit := paginator.ToParameter()
 
+	query := clientQuery(filter, cli)
+	if tags := splitTags(tag); len(tags) > 0 {
+		if query == nil {
+			query = bson.M{}
+		}
+		query["tags"] = bson.M{"$all": tags}
+	}
+
+	json = cli.GetSortedTop(query, start, limit, "health", "ip")
+	c.Data["json"] = json
+	c.ServeJSON()
+	return
+}
+
+// Post http method, bulk assign tags, business, env and owner to hosts
+func (c *ClientController) Post() {
+	cli := models.NewClient()
+	form := models.ClientTagForm{}
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &form); err != nil {
+		beego.Debug("Client tag error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+		c.ServeJSON()
+		return
+	}
+
+	// hosts in ip list first, "all" for all hosts, otherwise same as filter of client list
+	var query bson.M
+	if len(form.IPList) > 0 {
+		query = bson.M{"ip": bson.M{"$in": form.IPList}}
+	} else if form.Query == "all" {
+		query = bson.M{}
+	} else if form.Query != "" {
+		query = clientQuery(form.Query, cli)
+	} else {
+		c.Data["json"] = models.NewErrorInfo(settings.TagHostFailure)
+		c.ServeJSON()
+		return
+	}
+
+	add := splitTags(strings.Join(form.Add, ","))
+	remove := splitTags(strings.Join(form.Remove, ","))
+	meta := bson.M{}
+	if form.Business != nil {
+		meta["business"] = strings.TrimSpace(*form.Business)
+	}
+	if form.Env != nil {
+		meta["env"] = strings.TrimSpace(*form.Env)
+	}
+	if form.Owner != nil {
+		meta["owner"] = strings.TrimSpace(*form.Owner)
+	}
+	if len(add)+len(remove)+len(meta) == 0 {
+		c.Data["json"] = models.NewErrorInfo(settings.TagFormatFailure)
+		c.ServeJSON()
+		return
+	}
+
+	count, err := cli.UpdateTags(query, add, remove, meta)
+	if err != nil {
+		beego.Error("Client tag(model.UpdateTags) error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+	} else {
+		c.Data["json"] = bson.M{"status": true, "count": count}
+	}
+	c.ServeJSON()
+	return
+}
+
+// clientQuery query of client list filter, support "linux", health tags and "tag:xxx"
+func clientQuery(filter string, cli models.Client) bson.M {
 	var query bson.M
 	if filter == "linux" {
 		query = bson.M{"system": bson.M{"$regex": "^((?!windows)[\\s\\S])*$", "$options": "$i"}}
 	} else if flag, exist := settings.ClientHealthTag[filter]; exist {
 		query = bson.M{"health": flag}
+	} else if strings.HasPrefix(filter, settings.TagPrefix) {
+		query = bson.M{"tags": strings.TrimPrefix(filter, settings.TagPrefix)}
 	} else {
 		query = utils.AllKeyRegexQuery(filter, cli)
 	}
+	return query
+}
 
-	json = cli.GetSortedTop(query, start, limit, "health", "ip")
-	c.Data["json"] = json
-	c.ServeJSON()
-	return
+// splitTags split tags by comma and remove the empty ones
+func splitTags(tag string) []string {
+	var tags []string
+	for _, t := range strings.Split(tag, ",") {
+		t = strings.TrimSpace(t)
+		if t != "" && !utils.StringInSlice(t, tags) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
 }
 
 func getMonitorData(ip string, t int) interface{} {
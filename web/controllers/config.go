@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"encoding/json"
+	"yulong-hids/netaddr"
 	"yulong-hids/web/models"
 	"yulong-hids/web/settings"
 	"yulong-hids/web/utils"
@@ -45,6 +46,11 @@ func (c *ConfigController) Edit() {
 		return
 	}
 
+	if !c.canEditConfig(j.Id, j.Key) {
+		c.ErrorJSON(403, settings.PermissionFailure)
+		return
+	}
+
 	res := cli.EditByID(j.Id, j.Key, j.Input)
 	c.Data["json"] = bson.M{"status": res}
 	c.ServeJSON()
@@ -63,6 +69,10 @@ func (c *ConfigController) Del() {
 		c.ServeJSON()
 		return
 	}
+	if !c.canEditConfig(j.Id, j.Key) {
+		c.ErrorJSON(403, settings.PermissionFailure)
+		return
+	}
 	res := cli.DelOne(j.Id, j.Key, j.Input)
 	c.Data["json"] = bson.M{"status": res}
 	c.ServeJSON()
@@ -88,8 +98,33 @@ func (c *ConfigController) Add() {
 		j.Id = config.Id.Hex()
 	}
 
+	if !c.canEditConfig(j.Id, j.Key) {
+		c.ErrorJSON(403, settings.PermissionFailure)
+		return
+	}
+
+	// ip names in blacklist, whitelist and filter accept ip or cidr
+	if j.Key == "ip" && !netaddr.Valid(j.Input) {
+		c.Data["json"] = models.NewErrorInfo(settings.IPFormatFailure)
+		c.ServeJSON()
+		return
+	}
+
 	res := cli.AddOne(j.Id, j.Key, j.Input)
 	c.Data["json"] = bson.M{"status": res}
 	c.ServeJSON()
 	return
 }
+
+// canEditConfig server keys, notice api and other AdminConfigTypes can only be edited by admin
+func (c *ConfigController) canEditConfig(id string, key string) bool {
+	if c.User.Role == settings.RoleAdmin {
+		return true
+	}
+	if !bson.IsObjectIdHex(id) {
+		return false
+	}
+	cli := models.NewConfig()
+	config := cli.FindOne(bson.M{"_id": bson.ObjectIdHex(id)})
+	return config.Type != "" && !utils.ConfigAdminOnly(config.Type, key)
+}
@@ -0,0 +1,532 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"yulong-hids/web/models"
+	"yulong-hids/web/models/wmongo"
+	"yulong-hids/web/settings"
+	"yulong-hids/web/utils"
+
+	"github.com/astaxie/beego"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// IncidentController /incidents, cases grouping notices with assignee, status workflow,
+// comments and linked evidence
+type IncidentController struct {
+	BaseController
+}
+
+// incidentForm post body of incident actions, id is required except for add
+type incidentForm struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Assignee    string   `json:"assignee"`
+	Severity    *int     `json:"severity"`
+	Status      string   `json:"status"`
+	Comment     string   `json:"comment"`
+	Notices     []string `json:"notices"`
+	Remove      []string `json:"remove"`
+	Type        string   `json:"type"`
+	Ref         string   `json:"ref"`
+	Note        string   `json:"note"`
+	Evidence    string   `json:"evidence"`
+}
+
+// Get method, list incidents, or the incident with its notices when id is given,
+// related=event, task or notice lists the events, task results and unlinked notices
+// of its hosts to be linked
+func (c *IncidentController) Get() {
+	incidentModel := models.NewIncident()
+
+	id := c.GetString("id")
+	if id != "" {
+		if !bson.IsObjectIdHex(id) {
+			c.Data["json"] = models.NewErrorInfo(settings.IncidentNotFoundFailure)
+			c.ServeJSON()
+			return
+		}
+		inc, err := incidentModel.Get(bson.ObjectIdHex(id))
+		if err != nil {
+			c.Data["json"] = models.NewErrorInfo(settings.IncidentNotFoundFailure)
+			c.ServeJSON()
+			return
+		}
+		switch c.GetString("related") {
+		case "event":
+			c.Data["json"] = relatedEvents(inc)
+		case "task":
+			c.Data["json"] = relatedTaskResults(inc)
+		case "notice":
+			c.Data["json"] = relatedNotices(inc)
+		default:
+			noticeModel := models.NewNotice()
+			notices := noticeModel.GetSortedTop(bson.M{"incident": inc.Id}, 0, 0, "-time")
+			if notices == nil {
+				notices = []bson.M{}
+			}
+			transitions := settings.IncidentTransitions[inc.Status]
+			c.Data["json"] = bson.M{"incident": inc, "notices": notices, "transitions": transitions}
+		}
+		c.ServeJSON()
+		return
+	}
+
+	paginator := c.InitPaginator()
+	start, limit := paginator.ToParameter()
+
+	query := bson.M{}
+	switch status := c.GetString("status"); status {
+	case "":
+	case "open":
+		query["status"] = bson.M{"$nin": []string{settings.IncidentResolved, settings.IncidentFalsePositive}}
+	default:
+		query["status"] = status
+	}
+	if assignee := c.GetString("assignee"); assignee == "me" {
+		query["assignee"] = c.User.Username
+	} else if assignee != "" {
+		query["assignee"] = assignee
+	}
+	if ip := c.GetString("ip"); ip != "" {
+		query["hosts"] = ip
+	}
+	if q := c.GetString("q"); q != "" {
+		query["title"] = bson.M{"$regex": regexp.QuoteMeta(q), "$options": "i"}
+	}
+	if overdue, _ := c.GetBool("overdue"); overdue {
+		query = utils.MapUpdate(query, models.OverdueQuery(time.Now()))
+	}
+	c.Data["json"] = incidentModel.List(query, start, limit)
+	c.ServeJSON()
+	return
+}
+
+// Post method, action is add, edit, assign, status, severity, comment, notice, evidence or unlink
+func (c *IncidentController) Post() {
+	incidentModel := models.NewIncident()
+	incidentModel.EnsureIndex()
+	action := c.GetString("action")
+
+	var form incidentForm
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &form); err != nil {
+		beego.Debug("Incident form error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+		c.ServeJSON()
+		return
+	}
+
+	if action == "add" {
+		c.Data["json"] = c.addIncident(form)
+		c.ServeJSON()
+		return
+	}
+
+	if !bson.IsObjectIdHex(form.ID) {
+		c.Data["json"] = models.NewErrorInfo(settings.IncidentNotFoundFailure)
+		c.ServeJSON()
+		return
+	}
+	inc, err := incidentModel.Get(bson.ObjectIdHex(form.ID))
+	if err != nil {
+		c.Data["json"] = models.NewErrorInfo(settings.IncidentNotFoundFailure)
+		c.ServeJSON()
+		return
+	}
+
+	var msg string
+	switch action {
+	case "edit":
+		msg = c.editIncident(inc, form)
+	case "assign":
+		msg = c.assignIncident(inc, form.Assignee)
+	case "status":
+		msg = c.changeIncidentStatus(inc, form.Status, form.Comment)
+	case "severity":
+		msg = c.changeIncidentSeverity(inc, form.Severity)
+	case "comment":
+		text := strings.TrimSpace(form.Comment)
+		if text == "" || len(text) > settings.IncidentTextLimit {
+			msg = settings.IncidentCommentFailure
+			break
+		}
+		msg = c.updateIncident(bson.M{"_id": inc.Id}, bson.M{}, "comment", text)
+	case "notice":
+		msg = c.changeIncidentNotices(inc, form.Notices, form.Remove)
+	case "evidence":
+		msg = c.linkEvidence(inc, form.Type, form.Ref, form.Note)
+	case "unlink":
+		msg = c.unlinkEvidence(inc, form.Evidence)
+	default:
+		msg = settings.Failure
+	}
+	if msg != "" {
+		c.Data["json"] = models.NewErrorInfo(msg)
+		c.ServeJSON()
+		return
+	}
+	inc, _ = incidentModel.Get(inc.Id)
+	c.Data["json"] = inc
+	c.ServeJSON()
+	return
+}
+
+// addIncident create an incident and link the notices, severity is optional
+func (c *IncidentController) addIncident(form incidentForm) interface{} {
+	incidentModel := models.NewIncident()
+	incidentModel.Title = strings.TrimSpace(form.Title)
+	incidentModel.Description = form.Description
+	if incidentModel.Title == "" || len(incidentModel.Title) > settings.IncidentTextLimit ||
+		len(form.Description) > settings.IncidentTextLimit {
+		return models.NewErrorInfo(settings.IncidentTitleFailure)
+	}
+	if form.Severity != nil && (*form.Severity < 0 || *form.Severity > 2) {
+		return models.NewErrorInfo(settings.IncidentSeverityFailure)
+	}
+	incidentModel.Severity = form.Severity
+	if form.Assignee != "" && !validAssignee(form.Assignee) {
+		return models.NewErrorInfo(settings.IncidentAssigneeFailure)
+	}
+	incidentModel.Assignee = form.Assignee
+	ids, ok := objectIDs(form.Notices)
+	if !ok || len(ids) > settings.IncidentNoticeLimit {
+		return models.NewErrorInfo(settings.IncidentNoticeFailure)
+	}
+
+	if err := incidentModel.Create(c.User.Username); err != nil {
+		beego.Error("Incident insert error:", err)
+		return models.NewErrorInfo(settings.Failure)
+	}
+	if len(ids) > 0 {
+		noticeModel := models.NewNotice()
+		if !noticeModel.LinkIncident(ids, incidentModel.Id) {
+			incidentModel.Remove(bson.M{"_id": incidentModel.Id})
+			return models.NewErrorInfo(settings.IncidentNoticeFailure)
+		}
+		if err := incidentModel.Refresh(incidentModel.Id); err != nil {
+			beego.Error("Incident refresh error:", err)
+		}
+	}
+	inc, _ := incidentModel.Get(incidentModel.Id)
+	return inc
+}
+
+func (c *IncidentController) editIncident(inc models.Incident, form incidentForm) string {
+	title := strings.TrimSpace(form.Title)
+	if title == "" || len(title) > settings.IncidentTextLimit || len(form.Description) > settings.IncidentTextLimit {
+		return settings.IncidentTitleFailure
+	}
+	set := bson.M{"title": title, "description": form.Description}
+	return c.updateIncident(bson.M{"_id": inc.Id}, bson.M{"$set": set}, "edit", title)
+}
+
+func (c *IncidentController) assignIncident(inc models.Incident, assignee string) string {
+	if assignee != "" && !validAssignee(assignee) {
+		return settings.IncidentAssigneeFailure
+	}
+	return c.updateIncident(bson.M{"_id": inc.Id}, bson.M{"$set": bson.M{"assignee": assignee}}, "assign", assignee)
+}
+
+// changeIncidentStatus follow IncidentTransitions, record the SLA timestamps and
+// change the status of unhandled notices when the incident is closed
+func (c *IncidentController) changeIncidentStatus(inc models.Incident, status string, comment string) string {
+	if !utils.StringInSlice(status, settings.IncidentTransitions[inc.Status]) {
+		return settings.IncidentStatusFailure
+	}
+	if len(comment) > settings.IncidentTextLimit {
+		return settings.IncidentCommentFailure
+	}
+	now := time.Now()
+	set := bson.M{"status": status}
+	update := bson.M{"$set": set}
+	if inc.Responded == nil {
+		set["responded"] = now
+	}
+	if models.IsClosedIncident(status) {
+		set["resolved"] = now
+	} else if inc.Resolved != nil {
+		update["$unset"] = bson.M{"resolved": ""}
+	}
+	text := status
+	if comment = strings.TrimSpace(comment); comment != "" {
+		text = status + ": " + comment
+	}
+	// only update if the status was not changed by others meanwhile
+	query := bson.M{"_id": inc.Id, "status": inc.Status}
+	if msg := c.updateIncident(query, update, "status", text); msg != "" {
+		return msg
+	}
+	if noticeStatus, ok := settings.IncidentNoticeStatus[status]; ok {
+		noticeModel := models.NewNotice()
+		if err := noticeModel.CloseIncident(inc.Id, noticeStatus); err != nil {
+			beego.Error("Incident close notices error:", err)
+		}
+	}
+	return ""
+}
+
+// changeIncidentSeverity override the level of notices, nil or -1 to cancel the override
+func (c *IncidentController) changeIncidentSeverity(inc models.Incident, severity *int) string {
+	incidentModel := models.NewIncident()
+	var update bson.M
+	text := "-1"
+	if severity == nil || *severity == -1 {
+		update = bson.M{"$unset": bson.M{"severity": ""}}
+	} else if *severity < 0 || *severity > 2 {
+		return settings.IncidentSeverityFailure
+	} else {
+		update = bson.M{"$set": bson.M{"severity": *severity}}
+		text = fmt.Sprint(*severity)
+	}
+	if msg := c.updateIncident(bson.M{"_id": inc.Id}, update, "severity", text); msg != "" {
+		return msg
+	}
+	if err := incidentModel.Refresh(inc.Id); err != nil {
+		beego.Error("Incident refresh error:", err)
+	}
+	return ""
+}
+
+// changeIncidentNotices link and remove notices, notices can only be linked to one incident
+func (c *IncidentController) changeIncidentNotices(inc models.Incident, add []string, remove []string) string {
+	incidentModel := models.NewIncident()
+	noticeModel := models.NewNotice()
+	addIDs, ok := objectIDs(add)
+	removeIDs, ok2 := objectIDs(remove)
+	if !ok || !ok2 || len(inc.Notices)+len(addIDs) > settings.IncidentNoticeLimit {
+		return settings.IncidentNoticeFailure
+	}
+	if len(addIDs) > 0 && !noticeModel.LinkIncident(addIDs, inc.Id) {
+		return settings.IncidentNoticeFailure
+	}
+	if len(removeIDs) > 0 {
+		if err := noticeModel.UnlinkIncident(removeIDs, inc.Id); err != nil {
+			beego.Error("Incident unlink notices error:", err)
+			return settings.Failure
+		}
+	}
+	if err := incidentModel.Refresh(inc.Id); err != nil {
+		beego.Error("Incident refresh error:", err)
+		return settings.Failure
+	}
+	text := fmt.Sprintf("+%d -%d", len(addIDs), len(removeIDs))
+	return c.updateIncident(bson.M{"_id": inc.Id}, bson.M{}, "notice", text)
+}
+
+// linkEvidence copy the ES event or task result into the incident
+func (c *IncidentController) linkEvidence(inc models.Incident, etype string, ref string, note string) string {
+	if len(note) > settings.IncidentTextLimit {
+		return settings.IncidentCommentFailure
+	}
+	var evidence *models.Evidence
+	switch etype {
+	case "event":
+		evidence = findEvent(ref)
+	case "task":
+		evidence = findTaskResult(ref)
+	}
+	if evidence == nil {
+		return settings.IncidentEvidenceFailure
+	}
+	for _, e := range inc.Evidence {
+		if e.Type == evidence.Type && e.Ref == evidence.Ref {
+			return ""
+		}
+	}
+	evidence.Id = bson.NewObjectId()
+	evidence.Note = strings.TrimSpace(note)
+	evidence.User = c.User.Username
+	evidence.Linked = time.Now()
+	update := bson.M{"$push": bson.M{"evidence": evidence}}
+	return c.updateIncident(bson.M{"_id": inc.Id}, update, "evidence", "+"+etype+" "+ref)
+}
+
+func (c *IncidentController) unlinkEvidence(inc models.Incident, id string) string {
+	for _, e := range inc.Evidence {
+		if e.Id.Hex() == id {
+			update := bson.M{"$pull": bson.M{"evidence": bson.M{"_id": e.Id}}}
+			return c.updateIncident(bson.M{"_id": inc.Id}, update, "evidence", "-"+e.Type+" "+e.Ref)
+		}
+	}
+	return settings.IncidentEvidenceFailure
+}
+
+// updateIncident apply the update to the incident matching query and record it in comments
+func (c *IncidentController) updateIncident(query bson.M, update bson.M, action string, text string) string {
+	incidentModel := models.NewIncident()
+	comment := models.IncidentComment{User: c.User.Username, Time: time.Now(), Action: action, Text: text}
+	err := incidentModel.Update(query, update, comment)
+	if err == mgo.ErrNotFound {
+		return settings.IncidentConflictFailure
+	}
+	if err != nil {
+		beego.Error("Incident update error:", err)
+		return settings.Failure
+	}
+	return ""
+}
+
+// validAssignee only enabled users can be assigned
+func validAssignee(username string) bool {
+	userModel := models.NewUser()
+	user := userModel.FindByName(username)
+	return user != nil && user.Enabled
+}
+
+// objectIDs convert and deduplicate ids, false if any id is invalid
+func objectIDs(ids []string) ([]bson.ObjectId, bool) {
+	var res []bson.ObjectId
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if !bson.IsObjectIdHex(id) {
+			return nil, false
+		}
+		if !seen[id] {
+			seen[id] = true
+			res = append(res, bson.ObjectIdHex(id))
+		}
+	}
+	return res, true
+}
+
+// incidentWindow time range around the notices of the incident to find related data
+func incidentWindow(inc models.Incident) (time.Time, time.Time) {
+	noticeModel := models.NewNotice()
+	from, to := inc.Created, inc.Created
+	for _, notice := range noticeModel.FindAll(bson.M{"incident": inc.Id}) {
+		if t, ok := notice["time"].(time.Time); ok {
+			if t.Before(from) {
+				from = t
+			}
+			if t.After(to) {
+				to = t
+			}
+		}
+	}
+	window := time.Duration(settings.IncidentRelatedWindow) * time.Hour
+	return from.Add(-window), to.Add(window)
+}
+
+// esEvent a hit of the monitor indexes in elasticsearch
+type esEvent struct {
+	ID     string `json:"_id"`
+	Type   string `json:"_type"`
+	Source struct {
+		IP   string            `json:"ip"`
+		Time time.Time         `json:"time"`
+		Data map[string]string `json:"data"`
+	} `json:"_source"`
+}
+
+func searchEvents(query bson.M) []esEvent {
+	var res struct {
+		Hits struct {
+			Hits []esEvent `json:"hits"`
+		} `json:"hits"`
+	}
+	b, _ := json.Marshal(utils.NewSession().SearchByJSON([]string{"monitor"}, query))
+	json.Unmarshal(b, &res)
+	return res.Hits.Hits
+}
+
+// relatedEvents events of the incident hosts around the notices
+func relatedEvents(inc models.Incident) []esEvent {
+	if len(inc.Hosts) == 0 {
+		return []esEvent{}
+	}
+	from, to := incidentWindow(inc)
+	query := bson.M{
+		"query": bson.M{"bool": bson.M{"must": []bson.M{
+			{"terms": bson.M{"ip": inc.Hosts}},
+			{"range": bson.M{"time": bson.M{"gte": from.UTC().Format(time.RFC3339), "lte": to.UTC().Format(time.RFC3339)}}},
+		}}},
+		"size": settings.IncidentRelatedLimit,
+		"sort": []bson.M{{"time": bson.M{"order": "desc"}}},
+	}
+	res := searchEvents(query)
+	if res == nil {
+		res = []esEvent{}
+	}
+	return res
+}
+
+// relatedTaskResults task results of the incident hosts since the notices
+func relatedTaskResults(inc models.Incident) []bson.M {
+	res := []bson.M{}
+	if len(inc.Hosts) == 0 {
+		return res
+	}
+	from, _ := incidentWindow(inc)
+	taskResultModel := models.NewTaskResult()
+	query := bson.M{"ip": bson.M{"$in": inc.Hosts}, "time": bson.M{"$gte": from}}
+	for _, r := range taskResultModel.GetSortedTop(query, 0, settings.IncidentRelatedLimit, "-time") {
+		r["name"] = taskName(r["task_id"])
+		res = append(res, r)
+	}
+	return res
+}
+
+// relatedNotices notices of the incident hosts around the notices which are not linked to any incident
+func relatedNotices(inc models.Incident) []bson.M {
+	res := []bson.M{}
+	if len(inc.Hosts) == 0 {
+		return res
+	}
+	from, to := incidentWindow(inc)
+	noticeModel := models.NewNotice()
+	query := bson.M{
+		"ip":       bson.M{"$in": inc.Hosts},
+		"time":     bson.M{"$gte": from, "$lte": to},
+		"status":   settings.ValidNoticeQ["status"],
+		"incident": bson.M{"$exists": false},
+	}
+	if notices := noticeModel.GetSortedTop(query, 0, settings.IncidentRelatedLimit, "-time"); notices != nil {
+		res = notices
+	}
+	return res
+}
+
+func findEvent(id string) *models.Evidence {
+	if id == "" {
+		return nil
+	}
+	hits := searchEvents(bson.M{"query": bson.M{"ids": bson.M{"values": []string{id}}}, "size": 1})
+	if len(hits) == 0 {
+		return nil
+	}
+	hit := hits[0]
+	return &models.Evidence{Type: "event", Ref: hit.ID, Source: hit.Type, IP: hit.Source.IP,
+		Time: hit.Source.Time, Data: hit.Source.Data}
+}
+
+func findTaskResult(id string) *models.Evidence {
+	if !bson.IsObjectIdHex(id) {
+		return nil
+	}
+	taskResultModel := models.NewTaskResult()
+	r := taskResultModel.FindByID(bson.ObjectIdHex(id))
+	if r == nil {
+		return nil
+	}
+	ip, _ := r["ip"].(string)
+	t, _ := r["time"].(time.Time)
+	return &models.Evidence{Type: "task", Ref: id, Source: taskName(r["task_id"]), IP: ip, Time: t,
+		Data: bson.M{"task_id": r["task_id"], "status": r["status"], "data": r["data"]}}
+}
+
+func taskName(id interface{}) string {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	var task struct {
+		Name string `bson:"name"`
+	}
+	mConn.DB("").C("task").FindId(id).One(&task)
+	return task.Name
+}
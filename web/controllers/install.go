@@ -94,11 +94,11 @@ func (c *InstallController) Post() {
 	if step == 2 && currentStep == 2 {
 		// init rules
 		ruleModel := models.NewRule()
-		var rulelist []interface{}
-
-		json.Unmarshal(c.Ctx.Input.RequestBody, &rulelist)
-		if err := ruleModel.InsertMany(rulelist); err != nil {
-			beego.Error("Rule InsertMany error:", err)
+		rulelist, msg := decodeRules(c.Ctx.Input.RequestBody)
+		if msg != "" {
+			c.Data["json"] = bson.M{"status": false, "msg": "初始化规则失败，" + msg}
+		} else if _, err := ruleModel.Create(rulelist, "install"); err != nil {
+			beego.Error("Rule Create error:", err)
 			c.Data["json"] = bson.M{"status": false, "msg": "初始化规则失败"}
 		} else {
 			c.Data["json"] = bson.M{"status": true, "msg": "初始化规则成功"}
@@ -290,6 +290,15 @@ func initDB() bson.M {
 		beego.Error("Collection EnsureIndex", err)
 		return bson.M{"status": false, "msg": "create index error"}
 	}
+	userModel := models.NewUser()
+	userModel.EnsureIndex()
+	tokenModel := models.NewToken()
+	tokenModel.EnsureIndex()
+	ruleModel := models.NewRule()
+	ruleModel.EnsureIndex()
+	changeModel := models.NewInfoChange()
+	changeModel.EnsureIndex()
+
 	var defualtConfig []interface{}
 	json.Unmarshal(settings.DefualtConfig, &defualtConfig)
 	err = db.C("config").Insert(defualtConfig...)
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"yulong-hids/netaddr"
+	"yulong-hids/web/models"
+	"yulong-hids/web/settings"
+	"yulong-hids/web/utils"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// InventoryController /inventory, history of the host inventory (users, listening
+// ports, crontab, startup items, services and processes) for one host or fleet-wide
+type InventoryController struct {
+	BaseController
+}
+
+// Get method, changes sorted by time desc. type and action are comma lists, start
+// and end default to the last InventoryDefaultDays days. With hosts=true the
+// matching hosts are listed instead, e.g. hosts which gained a listening port
+func (c *InventoryController) Get() {
+	query := bson.M{}
+	if ip := c.GetString("ip"); ip != "" {
+		if netaddr.Parse(ip) == nil {
+			c.Data["json"] = models.NewErrorInfo(settings.TimelineHostFailure)
+			c.ServeJSON()
+			return
+		}
+		query["ip"] = ip
+	}
+	if s := c.GetString("type"); s != "" {
+		types := strings.Split(s, ",")
+		for _, t := range types {
+			if !utils.StringInSlice(t, settings.InventoryTypes) {
+				c.Data["json"] = models.NewErrorInfo(settings.InventoryTypeFailure)
+				c.ServeJSON()
+				return
+			}
+		}
+		query["type"] = bson.M{"$in": types}
+	}
+	if s := c.GetString("action"); s != "" {
+		actions := strings.Split(s, ",")
+		for _, a := range actions {
+			if !utils.StringInSlice(a, settings.InventoryActions) {
+				c.Data["json"] = models.NewErrorInfo(settings.InventoryActionFailure)
+				c.ServeJSON()
+				return
+			}
+		}
+		query["action"] = bson.M{"$in": actions}
+	}
+
+	end := time.Now()
+	var ok bool
+	if s := c.GetString("end"); s != "" {
+		if end, ok = parseAuditTime(s); !ok {
+			c.Data["json"] = models.NewErrorInfo(settings.TimelineTimeFailure)
+			c.ServeJSON()
+			return
+		}
+	}
+	start := end.AddDate(0, 0, -settings.InventoryDefaultDays)
+	if s := c.GetString("start"); s != "" {
+		if start, ok = parseAuditTime(s); !ok {
+			c.Data["json"] = models.NewErrorInfo(settings.TimelineTimeFailure)
+			c.ServeJSON()
+			return
+		}
+	}
+	if !start.Before(end) {
+		c.Data["json"] = models.NewErrorInfo(settings.TimelineTimeFailure)
+		c.ServeJSON()
+		return
+	}
+	query["time"] = bson.M{"$gte": start, "$lte": end}
+
+	if q := c.GetString("q"); q != "" {
+		regex := bson.M{"$regex": regexp.QuoteMeta(q), "$options": "$i"}
+		var filterlst []bson.M
+		for _, key := range settings.InventoryKeys {
+			filterlst = append(filterlst, bson.M{"data." + key: regex})
+		}
+		query["$or"] = filterlst
+	}
+
+	changeModel := models.NewInfoChange()
+	changeModel.EnsureIndex()
+	paginator := c.InitPaginator()
+	skip, limit := paginator.ToParameter()
+	if hosts, _ := c.GetBool("hosts"); hosts {
+		c.Data["json"] = changeModel.Hosts(query, skip, limit)
+	} else {
+		c.Data["json"] = changeModel.Search(query, skip, limit)
+	}
+	c.ServeJSON()
+	return
+}
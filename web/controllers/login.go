@@ -1,9 +1,13 @@
 package controllers
 
 import (
+	"time"
+	"yulong-hids/web/models"
+	"yulong-hids/web/settings"
 	"yulong-hids/web/utils"
 
 	"github.com/astaxie/beego"
+	"gopkg.in/mgo.v2/bson"
 )
 
 // LoginController /login
@@ -15,6 +19,9 @@ type LoginController struct {
 func (c *LoginController) Get() {
 	c.Ctx.Output.Header("is-login-page", "true")
 	c.Data["Style"] = "login-style"
+	if cfg, ok := utils.LoadOIDCConfig(); ok {
+		c.Data["OIDC"] = cfg.Name
+	}
 	c.TplName = "login.tpl"
 }
 
@@ -23,15 +30,181 @@ func (c *LoginController) Post() {
 	json := map[string]bool{"status": false}
 	username := c.GetString("username")
 	passwd := c.GetString("password")
-	admin := beego.AppConfig.String("username")
-	passhex := beego.AppConfig.String("passwordhex")
-	if username == admin && utils.Md5String(passwd) == passhex {
-		c.SetSession("user", admin)
-		beego.Warn("User Login :", username)
+
+	userModel := models.NewUser()
+	if userModel.CountAll() == 0 {
+		initAdmin(username, passwd)
+	}
+
+	if user := passwordAuth(username, passwd); user != nil && user.Enabled {
+		c.login(user)
 		json["status"] = true
+	} else {
+		beego.Warn("User Login failed :", username)
 	}
+	auditLogin(c.Ctx, username, json["status"])
 
 	c.Data["json"] = json
 	c.ServeJSON()
 	return
 }
+
+// OIDC HTTP method GET, redirect to the OpenID Connect provider
+func (c *LoginController) OIDC() {
+	cfg, ok := utils.LoadOIDCConfig()
+	if !ok {
+		c.Abort("404")
+	}
+	state := utils.RandToken(16)
+	authURL, err := cfg.AuthCodeURL(state)
+	if err != nil {
+		beego.Error("OIDC discovery error:", err)
+		c.Redirect(beego.URLFor("LoginController.Get")+"?error=sso", 302)
+		return
+	}
+	c.SetSession("oidc_state", state)
+	c.Redirect(authURL, 302)
+}
+
+// OIDCCallback HTTP method GET, authorization code callback of the OpenID Connect provider
+func (c *LoginController) OIDCCallback() {
+	cfg, ok := utils.LoadOIDCConfig()
+	if !ok {
+		c.Abort("404")
+	}
+	state, _ := c.GetSession("oidc_state").(string)
+	c.DelSession("oidc_state")
+	oidcUser, err := cfg.Callback(state, c.Ctx.Request.URL.Query())
+	if err != nil {
+		beego.Error("OIDC callback error:", err)
+		c.Redirect(beego.URLFor("LoginController.Get")+"?error=sso", 302)
+		return
+	}
+	user := ssoUser(oidcUser.Username, settings.SourceOIDC, oidcUser.Subject,
+		utils.MapRole(oidcUser.Groups, cfg.RoleMap, cfg.DefaultRole))
+	username := oidcUser.Username
+	if user != nil {
+		username = user.Username
+	}
+	auditLogin(c.Ctx, username, user != nil && user.Enabled)
+	if user == nil || !user.Enabled {
+		beego.Warn("User Login failed :", oidcUser.Username, oidcUser.Subject, oidcUser.Groups)
+		c.Redirect(beego.URLFor("LoginController.Get")+"?error=sso", 302)
+		return
+	}
+	c.login(user)
+	c.Redirect("/#!/", 302)
+}
+
+func (c *LoginController) login(user *models.User) {
+	userModel := models.NewUser()
+	c.SetSession("user", user.Username)
+	beego.Warn("User Login :", user.Username, user.Role, user.Source)
+	if err := userModel.UpdateByID(user.Id, bson.M{"lastlogin": time.Now()}); err != nil {
+		beego.Error("User lastlogin(model.UpdateByID) error:", err)
+	}
+}
+
+// passwordAuth local users always login with local password as break-glass accounts,
+// other users are authenticated by LDAP if configured
+func passwordAuth(username string, passwd string) *models.User {
+	userModel := models.NewUser()
+	user := userModel.FindByName(username)
+	if user != nil && user.Source == "" {
+		if user.CheckPassword(passwd) {
+			return user
+		}
+		return nil
+	}
+	cfg, ok := utils.LoadLDAPConfig()
+	if !ok || (user != nil && user.Source != settings.SourceLDAP) {
+		return nil
+	}
+	groups, err := cfg.Authenticate(username, passwd)
+	if err != nil {
+		if err != utils.ErrLDAPAuth {
+			beego.Error("LDAP authenticate error:", err)
+		}
+		return nil
+	}
+	return ssoUser(username, settings.SourceLDAP, "", utils.MapRole(groups, cfg.RoleMap, cfg.DefaultRole))
+}
+
+// ssoUser create or update the user from LDAP or OIDC, role follows the group mapping on every login,
+// return nil if no role is mapped or the username belongs to another source. OIDC users are matched
+// by subject (issuer and sub), the username claim can be changed by the user and is only used to
+// create the user, so a new subject never takes over an existing username
+func ssoUser(username string, source string, subject string, role string) *models.User {
+	if role == "" {
+		beego.Warn("User has no mapped role :", username, source)
+		return nil
+	}
+	userModel := models.NewUser()
+	var user *models.User
+	if subject != "" {
+		user = userModel.FindBySubject(subject)
+		if user == nil && userModel.FindByName(username) != nil {
+			beego.Warn("User name is taken by another user :", username, source, subject)
+			return nil
+		}
+	} else {
+		user = userModel.FindByName(username)
+	}
+	if user != nil {
+		if user.Source != source {
+			beego.Warn("User source mismatch :", user.Username, user.Source, source)
+			return nil
+		}
+		if user.Role != role {
+			if err := userModel.UpdateByID(user.Id, bson.M{"role": role}); err != nil {
+				beego.Error("User role(model.UpdateByID) error:", err)
+				return nil
+			}
+			user.Role = role
+		}
+		return user
+	}
+	if !userNameReg.MatchString(username) {
+		beego.Warn("User name not allowed :", username, source)
+		return nil
+	}
+	user = &models.User{}
+	*user = models.NewUser()
+	user.Username = username
+	user.Source = source
+	user.Subject = subject
+	user.Role = role
+	user.Enabled = true
+	user.TOTP = utils.GenTOTPKey()
+	if err := user.Save(); err != nil {
+		beego.Error("User insert(model.Save) error:", err)
+		return nil
+	}
+	return user
+}
+
+// initAdmin the account in app.conf becomes the first admin user when users collection is empty,
+// the global TwoFactorAuthKey becomes its totp key
+func initAdmin(username string, passwd string) {
+	if username != beego.AppConfig.String("username") || utils.Md5String(passwd) != beego.AppConfig.String("passwordhex") {
+		return
+	}
+	admin := models.NewUser()
+	admin.Username = username
+	admin.Role = settings.RoleAdmin
+	admin.Enabled = true
+	admin.TOTP = beego.AppConfig.String("TwoFactorAuthKey")
+	if admin.TOTP == "" {
+		admin.TOTP = utils.GenTOTPKey()
+	}
+	if err := admin.SetPassword(passwd); err != nil {
+		beego.Error("User SetPassword error:", err)
+		return
+	}
+	admin.EnsureIndex()
+	if err := admin.Save(); err != nil {
+		beego.Error("User init admin error:", err)
+		return
+	}
+	beego.Warn("Init admin user from app.conf :", username)
+}
@@ -12,7 +12,9 @@ type LogoutController struct {
 
 // Post HTTP method POST
 func (c *LogoutController) Post() {
+	username, _ := c.GetSession("user").(string)
 	c.DelSession("user")
+	auditLogin(c.Ctx, username, true)
 	c.Data["json"] = bson.M{"status": true}
 	c.ServeJSON()
 	return
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"encoding/json"
+	"strings"
 	"yulong-hids/web/models"
 	"yulong-hids/web/settings"
 	"yulong-hids/web/utils"
@@ -40,6 +41,16 @@ func (c *NoticeController) Get() {
 			query["status"] = 0
 		}
 
+		// notices of hosts with the tag
+		tag := c.GetString("tag")
+		if strings.HasPrefix(filter, settings.TagPrefix) {
+			tag, filter = strings.TrimPrefix(filter, settings.TagPrefix), ""
+		}
+		if tag != "" {
+			client := models.NewClient()
+			query["ip"] = bson.M{"$in": client.IPByTag(tag)}
+		}
+
 		queryor := utils.AllKeyRegexQuery(filter, cli)
 		query = utils.MapUpdate(query, queryor)
 
@@ -81,10 +92,8 @@ func (c *NoticeController) ChangeStatus() {
 
 			tfaSwitch, _ := beego.AppConfig.Bool("TwoFactorAuth")
 			if tfaSwitch {
-				serverside := utils.GetPassword(beego.AppConfig.String("TwoFactorAuthKey"))
-				clientside, err := c.GetUint32("pass")
-				if err != nil || serverside != clientside {
-					c.Data["json"] = bson.M{"status": false, "msg": "验证密码为空或者验证密码不正确，请重新输入双因子验证密码"}
+				if msg := c.TFACheck(false); msg != "" {
+					c.Data["json"] = bson.M{"status": false, "msg": msg}
 					c.ServeJSON()
 					return
 				}
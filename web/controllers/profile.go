@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strings"
+	"yulong-hids/profile"
+	"yulong-hids/web/models"
+	"yulong-hids/web/models/wmongo"
+	"yulong-hids/web/settings"
+	"yulong-hids/web/utils"
+
+	"github.com/astaxie/beego"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ProfileController /profile
+type ProfileController struct {
+	BaseController
+}
+
+// Get HTTP method GET, list all profiles
+func (c *ProfileController) Get() {
+	profileModel := models.NewProfile()
+	c.Data["json"] = profileModel.GetSortedTop(nil, 0, 0, "priority", "name")
+	c.ServeJSON()
+	return
+}
+
+// Post HTTP method POST, add a profile or edit it when _id exists
+func (c *ProfileController) Post() {
+	profileModel := models.NewProfile()
+	var p profile.Profile
+
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &p); err != nil {
+		beego.Debug("Profile edit error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.EditProfileFailure)
+		c.ServeJSON()
+		return
+	}
+	if msg := checkProfile(&p); msg != "" {
+		c.Data["json"] = models.NewErrorInfo(msg)
+		c.ServeJSON()
+		return
+	}
+
+	data := bson.M{
+		"name":     p.Name,
+		"priority": p.Priority,
+		"enabled":  p.Enabled,
+		"match":    p.Match,
+		"config":   p.Config,
+	}
+	res := true
+	if p.ID != "" {
+		if err := profileModel.UpdateByID(p.ID, data); err != nil {
+			beego.Error("Profile update(model.UpdateByID) error:", err)
+			res = false
+		}
+	} else {
+		id := bson.NewObjectId()
+		data["_id"] = id
+		if res = profileModel.InsertOne(data); res {
+			c.AuditDocs(id)
+		}
+	}
+	if !res {
+		c.Data["json"] = models.NewErrorInfo(settings.EditProfileFailure)
+	} else {
+		c.Data["json"] = bson.M{"status": true}
+	}
+	c.ServeJSON()
+	return
+}
+
+// Delete HTTP method DELETE
+func (c *ProfileController) Delete() {
+	profileModel := models.NewProfile()
+	id := c.GetString("id")
+	if !bson.IsObjectIdHex(id) {
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+		c.ServeJSON()
+		return
+	}
+	if err := profileModel.Remove(bson.M{"_id": bson.ObjectIdHex(id)}); err != nil {
+		beego.Error("Profile delete error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+	} else {
+		c.Data["json"] = bson.M{"status": true}
+	}
+	c.ServeJSON()
+	return
+}
+
+// Preview HTTP method GET, the config resolved for one host
+func (c *ProfileController) Preview() {
+	ip := c.GetString("ip")
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	resolved, applied, err := profile.Load(mConn.DB(""), ip)
+	if err != nil {
+		beego.Error("Profile preview error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+		c.ServeJSON()
+		return
+	}
+	c.Data["json"] = bson.M{"ip": ip, "config": resolved, "profiles": applied}
+	c.ServeJSON()
+	return
+}
+
+// checkProfile check the profile posted by user, return the error message
+func checkProfile(p *profile.Profile) string {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return settings.ProfileNameFailure
+	}
+	for _, ip := range p.Match.IP {
+		if !profile.ValidIP(ip) {
+			return settings.ProfileIPFailure
+		}
+	}
+	for t, v := range p.Config {
+		dic, ok := v.(map[string]interface{})
+		if !ok || !utils.StringInSlice(t, profile.Types) {
+			return settings.ProfileTypeFailure
+		}
+		// bson skips values of wrong type and the agent would get zero values
+		for k, item := range dic {
+			if !utils.StringInSlice(k, settings.ProfileKeys[t]) {
+				return settings.ProfileKeyFailure
+			}
+			value, ok := utils.ConfigValue(k, item)
+			if !ok {
+				return settings.ProfileKeyFailure
+			}
+			dic[k] = value
+		}
+		p.Config[t] = bson.M(dic)
+	}
+	return ""
+}
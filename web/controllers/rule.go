@@ -1,8 +1,20 @@
 package controllers
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+	"yulong-hids/netaddr"
+	"yulong-hids/rule"
 	"yulong-hids/web/models"
+	"yulong-hids/web/models/wmongo"
+	"yulong-hids/web/settings"
+	"yulong-hids/web/utils"
 
 	"github.com/astaxie/beego"
 
@@ -14,6 +26,23 @@ type RuleController struct {
 	BaseController
 }
 
+// ruleForm post body of edit, enable, del, rollback and test actions
+type ruleForm struct {
+	ID      string          `json:"id"`
+	Enable  bool            `json:"enable"`
+	Version int             `json:"version"`
+	Rule    json.RawMessage `json:"rule"`
+	Days    int             `json:"days"`
+}
+
+// ruleMatch a historical event matched by the tested rule
+type ruleMatch struct {
+	IP    string            `json:"ip"`
+	Time  time.Time         `json:"time"`
+	Value string            `json:"value"`
+	Data  map[string]string `json:"data"`
+}
+
 // Get method
 func (c *RuleController) Get() {
 
@@ -25,11 +54,22 @@ func (c *RuleController) Get() {
 		res = ruleModel.GetAll()
 		for _, rule := range res {
 			delete(rule, "_id")
+			delete(rule, "version")
 		}
 		c.Data["json"] = res
 		c.Ctx.Output.Header("Content-Disposition", "attachment; filename=rules.json")
 		c.Ctx.Output.JSON(res, true, false)
 
+	} else if action == "versions" {
+		// version history of a rule, the rule may have been deleted
+		id := c.GetString("id")
+		if !bson.IsObjectIdHex(id) {
+			c.Data["json"] = models.NewErrorInfo(settings.RuleNotFoundFailure)
+		} else {
+			c.Data["json"] = ruleModel.Versions(bson.ObjectIdHex(id))
+		}
+		c.ServeJSON()
+
 	} else {
 		res = ruleModel.GetAll()
 		c.Data["json"] = res
@@ -38,52 +78,358 @@ func (c *RuleController) Get() {
 	return
 }
 
-// Post method
+// Post method, action is add, edit, enable, del, rollback, validate, test or sigma
 func (c *RuleController) Post() {
 
 	var res interface{}
 	ruleModel := models.NewRule()
 	action := c.GetString("action")
+	body := c.Ctx.Input.RequestBody
 
-	if action == "enable" {
-		// enable or unalbe rule
-		var postjson bson.M
-		json.Unmarshal(c.Ctx.Input.RequestBody, &postjson)
-		idstr := postjson["id"].(string)
-		status := postjson["enable"].(bool)
-		beego.Debug("Rule id and current status:", idstr, status)
-		err := ruleModel.UpdateByID(bson.ObjectIdHex(idstr), bson.M{"enabled": status})
+	var form ruleForm
+	if action != "add" && action != "validate" && action != "sigma" {
+		if err := json.Unmarshal(body, &form); err != nil {
+			c.Data["json"] = models.NewErrorInfo(settings.RuleFormatFailure)
+			c.ServeJSON()
+			return
+		}
+		if action != "test" && !bson.IsObjectIdHex(form.ID) {
+			c.Data["json"] = models.NewErrorInfo(settings.RuleNotFoundFailure)
+			c.ServeJSON()
+			return
+		}
+	}
+	ruleModel.EnsureIndex()
+
+	switch action {
+	case "add":
+		// new rules, a rule list or a single rule, nothing is saved if any rule is invalid
+		rules, msg := decodeRules(body)
+		if msg != "" {
+			res = models.NewErrorInfo(msg)
+			break
+		}
+		rules, err := ruleModel.Create(rules, c.User.Username)
 		if err != nil {
-			beego.Error("Rule change enable(model.UpdateByID):", err)
-			res = bson.M{"err": err}
+			beego.Error("Rule insert(model.Create) error:", err)
+			res = models.NewErrorInfo(settings.RuleSaveFailure)
+		} else {
+			c.auditRules(rules)
+			res = rules
+		}
+
+	case "validate":
+		// dry-run, check rules without saving
+		if _, msg := decodeRules(body); msg != "" {
+			res = models.NewErrorInfo(msg)
 		} else {
-			res = postjson
+			res = bson.M{"status": true}
 		}
-	} else if action == "add" {
-		// new rule
-		var rulelist []interface{}
 
-		json.Unmarshal(c.Ctx.Input.RequestBody, &rulelist)
+	case "edit":
+		r, msg := decodeRule(form.Rule)
+		if msg != "" {
+			res = models.NewErrorInfo(msg)
+			break
+		}
+		res = c.updateRule(bson.ObjectIdHex(form.ID), r, "edit")
 
-		if err := ruleModel.InsertMany(rulelist); err != nil {
-			beego.Error("Rule insert(model.InsertMany) error:", err)
-			res = bson.M{"err": err}
+	case "enable":
+		// enable or unalbe rule
+		id := bson.ObjectIdHex(form.ID)
+		r, err := ruleModel.GetRule(id)
+		if err != nil {
+			res = models.NewErrorInfo(settings.RuleNotFoundFailure)
+			break
+		}
+		beego.Debug("Rule id and current status:", form.ID, form.Enable)
+		r.Enabled = form.Enable
+		action = "disable"
+		if form.Enable {
+			action = "enable"
+		}
+		if _, err := ruleModel.Update(id, r, action, c.User.Username); err != nil {
+			beego.Error("Rule change enable(model.Update):", err)
+			res = models.NewErrorInfo(settings.RuleSaveFailure)
 		} else {
-			res = rulelist
+			res = bson.M{"id": form.ID, "enable": form.Enable}
 		}
 
-	} else if action == "del" {
-		// delete a rule, delete and new is edit
-		var postjson bson.M
-		json.Unmarshal(c.Ctx.Input.RequestBody, &postjson)
-		if err := ruleModel.Remove(bson.M{"_id": bson.ObjectIdHex(postjson["id"].(string))}); err != nil {
-			res = bson.M{"err": err}
+	case "rollback":
+		// restore the rule to a version, a new version is created with the old content
+		id := bson.ObjectIdHex(form.ID)
+		v, err := ruleModel.GetVersion(id, form.Version)
+		if err != nil {
+			res = models.NewErrorInfo(settings.RuleNotFoundFailure)
+			break
+		}
+		res = c.updateRule(id, v.Rule, "rollback")
+
+	case "del":
+		// versions of the deleted rule are kept, it can be restored by rollback
+		if err := ruleModel.Delete(bson.ObjectIdHex(form.ID), c.User.Username); err != nil {
+			beego.Error("Rule delete(model.Delete) error:", err)
+			res = models.NewErrorInfo(settings.RuleNotFoundFailure)
 		} else {
 			res = bson.M{"status": true}
 		}
+
+	case "test":
+		// evaluate a draft rule against the historical events of last days
+		r, msg := decodeRule(form.Rule)
+		if msg != "" {
+			res = models.NewErrorInfo(msg)
+			break
+		}
+		if form.Days <= 0 || form.Days > settings.RuleTestMaxDays {
+			form.Days = 7
+		}
+		res = testRule(r, form.Days)
+
+	case "sigma":
+		// convert sigma rules, they are saved as disabled rules only when save is true
+		res = c.importSigma(c.GetString("save") == "true")
+
+	default:
+		res = models.NewErrorInfo(settings.Failure)
 	}
 
 	c.Data["json"] = res
 	c.ServeJSON()
 	return
 }
+
+// RuleDryRun validate, test and sigma preview actions of /rules do not change rules, two factor auth is not needed
+func RuleDryRun(c *BaseController) bool {
+	if !strings.HasSuffix(c.Ctx.Input.URL(), "rules") {
+		return false
+	}
+	action := c.GetString("action")
+	return action == "validate" || action == "test" || (action == "sigma" && c.GetString("save") != "true")
+}
+
+// importSigma convert sigma rules of the uploaded files or the request body
+func (c *RuleController) importSigma(save bool) interface{} {
+	type sigmaSource struct {
+		name string
+		data []byte
+	}
+	var sources []sigmaSource
+	if files, err := c.GetFiles("file"); err == nil {
+		for _, fh := range files {
+			f, err := fh.Open()
+			if err != nil {
+				beego.Error("Sigma file open error:", err)
+				continue
+			}
+			data, err := ioutil.ReadAll(io.LimitReader(f, settings.SigmaFileLimit))
+			f.Close()
+			if err == nil {
+				sources = append(sources, sigmaSource{fh.Filename, data})
+			}
+		}
+	} else if len(bytes.TrimSpace(c.Ctx.Input.RequestBody)) > 0 {
+		sources = append(sources, sigmaSource{"", c.Ctx.Input.RequestBody})
+	}
+	if len(sources) == 0 {
+		return models.NewErrorInfo(settings.SigmaEmptyFailure)
+	}
+
+	rules := []rule.Rule{}
+	problems := []bson.M{}
+	for _, src := range sources {
+		converted, errs := rule.ConvertSigma(src.data)
+		rules = append(rules, converted...)
+		for _, err := range errs {
+			p := bson.M{"file": src.name, "problems": []string{err.Error()}}
+			if se, ok := err.(*rule.SigmaError); ok {
+				p["title"], p["problems"] = se.Title, se.Problems
+			}
+			problems = append(problems, p)
+		}
+	}
+	if save && len(rules) > 0 {
+		ruleModel := models.NewRule()
+		saved, err := ruleModel.Create(rules, c.User.Username)
+		if err != nil {
+			beego.Error("Sigma rule insert(model.Create) error:", err)
+			return models.NewErrorInfo(settings.RuleSaveFailure)
+		}
+		c.auditRules(saved)
+		rules = saved
+	}
+	return bson.M{"status": true, "saved": save && len(rules) > 0, "rules": rules, "errors": problems}
+}
+
+// auditRules add the created rules to the audit diff
+func (c *RuleController) auditRules(rules []rule.Rule) {
+	for _, r := range rules {
+		c.AuditDocs(r.ID)
+	}
+}
+
+// updateRule save the rule as a new version
+func (c *RuleController) updateRule(id bson.ObjectId, r rule.Rule, action string) interface{} {
+	ruleModel := models.NewRule()
+	if err := rule.Validate(r); err != nil {
+		return models.NewErrorInfo(err.Error())
+	}
+	r, err := ruleModel.Update(id, r, action, c.User.Username)
+	if err != nil {
+		beego.Error("Rule update(model.Update) error:", err)
+		return models.NewErrorInfo(settings.RuleSaveFailure)
+	}
+	return r
+}
+
+// decodeRules decode a rule list or a single rule and validate all of them
+func decodeRules(body []byte) ([]rule.Rule, string) {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(body, &raws); err != nil {
+		raws = []json.RawMessage{body}
+	}
+	if len(raws) == 0 {
+		return nil, settings.RuleFormatFailure
+	}
+	rules := make([]rule.Rule, 0, len(raws))
+	for i, raw := range raws {
+		r, msg := decodeRule(raw)
+		if msg != "" {
+			if len(raws) > 1 {
+				msg = fmt.Sprintf("第%d条规则 %s", i+1, msg)
+			}
+			return nil, msg
+		}
+		rules = append(rules, r)
+	}
+	return rules, ""
+}
+
+// decodeRule decode a rule strictly, unknown fields are not allowed
+func decodeRule(raw []byte) (rule.Rule, string) {
+	var r rule.Rule
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&r); err != nil {
+		return r, fmt.Sprintf("%s: %v", settings.RuleFormatFailure, err)
+	}
+	if err := rule.Validate(r); err != nil {
+		return r, err.Error()
+	}
+	r.ID = ""
+	return r, ""
+}
+
+// testRule match the rule with events in elasticsearch or info in mongodb,
+// count conditions are judged by current statistics
+func testRule(r rule.Rule, days int) bson.M {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+	db := mConn.DB("")
+
+	var hosts []struct {
+		IP     string   `bson:"ip"`
+		System string   `bson:"system"`
+		Tags   []string `bson:"tags"`
+	}
+	if err := db.C("client").Find(nil).Select(bson.M{"ip": 1, "system": 1, "tags": 1}).All(&hosts); err != nil {
+		beego.Error("Rule test client find error:", err)
+	}
+	systems := make(map[string]string)
+	tags := make(map[string][]string)
+	for _, h := range hosts {
+		systems[h.IP] = "linux"
+		if strings.Contains(strings.ToLower(h.System), "windows") {
+			systems[h.IP] = "windows"
+		}
+		tags[h.IP] = h.Tags
+	}
+
+	count := func(source string, key string, value string, n int) bool {
+		keyword := value
+		if source == "connection" {
+			keyword = netaddr.Host(value)
+		}
+		var stats models.Statistics
+		if err := db.C("statistics").Find(bson.M{"type": source, "info": keyword}).One(&stats); err != nil {
+			return false
+		}
+		return stats.Count == n
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	scanned := 0
+	matches := []ruleMatch{}
+	total := 0
+	check := func(ip string, t time.Time, data map[string]string) {
+		scanned++
+		if !r.Applies(systems[ip], r.Source, tags[ip]) {
+			return
+		}
+		if ok, value := r.Match(data, count); ok {
+			total++
+			if len(matches) < settings.RuleTestMatchLimit {
+				matches = append(matches, ruleMatch{IP: ip, Time: t, Value: value, Data: data})
+			}
+		}
+	}
+
+	if !utils.StringInSlice(r.Source, settings.ElasticSearchTypeList) {
+		var infos []models.Info
+		err := db.C("info").Find(bson.M{"type": r.Source, "uptime": bson.M{"$gte": since}}).
+			Limit(settings.RuleTestMaxEvents).All(&infos)
+		if err != nil {
+			beego.Error("Rule test info find error:", err)
+		}
+		for _, info := range infos {
+			for _, data := range info.Data {
+				check(info.Ip, info.Uptime, data)
+			}
+		}
+	} else {
+		query := bson.M{
+			"query": bson.M{"range": bson.M{"time": bson.M{"gte": fmt.Sprintf("now-%dd", days)}}},
+			"size":  settings.RuleTestMaxEvents,
+			"sort":  []bson.M{{"time": bson.M{"order": "desc"}}},
+		}
+		esres := utils.NewSession().SearchByJSON([]string{"monitor", r.Source}, query)
+		for _, hit := range esHits(esres) {
+			var event struct {
+				IP   string            `json:"ip"`
+				Time time.Time         `json:"time"`
+				Data map[string]string `json:"data"`
+			}
+			if json.Unmarshal(hit, &event) == nil {
+				check(event.IP, event.Time, event.Data)
+			}
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Time.After(matches[j].Time) })
+	return bson.M{
+		"status":    true,
+		"days":      days,
+		"scanned":   scanned,
+		"matched":   total,
+		"truncated": scanned >= settings.RuleTestMaxEvents,
+		"matches":   matches,
+	}
+}
+
+// esHits _source of hits in elasticsearch response
+func esHits(res bson.M) []json.RawMessage {
+	var hits struct {
+		Hits struct {
+			Hits []struct {
+				Source json.RawMessage `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	b, _ := json.Marshal(res)
+	json.Unmarshal(b, &hits)
+	sources := make([]json.RawMessage, 0, len(hits.Hits.Hits))
+	for _, hit := range hits.Hits.Hits {
+		sources = append(sources, hit.Source)
+	}
+	return sources
+}
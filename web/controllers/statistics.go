@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"sort"
 	"time"
+	"yulong-hids/rule"
 	"yulong-hids/web/models"
 	"yulong-hids/web/settings"
 	"yulong-hids/web/utils"
@@ -36,6 +38,13 @@ func (c *StatisticsController) Get() {
 	case "total":
 		// nav data for each type count
 		result = getTotalData()
+	case "attack":
+		// ATT&CK coverage of enabled rules and notice count per tactic
+		days, _ := c.GetInt("days", 7)
+		if days <= 0 || days > settings.AttackStatsMaxDays {
+			days = 7
+		}
+		result = getAttackData(days)
 	}
 	c.Data["json"] = result
 	c.ServeJSON()
@@ -236,6 +245,107 @@ func getLineData() bson.M {
 	return result
 }
 
+func getAttackData(days int) bson.M {
+	ruleModel := models.NewRule()
+	rules := ruleModel.Rules(bson.M{"enabled": true})
+
+	// coverage: techniques and rules of each tactic
+	techniques := make(map[string][]string)
+	ruleCount := make(map[string]int)
+	covered := make(map[string]bool)
+	untagged := 0
+	for _, r := range rules {
+		if len(r.Meta.Technique) == 0 && len(r.Meta.Tactic) == 0 {
+			untagged++
+			continue
+		}
+		for _, t := range r.Meta.Technique {
+			covered[t] = true
+		}
+		for _, tactic := range r.Meta.Tactic {
+			ruleCount[tactic]++
+			for _, t := range r.Meta.Technique {
+				if !utils.StringInSlice(t, techniques[tactic]) {
+					techniques[tactic] = append(techniques[tactic], t)
+				}
+			}
+		}
+	}
+
+	// notice count per tactic per day
+	var dates []string
+	today := utils.TodayRounded()
+	for day := days - 1; day >= 0; day-- {
+		dates = append(dates, today.AddDate(0, 0, -day).Format(settings.TimeFormat))
+	}
+	match := bson.M{
+		"time":   bson.M{"$gte": today.AddDate(0, 0, 1-days), "$lt": today.AddDate(0, 0, 1)},
+		"status": settings.ValidNoticeQ["status"],
+		"tactic": bson.M{"$exists": true},
+	}
+	counts := make(map[string][]int)
+	noticeModel := models.NewNotice()
+	for _, res := range noticeModel.CountPerTacticDay(match) {
+		id, _ := res["_id"].(bson.M)
+		tactic, _ := id["tactic"].(string)
+		date, _ := id["d"].(string)
+		if counts[tactic] == nil {
+			counts[tactic] = make([]int, days)
+		}
+		for i, d := range dates {
+			if d == date {
+				counts[tactic][i] += toInt(res["count"])
+			}
+		}
+	}
+
+	var tactics []bson.M
+	var listdata []bson.M
+	for _, t := range rule.Tactics {
+		sort.Strings(techniques[t.ID])
+		if techniques[t.ID] == nil {
+			techniques[t.ID] = []string{}
+		}
+		total := 0
+		for _, n := range counts[t.ID] {
+			total += n
+		}
+		tactics = append(tactics, bson.M{
+			"id":         t.ID,
+			"name":       t.Name,
+			"techniques": techniques[t.ID],
+			"rules":      ruleCount[t.ID],
+			"notices":    total,
+		})
+		if counts[t.ID] == nil {
+			counts[t.ID] = make([]int, days)
+		}
+		listdata = append(listdata, bson.M{"name": t.Name, "type": "line", "data": counts[t.ID]})
+	}
+
+	result := newStatisticsJson(dates, listdata)
+	result["tactics"] = tactics
+	result["coverage"] = bson.M{
+		"techniques": len(covered),
+		"rules":      len(rules),
+		"untagged":   untagged,
+	}
+	return result
+}
+
+// toInt number returned by mongodb aggregate
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
+
 func newStatisticsJson(xdata []string, listdata interface{}) bson.M {
 	var result bson.M
 	result = bson.M{"xdata": xdata, "listdata": listdata}
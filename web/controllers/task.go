@@ -46,6 +46,7 @@ func (c *TaskController) Post() {
 		return
 	}
 	if res := j.Save(); res {
+		c.AuditTargets(j.HostList)
 		json := bson.M{
 			"status": 1,
 			"msg":    "添加任务成功",
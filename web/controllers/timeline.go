@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+	"yulong-hids/netaddr"
+	"yulong-hids/web/models"
+	"yulong-hids/web/settings"
+	"yulong-hids/web/utils"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TimelineController /timeline/:host, events, notices, task results and inventory
+// changes of a host in one stream
+type TimelineController struct {
+	BaseController
+}
+
+// timelineItem an entry of the host timeline
+type timelineItem struct {
+	Time    time.Time   `json:"time"`
+	Source  string      `json:"source"` // event, notice, task or inventory
+	Type    string      `json:"type"`   // type of the event, notice or inventory, task type
+	ID      string      `json:"_id"`
+	Summary string      `json:"summary"`
+	Data    interface{} `json:"data"`
+}
+
+// timelineSummaryKeys fields joined as the summary of events and inventory changes
+var timelineSummaryKeys = map[string][]string{
+	"process":      {"name", "command"},
+	"file":         {"action", "path", "name"},
+	"connection":   {"dir", "protocol", "local", "remote", "name"},
+	"loginlog":     {"username", "remote", "hostname", "status"},
+	"dns":          {"domain", "qtype", "rcode", "answers", "name"},
+	"reverseshell": {"name", "command"},
+	"userlist":     {"name", "description"},
+	"listening":    {"proto", "address", "name"},
+	"crontab":      {"user", "name", "command", "arg"},
+	"startup":      {"name", "location", "command"},
+	"service":      {"name", "pathname", "started"},
+	"processlist":  {"name", "command"},
+}
+
+// Get method, time-ordered stream of the host, newest first. types is a comma list
+// of TimelineTypes, start and end default to the last TimelineDefaultHours hours
+func (c *TimelineController) Get() {
+	host := c.Ctx.Input.Param(":host")
+	if netaddr.Parse(host) == nil {
+		c.Data["json"] = models.NewErrorInfo(settings.TimelineHostFailure)
+		c.ServeJSON()
+		return
+	}
+
+	types := settings.TimelineTypes
+	if s := c.GetString("types"); s != "" {
+		types = strings.Split(s, ",")
+		for _, t := range types {
+			if !utils.StringInSlice(t, settings.TimelineTypes) {
+				c.Data["json"] = models.NewErrorInfo(settings.TimelineTypeFailure)
+				c.ServeJSON()
+				return
+			}
+		}
+	}
+
+	end := time.Now()
+	start := end.Add(-time.Duration(settings.TimelineDefaultHours) * time.Hour)
+	var ok bool
+	if s := c.GetString("end"); s != "" {
+		if end, ok = parseAuditTime(s); !ok {
+			c.Data["json"] = models.NewErrorInfo(settings.TimelineTimeFailure)
+			c.ServeJSON()
+			return
+		}
+		start = end.Add(-time.Duration(settings.TimelineDefaultHours) * time.Hour)
+	}
+	if s := c.GetString("start"); s != "" {
+		if start, ok = parseAuditTime(s); !ok {
+			c.Data["json"] = models.NewErrorInfo(settings.TimelineTimeFailure)
+			c.ServeJSON()
+			return
+		}
+	}
+	if !start.Before(end) {
+		c.Data["json"] = models.NewErrorInfo(settings.TimelineTimeFailure)
+		c.ServeJSON()
+		return
+	}
+
+	paginator := c.InitPaginator()
+	skip, limit := paginator.ToParameter()
+	if limit <= 0 || skip+limit > settings.TimelineMaxEvents {
+		c.Data["json"] = models.NewErrorInfo(settings.TimelinePageFailure)
+		c.ServeJSON()
+		return
+	}
+
+	// the newest skip+limit items of each source are merged, then the page is cut out
+	size := skip + limit
+	var items []timelineItem
+	var events []string
+	for _, t := range types {
+		if utils.StringInSlice(t, settings.TimelineEventTypes) {
+			events = append(events, t)
+		}
+	}
+	if len(events) > 0 {
+		items = append(items, timelineEvents(host, events, start, end, size)...)
+	}
+	if utils.StringInSlice("notice", types) {
+		items = append(items, timelineNotices(host, start, end, size)...)
+	}
+	if utils.StringInSlice("task", types) {
+		items = append(items, timelineTaskResults(host, start, end, size)...)
+	}
+	if utils.StringInSlice("inventory", types) {
+		items = append(items, timelineInventory(host, start, end, size)...)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Time.After(items[j].Time) })
+	res := []timelineItem{}
+	if skip < len(items) {
+		res = items[skip:]
+		if len(res) > limit {
+			res = res[:limit]
+		}
+	}
+	c.Data["json"] = res
+	c.ServeJSON()
+	return
+}
+
+// timelineSummary non-empty values of the summary fields
+func timelineSummary(t string, data map[string]string) string {
+	var values []string
+	for _, key := range timelineSummaryKeys[t] {
+		if data[key] != "" {
+			values = append(values, data[key])
+		}
+	}
+	return strings.Join(values, " ")
+}
+
+func timelineEvents(host string, types []string, start time.Time, end time.Time, size int) []timelineItem {
+	query := bson.M{
+		"query": bson.M{"bool": bson.M{"must": []bson.M{
+			{"term": bson.M{"ip": host}},
+			{"range": bson.M{"time": bson.M{"gte": start.UTC().Format(time.RFC3339), "lte": end.UTC().Format(time.RFC3339)}}},
+		}}},
+		"size": size,
+		"sort": []bson.M{{"time": bson.M{"order": "desc"}}},
+	}
+	var res struct {
+		Hits struct {
+			Hits []esEvent `json:"hits"`
+		} `json:"hits"`
+	}
+	b, _ := json.Marshal(utils.NewSession().SearchByJSON([]string{"monitor", strings.Join(types, ",")}, query))
+	json.Unmarshal(b, &res)
+
+	var items []timelineItem
+	for _, hit := range res.Hits.Hits {
+		items = append(items, timelineItem{
+			Time:    hit.Source.Time,
+			Source:  "event",
+			Type:    hit.Type,
+			ID:      hit.ID,
+			Summary: timelineSummary(hit.Type, hit.Source.Data),
+			Data:    hit.Source.Data,
+		})
+	}
+	return items
+}
+
+func timelineNotices(host string, start time.Time, end time.Time, size int) []timelineItem {
+	noticeModel := models.NewNotice()
+	query := bson.M{"ip": host, "time": bson.M{"$gte": start, "$lte": end}, "status": settings.ValidNoticeQ["status"]}
+	var items []timelineItem
+	for _, n := range noticeModel.GetSortedTop(query, 0, size, "-time") {
+		t, _ := n["time"].(time.Time)
+		ntype, _ := n["type"].(string)
+		source, _ := n["source"].(string)
+		info, _ := n["info"].(string)
+		id, _ := n["_id"].(bson.ObjectId)
+		delete(n, "_id")
+		delete(n, "ip")
+		items = append(items, timelineItem{
+			Time:    t,
+			Source:  "notice",
+			Type:    ntype,
+			ID:      id.Hex(),
+			Summary: source + ": " + info,
+			Data:    n,
+		})
+	}
+	return items
+}
+
+func timelineTaskResults(host string, start time.Time, end time.Time, size int) []timelineItem {
+	taskResultModel := models.NewTaskResult()
+	query := bson.M{"ip": host, "time": bson.M{"$gte": start, "$lte": end}}
+	var items []timelineItem
+	for _, r := range taskResultModel.GetSortedTop(query, 0, size, "-time") {
+		t, _ := r["time"].(time.Time)
+		status, _ := r["status"].(string)
+		id, _ := r["_id"].(bson.ObjectId)
+		name := taskName(r["task_id"])
+		items = append(items, timelineItem{
+			Time:    t,
+			Source:  "task",
+			Type:    "task",
+			ID:      id.Hex(),
+			Summary: name + " " + status,
+			Data:    bson.M{"task_id": r["task_id"], "name": name, "status": status, "data": r["data"]},
+		})
+	}
+	return items
+}
+
+func timelineInventory(host string, start time.Time, end time.Time, size int) []timelineItem {
+	changeModel := models.NewInfoChange()
+	changeModel.EnsureIndex()
+	query := bson.M{"ip": host, "time": bson.M{"$gte": start, "$lte": end}}
+	var items []timelineItem
+	for _, change := range changeModel.Search(query, 0, size) {
+		sign := "+"
+		switch change.Action {
+		case "remove":
+			sign = "-"
+		case "change":
+			sign = "~"
+		}
+		items = append(items, timelineItem{
+			Time:    change.Time,
+			Source:  "inventory",
+			Type:    change.Type,
+			ID:      change.Id.Hex(),
+			Summary: sign + " " + timelineSummary(change.Type, change.Data),
+			Data:    bson.M{"action": change.Action, "data": change.Data, "prev": change.Prev},
+		})
+	}
+	return items
+}
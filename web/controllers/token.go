@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+	"yulong-hids/web/models"
+	"yulong-hids/web/settings"
+	"yulong-hids/web/utils"
+
+	"github.com/astaxie/beego"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TokenController /token, API tokens of current user, admin can see and revoke all tokens
+type TokenController struct {
+	BaseController
+}
+
+// Get HTTP method GET, list tokens of current user, all=true for all users (admin)
+func (c *TokenController) Get() {
+	tokenModel := models.NewToken()
+	query := bson.M{"user": c.User.Username}
+	if all, _ := c.GetBool("all"); all && c.IsRoot {
+		query = bson.M{}
+	}
+	c.Data["json"] = tokenModel.List(query)
+	c.ServeJSON()
+	return
+}
+
+// Post HTTP method POST, create a token and return it, the token will only be showed once
+func (c *TokenController) Post() {
+	form := models.TokenForm{}
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &form); err != nil {
+		beego.Debug("Token add error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+		c.ServeJSON()
+		return
+	}
+
+	msg := ""
+	form.Name = strings.TrimSpace(form.Name)
+	if form.Name == "" {
+		msg = settings.TokenNameFailure
+	} else if form.Expires < 1 || form.Expires > settings.TokenMaxDays {
+		msg = settings.TokenExpiresFailure
+	} else if len(form.Scopes) == 0 {
+		msg = settings.TokenScopesFailure
+	}
+	for _, scope := range form.Scopes {
+		if _, ok := settings.TokenScopes[scope]; !ok {
+			msg = settings.TokenScopesFailure
+		}
+	}
+	if msg != "" {
+		c.Data["json"] = models.NewErrorInfo(msg)
+		c.ServeJSON()
+		return
+	}
+
+	token := settings.TokenPrefix + utils.RandToken(20)
+	t := models.NewToken()
+	t.Name = form.Name
+	t.User = c.User.Username
+	t.Scopes = form.Scopes
+	t.Expires = time.Now().AddDate(0, 0, form.Expires)
+	t.EnsureIndex()
+	if err := t.Save(token); err != nil {
+		beego.Error("Token insert(model.Save) error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+		c.ServeJSON()
+		return
+	}
+	c.AuditTargets([]string{t.Name + " " + t.Prefix})
+	c.Data["json"] = bson.M{"status": true, "token": token, "data": t}
+	c.ServeJSON()
+	return
+}
+
+// Delete HTTP method DELETE, revoke a token by ?id=
+func (c *TokenController) Delete() {
+	tokenModel := models.NewToken()
+	id := c.GetString("id")
+	if !bson.IsObjectIdHex(id) {
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+		c.ServeJSON()
+		return
+	}
+	query := bson.M{"_id": bson.ObjectIdHex(id)}
+	if !c.IsRoot {
+		query["user"] = c.User.Username
+	}
+	if err := tokenModel.Remove(query); err != nil {
+		beego.Error("Token remove error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+	} else {
+		c.Data["json"] = bson.M{"status": true}
+	}
+	c.ServeJSON()
+	return
+}
+
+// bearerToken API token in Authorization header, empty if not a bearer token
+func bearerToken(header string) string {
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// tokenAuth the token must not be expired and its user must be enabled
+func (c *BaseController) tokenAuth(token string) bool {
+	if !strings.HasPrefix(token, settings.TokenPrefix) {
+		return false
+	}
+	tokenModel := models.NewToken()
+	t := tokenModel.FindByToken(token)
+	if t == nil || time.Now().After(t.Expires) {
+		return false
+	}
+	userModel := models.NewUser()
+	user := userModel.FindByName(t.User)
+	if user == nil || !user.Enabled {
+		return false
+	}
+	t.Touch(c.Ctx.Input.IP())
+	c.User = *user
+	c.Token = t
+	return true
+}
+
+// tokenAllowed GET requests need the read scope, others need the scope of the url
+func (c *BaseController) tokenAllowed() bool {
+	url := c.Ctx.Input.URL()
+	if c.Ctx.Input.Method() == "GET" {
+		return utils.StringInSlice("read", c.Token.Scopes) && matchRoute(settings.TokenScopes["read"], url) != ""
+	}
+	for _, scope := range c.Token.Scopes {
+		if scope != "read" && matchRoute(settings.TokenScopes[scope], url) != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"yulong-hids/web/models"
+	"yulong-hids/web/settings"
+	"yulong-hids/web/utils"
+
+	"github.com/astaxie/beego"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var userNameReg = regexp.MustCompile(`^[\w.@-]{2,32}$`)
+
+// UserController /user, only admin
+type UserController struct {
+	BaseController
+}
+
+// Get HTTP method GET, list all users
+func (c *UserController) Get() {
+	userModel := models.NewUser()
+	c.Data["json"] = userModel.List()
+	c.ServeJSON()
+	return
+}
+
+// Post HTTP method POST, add a user and return its totp key
+func (c *UserController) Post() {
+	userModel := models.NewUser()
+	form := models.UserForm{}
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &form); err != nil {
+		beego.Debug("User add error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+		c.ServeJSON()
+		return
+	}
+
+	msg := ""
+	if !userNameReg.MatchString(form.Username) {
+		msg = settings.UserNameFailure
+	} else if len(form.Password) < 8 {
+		msg = settings.PasswordFailure
+	} else if !utils.StringInSlice(form.Role, settings.RoleList) {
+		msg = settings.RoleFailure
+	} else if userModel.FindByName(form.Username) != nil {
+		msg = settings.UserExistFailure
+	}
+	if msg != "" {
+		c.Data["json"] = models.NewErrorInfo(msg)
+		c.ServeJSON()
+		return
+	}
+
+	user := models.NewUser()
+	user.Username = form.Username
+	user.Role = form.Role
+	user.Enabled = true
+	user.TOTP = utils.GenTOTPKey()
+	if err := user.SetPassword(form.Password); err != nil {
+		beego.Error("User SetPassword error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+		c.ServeJSON()
+		return
+	}
+	if err := user.Save(); err != nil {
+		beego.Error("User insert(model.Save) error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+		c.ServeJSON()
+		return
+	}
+	c.Data["json"] = totpInfo(user.Username, user.TOTP)
+	c.ServeJSON()
+	return
+}
+
+// Put HTTP method PUT, edit role, enabled, password or reset totp key of a user
+func (c *UserController) Put() {
+	userModel := models.NewUser()
+	form := models.UserForm{}
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &form); err != nil {
+		beego.Debug("User edit error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+		c.ServeJSON()
+		return
+	}
+	user := userModel.FindByName(form.Username)
+	if user == nil {
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+		c.ServeJSON()
+		return
+	}
+
+	data := bson.M{}
+	if form.Role != "" && form.Role != user.Role {
+		if !utils.StringInSlice(form.Role, settings.RoleList) {
+			c.Data["json"] = models.NewErrorInfo(settings.RoleFailure)
+			c.ServeJSON()
+			return
+		}
+		data["role"] = form.Role
+	}
+	if form.Enabled != nil && *form.Enabled != user.Enabled {
+		data["enabled"] = *form.Enabled
+	}
+	// admin can not lock himself out, and there must be an enabled admin
+	if _, ok := data["role"]; ok || data["enabled"] == false {
+		if user.Username == c.User.Username {
+			c.Data["json"] = models.NewErrorInfo(settings.UserSelfFailure)
+			c.ServeJSON()
+			return
+		}
+		if user.Role == settings.RoleAdmin && user.Enabled && c.enabledAdmin() <= 1 {
+			c.Data["json"] = models.NewErrorInfo(settings.LastAdminFailure)
+			c.ServeJSON()
+			return
+		}
+	}
+	if form.Password != "" {
+		if user.Source != "" {
+			c.Data["json"] = models.NewErrorInfo(settings.SSOUserFailure)
+			c.ServeJSON()
+			return
+		}
+		if len(form.Password) < 8 {
+			c.Data["json"] = models.NewErrorInfo(settings.PasswordFailure)
+			c.ServeJSON()
+			return
+		}
+		if err := user.SetPassword(form.Password); err != nil {
+			beego.Error("User SetPassword error:", err)
+			c.Data["json"] = models.NewErrorInfo(settings.Failure)
+			c.ServeJSON()
+			return
+		}
+		data["password"] = user.Password
+	}
+	if form.ResetTOTP {
+		data["totp"] = utils.GenTOTPKey()
+	}
+	if len(data) == 0 {
+		c.Data["json"] = bson.M{"status": true}
+		c.ServeJSON()
+		return
+	}
+
+	if err := userModel.UpdateByID(user.Id, data); err != nil {
+		beego.Error("User update(model.UpdateByID) error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+		c.ServeJSON()
+		return
+	}
+	if form.ResetTOTP {
+		c.Data["json"] = totpInfo(user.Username, data["totp"].(string))
+	} else {
+		c.Data["json"] = bson.M{"status": true}
+	}
+	c.ServeJSON()
+	return
+}
+
+// Delete HTTP method DELETE
+func (c *UserController) Delete() {
+	userModel := models.NewUser()
+	user := userModel.FindByName(c.GetString("username"))
+	if user == nil {
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+		c.ServeJSON()
+		return
+	}
+	if user.Username == c.User.Username {
+		c.Data["json"] = models.NewErrorInfo(settings.UserSelfFailure)
+		c.ServeJSON()
+		return
+	}
+	if user.Role == settings.RoleAdmin && user.Enabled && c.enabledAdmin() <= 1 {
+		c.Data["json"] = models.NewErrorInfo(settings.LastAdminFailure)
+		c.ServeJSON()
+		return
+	}
+	if err := userModel.Remove(bson.M{"_id": user.Id}); err != nil {
+		beego.Error("User remove error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+	} else {
+		c.Data["json"] = bson.M{"status": true}
+	}
+	c.ServeJSON()
+	return
+}
+
+// enabledAdmin count of enabled admin users
+func (c *UserController) enabledAdmin() int {
+	userModel := models.NewUser()
+	return userModel.Count(bson.M{"role": settings.RoleAdmin, "enabled": true})
+}
+
+// totpInfo totp key will only be showed once, scan the uri with Google Authenticator
+func totpInfo(username string, key string) bson.M {
+	uri := "otpauth://totp/" + url.PathEscape("yulong:"+username) + "?secret=" + key + "&issuer=yulong"
+	return bson.M{"status": true, "username": username, "totp": key, "uri": uri}
+}
+
+// AccountController /account, current login user
+type AccountController struct {
+	BaseController
+}
+
+// Get HTTP method GET, current user and role
+func (c *AccountController) Get() {
+	c.Data["json"] = bson.M{
+		"username":    c.User.Username,
+		"role":        c.User.Role,
+		"source":      c.User.Source,
+		"permissions": settings.RolePermissions[c.User.Role],
+	}
+	c.ServeJSON()
+	return
+}
+
+// Post HTTP method POST, change password of current user
+func (c *AccountController) Post() {
+	userModel := models.NewUser()
+	form := models.PasswordForm{}
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &form); err != nil {
+		beego.Debug("Account password error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+		c.ServeJSON()
+		return
+	}
+	if c.User.Source != "" {
+		c.Data["json"] = models.NewErrorInfo(settings.SSOUserFailure)
+		c.ServeJSON()
+		return
+	}
+	if !c.User.CheckPassword(form.Old) {
+		c.Data["json"] = models.NewErrorInfo(settings.OldPassFailure)
+		c.ServeJSON()
+		return
+	}
+	if len(form.New) < 8 {
+		c.Data["json"] = models.NewErrorInfo(settings.PasswordFailure)
+		c.ServeJSON()
+		return
+	}
+	if err := c.User.SetPassword(form.New); err != nil {
+		beego.Error("User SetPassword error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+		c.ServeJSON()
+		return
+	}
+	if err := userModel.UpdateByID(c.User.Id, bson.M{"password": c.User.Password}); err != nil {
+		beego.Error("User update(model.UpdateByID) error:", err)
+		c.Data["json"] = models.NewErrorInfo(settings.Failure)
+	} else {
+		c.Data["json"] = bson.M{"status": true}
+	}
+	c.ServeJSON()
+	return
+}
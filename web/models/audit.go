@@ -0,0 +1,241 @@
+package models
+
+import (
+	"reflect"
+	"sort"
+	"time"
+	"yulong-hids/rule"
+	"yulong-hids/web/models/wmongo"
+	"yulong-hids/web/settings"
+	"yulong-hids/web/utils"
+
+	"github.com/astaxie/beego"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Audit audit log of console actions, append only, never updated or removed by web.
+// With mongodb::audit_url it is saved by a user without update and remove privileges
+type Audit struct {
+	Id        bson.ObjectId `bson:"_id,omitempty" json:"_id,omitempty"`
+	Time      time.Time     `bson:"time"          json:"time"`
+	User      string        `bson:"user"          json:"user"`
+	Role      string        `bson:"role"          json:"role"`
+	Token     string        `bson:"token"         json:"token"` // name and prefix of the API token
+	IP        string        `bson:"ip"            json:"ip"`
+	Method    string        `bson:"method"        json:"method"`
+	Endpoint  string        `bson:"endpoint"      json:"endpoint"`
+	Query     string        `bson:"query"         json:"query"`
+	Body      string        `bson:"body"          json:"body"`
+	Targets   []string      `bson:"targets"       json:"targets"`
+	Changes   []AuditChange `bson:"changes"       json:"changes"`
+	Success   bool          `bson:"success"       json:"success"`
+	Status    int           `bson:"status"        json:"status"`
+	Msg       string        `bson:"msg"           json:"msg"`
+	baseModel `bson:",inline"`
+}
+
+// AuditChange before and after of one changed document, nil before is added and nil after is deleted
+type AuditChange struct {
+	ID     string `bson:"id"     json:"id"`
+	Name   string `bson:"name"   json:"name"`
+	Before bson.M `bson:"before" json:"before"`
+	After  bson.M `bson:"after"  json:"after"`
+}
+
+func NewAudit() Audit {
+	mdl := Audit{}
+	mdl.collectionName = "audit"
+	return mdl
+}
+
+// Append insert the audit log
+func (c *Audit) Append() {
+	mConn := wmongo.AuditConn()
+	defer mConn.Close()
+
+	c.Id = bson.NewObjectId()
+	if err := mConn.DB("").C(c.collectionName).Insert(c); err != nil {
+		beego.Error("Audit insert error:", err, c.User, c.Endpoint)
+	}
+}
+
+// Search find audit logs sorted by time desc
+func (c *Audit) Search(query bson.M, start int, limit int) []Audit {
+	mConn := wmongo.AuditConn()
+	defer mConn.Close()
+
+	res := []Audit{}
+	err := mConn.DB("").C(c.collectionName).Find(query).Sort("-time").Skip(start).Limit(limit).All(&res)
+	if err != nil {
+		beego.Error("Audit find error:", err, query)
+	}
+	return res
+}
+
+// AuditQuery query of the documents with the ids, an id which is not ObjectId hex is
+// the type of a config document, such as blacklist
+func AuditQuery(ids []string) bson.M {
+	var oids []bson.ObjectId
+	var types []string
+	for _, id := range ids {
+		if bson.IsObjectIdHex(id) {
+			oids = append(oids, bson.ObjectIdHex(id))
+		} else if id != "" {
+			types = append(types, id)
+		}
+	}
+	var or []bson.M
+	if len(oids) > 0 {
+		or = append(or, bson.M{"_id": bson.M{"$in": oids}})
+	}
+	if len(types) > 0 {
+		or = append(or, bson.M{"type": bson.M{"$in": types}})
+	}
+	if len(or) == 0 {
+		return nil
+	}
+	return bson.M{"$or": or}
+}
+
+// Snapshot documents matched by the query by id, for the before and after diff
+func Snapshot(collection string, query bson.M) map[string]bson.M {
+	res := make(map[string]bson.M)
+	if query == nil {
+		return res
+	}
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	var docs []bson.M
+	if err := mConn.DB("").C(collection).Find(query).All(&docs); err != nil {
+		beego.Error("Audit snapshot error:", err, collection)
+	}
+	for _, doc := range docs {
+		if id, ok := doc["_id"].(bson.ObjectId); ok {
+			res[id.Hex()] = maskSecret(doc)
+		}
+	}
+	return res
+}
+
+// AuditSnapshot documents touched by the request before it is handled, rules are not
+// snapshot, their changes come from the rule versions
+func AuditSnapshot(collection string, ids []string) map[string]bson.M {
+	if collection == NewRule().collectionName {
+		return nil
+	}
+	return Snapshot(collection, AuditQuery(ids))
+}
+
+// AuditChanges changed documents of the request, ids are the documents in the request
+// and the documents created by it
+func AuditChanges(collection string, ids []string, before map[string]bson.M, since time.Time, user string) []AuditChange {
+	if collection == NewRule().collectionName {
+		return ruleChanges(ids, since, user)
+	}
+	return Diff(before, Snapshot(collection, AuditQuery(ids)))
+}
+
+// ruleChanges changes of the rules from the versions saved by the user since the time,
+// the version before them is the content before the request
+func ruleChanges(ids []string, since time.Time, user string) []AuditChange {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	// time is saved in milliseconds by mongodb
+	since = since.Truncate(time.Millisecond)
+	var changes []AuditChange
+	for _, id := range ids {
+		if !bson.IsObjectIdHex(id) {
+			continue
+		}
+		var versions []RuleVersion
+		err := mConn.DB("").C(ruleVersionCollection).Find(bson.M{"rule_id": bson.ObjectIdHex(id)}).Sort("version").All(&versions)
+		if err != nil {
+			beego.Error("Audit rule versions error:", err, id)
+			continue
+		}
+		first := -1
+		for i, v := range versions {
+			if v.User == user && !v.Time.Before(since) {
+				first = i
+				break
+			}
+		}
+		if first < 0 {
+			continue
+		}
+		var before, after bson.M
+		if first > 0 && versions[first-1].Action != "del" {
+			before = ruleDoc(versions[first-1].Rule)
+		}
+		if last := versions[len(versions)-1]; last.Action != "del" {
+			after = ruleDoc(last.Rule)
+		}
+		if before == nil && after == nil {
+			continue
+		}
+		name := docName(after)
+		if after == nil {
+			name = docName(before)
+		}
+		changes = append(changes, AuditChange{ID: id, Name: name, Before: before, After: after})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].ID < changes[j].ID })
+	return changes
+}
+
+func ruleDoc(r rule.Rule) bson.M {
+	var doc bson.M
+	if data, err := bson.Marshal(r); err == nil {
+		bson.Unmarshal(data, &doc)
+	}
+	return doc
+}
+
+// Diff changed documents between two snapshots
+func Diff(before map[string]bson.M, after map[string]bson.M) []AuditChange {
+	var changes []AuditChange
+	for id, doc := range before {
+		if newDoc, ok := after[id]; !ok {
+			changes = append(changes, AuditChange{ID: id, Name: docName(doc), Before: doc})
+		} else if !reflect.DeepEqual(doc, newDoc) {
+			changes = append(changes, AuditChange{ID: id, Name: docName(newDoc), Before: doc, After: newDoc})
+		}
+	}
+	for id, doc := range after {
+		if _, ok := before[id]; !ok {
+			changes = append(changes, AuditChange{ID: id, Name: docName(doc), After: doc})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].ID < changes[j].ID })
+	return changes
+}
+
+// docName config type, rule name or profile name
+func docName(doc bson.M) string {
+	if t, ok := doc["type"].(string); ok {
+		return t
+	}
+	if meta, ok := doc["meta"].(bson.M); ok {
+		if name, ok := meta["name"].(string); ok {
+			return name
+		}
+	}
+	name, _ := doc["name"].(string)
+	return name
+}
+
+// maskSecret keys in server config will be saved as md5
+func maskSecret(doc bson.M) bson.M {
+	dic, ok := doc["dic"].(bson.M)
+	if !ok {
+		return doc
+	}
+	for _, key := range settings.SecretKeyLst {
+		if v, ok := dic[key].(string); ok {
+			dic[key] = utils.Md5String(v)
+		}
+	}
+	return doc
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"time"
+	"yulong-hids/web/models/wmongo"
 
 	"gopkg.in/mgo.v2/bson"
 )
@@ -12,6 +13,11 @@ type Client struct {
 	System   string        `bson:"system"   json:"system"`
 	Hostname string        `bson:"hostname" json:"hostname"`
 	Type     string        `bson:"type"     json:"type"`
+	Roles    []string      `bson:"roles"    json:"roles"`
+	Tags     []string      `bson:"tags"     json:"tags"`
+	Business string        `bson:"business" json:"business"`
+	Env      string        `bson:"env"      json:"env"`
+	Owner    string        `bson:"owner"    json:"owner"`
 	Uptime   time.Time     `bson:"uptime"   json:"uptime,omitempty"`
 	baseModel
 }
@@ -21,3 +27,40 @@ func NewClient() Client {
 	mdl.collectionName = "client"
 	return mdl
 }
+
+// IPByTag ip list of hosts with the tag
+func (c *Client) IPByTag(tag string) []string {
+	iplist := []string{}
+	for _, ip := range c.Distinct(bson.M{"tags": tag}, "ip") {
+		iplist = append(iplist, ip.(string))
+	}
+	return iplist
+}
+
+// UpdateTags add or remove tags and set business, env and owner of all hosts in query
+func (c *Client) UpdateTags(query bson.M, add []string, remove []string, meta bson.M) (int, error) {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+	collection := mConn.DB("").C(c.collectionName)
+
+	// $addToSet and $pull can not update the same field at once
+	var updates []bson.M
+	if len(add) > 0 {
+		updates = append(updates, bson.M{"$addToSet": bson.M{"tags": bson.M{"$each": add}}})
+	}
+	if len(remove) > 0 {
+		updates = append(updates, bson.M{"$pull": bson.M{"tags": bson.M{"$in": remove}}})
+	}
+	if len(meta) > 0 {
+		updates = append(updates, bson.M{"$set": meta})
+	}
+	matched := 0
+	for _, update := range updates {
+		info, err := collection.UpdateAll(query, update)
+		if err != nil {
+			return matched, err
+		}
+		matched = info.Matched
+	}
+	return matched, nil
+}
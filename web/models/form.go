@@ -23,6 +23,47 @@ type EditCfgForm struct {
 	Input string `form:"input" valid:"Required"`
 }
 
+// ClientTagForm bulk assign tags and ownership to hosts in ip list or query
+type ClientTagForm struct {
+	Query    string   `json:"q"`
+	IPList   []string `json:"ip"`
+	Add      []string `json:"add"`
+	Remove   []string `json:"remove"`
+	Business *string  `json:"business"`
+	Env      *string  `json:"env"`
+	Owner    *string  `json:"owner"`
+}
+
+// UserForm add or edit a user, empty password and nil enabled will not be changed
+type UserForm struct {
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Role      string `json:"role"`
+	Enabled   *bool  `json:"enabled"`
+	ResetTOTP bool   `json:"resettotp"`
+}
+
+// PasswordForm change password of current user
+type PasswordForm struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// ErrorInfo JSON error envelope of all failed api responses,
+// code is the http status of the error, also used as response status for API token requests
+type ErrorInfo struct {
+	Status bool   `json:"status"`
+	Code   int    `json:"code"`
+	Msg    string `json:"msg"`
+}
+
+// TokenForm create an API token, expires in days
+type TokenForm struct {
+	Name    string   `json:"name"`
+	Scopes  []string `json:"scopes"`
+	Expires int      `json:"expires"`
+}
+
 type CodeInfo struct {
 	Status int               `json:"status"`
 	Msg    string            `json:"msg"`
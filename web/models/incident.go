@@ -0,0 +1,212 @@
+package models
+
+import (
+	"time"
+	"yulong-hids/web/models/wmongo"
+	"yulong-hids/web/settings"
+	"yulong-hids/web/utils"
+
+	"github.com/astaxie/beego"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Incident a case grouping related notices, handled by the assignee through the status workflow
+type Incident struct {
+	Id          bson.ObjectId     `bson:"_id,omitempty"      json:"_id,omitempty"`
+	Title       string            `bson:"title"              json:"title"`
+	Description string            `bson:"description"        json:"description"`
+	Status      string            `bson:"status"             json:"status"`
+	Level       int               `bson:"level"              json:"level"`              // highest level of the notices
+	Severity    *int              `bson:"severity,omitempty" json:"severity,omitempty"` // set by analyst, overrides level
+	Assignee    string            `bson:"assignee"           json:"assignee"`
+	Creator     string            `bson:"creator"            json:"creator"`
+	Notices     []bson.ObjectId   `bson:"notices"            json:"notices"`
+	Hosts       []string          `bson:"hosts"              json:"hosts"`
+	Evidence    []Evidence        `bson:"evidence"           json:"evidence"`
+	Comments    []IncidentComment `bson:"comments"           json:"comments"`
+	Created     time.Time         `bson:"created"            json:"created"`
+	Updated     time.Time         `bson:"updated"            json:"updated"`
+	// SLA, responded when the status leaves new, resolved when it is closed
+	Responded   *time.Time `bson:"responded,omitempty" json:"responded,omitempty"`
+	Resolved    *time.Time `bson:"resolved,omitempty"  json:"resolved,omitempty"`
+	ResponseDue time.Time  `bson:"response_due"        json:"response_due"`
+	ResolveDue  time.Time  `bson:"resolve_due"         json:"resolve_due"`
+	baseModel   `bson:",inline"`
+}
+
+// Evidence ES event or task result linked to the incident, the data is copied
+// when linked because old ES indexes and task results may be removed
+type Evidence struct {
+	Id     bson.ObjectId `bson:"_id"    json:"_id"`
+	Type   string        `bson:"type"   json:"type"`   // event or task
+	Ref    string        `bson:"ref"    json:"ref"`    // _id of the event in ES or the task result
+	Source string        `bson:"source" json:"source"` // type of the event, name of the task
+	IP     string        `bson:"ip"     json:"ip"`
+	Time   time.Time     `bson:"time"   json:"time"`
+	Data   interface{}   `bson:"data"   json:"data"`
+	Note   string        `bson:"note"   json:"note"`
+	User   string        `bson:"user"   json:"user"`
+	Linked time.Time     `bson:"linked" json:"linked"`
+}
+
+// IncidentComment comment of analyst, or record of changes such as status and assignee
+type IncidentComment struct {
+	User   string    `bson:"user"   json:"user"`
+	Time   time.Time `bson:"time"   json:"time"`
+	Action string    `bson:"action" json:"action"` // comment, status, assign, severity, edit, notice, evidence
+	Text   string    `bson:"text"   json:"text"`
+}
+
+func NewIncident() Incident {
+	mdl := Incident{}
+	mdl.collectionName = "incident"
+	return mdl
+}
+
+// EffectiveLevel severity set by analyst, otherwise the highest level of notices
+func (c *Incident) EffectiveLevel() int {
+	if c.Severity != nil {
+		return *c.Severity
+	}
+	return c.Level
+}
+
+// IsClosedIncident status is resolved or false positive
+func IsClosedIncident(status string) bool {
+	_, ok := settings.IncidentNoticeStatus[status]
+	return ok
+}
+
+// slaDue response and resolve deadline of the level since created
+func slaDue(created time.Time, level int) (time.Time, time.Time) {
+	if level < 0 || level >= len(settings.IncidentResponseSLA) {
+		level = len(settings.IncidentResponseSLA) - 1
+	}
+	return created.Add(time.Duration(settings.IncidentResponseSLA[level]) * time.Hour),
+		created.Add(time.Duration(settings.IncidentResolveSLA[level]) * time.Hour)
+}
+
+// OverdueQuery open incidents which are not responded or resolved in time
+func OverdueQuery(now time.Time) bson.M {
+	return bson.M{"$or": []bson.M{
+		{"status": settings.IncidentNew, "response_due": bson.M{"$lt": now}},
+		{"resolved": bson.M{"$exists": false}, "resolve_due": bson.M{"$lt": now}},
+	}}
+}
+
+// List incidents without comments and evidence, latest updated first
+func (c *Incident) List(query bson.M, start int, limit int) []Incident {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	res := []Incident{}
+	err := mConn.DB("").C(c.collectionName).Find(query).Select(bson.M{"comments": 0, "evidence": 0}).
+		Sort("-updated").Skip(start).Limit(limit).All(&res)
+	if err != nil {
+		beego.Error("Incident find error:", err)
+	}
+	return res
+}
+
+// Get find an incident by id
+func (c *Incident) Get(id bson.ObjectId) (Incident, error) {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	var res Incident
+	err := mConn.DB("").C(c.collectionName).FindId(id).One(&res)
+	return res, err
+}
+
+// Create insert the incident as new, notices should be linked after
+func (c *Incident) Create(user string) error {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	now := time.Now()
+	c.Id = bson.NewObjectId()
+	c.Status = settings.IncidentNew
+	c.Creator = user
+	c.Level = len(settings.IncidentResponseSLA) - 1
+	c.Notices, c.Hosts, c.Evidence = []bson.ObjectId{}, []string{}, []Evidence{}
+	c.Comments = []IncidentComment{{User: user, Time: now, Action: "status", Text: settings.IncidentNew}}
+	c.Created, c.Updated = now, now
+	c.ResponseDue, c.ResolveDue = slaDue(now, c.EffectiveLevel())
+	return mConn.DB("").C(c.collectionName).Insert(c)
+}
+
+// Update apply the update operators to the incident matching query, record the comments
+// and update time, mgo.ErrNotFound if no incident matches
+func (c *Incident) Update(query bson.M, update bson.M, comments ...IncidentComment) error {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+	}
+	set["updated"] = time.Now()
+	update["$set"] = set
+	if len(comments) > 0 {
+		push, _ := update["$push"].(bson.M)
+		if push == nil {
+			push = bson.M{}
+		}
+		push["comments"] = bson.M{"$each": comments}
+		update["$push"] = push
+	}
+	return mConn.DB("").C(c.collectionName).Update(query, update)
+}
+
+// Refresh notices, hosts, level and SLA deadlines of the incident from the linked notices
+func (c *Incident) Refresh(id bson.ObjectId) error {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	inc, err := c.Get(id)
+	if err != nil {
+		return err
+	}
+	var notices []struct {
+		Id    bson.ObjectId `bson:"_id"`
+		Ip    string        `bson:"ip"`
+		Level int           `bson:"level"`
+	}
+	err = mConn.DB("").C("notice").Find(bson.M{"incident": id}).
+		Select(bson.M{"_id": 1, "ip": 1, "level": 1}).Sort("time").All(&notices)
+	if err != nil {
+		return err
+	}
+	inc.Notices, inc.Hosts = []bson.ObjectId{}, []string{}
+	inc.Level = len(settings.IncidentResponseSLA) - 1
+	for _, n := range notices {
+		inc.Notices = append(inc.Notices, n.Id)
+		if !utils.StringInSlice(n.Ip, inc.Hosts) {
+			inc.Hosts = append(inc.Hosts, n.Ip)
+		}
+		if n.Level < inc.Level {
+			inc.Level = n.Level
+		}
+	}
+	inc.ResponseDue, inc.ResolveDue = slaDue(inc.Created, inc.EffectiveLevel())
+	return mConn.DB("").C(c.collectionName).UpdateId(id, bson.M{"$set": bson.M{
+		"notices":      inc.Notices,
+		"hosts":        inc.Hosts,
+		"level":        inc.Level,
+		"response_due": inc.ResponseDue,
+		"resolve_due":  inc.ResolveDue,
+	}})
+}
+
+// EnsureIndex incidents are listed by status and assignee
+func (c *Incident) EnsureIndex() {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	for _, key := range [][]string{{"status", "-updated"}, {"assignee", "-updated"}} {
+		if err := mConn.DB("").C(c.collectionName).EnsureIndex(mgo.Index{Key: key}); err != nil {
+			beego.Error("Incident EnsureIndex error:", err)
+		}
+	}
+}
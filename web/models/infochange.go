@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+	"yulong-hids/web/models/wmongo"
+	"yulong-hids/web/settings"
+
+	"github.com/astaxie/beego"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// InfoChange item added to, removed from or changed in the inventory of a host,
+// recorded by server when the info is reported
+type InfoChange struct {
+	Id        bson.ObjectId     `bson:"_id,omitempty"  json:"_id,omitempty"`
+	Ip        string            `bson:"ip"             json:"ip"`
+	Type      string            `bson:"type"           json:"type"`
+	Action    string            `bson:"action"         json:"action"` // add, remove or change
+	Data      map[string]string `bson:"data"           json:"data"`
+	Prev      map[string]string `bson:"prev,omitempty" json:"prev,omitempty"` // item before the change
+	Time      time.Time         `bson:"time"           json:"time"`
+	baseModel `bson:",inline"`
+}
+
+// InfoChangeHost hosts matching the changes, with the count and the last time
+type InfoChangeHost struct {
+	Ip    string    `bson:"_id"   json:"ip"`
+	Count int       `bson:"count" json:"count"`
+	Types []string  `bson:"types" json:"types"`
+	Last  time.Time `bson:"last"  json:"last"`
+}
+
+func NewInfoChange() InfoChange {
+	mdl := InfoChange{}
+	mdl.collectionName = "info_change"
+	return mdl
+}
+
+// Search changes sorted by time desc
+func (c *InfoChange) Search(query bson.M, start int, limit int) []InfoChange {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	res := []InfoChange{}
+	err := mConn.DB("").C(c.collectionName).Find(query).Sort("-time").Skip(start).Limit(limit).All(&res)
+	if err != nil {
+		beego.Error("InfoChange find error:", err)
+	}
+	return res
+}
+
+// Hosts group the changes by host, sorted by the last change
+func (c *InfoChange) Hosts(query bson.M, start int, limit int) []InfoChangeHost {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	res := []InfoChangeHost{}
+	pipeline := []bson.M{
+		{"$match": query},
+		{"$group": bson.M{"_id": "$ip", "count": bson.M{"$sum": 1}, "types": bson.M{"$addToSet": "$type"}, "last": bson.M{"$max": "$time"}}},
+		{"$sort": bson.M{"last": -1}},
+		{"$skip": start},
+		{"$limit": limit},
+	}
+	if err := mConn.DB("").C(c.collectionName).Pipe(pipeline).All(&res); err != nil {
+		beego.Error("InfoChange aggregate error:", err)
+	}
+	return res
+}
+
+// EnsureIndex changes are searched by host and time or by type fleet-wide,
+// and expire after InventoryKeepDays
+func (c *InfoChange) EnsureIndex() {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	indexes := []mgo.Index{
+		{Key: []string{"ip", "-time"}},
+		{Key: []string{"type", "action", "-time"}},
+		{Key: []string{"time"}, ExpireAfter: time.Duration(settings.InventoryKeepDays) * 24 * time.Hour},
+	}
+	for _, index := range indexes {
+		if err := mConn.DB("").C(c.collectionName).EnsureIndex(index); err != nil {
+			beego.Error("InfoChange EnsureIndex error:", err)
+		}
+	}
+}
@@ -20,6 +20,11 @@ type Notice struct {
 	Ip     string        `bson:"ip"   json:"ip"`
 	Source string        `bson:"source"   json:"source"`
 	Level  int           `bson:"level"   json:"level"`
+	// ATT&CK technique and tactic IDs of the rule
+	Technique []string `bson:"technique,omitempty" json:"technique,omitempty"`
+	Tactic    []string `bson:"tactic,omitempty"    json:"tactic,omitempty"`
+	// incident which the notice is linked to
+	Incident bson.ObjectId `bson:"incident,omitempty" json:"incident,omitempty"`
 	baseModel
 }
 
@@ -88,6 +93,24 @@ func (c *Notice) CountPerHour(match bson.M) []bson.M {
 	return res
 }
 
+// CountPerTacticDay notice count of each ATT&CK tactic per day, _id is {tactic, d}
+func (c *Notice) CountPerTacticDay(match bson.M) []bson.M {
+	project := bson.M{
+		"$project": bson.M{
+			"d":      bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$time"}},
+			"tactic": 1,
+		},
+	}
+	unwind := bson.M{"$unwind": "$tactic"}
+	group := bson.M{
+		"$group": bson.M{
+			"_id":   bson.M{"tactic": "$tactic", "d": "$d"},
+			"count": bson.M{"$sum": 1},
+		},
+	}
+	return c.Aggregate(bson.M{"$match": match}, project, unwind, group)
+}
+
 func (c *Notice) InfoRanking() []bson.M {
 
 	match := bson.M{
@@ -121,6 +144,43 @@ func (c *Notice) UpdateAll(selector bson.M, update bson.M) error {
 
 }
 
+// LinkIncident link notices to the incident, nothing is linked if any notice does not
+// exist, is in watch mode or has been linked to another incident
+func (c *Notice) LinkIncident(ids []bson.ObjectId, incident bson.ObjectId) bool {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+	collection := mConn.DB("").C(c.collectionName)
+
+	query := bson.M{
+		"_id":    bson.M{"$in": ids},
+		"status": settings.ValidNoticeQ["status"],
+		"$or":    []bson.M{{"incident": bson.M{"$exists": false}}, {"incident": incident}},
+	}
+	if count, err := collection.Find(query).Count(); err != nil || count != len(ids) {
+		return false
+	}
+	if _, err := collection.UpdateAll(query, bson.M{"$set": bson.M{"incident": incident}}); err != nil {
+		beego.Error("Notice LinkIncident error:", err)
+		return false
+	}
+	return true
+}
+
+// UnlinkIncident remove notices from the incident
+func (c *Notice) UnlinkIncident(ids []bson.ObjectId, incident bson.ObjectId) error {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	query := bson.M{"_id": bson.M{"$in": ids}, "incident": incident}
+	_, err := mConn.DB("").C(c.collectionName).UpdateAll(query, bson.M{"$unset": bson.M{"incident": ""}})
+	return err
+}
+
+// CloseIncident change the status of unhandled notices when the incident is closed
+func (c *Notice) CloseIncident(incident bson.ObjectId, status int) error {
+	return c.UpdateAll(bson.M{"incident": incident, "status": 0}, bson.M{"status": status, "uptime": time.Now()})
+}
+
 // LearnEnding done watch mode ending action
 func (c *Notice) LearnEnding() bool {
 
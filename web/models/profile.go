@@ -0,0 +1,13 @@
+package models
+
+// Profile agent配置模板
+type Profile struct {
+	baseModel
+}
+
+// NewProfile 配置模板，按主机分组覆盖全局agent配置
+func NewProfile() Profile {
+	mdl := Profile{}
+	mdl.collectionName = "profile"
+	return mdl
+}
@@ -1,5 +1,15 @@
 package models
 
+import (
+	"time"
+	"yulong-hids/rule"
+	"yulong-hids/web/models/wmongo"
+
+	"github.com/astaxie/beego"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
 type Rule struct {
 	baseModel
 }
@@ -9,3 +19,160 @@ func NewRule() Rule {
 	mdl.collectionName = "rules"
 	return mdl
 }
+
+// RuleVersion snapshot of a rule after each change, used to rollback
+type RuleVersion struct {
+	Id      bson.ObjectId `bson:"_id,omitempty" json:"_id,omitempty"`
+	RuleID  bson.ObjectId `bson:"rule_id"       json:"rule_id"`
+	Version int           `bson:"version"       json:"version"`
+	Action  string        `bson:"action"        json:"action"` // add, edit, enable, disable, rollback, del
+	User    string        `bson:"user"          json:"user"`
+	Time    time.Time     `bson:"time"          json:"time"`
+	Rule    rule.Rule     `bson:"rule"          json:"rule"`
+}
+
+const ruleVersionCollection = "rule_version"
+
+// GetRule find a rule by id
+func (c *Rule) GetRule(id bson.ObjectId) (rule.Rule, error) {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	var r rule.Rule
+	err := mConn.DB("").C(c.collectionName).FindId(id).One(&r)
+	return r, err
+}
+
+// Rules find rules by query
+func (c *Rule) Rules(query bson.M) []rule.Rule {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	res := []rule.Rule{}
+	if err := mConn.DB("").C(c.collectionName).Find(query).All(&res); err != nil {
+		beego.Error("Rule find error:", err)
+	}
+	return res
+}
+
+// Create insert new rules as version 1, rules should be validated before
+func (c *Rule) Create(rules []rule.Rule, user string) ([]rule.Rule, error) {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	docs := make([]interface{}, len(rules))
+	for i := range rules {
+		rules[i].ID = bson.NewObjectId()
+		rules[i].Version = 1
+		docs[i] = rules[i]
+	}
+	if err := mConn.DB("").C(c.collectionName).Insert(docs...); err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		c.saveVersion(mConn, r, "add", user)
+	}
+	return rules, nil
+}
+
+// Update replace the rule and increase its version, the rule is created again
+// with the same id when it has been deleted (rollback a deleted rule)
+func (c *Rule) Update(id bson.ObjectId, r rule.Rule, action string, user string) (rule.Rule, error) {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	r.ID = id
+	r.Version = c.lastVersion(mConn, id) + 1
+	if _, err := mConn.DB("").C(c.collectionName).UpsertId(id, r); err != nil {
+		return r, err
+	}
+	c.saveVersion(mConn, r, action, user)
+	return r, nil
+}
+
+// Delete remove the rule, its versions are kept so that it can be restored
+func (c *Rule) Delete(id bson.ObjectId, user string) error {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	var r rule.Rule
+	if err := mConn.DB("").C(c.collectionName).FindId(id).One(&r); err != nil {
+		return err
+	}
+	version := c.lastVersion(mConn, id) + 1
+	if err := mConn.DB("").C(c.collectionName).RemoveId(id); err != nil {
+		return err
+	}
+	r.Version = version
+	c.saveVersion(mConn, r, "del", user)
+	return nil
+}
+
+// Versions history of a rule, latest first
+func (c *Rule) Versions(id bson.ObjectId) []RuleVersion {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	res := []RuleVersion{}
+	if err := mConn.DB("").C(ruleVersionCollection).Find(bson.M{"rule_id": id}).Sort("-version").All(&res); err != nil {
+		beego.Error("Rule versions find error:", err)
+	}
+	return res
+}
+
+// GetVersion snapshot of the rule at the version
+func (c *Rule) GetVersion(id bson.ObjectId, version int) (RuleVersion, error) {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	var res RuleVersion
+	err := mConn.DB("").C(ruleVersionCollection).Find(bson.M{"rule_id": id, "version": version}).One(&res)
+	return res, err
+}
+
+// lastVersion the max version of the rule in history, rules added before versioning
+// have no history, their current content is saved as the first version
+func (c *Rule) lastVersion(mConn *mgo.Session, id bson.ObjectId) int {
+	var last RuleVersion
+	if err := mConn.DB("").C(ruleVersionCollection).Find(bson.M{"rule_id": id}).Sort("-version").One(&last); err == nil {
+		return last.Version
+	}
+	var r rule.Rule
+	if err := mConn.DB("").C(c.collectionName).FindId(id).One(&r); err != nil {
+		return 0
+	}
+	if r.Version == 0 {
+		r.Version = 1
+	}
+	c.saveVersion(mConn, r, "add", "")
+	return r.Version
+}
+
+func (c *Rule) saveVersion(mConn *mgo.Session, r rule.Rule, action string, user string) {
+	v := RuleVersion{
+		Id:      bson.NewObjectId(),
+		RuleID:  r.ID,
+		Version: r.Version,
+		Action:  action,
+		User:    user,
+		Time:    time.Now(),
+		Rule:    r,
+	}
+	if err := mConn.DB("").C(ruleVersionCollection).Insert(v); err != nil {
+		beego.Error("Rule version insert error:", err)
+	}
+}
+
+// EnsureIndex version of a rule must be unique
+func (c *Rule) EnsureIndex() {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	index := mgo.Index{
+		Key:    []string{"rule_id", "-version"},
+		Unique: true,
+	}
+	if err := mConn.DB("").C(ruleVersionCollection).EnsureIndex(index); err != nil {
+		beego.Error("Rule version EnsureIndex error:", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 	"yulong-hids/web/models/wmongo"
+	"yulong-hids/web/settings"
 	"yulong-hids/web/utils"
 
 	"github.com/astaxie/beego"
@@ -48,11 +49,6 @@ func (c *Task) Save() bool {
 	c.Time = time.Now()
 	c.ID = id
 
-	if err := collections.Insert(&c); err != nil {
-		beego.Error("Task Insert Error", err)
-		return false
-	}
-
 	// enable "all" tag
 	if utils.StringInSlice("all", c.HostList) {
 		tmp := clientdb.Distinct(nil, "ip")
@@ -84,25 +80,25 @@ func (c *Task) Save() bool {
 		}
 	}
 
-	addedLst := []string{} // ip addresses which has added to the queue
-
-	for _, ip := range c.HostList {
-		if utils.StringInSlice(ip, addedLst) {
-			break
-		} else if strings.Contains(ip, "-") {
-			oriLst := strings.Split(ip, "-")
-			if len(oriLst) == 2 {
-				subIPLst := utils.BetweenIP(oriLst[0], oriLst[1])
-				for _, subIP := range subIPLst {
-					addQueue(id, c, subIP)
-					addedLst = append(addedLst, ip)
-				}
-			}
+	// enable "tag:xxx" tags, hosts with the tag
+	var hostList []string
+	for _, item := range c.HostList {
+		if item = strings.TrimSpace(item); strings.HasPrefix(item, settings.TagPrefix) {
+			hostList = append(hostList, clientdb.IPByTag(strings.TrimPrefix(item, settings.TagPrefix))...)
 		} else {
-			addQueue(id, c, ip)
-			addedLst = append(addedLst, ip)
+			hostList = append(hostList, item)
 		}
 	}
+	// tags and explicit ips may overlap, the task records the actual targets
+	c.HostList = utils.ExpandHosts(hostList)
+
+	if err := collections.Insert(&c); err != nil {
+		beego.Error("Task Insert Error", err)
+		return false
+	}
+	for _, ip := range c.HostList {
+		addQueue(id, c, ip)
+	}
 	return true
 }
 
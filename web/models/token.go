@@ -0,0 +1,97 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+	"yulong-hids/web/models/wmongo"
+
+	"github.com/astaxie/beego"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Token API token of a user, only the sha256 hash of the token is saved
+type Token struct {
+	Id        bson.ObjectId `bson:"_id,omitempty" json:"_id,omitempty"`
+	Name      string        `bson:"name"          json:"name"`
+	User      string        `bson:"user"          json:"user"`
+	Hash      string        `bson:"hash"          json:"-"`
+	Prefix    string        `bson:"prefix"        json:"prefix"` // first characters of the token to identify it
+	Scopes    []string      `bson:"scopes"        json:"scopes"`
+	Expires   time.Time     `bson:"expires"       json:"expires"`
+	Created   time.Time     `bson:"created"       json:"created"`
+	LastUsed  time.Time     `bson:"lastused"      json:"lastused"`
+	LastIP    string        `bson:"lastip"        json:"lastip"`
+	baseModel `bson:",inline"`
+}
+
+func NewToken() Token {
+	mdl := Token{}
+	mdl.collectionName = "token"
+	return mdl
+}
+
+// TokenHash sha256 hex of the token
+func TokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// FindByToken find token by its plain text, return nil if not exist
+func (c *Token) FindByToken(token string) *Token {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	var res Token
+	if err := mConn.DB("").C(c.collectionName).Find(bson.M{"hash": TokenHash(token)}).One(&res); err != nil {
+		return nil
+	}
+	res.collectionName = c.collectionName
+	return &res
+}
+
+// List tokens sorted by created time desc
+func (c *Token) List(query bson.M) []Token {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	res := []Token{}
+	if err := mConn.DB("").C(c.collectionName).Find(query).Sort("-created").All(&res); err != nil {
+		beego.Error("Token find error:", err)
+	}
+	return res
+}
+
+// Save insert a new token, the plain text token will not be saved
+func (c *Token) Save(token string) error {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	c.Id = bson.NewObjectId()
+	c.Created = time.Now()
+	c.Hash = TokenHash(token)
+	c.Prefix = token[:10]
+	return mConn.DB("").C(c.collectionName).Insert(c)
+}
+
+// Touch record the last used time and ip
+func (c *Token) Touch(ip string) {
+	if err := c.UpdateByID(c.Id, bson.M{"lastused": time.Now(), "lastip": ip}); err != nil {
+		beego.Error("Token touch(model.UpdateByID) error:", err)
+	}
+}
+
+// EnsureIndex token hash must be unique
+func (c *Token) EnsureIndex() {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	index := mgo.Index{
+		Key:    []string{"hash"},
+		Unique: true,
+	}
+	if err := mConn.DB("").C(c.collectionName).EnsureIndex(index); err != nil {
+		beego.Error("Token EnsureIndex error:", err)
+	}
+}
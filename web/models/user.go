@@ -0,0 +1,122 @@
+package models
+
+import (
+	"time"
+	"yulong-hids/web/models/wmongo"
+
+	"github.com/astaxie/beego"
+	"golang.org/x/crypto/bcrypt"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// User web console user
+type User struct {
+	Id        bson.ObjectId `bson:"_id,omitempty" json:"_id,omitempty"`
+	Username  string        `bson:"username"      json:"username"`
+	Password  string        `bson:"password"      json:"-"`
+	Role      string        `bson:"role"          json:"role"`
+	Source    string        `bson:"source"        json:"source"` // 认证来源，ldap、oidc，本地用户为空
+	Subject   string        `bson:"subject,omitempty" json:"-"`  // OIDC用户的issuer和sub，用于识别同一用户
+	TOTP      string        `bson:"totp"          json:"-"`
+	Enabled   bool          `bson:"enabled"       json:"enabled"`
+	Created   time.Time     `bson:"created"       json:"created"`
+	LastLogin time.Time     `bson:"lastlogin"     json:"lastlogin"`
+	baseModel `bson:",inline"`
+}
+
+func NewUser() User {
+	mdl := User{}
+	mdl.collectionName = "user"
+	return mdl
+}
+
+// FindByName find user by username, return nil if not exist
+func (c *User) FindByName(username string) *User {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	var res User
+	if err := mConn.DB("").C(c.collectionName).Find(bson.M{"username": username}).One(&res); err != nil {
+		return nil
+	}
+	res.collectionName = c.collectionName
+	return &res
+}
+
+// FindBySubject find OIDC user by issuer and sub, return nil if not exist
+func (c *User) FindBySubject(subject string) *User {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	var res User
+	if err := mConn.DB("").C(c.collectionName).Find(bson.M{"subject": subject}).One(&res); err != nil {
+		return nil
+	}
+	res.collectionName = c.collectionName
+	return &res
+}
+
+// List all users, password hash and totp key will not be showed
+func (c *User) List() []User {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	res := []User{}
+	if err := mConn.DB("").C(c.collectionName).Find(nil).Sort("username").All(&res); err != nil {
+		beego.Error("User find error:", err)
+	}
+	return res
+}
+
+// CountAll count of all users
+func (c *User) CountAll() int {
+	return c.Count(nil)
+}
+
+// SetPassword hash the password with bcrypt
+func (c *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	c.Password = string(hash)
+	return nil
+}
+
+// CheckPassword as name
+func (c *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(c.Password), []byte(password)) == nil
+}
+
+// Save insert a new user
+func (c *User) Save() error {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	c.Id = bson.NewObjectId()
+	c.Created = time.Now()
+	return mConn.DB("").C(c.collectionName).Insert(c)
+}
+
+// EnsureIndex username must be unique
+func (c *User) EnsureIndex() {
+	mConn := wmongo.Conn()
+	defer mConn.Close()
+
+	index := mgo.Index{
+		Key:    []string{"username"},
+		Unique: true,
+	}
+	if err := mConn.DB("").C(c.collectionName).EnsureIndex(index); err != nil {
+		beego.Error("User EnsureIndex error:", err)
+	}
+	index = mgo.Index{
+		Key:    []string{"subject"},
+		Unique: true,
+		Sparse: true,
+	}
+	if err := mConn.DB("").C(c.collectionName).EnsureIndex(index); err != nil {
+		beego.Error("User EnsureIndex error:", err)
+	}
+}
@@ -7,11 +7,24 @@ import (
 
 var session *mgo.Session
 
+// auditSession session of mongodb::audit_url, nil when it is not set
+var auditSession *mgo.Session
+
 // Conn return mongodb session.
 func Conn() *mgo.Session {
 	return session.Copy()
 }
 
+// AuditConn return mongodb session of the audit log. mongodb::audit_url should be a user
+// that can only find and insert the audit collection of another database, so the audit
+// log is append only even for the console. The main session is used when it is not set
+func AuditConn() *mgo.Session {
+	if auditSession != nil {
+		return auditSession.Copy()
+	}
+	return Conn()
+}
+
 /*
 func Close() {
 	session.Close()
@@ -29,4 +42,14 @@ func init() {
 
 	session = sess
 	session.SetMode(mgo.Monotonic, true)
+
+	if auditURL := beego.AppConfig.String("mongodb::audit_url"); auditURL != "" {
+		sess, err := mgo.Dial(auditURL)
+		if err != nil {
+			beego.Error("Mongodb audit session connect, audit log is written by the main session:", err)
+			return
+		}
+		auditSession = sess
+		auditSession.SetMode(mgo.Monotonic, true)
+	}
 }
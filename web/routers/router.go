@@ -2,12 +2,28 @@ package routers
 
 import (
 	"yulong-hids/web/controllers"
+	"yulong-hids/web/settings"
 
 	"github.com/astaxie/beego"
 )
 
+// APIVersion version of the documented REST API for automation, see static/openapi.yaml
+const APIVersion = settings.APIVersion
+
 func init() {
-	ns := beego.NewNamespace("/"+beego.AppConfig.String("ApiVer"),
+	// web pages use the ApiVer namespace, automation uses the same api with version prefix
+	beego.AddNamespace(apiNamespace("/" + beego.AppConfig.String("ApiVer")))
+	beego.AddNamespace(apiNamespace(APIVersion))
+	beego.Router("/", &controllers.MainController{})
+	beego.Router("/login/", &controllers.LoginController{})
+	beego.Router("/login/oidc", &controllers.LoginController{}, "get:OIDC")
+	beego.Router("/login/oidc/callback", &controllers.LoginController{}, "get:OIDCCallback")
+	beego.Router("/install/", &controllers.InstallController{})
+
+}
+
+func apiNamespace(prefix string) *beego.Namespace {
+	return beego.NewNamespace(prefix,
 		beego.NSRouter("/client", &controllers.ClientController{}),
 		beego.NSRouter("/download", &controllers.DloadController{}),
 		beego.NSRouter("/serverlist", &controllers.AgentApiController{}),
@@ -17,17 +33,21 @@ func init() {
 		beego.NSRouter("/file", &controllers.FileController{}, "post:Upload"),
 		beego.NSRouter("/analyze", &controllers.AnalyzeController{}, "post:Post;get:Get"),
 		beego.NSRouter("/config", &controllers.ConfigController{}, "get:Get;post:Edit;delete:Del;put:Add"),
+		beego.NSRouter("/profile", &controllers.ProfileController{}, "get:Get;post:Post;delete:Delete"),
+		beego.NSRouter("/profile/preview", &controllers.ProfileController{}, "get:Preview"),
 		beego.NSRouter("/info/:ip", &controllers.InfoController{}, "get:GetInfoByIp"),
 		beego.NSRouter("/monitor/:ip/:type/:start", &controllers.MonitorController{}, "get:GetTwenty"),
 		beego.NSRouter("/monitor/:ip", &controllers.MonitorController{}, "get:GetAllType"),
+		beego.NSRouter("/timeline/:host", &controllers.TimelineController{}, "get:Get"),
+		beego.NSRouter("/inventory", &controllers.InventoryController{}, "get:Get"),
 		beego.NSRouter("/notice", &controllers.NoticeController{}, "get:Get;post:ChangeStatus;delete:Delete"),
+		beego.NSRouter("/incidents", &controllers.IncidentController{}, "get:Get;post:Post"),
 		beego.NSRouter("/tasks", &controllers.TaskController{}, "get:Get;post:Post"),
 		beego.NSRouter("/rules", &controllers.RuleController{}, "get:Get;post:Post"),
+		beego.NSRouter("/user", &controllers.UserController{}, "get:Get;post:Post;put:Put;delete:Delete"),
+		beego.NSRouter("/account", &controllers.AccountController{}, "get:Get;post:Post"),
+		beego.NSRouter("/audit", &controllers.AuditController{}, "get:Get"),
+		beego.NSRouter("/token", &controllers.TokenController{}, "get:Get;post:Post;delete:Delete"),
 		beego.NSRouter("/logout", &controllers.LogoutController{}, "post:Post"),
 	)
-	beego.AddNamespace(ns)
-	beego.Router("/", &controllers.MainController{})
-	beego.Router("/login/", &controllers.LoginController{})
-	beego.Router("/install/", &controllers.InstallController{})
-
 }
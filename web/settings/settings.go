@@ -2,12 +2,38 @@ package settings
 
 import "gopkg.in/mgo.v2/bson"
 
+// 用户角色
+const (
+	RoleAdmin     = "admin"
+	RoleAnalyst   = "analyst"
+	RoleResponder = "responder"
+	RoleReadOnly  = "readonly"
+)
+
+// 事件状态：新建、分诊、调查中、已解决、误报
+const (
+	IncidentNew           = "new"
+	IncidentTriage        = "triage"
+	IncidentInvestigating = "investigating"
+	IncidentResolved      = "resolved"
+	IncidentFalsePositive = "false_positive"
+)
+
+// 用户认证来源，本地用户为空
+const (
+	SourceLDAP = "ldap"
+	SourceOIDC = "oidc"
+)
+
+// APIVersion 自动化调用的REST API前缀，见 static/openapi.yaml
+const APIVersion = "/api/v1"
+
 var (
 	// Version 版本号
 	Version = "v0.4.4 BETA"
 
-	// TFAPassHistorys 双因子验证密码历史, 永远只接受6个历史
-	TFAPassHistorys = []uint32{0, 0, 0, 0, 0, 0}
+	// TFAMaxTries 每个用户同一个双因子验证密码最多尝试的次数
+	TFAMaxTries = 6
 
 	// SystemArray System参数白名单
 	SystemArray = []string{"linux", "windows"}
@@ -25,6 +51,9 @@ var (
 		"can-not-push": 2,
 	}
 
+	// TagPrefix 按主机标签搜索或指定任务主机的前缀，例如 tag:prod
+	TagPrefix = "tag:"
+
 	// FileName2Type 文件名和类型的对应关系
 	FileName2Type = bson.M{
 		"agent":      "agent",
@@ -61,7 +90,7 @@ var (
 
 	// ElasticSearchTypeList 当搜索条件出现以下key时应该调用ElasticSearch接口
 	ElasticSearchTypeList = []string{
-		"connection", "process", "loginlog", "file", "count",
+		"connection", "process", "loginlog", "file", "dns", "reverseshell", "count",
 	}
 
 	// MongoComparisonOperator mongodb比较符对比表
@@ -75,8 +104,17 @@ var (
 
 	// ConfigTypeMap 根据type判断配置类别
 	ConfigTypeMap = map[string][]string{
-		"bool": []string{"udp", "lan", "learn", "switch", "onlyhigh", "offlinecheck"},
-		"int":  []string{"cycle"},
+		"bool": []string{"udp", "lan", "learn", "switch", "onlyhigh", "offlinecheck", "fanotify"},
+		"int":  []string{"cycle", "cpu", "memory", "rate"},
+		"list": []string{"monitorPath", "file", "ip", "process", "rules"},
+	}
+
+	// ProfileKeys 配置模板中各配置类型可以覆盖的配置项，类型见ConfigTypeMap
+	ProfileKeys = map[string][]string{
+		"client":   {"cycle", "udp", "lan", "fanotify", "monitorPath"},
+		"filter":   {"file", "ip", "process"},
+		"webshell": {"switch", "rules"},
+		"resource": {"cpu", "memory", "rate"},
 	}
 
 	// TimeFormat 时间模板
@@ -90,7 +128,10 @@ var (
         "data": {
             "name": "数据内容",
             "command": "命令",
-            "user": "用户名"
+            "user": "用户名",
+            "container_id": "所属容器ID（linux，带pid的事件，不在容器中时没有此字段）",
+            "container_image": "所属容器的镜像",
+            "pod": "所属Kubernetes pod，格式为 namespace/name"
         },
         "crontab": {
             "arg": "启动参数",
@@ -116,10 +157,59 @@ var (
             "description": "描述 ",
             "status": "状态"
         },
+        "agentstat": {
+            "cpu": "agent的CPU使用率，单核的百分比",
+            "rss": "agent的常驻内存，单位MB",
+            "cpulimit": "配置的CPU上限",
+            "memorylimit": "配置的内存上限，单位MB",
+            "ratelimit": "配置的每种事件每分钟回传上限",
+            "cgroup": "是否由cgroup v2限制资源（true、false）",
+            "throttle": "当前降速等待时间，单位毫秒",
+            "dropped": "超出回传上限丢弃的事件数量，格式为 类型:数量，多个以|分隔",
+            "droppedsum": "丢弃的事件总数",
+            "hashskipped": "资源紧张时跳过的文件hash计算次数",
+            "goroutine": "agent的协程数量"
+        },
+        "health": {
+            "monitors": "监控模块状态，格式为 名称:状态（running、stopped、failed:原因、unsupported），多个以|分隔",
+            "lastevent": "每种事件最后回传的时间戳，格式为 类型:时间戳，多个以|分隔",
+            "kernelmodule": "进程监控内核模块是否已加载（linux，true、false）",
+            "dropped": "超出回传上限丢弃的事件总数",
+            "configversion": "当前生效配置的md5",
+            "agenthash": "agent程序文件的md5",
+            "starttime": "agent启动时间戳",
+            "restarts": "一小时内被daemon重启的次数"
+        },
+        "container": {
+            "id": "容器ID",
+            "image": "镜像",
+            "runtime": "容器运行时（docker、containerd、cri-o）",
+            "pod": "Kubernetes pod，格式为 namespace/name",
+            "privileged": "是否为特权容器（true、false）",
+            "hostnetwork": "是否使用宿主机网络（true、false）",
+            "hostpid": "是否使用宿主机pid命名空间（true、false）",
+            "hostipc": "是否使用宿主机ipc命名空间（true、false）",
+            "capabilities": "默认之外添加的capabilities，多个以|分隔",
+            "mounts": "宿主机目录挂载，格式为 宿主机路径:容器内路径，多个以|分隔"
+        },
         "file": {
             "path": "文件或者目录路径 file",
             "action": "行为类型",
-            "hash": "文件md5 hash"
+            "hash": "文件md5 hash",
+            "mode": "文件权限，如4755",
+            "oldmode": "变化前的文件权限",
+            "uid": "属主uid",
+            "gid": "属组gid",
+            "size": "文件大小",
+            "inode": "文件inode",
+            "from": "重命名前的路径",
+            "to": "重命名后的路径",
+            "flags": "新增的敏感权限（setuid、setgid、world-writable）",
+            "changed": "发生变化的属性（mode、owner、size、inode）",
+            "pid": "写入或执行文件的进程pid（fanotify）",
+            "command": "写入或执行文件的进程命令行（fanotify）",
+            "scan": "web目录文件命中的webshell检测规则",
+            "watches": "已监控的目录数量（监控数量达到上限时）"
         },
         "loginlog": {
             "username": "用户名",
@@ -136,9 +226,31 @@ var (
         "connection": {
             "dir": "方向 ",
             "protocol": "类型（TCP、UDP） type",
-            "local": "本机进行通讯ip:port",
-            "remote": "远程进行通讯的ip:port",
+            "local": "本机进行通讯ip:port，IPv6为[ip]:port",
+            "remote": "远程进行通讯的ip:port，IPv6为[ip]:port",
+            "local_ip": "本机IP，不含端口（仅es）",
+            "remote_ip": "远程IP，不含端口（仅es）",
             "pid ": "进程pid"
+        },
+        "dns": {
+            "domain": "查询的域名",
+            "qtype": "查询类型，如A、AAAA、CNAME、TXT",
+            "rcode": "应答结果，如NOERROR、NXDOMAIN，没有应答时为TIMEOUT",
+            "answers": "应答记录，多个以|分隔",
+            "server": "DNS服务器IP",
+            "name": "发起查询的进程名（linux）",
+            "pid": "发起查询的进程pid（linux）"
+        },
+        "reverseshell": {
+            "name": "进程名",
+            "command": "程序或命令以及参数",
+            "pid": "进程pid",
+            "ppid": "父进程pid",
+            "parentname": "父进程名",
+            "fds": "标准输入、输出、错误的指向，格式为 fd:目标，多个以|分隔",
+            "protocol": "连接类型（tcp、udp）",
+            "remote": "远程ip:port",
+            "local": "本机ip:port"
         }
     }`)
 
@@ -181,8 +293,142 @@ var (
 		"/config",
 		"/tasks",
 		"/rules",
+		"/profile",
+		"/client",
+		"/user",
+		"/token",
 	}
 
+	// RoleList 用户角色：admin 管理员，analyst 分析员，responder 响应人员，readonly 只读
+	RoleList = []string{RoleAdmin, RoleAnalyst, RoleResponder, RoleReadOnly}
+
+	// RolePermissions 各角色可以进行修改操作（非GET请求）的url，admin可以访问所有url
+	RolePermissions = map[string][]string{
+		RoleAnalyst:   {"/analyze", "/notice", "/incidents", "/rules", "/config", "/profile", "/client", "/account", "/token"},
+		RoleResponder: {"/analyze", "/notice", "/incidents", "/tasks", "/account", "/token"},
+		RoleReadOnly:  {"/analyze", "/account", "/token"},
+	}
+
+	// AdminConfigTypes 仅admin可以修改的配置类型，服务端密钥、告警通知接口和2FA密钥影响整个系统，
+	// SecretKeyLst中的配置项也仅admin可以修改
+	AdminConfigTypes = []string{"server", "notice", "web"}
+
+	// AdminURILst 仅admin可以访问的url，包括GET请求
+	AdminURILst = []string{
+		"/user",
+		"/install",
+		"/audit",
+	}
+
+	// TokenScopes API token的权限范围及其可访问的url，read为GET请求，其它为修改操作，
+	// 同时受token所属用户的角色权限限制，用户、token管理等接口不能通过token访问
+	TokenScopes = map[string][]string{
+		"read":    {"/client", "/notice", "/incidents", "/rules", "/tasks", "/config", "/profile", "/analyze", "/statistics", "/info", "/monitor", "/timeline", "/inventory"},
+		"analyze": {"/analyze"},
+		"notice":  {"/notice", "/incidents"},
+		"rules":   {"/rules"},
+		"tasks":   {"/tasks"},
+		"config":  {"/config", "/profile"},
+		"client":  {"/client"},
+	}
+
+	// TokenPrefix API token的前缀，便于识别泄露的token
+	TokenPrefix = "yl_"
+
+	// TokenMaxDays API token最长有效期
+	TokenMaxDays = 365
+
+	// AuditDiffLst 审计日志中记录修改前后差异的url及对应的集合
+	AuditDiffLst = map[string]string{
+		"/config":  "config",
+		"/rules":   "rules",
+		"/profile": "profile",
+	}
+
+	// AuditMaskKeys 审计日志中不记录明文的请求参数
+	AuditMaskKeys = []string{"pass", "passwd", "password", "old", "new", "totp"}
+
+	// AuditBodyLimit 审计日志中请求内容的最大长度
+	AuditBodyLimit = 8192
+
+	// AuditExportLimit 审计日志单次导出的最大条数
+	AuditExportLimit = 10000
+
+	// RuleTestMaxDays 规则测试最多使用最近多少天的历史数据
+	RuleTestMaxDays = 30
+
+	// RuleTestMaxEvents 规则测试最多扫描的数据条数
+	RuleTestMaxEvents = 10000
+
+	// RuleTestMatchLimit 规则测试返回的命中数据的最大条数
+	RuleTestMatchLimit = 100
+
+	// AttackStatsMaxDays ATT&CK统计最多查询最近多少天的告警
+	AttackStatsMaxDays = 90
+
+	// IncidentTransitions 事件状态的流转，已解决和误报的事件可以重新打开
+	IncidentTransitions = map[string][]string{
+		IncidentNew:           {IncidentTriage, IncidentInvestigating, IncidentFalsePositive},
+		IncidentTriage:        {IncidentInvestigating, IncidentResolved, IncidentFalsePositive},
+		IncidentInvestigating: {IncidentResolved, IncidentFalsePositive},
+		IncidentResolved:      {IncidentInvestigating},
+		IncidentFalsePositive: {IncidentTriage},
+	}
+
+	// IncidentNoticeStatus 事件关闭时关联的未处理告警的状态，已解决为已处理，误报为忽略
+	IncidentNoticeStatus = map[string]int{
+		IncidentResolved:      1,
+		IncidentFalsePositive: 2,
+	}
+
+	// IncidentResponseSLA 各等级（危险、可疑、提示）事件从新建到开始分诊的时限，单位小时
+	IncidentResponseSLA = []int{1, 4, 24}
+
+	// IncidentResolveSLA 各等级（危险、可疑、提示）事件从新建到解决的时限，单位小时
+	IncidentResolveSLA = []int{24, 72, 168}
+
+	// IncidentRelatedWindow 查找事件相关的行为数据和任务结果时，告警时间前后的范围，单位小时
+	IncidentRelatedWindow = 2
+
+	// IncidentRelatedLimit 事件相关的行为数据或任务结果返回的最大条数
+	IncidentRelatedLimit = 100
+
+	// IncidentNoticeLimit 单个事件最多关联的告警数
+	IncidentNoticeLimit = 1000
+
+	// IncidentTextLimit 事件标题、描述和评论的最大长度
+	IncidentTextLimit = 8192
+
+	// TimelineEventTypes 主机时间线中来自ES的行为数据类型
+	TimelineEventTypes = []string{"process", "file", "connection", "loginlog", "dns", "reverseshell"}
+
+	// TimelineTypes 主机时间线可选的数据类型，inventory为主机信息的变化
+	TimelineTypes = append(TimelineEventTypes, "notice", "task", "inventory")
+
+	// TimelineDefaultHours 主机时间线默认查询最近多少小时
+	TimelineDefaultHours = 24
+
+	// TimelineMaxEvents 主机时间线最多翻到第几条数据
+	TimelineMaxEvents = 1000
+
+	// InventoryTypes 记录变化历史的主机信息类型
+	InventoryTypes = []string{"userlist", "listening", "crontab", "startup", "service", "processlist"}
+
+	// InventoryActions 主机信息变化的类型：新增、删除、修改
+	InventoryActions = []string{"add", "remove", "change"}
+
+	// InventoryKeys 按关键字搜索主机信息变化时匹配的字段
+	InventoryKeys = []string{"name", "address", "command", "user", "location", "pathname"}
+
+	// InventoryDefaultDays 主机信息变化默认查询最近多少天
+	InventoryDefaultDays = 7
+
+	// InventoryKeepDays 主机信息变化的保存天数
+	InventoryKeepDays = 180
+
+	// SigmaFileLimit 导入的单个sigma规则文件的最大长度
+	SigmaFileLimit int64 = 1 << 20
+
 	// HTTPURLLst 允许HTTP的url
 	HTTPURLLst = []string{
 		"/download",
@@ -197,6 +443,7 @@ var (
                 "cycle": 2,
                 "udp": false,
                 "lan": false,
+                "fanotify": false,
                 "monitorPath": [
                     "%windows%",
                     "%system32%",
@@ -242,6 +489,7 @@ var (
                 "file": [],
                 "ip": [],
                 "process": [],
+                "domain": [],
                 "other" : []
             }
         },
@@ -254,6 +502,7 @@ var (
                     "mssecsvc\\.exe",
                     "tasksche\\.exe"
                 ],
+                "domain": [],
                 "other": []
             }
         },
@@ -265,6 +514,32 @@ var (
                 "process": ["c:\\\\windows\\\\system32\\\\wbem\\\\wmiprvse.exe"]
             }
         },
+        {
+            "type": "webshell",
+            "dic": {
+                "switch": true,
+                "rules": [
+                    "php_eval_input:(eval|assert)\\s*\\(\\s*@?\\s*\\$_(post|get|request|cookie|server)",
+                    "php_system_input:(system|exec|shell_exec|passthru|popen|proc_open)\\s*\\(\\s*@?\\s*\\$_(post|get|request|cookie)",
+                    "php_callback_input:(array_map|array_filter|call_user_func(_array)?|usort|uasort|preg_replace_callback|register_shutdown_function)\\s*\\([^;]{0,100}\\$_(post|get|request|cookie)",
+                    "php_variable_func:\\$_(post|get|request|cookie)\\s*\\[[^\\]]{1,50}\\]\\s*\\(",
+                    "php_preg_e:preg_replace\\s*\\(\\s*[\"'][^\"']*/[a-z]*e[a-z]*[\"']",
+                    "jsp_exec_param:runtime\\.getruntime\\(\\)\\.exec\\s*\\(\\s*request\\.getparameter",
+                    "jsp_define_class:(classloader|defineclass).{0,300}(base64decoder|getdecoder)",
+                    "aspx_eval_request:eval\\s*\\(\\s*request(\\.item)?\\s*[\\[(]",
+                    "aspx_process_request:process\\.start\\s*\\(.{0,200}request",
+                    "asp_execute_request:(execute|executeglobal|eval)\\s*\\(?\\s*request\\s*\\("
+                ]
+            }
+        },
+        {
+            "type": "resource",
+            "dic": {
+                "cpu": 30,
+                "memory": 256,
+                "rate": 1200
+            }
+        },
         {
             "type" : "web",
             "dic" : {
@@ -288,10 +563,68 @@ var (
 	CertKeyName    = "cert.pem"
 
 	// msg list
-	AddTaskSucceed = "添加任务成功"
-	AddTaskFailure = "添加任务失败"
-	EditCfgSucceed = "修改配置成功"
-	EditCfgFailure = "修改配置失败"
-	Failure        = "您的操作失败，请检查输入是否非法"
-	Succeed        = "操作成功"
+	AddTaskSucceed  = "添加任务成功"
+	AddTaskFailure  = "添加任务失败"
+	EditCfgSucceed  = "修改配置成功"
+	EditCfgFailure  = "修改配置失败"
+	IPFormatFailure = "IP格式错误，请填写IP或CIDR网段"
+	Failure         = "您的操作失败，请检查输入是否非法"
+	Succeed         = "操作成功"
+
+	// profile msg
+	EditProfileFailure = "保存配置模板失败"
+	ProfileNameFailure = "配置模板名称不能为空"
+	ProfileIPFailure   = "分组IP格式错误，请填写IP、CIDR网段或 起始IP-结束IP 范围"
+	ProfileTypeFailure = "配置模板只能覆盖client、filter、webshell、resource配置，且配置项需为对象"
+	ProfileKeyFailure  = "配置模板的配置项不存在或类型错误，数值项需为整数，开关项需为true/false，列表项需为字符串数组"
+
+	// user msg
+	PermissionFailure = "权限不足，请联系管理员"
+	TOTPEmptyFailure  = "当前用户未设置双因子验证密钥，请联系管理员重置"
+	UserNameFailure   = "用户名只能包含字母、数字和._@-，长度为2-32"
+	PasswordFailure   = "密码长度不能少于8位"
+	RoleFailure       = "角色只能为admin、analyst、responder、readonly"
+	UserExistFailure  = "用户名已存在"
+	UserSelfFailure   = "不能禁用、删除自己或修改自己的角色"
+	LastAdminFailure  = "至少需要保留一个启用的admin用户"
+	OldPassFailure    = "原密码错误"
+	SSOUserFailure    = "LDAP/OIDC用户的密码由统一认证管理，不能在此修改"
+
+	// token msg
+	TokenInvalidFailure = "API token无效、已过期或所属用户已禁用"
+	TokenScopeFailure   = "API token的权限范围不包含该接口"
+	TokenNameFailure    = "API token名称不能为空"
+	TokenExpiresFailure = "API token有效期需为1-365天"
+	TokenScopesFailure  = "API token权限范围只能为read、analyze、notice、rules、tasks、config、client"
+
+	// rule msg
+	RuleFormatFailure   = "规则格式错误，请检查JSON格式和字段名"
+	RuleNotFoundFailure = "规则或规则版本不存在"
+	RuleSaveFailure     = "保存规则失败"
+	SigmaEmptyFailure   = "请上传sigma规则文件，或在请求内容中填写sigma规则（YAML）"
+
+	// incident msg
+	IncidentNotFoundFailure = "事件不存在"
+	IncidentTitleFailure    = "事件标题不能为空，标题和描述长度不能超过8192"
+	IncidentStatusFailure   = "事件状态流转错误，需按 new→triage→investigating→resolved/false_positive 处理，关闭后可重新打开"
+	IncidentAssigneeFailure = "指派的用户不存在或已禁用"
+	IncidentSeverityFailure = "事件等级只能为0-2（危险、可疑、提示），-1为取消覆盖"
+	IncidentNoticeFailure   = "告警不存在、已关联其它事件或超过单个事件的告警上限"
+	IncidentEvidenceFailure = "证据不存在，类型只能为event（ES中的行为数据）或task（任务结果）"
+	IncidentCommentFailure  = "评论不能为空，长度不能超过8192"
+	IncidentConflictFailure = "事件已被其他用户修改或删除，请刷新后重试"
+
+	// timeline msg
+	TimelineHostFailure = "主机IP格式错误"
+	TimelineTypeFailure = "时间线的数据类型只能为process、file、connection、loginlog、dns、reverseshell、notice、task、inventory"
+	TimelineTimeFailure = "时间范围错误，开始时间需早于结束时间，格式为时间戳或 2006-01-02 15:04:05"
+	TimelinePageFailure = "时间线最多翻到第1000条数据，请缩小时间范围"
+
+	// inventory msg
+	InventoryTypeFailure   = "主机信息类型只能为userlist、listening、crontab、startup、service、processlist"
+	InventoryActionFailure = "变化类型只能为add、remove、change"
+
+	// tag msg
+	TagHostFailure   = "请选择需要设置标签的主机，可填写IP列表或主机过滤条件，all为所有主机"
+	TagFormatFailure = "请填写需要添加或删除的标签，或业务、环境、负责人信息"
 )
@@ -112,13 +112,21 @@ var api_base_url = apihost + '/json'
 var client_url = api_base_url + "/client"
 var info_url = api_base_url + "/info"
 var notice_url = api_base_url + "/notice"
+var incident_url = api_base_url + "/incidents"
 var config_url = api_base_url + "/config"
 var task_url = api_base_url + "/tasks"
 var file_url = api_base_url + "/file"
 var monitor_url = api_base_url + "/monitor"
+var timeline_url = api_base_url + "/timeline"
+var inventory_url = api_base_url + "/inventory"
 var analyze_url = api_base_url + "/analyze"
 var statistics_url = api_base_url + "/statistics"
 var rules_url = api_base_url + "/rules"
+var profile_url = api_base_url + "/profile"
+var user_url = api_base_url + "/user"
+var account_url = api_base_url + "/account"
+var audit_url = api_base_url + "/audit"
+var token_url = api_base_url + "/token"
 var logout_url = api_base_url + "/logout"
 
 if (!localStorage.search_history) {
@@ -184,6 +192,13 @@ hostw.factory('Redirect', function ($q) {
                 return response;
             }
             return response;
+        },
+        responseError: function (response) {
+            // 当前用户的角色没有权限
+            if (response.status == 403 && response.data && response.data.msg) {
+                swal('权限不足!', response.data.msg, 'error');
+            }
+            return $q.reject(response);
         }
     };
 });
@@ -32,11 +32,52 @@ global_data_info = {
         "description": "描述",
         "status": "状态"
     },
+    "agentstat": {
+        "cpu": "CPU使用率",
+        "rss": "内存(MB)",
+        "cpulimit": "CPU上限",
+        "memorylimit": "内存上限",
+        "ratelimit": "回传上限",
+        "cgroup": "cgroup限制",
+        "throttle": "降速等待(ms)",
+        "dropped": "丢弃事件",
+        "droppedsum": "丢弃事件总数",
+        "hashskipped": "跳过hash次数",
+        "goroutine": "协程数量"
+    },
+    "health": {
+        "monitors": "监控模块状态",
+        "lastevent": "最后事件时间",
+        "kernelmodule": "内核模块",
+        "dropped": "丢弃事件总数",
+        "configversion": "配置版本",
+        "agenthash": "程序hash",
+        "starttime": "启动时间",
+        "restarts": "重启次数",
+        "pid": "进程pid"
+    },
+    "container": {
+        "id": "容器ID",
+        "name": "容器名",
+        "image": "镜像",
+        "command": "启动命令",
+        "runtime": "容器运行时",
+        "pod": "Kubernetes pod",
+        "privileged": "特权容器",
+        "hostnetwork": "宿主机网络",
+        "hostpid": "宿主机pid命名空间",
+        "hostipc": "宿主机ipc命名空间",
+        "capabilities": "添加的capabilities",
+        "mounts": "宿主机目录挂载"
+    },
     "file": {
         "path": "文件或者目录路径 file",
         "action": "行为类型",
         "user": "操作用户",
-        "hash": "文件md5 hash"
+        "hash": "文件md5 hash",
+        "container_id": "容器ID",
+        "container_image": "容器镜像",
+        "pod": "Kubernetes pod"
     },
     "loginlog": {
         "username": "用户名",
@@ -50,7 +91,10 @@ global_data_info = {
         "command": "程序或命令以及参数",
         "pid": "进程pid",
         "ppid": "父进程pid",
-        "parentname": "父进程名"
+        "parentname": "父进程名",
+        "container_id": "容器ID",
+        "container_image": "容器镜像",
+        "pod": "Kubernetes pod"
     },
     "connection": {
         "dir": "方向 ",
@@ -58,7 +102,36 @@ global_data_info = {
         "local": "本机进行通讯ip:port ",
         "remote": "远程进行通讯的ip:port",
         "name": "进程名",
-        "pid ": "进程pid"
+        "pid ": "进程pid",
+        "container_id": "容器ID",
+        "container_image": "容器镜像",
+        "pod": "Kubernetes pod"
+    },
+    "dns": {
+        "domain": "查询的域名",
+        "qtype": "查询类型",
+        "rcode": "应答结果",
+        "answers": "应答记录",
+        "server": "DNS服务器IP",
+        "name": "进程名",
+        "pid": "进程pid",
+        "container_id": "容器ID",
+        "container_image": "容器镜像",
+        "pod": "Kubernetes pod"
+    },
+    "reverseshell": {
+        "name": "进程名",
+        "command": "程序或命令以及参数",
+        "pid": "进程pid",
+        "ppid": "父进程pid",
+        "parentname": "父进程名",
+        "fds": "标准输入输出指向",
+        "protocol": "连接类型",
+        "remote": "远程ip:port",
+        "local": "本机ip:port",
+        "container_id": "容器ID",
+        "container_image": "容器镜像",
+        "pod": "Kubernetes pod"
     }
 }
 
@@ -84,6 +157,7 @@ HostWData.update("zh_cn", {
         "client": {
             "type_description": "客户端 Agent配置",
             "cycle": "间隔 收集型信息回传间隔",
+            "fanotify": "fanotify 使用fanotify监控文件写入，可记录写入文件的进程（linux，需内核支持）",
             "lan": "内网连接 是否记录内网网络连接信息",
             "mode": "模式 （规划中）",
             "monitorPath": "监控目录 文件操作监控目录，%web%为自动识别的web目录，*结尾为迭代监控（例如/tmp/*）",
@@ -107,23 +181,48 @@ HostWData.update("zh_cn", {
         "blacklist": {
             "type_description": "黑名单",
             "file": "文件 文件行为，可文件md5或文件路径的正则(自动识别)",
-            "ip": "IP IP地址，不包含端口",
+            "ip": "IP IP地址或CIDR网段，不包含端口，支持IPv6",
             "process": "进程 进程名称或参数的正则",
+            "domain": "域名 DNS查询的域名，包含其子域名",
             "other": "其他 其他类型信息的正则（自动识别对应的关键字段）"
         },
         "whitelist": {
             "type_description": "白名单",
             "file": "文件 文件行为 可文件md5或文件路径的正则(自动识别)",
-            "ip": "IP IP地址 不包含端口",
+            "ip": "IP IP地址或CIDR网段 不包含端口，支持IPv6",
             "process": "进程 进程名称或参数的正则",
+            "domain": "域名 DNS查询的域名，包含其子域名",
             "other": "其他 其他类型信息的正则（自动识别对应的关键字段）"
         },
         "filter": {
             "type_description": "过滤 （不传回Server记录，直接抛弃）",
             "file": "文件 文件行为 可文件md5或文件路径的正则(自动识别)",
-            "ip": "IP IP地址 不包含端口",
+            "ip": "IP IP地址或CIDR网段 不包含端口，支持IPv6",
             "process": "进程 进程名称或参数的正则"
         },
+        "user": {
+            "type_description": "用户管理 （admin管理员、analyst分析员、responder响应人员、readonly只读，每个用户使用独立的双因子验证密钥）"
+        },
+        "token": {
+            "type_description": "API Token （用于SOAR等自动化脚本，通过 Authorization: Bearer 头访问 /api/v1 接口，权限为token范围与所属用户角色的交集）"
+        },
+        "audit": {
+            "type_description": "审计日志 （所有修改操作的用户、来源IP、参数和配置规则修改前后的差异，仅管理员可查看和导出）"
+        },
+        "profile": {
+            "type_description": "配置模板 （按主机标签、IP范围、系统或类型分组覆盖全局Agent配置）"
+        },
+        "resource": {
+            "type_description": "资源限制 （Agent自身的资源占用上限）",
+            "cpu": "CPU上限 单核的百分比，例如30为单核的30%，linux支持cgroup v2时由内核限制，否则自动降速，0为不限制",
+            "memory": "内存上限 单位MB，超出时跳过文件hash计算并回收内存，0为不限制",
+            "rate": "回传上限 每种事件每分钟最多回传的数量，超出部分丢弃并计数，0为不限制"
+        },
+        "webshell": {
+            "type_description": "Webshell检测 （Agent对web目录下写入的文件做静态检测）",
+            "rules": "特征规则 格式为 名称:正则，正则不区分大小写，例如 php_eval:eval\\s*\\(\\$_post",
+            "switch": "开关"
+        },
         "notice": {
             "type_description": "通知",
             "api": "通知接口 （例如短信、微信、邮件），格式为：http://x.x.x.x/sendmsg/?text={$info}，{$info}为消息通知占位符",
@@ -148,7 +247,12 @@ HostWData.update("zh_cn", {
         "crontab": "计划任务",
         "process": "进程",
         "abnormal": "异常",
-        "file" : "文件操作"
+        "file" : "文件操作",
+        "dns": "DNS查询",
+        "reverseshell": "反弹shell",
+        "container": "容器",
+        "agentstat": "Agent状态",
+        "health": "Agent健康状态"
     }
 })
 
@@ -163,6 +267,8 @@ HostWData.update("zh_cn", {
             "ip": "发出告警的主机IP",
             "source": "告警原因",
             "level": "告警等级",
+            "attack": "ATT&CK",
+            "incident": "事件",
             "raw": "原始数据"
         },
         "data": {
@@ -179,6 +285,69 @@ HostWData.update("zh_cn", {
             }
         }
     },
+    "incident": {
+        "key": {
+            "description": "描述",
+            "level": "事件等级",
+            "assignee": "处理人",
+            "hosts": "涉及主机",
+            "sla": "SLA"
+        },
+        "status": {
+            "new": "新建",
+            "triage": "分诊",
+            "investigating": "调查中",
+            "resolved": "已解决",
+            "false_positive": "误报"
+        },
+        "action": {
+            "comment": "评论",
+            "status": "变更状态为",
+            "assign": "指派给",
+            "severity": "设置等级为",
+            "edit": "修改标题为",
+            "notice": "修改关联告警",
+            "evidence": "修改证据"
+        },
+        "evidence": {
+            "event": "行为数据",
+            "task": "任务结果"
+        }
+    },
+    "timeline": {
+        "source": {
+            "event": "行为数据",
+            "notice": "告警",
+            "task": "任务结果",
+            "inventory": "主机信息变化"
+        },
+        "type": {
+            "process": "进程",
+            "file": "文件",
+            "connection": "网络连接",
+            "loginlog": "登录日志",
+            "dns": "DNS",
+            "reverseshell": "反弹shell",
+            "notice": "告警",
+            "task": "任务结果",
+            "inventory": "主机信息变化"
+        }
+    },
+    "inventory": {
+        "type": {
+            "userlist": "用户",
+            "listening": "监听端口",
+            "crontab": "计划任务",
+            "startup": "启动项",
+            "service": "服务",
+            "processlist": "进程"
+        },
+        "action": {
+            "add": "新增",
+            "remove": "删除",
+            "change": "修改"
+        }
+    },
     "file": {
         "fileupload": "上传文件",
         "upload": "上传"
@@ -203,6 +372,45 @@ format_connection_msg = function(source) {
         msg += "<span class='key'>PID:</span>" + source.data.pid + "  ";
     if(source.data.protocol)
         msg += "<span class='key'>网络类型:</span>" + source.data.protocol + "  ";
+    msg += format_container_msg(source);
+    msg += "<span class='key'>时间:</span>" + timeformat(source.time);
+    return msg
+}
+
+format_dns_msg = function(source) {
+    msg = "<span class='title'>DNS查询:</span>";
+    if(source.data.domain)
+        msg += "<span class='key'>域名:</span>" + source.data.domain + "  ";
+    if(source.data.qtype)
+        msg += "<span class='key'>类型:</span>" + source.data.qtype + "  ";
+    if(source.data.rcode)
+        msg += "<span class='key'>结果:</span>" + source.data.rcode + "  ";
+    if(source.data.answers)
+        msg += "<span class='key'>应答:</span>" + source.data.answers + "  ";
+    if(source.data.server)
+        msg += "<span class='key'>DNS服务器:</span>" + source.data.server + "  ";
+    if(source.data.name)
+        msg += "<span class='key'>进程名:</span>" + source.data.name + "  ";
+    if(source.data.pid)
+        msg += "<span class='key'>PID:</span>" + source.data.pid + "  ";
+    msg += format_container_msg(source);
+    msg += "<span class='key'>时间:</span>" + timeformat(source.time);
+    return msg
+}
+
+format_reverseshell_msg = function(source) {
+    msg = "<span class='title'>反弹shell:</span>";
+    if(source.data.command)
+        msg += "<span class='key'>命令:</span>" + source.data.command + "  ";
+    if(source.data.name)
+        msg += "<span class='key'>进程信息:</span>" + source.data.name + ":" + source.data.pid + "  ";
+    if(source.data.parentname)
+        msg += "<span class='key'>父进程信息:</span>" + source.data.parentname + ":" + source.data.ppid + "  ";
+    if(source.data.remote)
+        msg += "<span class='key'>远程地址:</span>" + source.data.remote + "  ";
+    if(source.data.fds)
+        msg += "<span class='key'>标准输入输出:</span>" + source.data.fds + "  ";
+    msg += format_container_msg(source);
     msg += "<span class='key'>时间:</span>" + timeformat(source.time);
     return msg
 }
@@ -217,6 +425,7 @@ format_file_msg = function(source) {
         msg += "<span class='key'>文件hash:</span>" + source.data.hash + "  ";
     if(source.data.user)
         msg += "<span class='key'>用户:</span>" + source.data.user + "  ";
+    msg += format_container_msg(source);
     msg += "<span class='key'>时间:</span>" + timeformat(source.time);
     return msg
 }
@@ -229,6 +438,7 @@ format_process_msg = function(source) {
         msg += "<span class='key'>进程信息:</span>" + source.data.name + ":" + source.data.pid + "  ";
     if(source.data.parentname)
         msg += "<span class='key'>父进程信息:</span>" + source.data.parentname + ":" + source.data.ppid + "  ";
+    msg += format_container_msg(source);
     msg += "<span class='key'>时间:</span>" + timeformat(source.time);
     return msg
 }
@@ -247,6 +457,18 @@ format_loginlog_msg = function(source) {
     return msg
 }
 
+// 容器中的进程产生的事件
+format_container_msg = function(source) {
+    var container = "";
+    if(source.data.container_id)
+        container += "<span class='key'>容器:</span>" + source.data.container_id.substr(0, 12) + "  ";
+    if(source.data.container_image)
+        container += "<span class='key'>镜像:</span>" + source.data.container_image + "  ";
+    if(source.data.pod)
+        container += "<span class='key'>pod:</span>" + source.data.pod + "  ";
+    return container
+}
+
 format_msg = function(data) {
     source_type = data["_type"];
     if (source_type) {
@@ -1,6 +1,10 @@
 
 $(document).ready(function () {
 
+    if (location.search.indexOf("error=sso") != -1) {
+        swal("登录失败!", "统一认证失败或当前账号未分配角色，请联系管理员", "error");
+    }
+
     $("#loginbtn").click(function () {
         user = $.trim($("#username").val());
         pass = $.trim($("#password").val());
@@ -46,9 +46,18 @@ hostw.config(function ($routeProvider, $httpProvider) {
     }).when("/info/:ip/", {
         controller: hostw.detailinfo,
         template: document.getElementById('detailinfo').text
+    }).when("/timeline/:ip/", {
+        controller: hostw.timeline,
+        template: document.getElementById('timeline').text
+    }).when("/inventory", {
+        controller: hostw.inventory,
+        template: document.getElementById('inventory').text
     }).when("/notice", {
         controller: hostw.notice,
         template: document.getElementById('notice').text
+    }).when("/incidents", {
+        controller: hostw.incidents,
+        template: document.getElementById('incidents').text
     }).when("/config/", {
         controller: hostw.config,
         template: document.getElementById('config').text
@@ -369,7 +378,9 @@ hostw.controller('rules', function ($scope, $http, Notification) {
                 "author": "",
                 "description": "",
                 "level": 0,
-                "name": ""
+                "name": "",
+                "tactic": [],
+                "technique": []
             },
             "rules": {
                 "name": {
@@ -378,22 +389,37 @@ hostw.controller('rules', function ($scope, $http, Notification) {
                 }
             },
             "source": "",
-            "system": ""
+            "system": "",
+            "tags": []
+        }
+
+        // _id of the rule being edited, null when adding rules
+        $scope.edit_id = null;
+        $scope.test_days = 7;
+        $scope.test_result = null;
+
+        $scope.new_rule = function () {
+            $scope.edit_id = null;
+            $scope.test_result = null;
+            $scope.new_rules = $scope.pettyprint(rule_template, null, 2);
+            $('h4.modal-title strong').text('新增规则（多条规则请用json列表）');
         }
 
         $scope.edit = function(index) {
             current = jQuery.extend({}, $scope.rulelist[index]);
-            // current['//'] = '点击编辑规则并保存并不会覆盖原本规则，请调试新规则无误之后再删除原本规则。';
+            $scope.edit_id = current._id;
+            $scope.test_result = null;
             $scope.new_rules = $scope.pettyprint(current, null, 2);
             $('[href="#model-add-rules"]').click();
             $('h4.modal-title strong').text(
-                "编辑规则 (点击编辑规则并保存并不会覆盖原本规则, 而会新增一条规则，请调试新规则无误之后再删除原本规则)"
+                "编辑规则 " + current.meta.name + " (保存后生成新版本，可在历史版本中回滚)"
             );
         }
 
         $scope.pettyprint = function (obj, ...args) {
             res = Object.assign({}, obj);
             res._id = undefined;
+            res.version = undefined;
             return JSON.stringify(res, ...args);
         }
 
@@ -401,7 +427,7 @@ hostw.controller('rules', function ($scope, $http, Notification) {
             obj = { "id": id };
             swal({
                 title: "删除操作",
-                text: "该动作会删除这条规则，且不可复原。",
+                text: "该动作会删除这条规则，删除前的版本会保留在历史版本中。",
                 showCancelButton: true,
                 type: "warning",
                 confirmButtonColor: "#DD6B55"
@@ -437,8 +463,24 @@ hostw.controller('rules', function ($scope, $http, Notification) {
             }
         }, 10);
 
+        $scope.parse_rules = function () {
+            try {
+                return JSON.parse($scope.new_rules);
+            } catch (e) {
+                Notification.error('JSON格式错误: ' + e.message);
+                return null;
+            }
+        }
+
         $scope.add_rules = function () {
-            obj = JSON.parse($scope.new_rules);
+            obj = $scope.parse_rules();
+            if (obj == null) {
+                return;
+            }
+            if ($scope.edit_id != null) {
+                $scope.save_rule(obj);
+                return;
+            }
             if (!(obj instanceof Array)) {
                 obj = [obj];
             }
@@ -459,6 +501,159 @@ hostw.controller('rules', function ($scope, $http, Notification) {
                             res = response.data;
                             if (res.length) {
                                 Notification.success('成功添加' + res.length + '条规则!');
+                                location.reload();
+                            }
+                            if (response.data.status == false) {
+                                ajaxcallback(response.data);
+                            }
+                        })
+                    })
+                }
+            )
+        }
+
+        $scope.save_rule = function (obj) {
+            swal({
+                title: "是否确定保存规则？",
+                text: "该动作会修改\"" + obj.meta.name + "\"规则并生成新版本",
+                showCancelButton: true,
+                type: "warning",
+                confirmButtonColor: "#DD6B55"
+            },
+                function () {
+                    request_password(function (password) {
+                        rules_url = rules_url.url_update_query('pass', password);
+                        $http.post(
+                            rules_url.url_update_query('action', 'edit'),
+                            { "id": $scope.edit_id, "rule": obj }
+                        ).then(function (response) {
+                            res = response.data;
+                            if (res.version) {
+                                Notification.success('成功保存规则，当前版本 v' + res.version);
+                                location.reload();
+                            }
+                            if (response.data.status == false) {
+                                ajaxcallback(response.data);
+                            }
+                        })
+                    })
+                }
+            )
+        }
+
+        // dry-run, only check the rules
+        $scope.validate_rules = function () {
+            obj = $scope.parse_rules();
+            if (obj == null) {
+                return;
+            }
+            $http.post(rules_url.url_update_query('action', 'validate'), obj).then(function (response) {
+                if (response.data.status) {
+                    Notification.success('规则校验通过');
+                } else {
+                    Notification.error(response.data.msg);
+                }
+            })
+        }
+
+        // match the draft rule with historical data of last days
+        $scope.test_rule = function () {
+            obj = $scope.parse_rules();
+            if (obj == null) {
+                return;
+            }
+            if (obj instanceof Array) {
+                Notification.error('每次只能测试一条规则');
+                return;
+            }
+            $scope.test_result = null;
+            $http.post(
+                rules_url.url_update_query('action', 'test'),
+                { "rule": obj, "days": parseInt($scope.test_days) }
+            ).then(function (response) {
+                if (response.data.status) {
+                    $scope.test_result = response.data;
+                } else {
+                    Notification.error(response.data.msg);
+                }
+            })
+        }
+
+        $scope.sigma_reset = function () {
+            $scope.sigma_text = '';
+            $scope.sigma_result = null;
+            $('#sigma-file').val('');
+        }
+
+        // convert sigma rules, save them as disabled rules when save is true
+        $scope.sigma_import = function (save) {
+            files = $('#sigma-file')[0].files;
+            data = $scope.sigma_text;
+            if (files.length > 0) {
+                data = new FormData();
+                for (i = 0; i < files.length; i++) {
+                    data.append('file', files[i]);
+                }
+            } else if (!data) {
+                Notification.error('请选择或粘贴sigma规则');
+                return;
+            }
+            post = function (url) {
+                $http.post(url, data, {
+                    headers: { 'Content-Type': files.length > 0 ? undefined : 'application/x-yaml' },
+                    transformRequest: angular.identity
+                }).then(function (response) {
+                    if (response.data.status) {
+                        $scope.sigma_result = response.data;
+                        if (response.data.saved) {
+                            Notification.success('成功导入' + response.data.rules.length + '条规则!');
+                            $http.get(rules_url).then(function (response) {
+                                $scope.rulelist = response.data;
+                            })
+                        }
+                    } else {
+                        ajaxcallback(response.data);
+                    }
+                })
+            }
+            url = rules_url.url_update_query('action', 'sigma');
+            if (!save) {
+                post(url);
+                return;
+            }
+            request_password(function (password) {
+                post(url.url_update_query('save', 'true').url_update_query('pass', password));
+            })
+        }
+
+        $scope.history = function (index) {
+            $scope.history_rule = $scope.rulelist[index];
+            $http.get(rules_url.url_update_query('action', 'versions').url_update_query('id', $scope.history_rule._id))
+                .then(function (response) {
+                    $scope.versions = response.data;
+                    $('[href="#model-rule-versions"]').click();
+                })
+        }
+
+        $scope.rollback = function (v) {
+            swal({
+                title: "是否确定回滚规则？",
+                text: "该动作会将\"" + v.rule.meta.name + "\"规则恢复为 v" + v.version + " 的内容并生成新版本",
+                showCancelButton: true,
+                type: "warning",
+                confirmButtonColor: "#DD6B55"
+            },
+                function () {
+                    request_password(function (password) {
+                        rules_url = rules_url.url_update_query('pass', password);
+                        $http.post(
+                            rules_url.url_update_query('action', 'rollback'),
+                            { "id": v.rule_id, "version": v.version }
+                        ).then(function (response) {
+                            res = response.data;
+                            if (res.version) {
+                                Notification.success('成功回滚规则，当前版本 v' + res.version);
+                                location.reload();
                             }
                             if (response.data.status == false) {
                                 ajaxcallback(response.data);
@@ -845,6 +1040,298 @@ hostw.controller('config', function ($scope, $http, $rootScope, $routeParams, No
         add_tab_click_event()
     });
 
+    profile_template = {
+        "name": "",
+        "priority": 0,
+        "enabled": true,
+        "match": { "tags": [], "ip": [], "system": [], "type": [] },
+        "config": { "client": {}, "filter": {}, "webshell": {}, "resource": {} }
+    }
+    $scope.profiles = [];
+    $scope.preview = null;
+    $scope.new_profile = function () {
+        $scope.profile_json = JSON.stringify(profile_template, null, 2);
+    }
+    $scope.new_profile();
+    $scope.get_profiles = function () {
+        $http.get(profile_url).then(function (response) {
+            $scope.profiles = response.data || [];
+        });
+    }
+    $scope.get_profiles();
+
+    $scope.edit_profile = function (index) {
+        $scope.profile_json = JSON.stringify($scope.profiles[index], null, 2);
+    }
+
+    $scope.save_profile = function () {
+        try {
+            obj = JSON.parse($scope.profile_json);
+        } catch (e) {
+            Notification.error("配置模板不是合法的json");
+            return
+        }
+        request_password(function (password) {
+            $http.post(
+                profile_url.url_update_query('pass', password),
+                obj
+            ).then(function (response) {
+                if (response.data.status) {
+                    Notification.success('配置模板已保存，agent下次获取配置时生效');
+                    $scope.get_profiles();
+                } else {
+                    ajaxcallback(response.data);
+                }
+            })
+        });
+    }
+
+    $scope.delete_profile = function (id) {
+        swal({
+            title: "删除操作",
+            text: "该动作会删除这个配置模板，且不可复原。",
+            showCancelButton: true,
+            type: "warning",
+            confirmButtonColor: "#DD6B55"
+        },
+        function () {
+            request_password(function (password) {
+                $http.delete(
+                    profile_url.url_update_query('pass', password).url_update_query('id', id)
+                ).then(function (response) {
+                    if (response.data.status) {
+                        Notification.success('成功删除配置模板!');
+                        $scope.get_profiles();
+                    } else {
+                        ajaxcallback(response.data);
+                    }
+                })
+            })
+        });
+    }
+
+    $scope.preview_profile = function (ip) {
+        $http.get(profile_url + "/preview?ip=" + encodeURIComponent(ip)).then(function (response) {
+            if (response.data.config) {
+                $scope.preview = response.data;
+            } else {
+                ajaxcallback(response.data);
+            }
+        });
+    }
+
+    $scope.roles = ["admin", "analyst", "responder", "readonly"];
+    $scope.account = {};
+    $scope.users = [];
+    $scope.new_user = { "username": "", "password": "", "role": "readonly" };
+    $http.get(account_url).then(function (response) {
+        $scope.account = response.data;
+        if ($scope.account.role == "admin") {
+            $scope.get_users();
+        }
+    });
+    $scope.get_users = function () {
+        $http.get(user_url).then(function (response) {
+            $scope.users = response.data || [];
+        });
+    }
+
+    // 双因子密钥只显示一次，需使用Google Authenticator导入
+    show_totp = function (data) {
+        setTimeout(function () {
+            swal("请保存 " + data.username + " 的双因子密钥", data.totp + "\n\n" + data.uri, "success");
+        }, 100);
+    }
+
+    $scope.add_user = function () {
+        request_password(function (password) {
+            $http.post(user_url.url_update_query('pass', password), $scope.new_user).then(function (response) {
+                if (response.data.status) {
+                    show_totp(response.data);
+                    $scope.new_user = { "username": "", "password": "", "role": "readonly" };
+                    $scope.get_users();
+                } else {
+                    ajaxcallback(response.data);
+                }
+            });
+        });
+    }
+
+    $scope.edit_user = function (username, data) {
+        data.username = username;
+        request_password(function (password) {
+            $http.put(user_url.url_update_query('pass', password), data).then(function (response) {
+                if (response.data.status) {
+                    if (response.data.totp) {
+                        show_totp(response.data);
+                    } else {
+                        Notification.success("用户 " + username + " 已修改");
+                    }
+                } else {
+                    ajaxcallback(response.data);
+                }
+                $scope.get_users();
+            });
+        });
+    }
+
+    $scope.reset_password = function (username) {
+        swal({
+            title: "重置 " + username + " 的密码",
+            text: "请输入新密码，不少于8位",
+            type: "input",
+            inputType: "password",
+            showCancelButton: true,
+            closeOnConfirm: false
+        },
+            function (inputValue) {
+                if (inputValue) {
+                    swal.close();
+                    $scope.edit_user(username, { "password": inputValue });
+                }
+            }
+        );
+    }
+
+    $scope.delete_user = function (username) {
+        swal({
+            title: "删除操作",
+            text: "该动作会删除用户 " + username + "，且不可复原。",
+            showCancelButton: true,
+            type: "warning",
+            confirmButtonColor: "#DD6B55"
+        },
+            function () {
+                request_password(function (password) {
+                    $http.delete(
+                        user_url.url_update_query('pass', password).url_update_query('username', username)
+                    ).then(function (response) {
+                        if (response.data.status) {
+                            Notification.success('成功删除用户!');
+                            $scope.get_users();
+                        } else {
+                            ajaxcallback(response.data);
+                        }
+                    })
+                })
+            });
+    }
+
+    $scope.change_password = function () {
+        swal({
+            title: "修改密码",
+            text: "请输入原密码",
+            type: "input",
+            inputType: "password",
+            showCancelButton: true,
+            closeOnConfirm: false
+        },
+            function (oldValue) {
+                if (!oldValue) {
+                    return
+                }
+                swal({
+                    title: "修改密码",
+                    text: "请输入新密码，不少于8位",
+                    type: "input",
+                    inputType: "password",
+                    showCancelButton: true
+                },
+                    function (newValue) {
+                        if (!newValue) {
+                            return
+                        }
+                        $http.post(account_url, { "old": oldValue, "new": newValue }).then(function (response) {
+                            if (response.data.status) {
+                                Notification.success("密码已修改");
+                            } else {
+                                ajaxcallback(response.data);
+                            }
+                        });
+                    }
+                );
+            }
+        );
+    }
+
+    // API token，只在创建时显示一次
+    $scope.tokens = [];
+    $scope.token_scopes = ["read", "analyze", "notice", "rules", "tasks", "config", "client"];
+    $scope.new_token = { "name": "", "scope": { "read": true }, "expires": 90 };
+    $scope.get_tokens = function () {
+        $http.get(token_url.url_update_query('all', $scope.account.role == "admin")).then(function (response) {
+            $scope.tokens = response.data || [];
+        });
+    }
+    $scope.add_token = function () {
+        var scopes = [];
+        for (var scope in $scope.new_token.scope) {
+            if ($scope.new_token.scope[scope]) {
+                scopes.push(scope);
+            }
+        }
+        var data = { "name": $scope.new_token.name, "scopes": scopes, "expires": $scope.new_token.expires };
+        request_password(function (password) {
+            $http.post(token_url.url_update_query('pass', password), data).then(function (response) {
+                if (response.data.status) {
+                    setTimeout(function () {
+                        swal("请保存 " + data.name + " 的API token", response.data.token, "success");
+                    }, 100);
+                    $scope.new_token = { "name": "", "scope": { "read": true }, "expires": 90 };
+                    $scope.get_tokens();
+                } else {
+                    ajaxcallback(response.data);
+                }
+            });
+        });
+    }
+    $scope.delete_token = function (token) {
+        swal({
+            title: "吊销操作",
+            text: "该动作会吊销API token " + token.name + "，使用该token的脚本将无法访问。",
+            showCancelButton: true,
+            type: "warning",
+            confirmButtonColor: "#DD6B55"
+        },
+            function () {
+                request_password(function (password) {
+                    $http.delete(
+                        token_url.url_update_query('pass', password).url_update_query('id', token._id)
+                    ).then(function (response) {
+                        if (response.data.status) {
+                            Notification.success('成功吊销API token!');
+                            $scope.get_tokens();
+                        } else {
+                            ajaxcallback(response.data);
+                        }
+                    })
+                })
+            });
+    }
+
+    // 审计日志，仅管理员可查看
+    $scope.audits = [];
+    $scope.audit_page = 1;
+    $scope.audit_filter = { "q": "", "user": "", "ip": "", "start": "", "end": "" };
+    audit_query = function () {
+        var url = audit_url;
+        for (var key in $scope.audit_filter) {
+            if ($scope.audit_filter[key]) {
+                url = url.url_update_query(key, $scope.audit_filter[key]);
+            }
+        }
+        return url;
+    }
+    $scope.get_audits = function (page) {
+        $scope.audit_page = page || 1;
+        $http.get(audit_query().url_update_query('page', $scope.audit_page).url_update_query('limit', 50)).then(function (response) {
+            $scope.audits = response.data || [];
+        });
+    }
+    $scope.export_audits = function (format) {
+        window.open(audit_query().url_update_query('action', 'export').url_update_query('format', format));
+    }
+
     $scope.upload_system = "";
     $scope.agent_type = { "system": "null", "platform": "null" };
     $scope.agent_type_lst = [
@@ -1008,6 +1495,45 @@ hostw.controller('hostlist', function ($scope, $http, Notification) {
         );
     }
 
+    // 为当前过滤条件下的所有主机添加或删除标签，格式为 tag1,tag2,-tag3，-开头为删除
+    $scope.bulk_tag = function () {
+        target = $scope.search_filter ? $scope.search_filter : "all";
+        swal({
+            title: "批量设置标签",
+            text: "将为过滤条件 [" + target + "] 下的主机设置标签，多个标签以逗号隔开，-开头为删除该标签",
+            type: "input",
+            showCancelButton: true,
+            inputPlaceholder: "prod,db,-test"
+        },
+            function (inputValue) {
+                if (!inputValue) {
+                    return
+                }
+                json = { "q": target, "add": [], "remove": [] };
+                inputValue.split(",").forEach(function (tag) {
+                    tag = tag.trim();
+                    if (tag.indexOf("-") == 0) {
+                        json.remove.push(tag.substr(1));
+                    } else if (tag) {
+                        json.add.push(tag);
+                    }
+                });
+                request_password(function (password) {
+                    $http.post(client_url.url_update_query('pass', password), json).then(function (response) {
+                        if (response.data.status) {
+                            Notification.success("已为 " + response.data.count + " 台主机设置标签。");
+                            $scope.hosts = [];
+                            $scope.current_page = 1;
+                            $scope.get_result();
+                        } else {
+                            ajaxcallback(response.data);
+                        }
+                    });
+                });
+            }
+        );
+    }
+
     $scope.get_result = function () {
         $http.get(
             client_url.url_add_Paginator($scope.current_page).url_update_query('q', $scope.search_filter).url_update_query('limit', 24)
@@ -1057,6 +1583,18 @@ hostw.controller('hostlist', function ($scope, $http, Notification) {
         }
     }
 
+    $scope.profile_preview = {};
+    $scope.show_profile = function (ip) {
+        $scope.profile_preview = { "ip": ip };
+        $http.get(profile_url + "/preview?ip=" + encodeURIComponent(ip)).then(function (response) {
+            if (response.data.config) {
+                $scope.profile_preview = response.data;
+            } else {
+                ajaxcallback(response.data);
+            }
+        });
+    }
+
     $scope.show_monitor = function (ip) {
         $("#side-modal-title").text(ip);
         $scope.has_show_ids = [];
@@ -1132,6 +1670,21 @@ hostw.controller('notice', function ($scope, $http, $window, Notification, globa
         $window.location.href = "/#!/analyze";
     }
 
+    $scope.new_incident = function (notice) {
+        data = {
+            title: notice.info,
+            description: notice.description,
+            notices: [notice._id]
+        };
+        $http.post(incident_url.url_update_query("action", "add"), data).then(function (response) {
+            if (response.data._id) {
+                $window.location.href = "/#!/incidents?id=" + response.data._id;
+            } else {
+                ajaxcallback(response.data);
+            }
+        });
+    }
+
     $scope.add2config = function (type, info, config_type) {
         if (info.indexOf('|') > 0) {
             swal("0ops!!!!", "该信息无法自动化添加到黑白名单，请手动添加~", "error");
@@ -1140,7 +1693,8 @@ hostw.controller('notice', function ($scope, $http, $window, Notification, globa
         keydict = {
             "process": "process",
             "loginlog": "ip",
-            "connection": "ip"
+            "connection": "ip",
+            "dns": "domain"
         }
 
         if (type == 'loginlog') {
@@ -1333,6 +1887,362 @@ hostw.controller('notice', function ($scope, $http, $window, Notification, globa
 
 });
 
+hostw.controller('incidents', function ($scope, $http, $location, Notification) {
+    $scope.incidentlist = [];
+    $scope.langtem = HostWData[lang];
+    $scope.style = HostWData.style;
+    $scope.currenttype = 'open';
+    $scope.currentpage = 1;
+    $scope.current = null;
+    $scope.notices = [];
+    $scope.transitions = [];
+    $scope.related = null;
+    $scope.form = { "comment": "" };
+    $scope.new_incident = { "title": "", "description": "", "assignee": "" };
+
+    $scope.list_type_words = {
+        'open': "处理中",
+        'me': "我的",
+        'overdue': "超时",
+        'all': "全部"
+    }
+
+    $scope.level = function (inc) {
+        return inc.severity != undefined ? inc.severity : inc.level;
+    }
+
+    $scope.overdue = function (inc) {
+        var now = new Date();
+        if (inc.status == 'new' && new Date(inc.response_due) < now) {
+            return true;
+        }
+        return !inc.resolved && new Date(inc.resolve_due) < now;
+    }
+
+    $scope.data_text = function (data) {
+        return JSON.stringify(data);
+    }
+
+    $scope.comment_text = function (cm) {
+        if (cm.action == 'status') {
+            var status = cm.text.split(':')[0];
+            return $scope.langtem.incident.status[status] + cm.text.substr(status.length);
+        }
+        if (cm.action == 'severity') {
+            return $scope.langtem.notice.data.level[cm.text] || "按告警等级";
+        }
+        return cm.text;
+    }
+
+    $scope.get_result = function (t, p) {
+        url = incident_url.url_add_Paginator(p);
+        if (t == 'open' || t == 'me') {
+            url = url.url_update_query("status", "open");
+        }
+        if (t == 'me') {
+            url = url.url_update_query("assignee", "me");
+        }
+        if (t == 'overdue') {
+            url = url.url_update_query("overdue", "true");
+        }
+        if ($scope.filter) {
+            url = url.url_update_query("q", encodeURIComponent($scope.filter));
+        }
+        $http.get(url).then(function (response) {
+            if (response.data && response.data.length) {
+                $scope.incidentlist.push.apply($scope.incidentlist, response.data);
+            } else {
+                Notification.error("没有其它数据了。");
+            }
+        });
+    }
+
+    $scope.change_type = function (t) {
+        $scope.currenttype = t;
+        $scope.currentpage = 1;
+        $scope.incidentlist = [];
+        $scope.get_result(t, 1);
+    }
+
+    $scope.get_more = function () {
+        $scope.currentpage = $scope.currentpage + 1;
+        $scope.get_result($scope.currenttype, $scope.currentpage);
+    }
+
+    $scope.add_filter = function () {
+        swal(
+            {
+                title: "事件过滤器",
+                text: "请输入事件标题中的关键字",
+                type: "input",
+                showCancelButton: true,
+                closeOnConfirm: true,
+                inputPlaceholder: "Filter"
+            },
+            function (inputValue) {
+                $scope.filter = inputValue || "";
+                $scope.change_type($scope.currenttype);
+            }
+        );
+    }
+
+    $scope.open = function (id) {
+        $scope.related = null;
+        $http.get(incident_url.url_update_query("id", id)).then(function (response) {
+            if (response.data.incident) {
+                $scope.current = response.data.incident;
+                $scope.notices = response.data.notices;
+                $scope.transitions = response.data.transitions || [];
+            } else {
+                ajaxcallback(response.data);
+            }
+        });
+    }
+
+    // refresh the incident in list and detail after the action
+    $scope.post = function (action, data, callback) {
+        data.id = $scope.current ? $scope.current._id : undefined;
+        $http.post(incident_url.url_update_query("action", action), data).then(function (response) {
+            if (response.data._id) {
+                for (var i = 0; i < $scope.incidentlist.length; i++) {
+                    if ($scope.incidentlist[i]._id == response.data._id) {
+                        $scope.incidentlist[i] = response.data;
+                    }
+                }
+                $scope.open(response.data._id);
+                Notification.success("操作成功。");
+                if (callback) {
+                    callback(response.data);
+                }
+            } else {
+                ajaxcallback(response.data);
+            }
+        });
+    }
+
+    $scope.add = function () {
+        $scope.current = null;
+        $scope.post('add', $scope.new_incident, function (inc) {
+            $scope.incidentlist.unshift(inc);
+            $scope.new_incident = { "title": "", "description": "", "assignee": "" };
+        });
+    }
+
+    $scope.edit = function () {
+        swal({
+            title: "修改事件标题",
+            type: "input",
+            showCancelButton: true,
+            closeOnConfirm: true,
+            inputValue: $scope.current.title
+        },
+            function (title) {
+                if (title) {
+                    $scope.post('edit', { title: title, description: $scope.current.description });
+                }
+            });
+    }
+
+    $scope.assign = function () {
+        swal({
+            title: "指派事件",
+            text: "请输入处理人的用户名，留空为取消指派",
+            type: "input",
+            showCancelButton: true,
+            closeOnConfirm: true,
+            inputValue: $scope.current.assignee
+        },
+            function (assignee) {
+                if (assignee !== false) {
+                    $scope.post('assign', { assignee: assignee });
+                }
+            });
+    }
+
+    $scope.change_status = function (status) {
+        swal({
+            title: "变更状态为" + $scope.langtem.incident.status[status],
+            text: "可填写处理说明，关闭事件时会同时处理关联的未处理告警",
+            type: "input",
+            showCancelButton: true,
+            closeOnConfirm: true
+        },
+            function (comment) {
+                if (comment !== false) {
+                    $scope.post('status', { status: status, comment: comment });
+                }
+            });
+    }
+
+    $scope.comment = function () {
+        $scope.post('comment', { comment: $scope.form.comment }, function () {
+            $scope.form.comment = "";
+        });
+    }
+
+    $scope.get_related = function (type) {
+        $http.get(incident_url.url_update_query("id", $scope.current._id).url_update_query("related", type)).then(
+            function (response) {
+                $scope.related_type = type;
+                $scope.related = response.data || [];
+            });
+    }
+
+    $scope.related_text = function (r) {
+        if ($scope.related_type == 'event') {
+            return JSON.stringify(r._source.data);
+        }
+        if ($scope.related_type == 'task') {
+            return r.status + " " + r.data;
+        }
+        return r.info;
+    }
+
+    $scope.link_related = function (r) {
+        if ($scope.related_type == 'notice') {
+            $scope.post('notice', { notices: [r._id] });
+        } else {
+            $scope.post('evidence', { type: $scope.related_type, ref: r._id, note: "" });
+        }
+        $scope.related.remove(r);
+    }
+
+    $scope.link_by_id = function () {
+        swal({
+            title: "按ID关联证据",
+            text: "格式为 event:ES中的数据_id 或 task:任务结果_id",
+            type: "input",
+            showCancelButton: true,
+            closeOnConfirm: true
+        },
+            function (input) {
+                if (input) {
+                    var i = input.indexOf(':');
+                    $scope.post('evidence', { type: input.substr(0, i), ref: input.substr(i + 1), note: "" });
+                }
+            });
+    }
+
+    $scope.get_result($scope.currenttype, 1);
+    if ($location.search().id) {
+        $scope.open($location.search().id);
+    }
+});
+
+hostw.controller('timeline', function ($scope, $http, $routeParams, Notification) {
+    $scope.langtem = HostWData[lang];
+    $scope.hostip = $routeParams.ip;
+    $scope.timeline = [];
+    $scope.currentpage = 1;
+    $scope.types = {};
+    angular.forEach($scope.langtem.timeline.type, function (v, k) {
+        $scope.types[k] = true;
+    });
+    $scope.range = { "start": "", "end": "" };
+
+    $scope.get_result = function (p) {
+        url = (timeline_url + '/' + $scope.hostip).url_add_Paginator(p);
+        var types = [];
+        angular.forEach($scope.types, function (v, k) {
+            if (v) {
+                types.push(k);
+            }
+        });
+        if (!types.length) {
+            Notification.error("请至少选择一种数据类型。");
+            return;
+        }
+        url = url.url_update_query("types", types.join(","));
+        if ($scope.range.start) {
+            url = url.url_update_query("start", encodeURIComponent($scope.range.start));
+        }
+        if ($scope.range.end) {
+            url = url.url_update_query("end", encodeURIComponent($scope.range.end));
+        }
+        $http.get(url).then(function (response) {
+            if (response.data && response.data.length) {
+                $scope.timeline.push.apply($scope.timeline, response.data);
+            } else if (response.data && response.data.status == 0) {
+                Notification.error(response.data.msg);
+            } else {
+                Notification.error("没有其它数据了。");
+            }
+        });
+    }
+
+    $scope.search = function () {
+        $scope.currentpage = 1;
+        $scope.timeline = [];
+        $scope.get_result(1);
+    }
+
+    $scope.get_more = function () {
+        $scope.currentpage = $scope.currentpage + 1;
+        $scope.get_result($scope.currentpage);
+    }
+
+    $scope.data_text = function (data) {
+        return JSON.stringify(data);
+    }
+
+    $scope.search();
+});
+
+hostw.controller('inventory', function ($scope, $http, $location, Notification) {
+    $scope.langtem = HostWData[lang];
+    $scope.changelist = [];
+    $scope.currentpage = 1;
+    $scope.form = { "ip": $location.search().ip || "", "type": "", "action": "", "q": "", "start": "", "end": "", "hosts": false };
+
+    $scope.get_result = function (p) {
+        url = inventory_url.url_add_Paginator(p);
+        angular.forEach($scope.form, function (v, k) {
+            if (v) {
+                url = url.url_update_query(k, encodeURIComponent(v));
+            }
+        });
+        $http.get(url).then(function (response) {
+            if (response.data && response.data.length) {
+                $scope.changelist.push.apply($scope.changelist, response.data);
+            } else if (response.data && response.data.status == 0) {
+                Notification.error(response.data.msg);
+            } else {
+                Notification.error("没有其它数据了。");
+            }
+        });
+    }
+
+    $scope.search = function () {
+        $scope.currentpage = 1;
+        $scope.changelist = [];
+        $scope.hosts = $scope.form.hosts;
+        $scope.get_result(1);
+    }
+
+    $scope.get_more = function () {
+        $scope.currentpage = $scope.currentpage + 1;
+        $scope.get_result($scope.currentpage);
+    }
+
+    $scope.show_host = function (ip) {
+        $scope.form.ip = ip;
+        $scope.form.hosts = false;
+        $scope.search();
+    }
+
+    $scope.data_text = function (data) {
+        var values = [];
+        angular.forEach(data, function (v, k) {
+            if (v) {
+                values.push(k + ": " + v);
+            }
+        });
+        return values.join(", ");
+    }
+
+    $scope.search();
+});
+
 hostw.controller('statistics', function ($scope, $http, Notification) {
     Notification.info("正在加载数据，请耐心等待...");
     $scope.langtem = HostWData[lang]
@@ -1493,6 +2403,42 @@ hostw.controller('statistics', function ($scope, $http, Notification) {
             myChart.setOption(option);
         });
     });
+
+    $(function () {
+        var myChart = echarts.init(document.getElementById('chartAttack'));
+        $.get(statistics_url + "?type=attack", function (data) {
+            $scope.$apply(function () {
+                $scope.attack = data;
+            });
+            option = {
+                tooltip: {
+                    trigger: 'axis'
+                },
+                legend: {
+                    type: 'scroll',
+                    data: data.listdata.map(function (item) {
+                        return item.name;
+                    })
+                },
+                grid: {
+                    left: '3%',
+                    right: '4%',
+                    bottom: '3%',
+                    containLabel: true
+                },
+                xAxis: {
+                    type: 'category',
+                    boundaryGap: false,
+                    data: data.xdata
+                },
+                yAxis: {
+                    type: 'value'
+                },
+                series: data.listdata
+            };
+            myChart.setOption(option);
+        });
+    });
 });
 
 
@@ -10,6 +10,7 @@ import (
 	"math"
 	"math/rand"
 	"os"
+	"path"
 	"path/filepath"
 	"reflect"
 	"regexp"
@@ -170,6 +171,35 @@ func KeyType(key string, value string) interface{} {
 	return vresult
 }
 
+// ConfigValue check the json value of a config key against ConfigTypeMap, json numbers of
+// int type are converted to int, false if the type is wrong
+func ConfigValue(key string, value interface{}) (interface{}, bool) {
+	switch ValueInListMap(key, settings.ConfigTypeMap) {
+	case "int":
+		f, ok := value.(float64)
+		if !ok || f != math.Trunc(f) {
+			return nil, false
+		}
+		return int(f), true
+	case "bool":
+		_, ok := value.(bool)
+		return value, ok
+	case "list":
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		for _, item := range list {
+			if _, ok := item.(string); !ok {
+				return nil, false
+			}
+		}
+		return value, true
+	}
+	_, ok := value.(string)
+	return value, ok
+}
+
 // FindSub which one is my sun?
 // input (["a", "b"],"ac")
 // return "a"
@@ -182,6 +212,48 @@ func FindSub(strlist []string, str string) string {
 	return ""
 }
 
+// HasPermission admin can access all api, other roles can't access AdminURILst and can only
+// access the api in RolePermissions with non-GET method, prefixes are the api namespaces
+func HasPermission(role string, method string, url string, prefixes ...string) bool {
+	if role == settings.RoleAdmin {
+		return true
+	}
+	// dot segments must not bypass the route match
+	url = path.Clean(url)
+	if MatchRoute(settings.AdminURILst, url, prefixes...) != "" {
+		return false
+	}
+	if method == "GET" {
+		return true
+	}
+	return MatchRoute(settings.RolePermissions[role], url, prefixes...) != ""
+}
+
+// ConfigAdminOnly only admin can edit the config of AdminConfigTypes and the secret keys
+func ConfigAdminOnly(configType string, key string) bool {
+	return StringInSlice(configType, settings.AdminConfigTypes) || StringInSlice(key, settings.SecretKeyLst)
+}
+
+// MatchRoute which route is the url in? the url must be one of the prefixes followed by the
+// route and then "/", "?" or the end, so "/user" matches /v1/user/1 but not /v1/monitor/ip/userlist/0
+func MatchRoute(routes []string, url string, prefixes ...string) string {
+	for _, prefix := range prefixes {
+		if !strings.HasPrefix(url, prefix) {
+			continue
+		}
+		rest := url[len(prefix):]
+		for _, route := range routes {
+			if !strings.HasPrefix(rest, route) {
+				continue
+			}
+			if len(rest) == len(route) || rest[len(route)] == '/' || rest[len(route)] == '?' {
+				return route
+			}
+		}
+	}
+	return ""
+}
+
 // AllKey return all key in map and sub map
 func AllKey(skmap map[string]interface{}) []string {
 	var result []string
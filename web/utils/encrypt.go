@@ -7,6 +7,7 @@ import (
 	"crypto/sha1"
 	"crypto/x509"
 	"encoding/base32"
+	"encoding/hex"
 	"encoding/pem"
 	"os"
 	"path"
@@ -27,6 +28,24 @@ func GetPassword(key string) uint32 {
 	return 0
 }
 
+// GenTOTPKey create a random base32 key for "google auth"
+func GenTOTPKey() string {
+	key := make([]byte, 10)
+	if _, err := rand.Read(key); err != nil {
+		return ""
+	}
+	return base32.StdEncoding.EncodeToString(key)
+}
+
+// RandToken random hex string of n bytes from crypto/rand, for state or token
+func RandToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
 func toBytes(value int64) []byte {
 	var result []byte
 	mask := int64(0xFF)
@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPConfig LDAP authentication config, [ldap] section in app.conf
+type LDAPConfig struct {
+	URL                string // ldap://host:389 or ldaps://host:636
+	StartTLS           bool
+	InsecureSkipVerify bool
+	BindDN             string // service account to search users, empty to bind with UserDN directly
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string // %s is the username, such as (uid=%s)
+	UserDN             string // %s is the username, used when BindDN is empty, such as uid=%s,ou=people,dc=example,dc=com
+	GroupAttr          string // group attribute of user entry, such as memberOf
+	GroupFilter        string // %s is the user dn, such as (&(objectClass=groupOfNames)(member=%s))
+	RoleMap            map[string]string
+	DefaultRole        string
+}
+
+// ErrLDAPAuth username or password incorrect, or user not found
+var ErrLDAPAuth = errors.New("ldap: invalid credentials")
+
+// LoadLDAPConfig read [ldap] section, LDAP login is disabled when url is empty
+func LoadLDAPConfig() (LDAPConfig, bool) {
+	cfg := LDAPConfig{
+		URL:          beego.AppConfig.String("ldap::url"),
+		BindDN:       beego.AppConfig.String("ldap::binddn"),
+		BindPassword: beego.AppConfig.String("ldap::bindpassword"),
+		BaseDN:       beego.AppConfig.String("ldap::basedn"),
+		UserFilter:   beego.AppConfig.DefaultString("ldap::userfilter", "(uid=%s)"),
+		UserDN:       beego.AppConfig.String("ldap::userdn"),
+		GroupAttr:    beego.AppConfig.DefaultString("ldap::groupattr", "memberOf"),
+		GroupFilter:  beego.AppConfig.String("ldap::groupfilter"),
+		RoleMap:      ParseRoleMap(beego.AppConfig.String("ldap::rolemap")),
+		DefaultRole:  beego.AppConfig.String("ldap::defaultrole"),
+	}
+	cfg.StartTLS, _ = beego.AppConfig.Bool("ldap::starttls")
+	cfg.InsecureSkipVerify, _ = beego.AppConfig.Bool("ldap::insecureskipverify")
+	return cfg, cfg.URL != ""
+}
+
+// Authenticate bind with the user password, return groups of the user
+func (cfg LDAPConfig) Authenticate(username string, password string) ([]string, error) {
+	// unauthenticated bind with empty password always succeeds
+	if username == "" || password == "" {
+		return nil, ErrLDAPAuth
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	conn, err := ldap.DialURL(cfg.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetTimeout(10 * time.Second)
+	if cfg.StartTLS {
+		if err = conn.StartTLS(tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	userDN := fmt.Sprintf(cfg.UserDN, escapeDN(username))
+	if cfg.BindDN != "" {
+		if err = conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap: service account bind: %v", err)
+		}
+		filter := fmt.Sprintf(cfg.UserFilter, ldap.EscapeFilter(username))
+		res, err := conn.Search(ldap.NewSearchRequest(cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			2, 10, false, filter, []string{"dn"}, nil))
+		if err != nil {
+			return nil, err
+		}
+		if len(res.Entries) != 1 {
+			return nil, ErrLDAPAuth
+		}
+		userDN = res.Entries[0].DN
+	}
+	if err = conn.Bind(userDN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLDAPAuth
+		}
+		return nil, err
+	}
+
+	// groups are searched with service account if configured
+	if cfg.BindDN != "" {
+		if err = conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			return nil, err
+		}
+	}
+	var groups []string
+	if cfg.GroupAttr != "" {
+		res, err := conn.Search(ldap.NewSearchRequest(userDN, ldap.ScopeBaseObject, ldap.NeverDerefAliases,
+			1, 10, false, "(objectClass=*)", []string{cfg.GroupAttr}, nil))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range res.Entries {
+			groups = append(groups, entry.GetEqualFoldAttributeValues(cfg.GroupAttr)...)
+		}
+	}
+	if cfg.GroupFilter != "" {
+		filter := fmt.Sprintf(cfg.GroupFilter, ldap.EscapeFilter(userDN))
+		res, err := conn.Search(ldap.NewSearchRequest(cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, 10, false, filter, []string{"dn"}, nil))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range res.Entries {
+			groups = append(groups, entry.DN)
+		}
+	}
+	return groups, nil
+}
+
+// escapeDN escape special characters of a RDN value, RFC 4514
+func escapeDN(s string) string {
+	var b strings.Builder
+	for i, c := range s {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, c),
+			i == 0 && (c == ' ' || c == '#'),
+			i == len(s)-1 && c == ' ':
+			b.WriteRune('\\')
+			b.WriteRune(c)
+		case c == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"net/url"
+	"yulong-hids/web/settings"
+)
+
+// MaskValues mask the AuditMaskKeys of query or form values, the input of a secret config
+// key (POST /config with key privatekey etc.) is saved as md5
+func MaskValues(values url.Values) string {
+	for _, key := range settings.AuditMaskKeys {
+		if values.Get(key) != "" {
+			values.Set(key, "******")
+		}
+	}
+	if StringInSlice(values.Get("key"), settings.SecretKeyLst) && values.Get("input") != "" {
+		values.Set("input", Md5String(values.Get("input")))
+	}
+	res, _ := url.QueryUnescape(values.Encode())
+	return res
+}
+
+// MaskBody mask the AuditMaskKeys of the json body recursively, like MaskValues
+func MaskBody(obj interface{}) interface{} {
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		if key, ok := v["key"].(string); ok && StringInSlice(key, settings.SecretKeyLst) {
+			if input, ok := v["input"].(string); ok {
+				v["input"] = Md5String(input)
+			}
+		}
+		for key, item := range v {
+			if StringInSlice(key, settings.AuditMaskKeys) {
+				v[key] = "******"
+			} else {
+				v[key] = MaskBody(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = MaskBody(item)
+		}
+	}
+	return obj
+}
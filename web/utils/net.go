@@ -78,3 +78,26 @@ func BetweenIP(ipsrt1 string, ipstr2 string) []string {
 
 	return res
 }
+
+// ExpandHosts expand "start-end" ip ranges of the task host list and remove empty and
+// duplicate items, the order is kept
+func ExpandHosts(list []string) []string {
+	res := []string{}
+	added := make(map[string]bool)
+	for _, item := range list {
+		ips := []string{item}
+		if strings.Contains(item, "-") {
+			ips = nil
+			if ipRange := strings.Split(item, "-"); len(ipRange) == 2 {
+				ips = BetweenIP(strings.TrimSpace(ipRange[0]), strings.TrimSpace(ipRange[1]))
+			}
+		}
+		for _, ip := range ips {
+			if ip = strings.TrimSpace(ip); ip != "" && !added[ip] {
+				added[ip] = true
+				res = append(res, ip)
+			}
+		}
+	}
+	return res
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -16,3 +17,21 @@ func TestString2NetIP(t *testing.T) {
 func TestBetweenIP(t *testing.T) {
 	fmt.Println(BetweenIP("127.0.0.1", "127.0.0.200"))
 }
+
+func TestExpandHosts(t *testing.T) {
+	tests := []struct {
+		list []string
+		want []string
+	}{
+		{nil, []string{}},
+		{[]string{"10.0.0.1", "10.0.0.2", "10.0.0.1"}, []string{"10.0.0.1", "10.0.0.2"}},
+		{[]string{"10.0.0.2", "10.0.0.1-10.0.0.3", "10.0.0.4"}, []string{"10.0.0.2", "10.0.0.1", "10.0.0.3", "10.0.0.4"}},
+		{[]string{"10.0.0.1 - 10.0.0.2", "10.0.0.2-10.0.0.3"}, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{[]string{"", " 10.0.0.5 ", "10.0.0.1-10.0.0.2-10.0.0.3"}, []string{"10.0.0.5"}},
+	}
+	for _, tt := range tests {
+		if got := ExpandHosts(tt.list); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ExpandHosts(%v) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+}
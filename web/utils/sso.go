@@ -0,0 +1,258 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"yulong-hids/web/settings"
+
+	"github.com/astaxie/beego"
+)
+
+// ParseRoleMap parse group to role mapping, such as "cn=secops,ou=groups,dc=example,dc=com:admin;soc:analyst"
+func ParseRoleMap(s string) map[string]string {
+	res := make(map[string]string)
+	for _, item := range strings.Split(s, ";") {
+		i := strings.LastIndex(item, ":")
+		if i <= 0 {
+			continue
+		}
+		group := strings.ToLower(strings.TrimSpace(item[:i]))
+		role := strings.TrimSpace(item[i+1:])
+		if group != "" && StringInSlice(role, settings.RoleList) {
+			res[group] = role
+		}
+	}
+	return res
+}
+
+// MapRole the most privileged role of groups, group can be matched by dn or its first cn,
+// return defaultRole if no group is mapped, empty role means login denied
+func MapRole(groups []string, roleMap map[string]string, defaultRole string) string {
+	best := -1
+	for _, group := range groups {
+		group = strings.ToLower(strings.TrimSpace(group))
+		names := []string{group}
+		if strings.HasPrefix(group, "cn=") {
+			names = append(names, strings.SplitN(group[3:], ",", 2)[0])
+		}
+		for _, name := range names {
+			role, ok := roleMap[name]
+			if !ok {
+				continue
+			}
+			for i, r := range settings.RoleList {
+				if r == role && (best == -1 || i < best) {
+					best = i
+				}
+			}
+		}
+	}
+	if best == -1 {
+		if StringInSlice(defaultRole, settings.RoleList) {
+			return defaultRole
+		}
+		return ""
+	}
+	return settings.RoleList[best]
+}
+
+// OIDCConfig OpenID Connect authorization code flow config, [oidc] section in app.conf
+type OIDCConfig struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string // https://hids.example.com/login/oidc/callback
+	Scopes        string
+	UsernameClaim string
+	GroupsClaim   string
+	RoleMap       map[string]string
+	DefaultRole   string
+	Name          string // text of the login button
+}
+
+// OIDCUser user of the provider, Subject is issuer and sub claim which is the only stable and
+// unique identifier, Username is only used to create the user
+type OIDCUser struct {
+	Subject  string
+	Username string
+	Groups   []string
+}
+
+// oidcProvider endpoints from .well-known/openid-configuration
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+var oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+// LoadOIDCConfig read [oidc] section, OIDC login is disabled when issuer is empty
+func LoadOIDCConfig() (OIDCConfig, bool) {
+	cfg := OIDCConfig{
+		Issuer:        strings.TrimRight(beego.AppConfig.String("oidc::issuer"), "/"),
+		ClientID:      beego.AppConfig.String("oidc::clientid"),
+		ClientSecret:  beego.AppConfig.String("oidc::clientsecret"),
+		RedirectURL:   beego.AppConfig.String("oidc::redirecturl"),
+		Scopes:        beego.AppConfig.DefaultString("oidc::scopes", "openid profile email groups"),
+		UsernameClaim: beego.AppConfig.DefaultString("oidc::usernameclaim", "preferred_username"),
+		GroupsClaim:   beego.AppConfig.DefaultString("oidc::groupsclaim", "groups"),
+		RoleMap:       ParseRoleMap(beego.AppConfig.String("oidc::rolemap")),
+		DefaultRole:   beego.AppConfig.String("oidc::defaultrole"),
+		Name:          beego.AppConfig.DefaultString("oidc::name", "SSO"),
+	}
+	return cfg, cfg.Issuer != "" && cfg.ClientID != ""
+}
+
+func (cfg OIDCConfig) discover() (oidcProvider, error) {
+	var p oidcProvider
+	err := oidcGet(cfg.Issuer+"/.well-known/openid-configuration", "", &p)
+	if err != nil {
+		return p, err
+	}
+	if strings.TrimRight(p.Issuer, "/") != cfg.Issuer {
+		return p, fmt.Errorf("oidc: issuer mismatch %s", p.Issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.UserinfoEndpoint == "" {
+		return p, errors.New("oidc: incomplete provider metadata")
+	}
+	return p, nil
+}
+
+// AuthCodeURL url of the provider login page, state will be checked in callback
+func (cfg OIDCConfig) AuthCodeURL(state string) (string, error) {
+	p, err := cfg.discover()
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(p.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", cfg.ClientID)
+	q.Set("redirect_uri", cfg.RedirectURL)
+	q.Set("scope", cfg.Scopes)
+	q.Set("state", state)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Callback check the state and error of the callback query, then exchange the code,
+// expected is the state saved in session by AuthCodeURL
+func (cfg OIDCConfig) Callback(expected string, query url.Values) (OIDCUser, error) {
+	state := query.Get("state")
+	if expected == "" || subtle.ConstantTimeCompare([]byte(state), []byte(expected)) != 1 {
+		return OIDCUser{}, fmt.Errorf("oidc: state mismatch %s", query.Get("error"))
+	}
+	if query.Get("code") == "" {
+		return OIDCUser{}, fmt.Errorf("oidc: no code %s", query.Get("error"))
+	}
+	return cfg.Exchange(query.Get("code"))
+}
+
+// Exchange exchange the code for access token, return the user from userinfo.
+// Claims are read from userinfo endpoint with the access token which is got by server
+// directly from the provider, so id_token signature does not need to be verified
+func (cfg OIDCConfig) Exchange(code string) (OIDCUser, error) {
+	var user OIDCUser
+	p, err := cfg.discover()
+	if err != nil {
+		return user, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {cfg.RedirectURL},
+		"client_id":     {cfg.ClientID},
+		"client_secret": {cfg.ClientSecret},
+	}
+	req, err := http.NewRequest("POST", p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return user, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err = oidcDo(req, &token); err != nil {
+		return user, err
+	}
+	if token.AccessToken == "" {
+		return user, fmt.Errorf("oidc: token error %s", token.Error)
+	}
+
+	claims := map[string]interface{}{}
+	if err = oidcGet(p.UserinfoEndpoint, token.AccessToken, &claims); err != nil {
+		return user, err
+	}
+	sub := claimString(claims, "sub")
+	if sub == "" {
+		return user, errors.New("oidc: sub claim not found")
+	}
+	user.Subject = cfg.Issuer + " " + sub
+	// email is only trusted when verified by the provider
+	user.Username = claimString(claims, cfg.UsernameClaim)
+	if verified, _ := claims["email_verified"].(bool); user.Username == "" && verified {
+		user.Username = claimString(claims, "email")
+	}
+	if user.Username == "" {
+		return user, errors.New("oidc: username claim not found")
+	}
+	switch v := claims[cfg.GroupsClaim].(type) {
+	case []interface{}:
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				user.Groups = append(user.Groups, s)
+			}
+		}
+	case string:
+		user.Groups = strings.Split(v, ",")
+	}
+	return user, nil
+}
+
+func claimString(claims map[string]interface{}, key string) string {
+	s, _ := claims[key].(string)
+	return s
+}
+
+func oidcGet(u string, accessToken string, v interface{}) error {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	return oidcDo(req, v)
+}
+
+func oidcDo(req *http.Request, v interface{}) error {
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		return fmt.Errorf("oidc: %s %s", req.URL.Path, resp.Status)
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRoleMap(t *testing.T) {
+	got := ParseRoleMap(" CN=SecOps,ou=groups,dc=example,dc=com:admin; soc : analyst;ops:root;:readonly;noc;web:responder")
+	want := map[string]string{
+		"cn=secops,ou=groups,dc=example,dc=com": "admin",
+		"soc":                                   "analyst",
+		"web":                                   "responder",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseRoleMap = %v, want %v", got, want)
+	}
+	if got := ParseRoleMap(""); len(got) != 0 {
+		t.Errorf("ParseRoleMap(empty) = %v", got)
+	}
+}
+
+func TestMapRole(t *testing.T) {
+	roleMap := ParseRoleMap("cn=secops,ou=groups,dc=example,dc=com:admin;soc:analyst;noc:readonly")
+	tests := []struct {
+		name        string
+		groups      []string
+		defaultRole string
+		want        string
+	}{
+		{"dn", []string{"CN=SecOps,OU=Groups,DC=example,DC=com"}, "", "admin"},
+		{"first cn", []string{"cn=soc,ou=groups,dc=example,dc=com"}, "", "analyst"},
+		{"name", []string{" NOC "}, "", "readonly"},
+		{"most privileged", []string{"noc", "soc"}, "", "analyst"},
+		{"default", []string{"dev"}, "readonly", "readonly"},
+		{"no role", []string{"dev"}, "", ""},
+		{"bad default", nil, "root", ""},
+		{"cn of other dn", []string{"cn=dev,ou=soc,dc=example,dc=com"}, "", ""},
+	}
+	for _, tt := range tests {
+		if got := MapRole(tt.groups, roleMap, tt.defaultRole); got != tt.want {
+			t.Errorf("%s: MapRole = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeDN(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"alice", "alice"},
+		{"a,b+c", `a\,b\+c`},
+		{`x"<>;=\`, `x\"\<\>\;\=\\`},
+		{" #lead", `\ #lead`},
+		{"#x", `\#x`},
+		{"trail ", `trail\ `},
+		{"a\x00b", `a\00b`},
+		{"张三", "张三"},
+	}
+	for _, tt := range tests {
+		if got := escapeDN(tt.s); got != tt.want {
+			t.Errorf("escapeDN(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+// oidcTestProvider stand-in OpenID Connect provider, issuer of the metadata and claims of
+// the userinfo can be changed by the test
+type oidcTestProvider struct {
+	*httptest.Server
+	issuer string
+	claims map[string]interface{}
+}
+
+func newOIDCTestProvider() *oidcTestProvider {
+	p := &oidcTestProvider{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := p.issuer
+		if issuer == "" {
+			issuer = p.URL
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": p.URL + "/auth",
+			"token_endpoint":         p.URL + "/token",
+			"userinfo_endpoint":      p.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if r.Method != "POST" || r.FormValue("code") != "good" || id != "hids" || secret != "s3cret" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer at" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(p.claims)
+	})
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+func TestOIDC(t *testing.T) {
+	p := newOIDCTestProvider()
+	defer p.Close()
+	cfg := OIDCConfig{Issuer: p.URL, ClientID: "hids", ClientSecret: "s3cret", RedirectURL: "https://hids/callback",
+		Scopes: "openid", UsernameClaim: "preferred_username", GroupsClaim: "groups"}
+
+	authURL, err := cfg.AuthCodeURL("st")
+	if err != nil || !strings.HasPrefix(authURL, p.URL+"/auth?") || !strings.Contains(authURL, "state=st") {
+		t.Errorf("AuthCodeURL = %s %v", authURL, err)
+	}
+
+	tests := []struct {
+		name   string
+		issuer string
+		claims map[string]interface{}
+		state  string
+		query  url.Values
+		want   OIDCUser
+		err    string
+	}{
+		{
+			name:   "ok",
+			claims: map[string]interface{}{"sub": "u1", "preferred_username": "alice", "groups": []interface{}{"soc", 1}},
+			state:  "st",
+			query:  url.Values{"state": {"st"}, "code": {"good"}},
+			want:   OIDCUser{Subject: p.URL + " u1", Username: "alice", Groups: []string{"soc"}},
+		},
+		{
+			name:   "verified email",
+			claims: map[string]interface{}{"sub": "u2", "email": "bob@example.com", "email_verified": true, "groups": "a,b"},
+			state:  "st",
+			query:  url.Values{"state": {"st"}, "code": {"good"}},
+			want:   OIDCUser{Subject: p.URL + " u2", Username: "bob@example.com", Groups: []string{"a", "b"}},
+		},
+		{
+			name:   "unverified email",
+			claims: map[string]interface{}{"sub": "u3", "email": "bob@example.com", "email_verified": false},
+			state:  "st",
+			query:  url.Values{"state": {"st"}, "code": {"good"}},
+			err:    "username claim not found",
+		},
+		{
+			name:   "missing username",
+			claims: map[string]interface{}{"sub": "u4"},
+			state:  "st",
+			query:  url.Values{"state": {"st"}, "code": {"good"}},
+			err:    "username claim not found",
+		},
+		{
+			name:   "missing sub",
+			claims: map[string]interface{}{"preferred_username": "alice"},
+			state:  "st",
+			query:  url.Values{"state": {"st"}, "code": {"good"}},
+			err:    "sub claim not found",
+		},
+		{
+			name:  "bad state",
+			state: "st",
+			query: url.Values{"state": {"other"}, "code": {"good"}},
+			err:   "state mismatch",
+		},
+		{
+			name:  "no state in session",
+			query: url.Values{"state": {""}, "code": {"good"}},
+			err:   "state mismatch",
+		},
+		{
+			name:  "provider error",
+			state: "st",
+			query: url.Values{"state": {"st"}, "error": {"access_denied"}},
+			err:   "no code access_denied",
+		},
+		{
+			name:  "bad code",
+			state: "st",
+			query: url.Values{"state": {"st"}, "code": {"bad"}},
+			err:   "token error invalid_grant",
+		},
+		{
+			name:   "issuer mismatch",
+			issuer: "https://evil.example.com",
+			claims: map[string]interface{}{"sub": "u1", "preferred_username": "alice"},
+			state:  "st",
+			query:  url.Values{"state": {"st"}, "code": {"good"}},
+			err:    "issuer mismatch",
+		},
+	}
+	for _, tt := range tests {
+		p.issuer, p.claims = tt.issuer, tt.claims
+		user, err := cfg.Callback(tt.state, tt.query)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: Callback = %+v %v, want error %q", tt.name, user, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(user, tt.want) {
+			t.Errorf("%s: Callback = %+v %v, want %+v", tt.name, user, err, tt.want)
+		}
+	}
+}
@@ -20,6 +20,22 @@
         <li role="update" id="update_tab" class="ng-scope">
           <a aria-controls="update" role="tab" data-toggle="tab" aria-expanded="false">update</a>
         </li>
+
+        <li role="profile" id="profile_tab" class="ng-scope">
+          <a aria-controls="profile" role="tab" data-toggle="tab" aria-expanded="false">profile</a>
+        </li>
+
+        <li role="user" id="user_tab" class="ng-scope">
+          <a aria-controls="user" role="tab" data-toggle="tab" aria-expanded="false">user</a>
+        </li>
+
+        <li role="token" id="token_tab" class="ng-scope">
+          <a aria-controls="token" role="tab" data-toggle="tab" aria-expanded="false" ng-click="get_tokens()">token</a>
+        </li>
+
+        <li role="audit" id="audit_tab" class="ng-scope" ng-if="account.role == 'admin'">
+          <a aria-controls="audit" role="tab" data-toggle="tab" aria-expanded="false" ng-click="get_audits()">audit</a>
+        </li>
       </ul>
     </div>
     <div class="card-body tab-content">
@@ -127,6 +143,168 @@
 
         </div>
       </div>
+
+      <div role="tabpanel" class="tab-pane" id="profile">
+        <div class="card-body no-padding table-responsive row">
+          <div class="col-md-6">
+            <h5>
+              配置模板按分组条件覆盖全局的 <span class="highlight">client</span>、<span class="highlight">filter</span>、<span class="highlight">webshell</span>、<span class="highlight">resource</span> 配置，优先级数值大的后生效。
+            </h5>
+            <div class="table card-table" ng-repeat="p in profiles track by $index">
+              <span class="badge badge-icon" ng-class="p.enabled ? 'badge-success' : ''">
+                <i class="fa fa-sliders" aria-hidden="true"></i>
+                <span>{{ p.priority }} - {{ p.name }}</span>
+              </span>
+              <span class="badge badge-info badge-icon" ng-repeat="(mk, mv) in p.match" ng-if="mv.length">
+                <i class="fa fa-tag" aria-hidden="true"></i>
+                <span>{{ mk }}: {{ mv.join(', ') }}</span>
+              </span>
+              <span class="badge badge-icon edit" ng-click="edit_profile($index)">
+                <i class="fa fa-pencil" aria-hidden="true"></i>
+                <span>Edit</span>
+              </span>
+              <span class="badge badge-danger" style="cursor: pointer" ng-click="delete_profile(p._id)">
+                <i class="fa fa-trash" aria-hidden="true"></i>
+              </span>
+            </div>
+            <textarea class="jsoncode form-control" rows="16" ng-model="profile_json"></textarea>
+            <button class="btn btn-primary btn-square pull-right" ng-click="save_profile()">保存配置模板</button>
+            <button class="btn btn-default btn-square pull-right" ng-click="new_profile()">新建</button>
+          </div>
+          <div class="col-md-6">
+            <div class="input-group">
+              <input type="text" class="form-control" placeholder="输入主机IP预览最终生效的配置" ng-model="preview_ip">
+              <span class="input-group-btn">
+                <button class="btn btn-info" ng-click="preview_profile(preview_ip)">预览</button>
+              </span>
+            </div>
+            <div ng-show="preview">
+              <h5>生效的配置模板：<span class="highlight" ng-repeat="name in preview.profiles">{{ name }} </span><span ng-if="!preview.profiles.length">无（使用全局配置）</span></h5>
+              <pre class="config-text">{{ preview.config | json }}</pre>
+            </div>
+          </div>
+        </div>
+      </div>
+
+      <div role="tabpanel" class="tab-pane" id="user">
+        <div class="card-body no-padding table-responsive row">
+          <div class="col-md-12">
+            <h5>
+              当前用户 <span class="highlight">{{ account.username }}</span> ，角色 <span class="highlight">{{ account.role }}</span>
+              <button class="btn btn-default btn-square" ng-if="!account.source" ng-click="change_password()">修改密码</button>
+            </h5>
+          </div>
+          <div class="col-md-12" ng-if="account.role == 'admin'">
+            <table class="table">
+              <thead>
+                <tr><th>用户名</th><th>角色</th><th>状态</th><th>最后登录</th><th>操作</th></tr>
+              </thead>
+              <tbody>
+                <tr ng-repeat="u in users track by $index">
+                  <td>{{ u.username }} <span class="highlight" ng-if="u.source">{{ u.source }}</span></td>
+                  <td>
+                    <select class="form-control" ng-model="u.role" ng-options="r for r in roles" ng-change="edit_user(u.username, {'role': u.role})"></select>
+                  </td>
+                  <td>
+                    <span class="badge badge-icon" ng-class="u.enabled ? 'badge-success' : ''" style="cursor: pointer" ng-click="edit_user(u.username, {'enabled': !u.enabled})">
+                      <span>{{ u.enabled ? '启用' : '禁用' }}</span>
+                    </span>
+                  </td>
+                  <td>{{ u.lastlogin | date:'yyyy-MM-dd HH:mm:ss' }}</td>
+                  <td>
+                    <span class="badge badge-info" style="cursor: pointer" ng-click="reset_password(u.username)">重置密码</span>
+                    <span class="badge badge-warning" style="cursor: pointer" ng-click="edit_user(u.username, {'resettotp': true})">重置双因子密钥</span>
+                    <span class="badge badge-danger" style="cursor: pointer" ng-click="delete_user(u.username)"><i class="fa fa-trash" aria-hidden="true"></i></span>
+                  </td>
+                </tr>
+              </tbody>
+            </table>
+            <div class="form-inline">
+              <input type="text" class="form-control" placeholder="username" ng-model="new_user.username">
+              <input type="password" class="form-control" placeholder="password" ng-model="new_user.password">
+              <select class="form-control" ng-model="new_user.role" ng-options="r for r in roles"></select>
+              <button class="btn btn-primary btn-square" ng-click="add_user()">新增用户</button>
+            </div>
+          </div>
+        </div>
+      </div>
+
+      <div role="tabpanel" class="tab-pane" id="token">
+        <div class="card-body no-padding table-responsive row">
+          <div class="col-md-12">
+            <table class="table">
+              <thead>
+                <tr><th>名称</th><th>用户</th><th>Token</th><th>权限范围</th><th>过期时间</th><th>最后使用</th><th>操作</th></tr>
+              </thead>
+              <tbody>
+                <tr ng-repeat="t in tokens track by $index">
+                  <td>{{ t.name }}</td>
+                  <td>{{ t.user }}</td>
+                  <td>{{ t.prefix }}...</td>
+                  <td>{{ t.scopes.join(', ') }}</td>
+                  <td>{{ t.expires | date:'yyyy-MM-dd HH:mm:ss' }}</td>
+                  <td>{{ t.lastip }} {{ t.lastused | date:'yyyy-MM-dd HH:mm:ss' }}</td>
+                  <td>
+                    <span class="badge badge-danger" style="cursor: pointer" ng-click="delete_token(t)"><i class="fa fa-trash" aria-hidden="true"></i></span>
+                  </td>
+                </tr>
+              </tbody>
+            </table>
+            <div class="form-inline">
+              <input type="text" class="form-control" placeholder="名称，如 soar" ng-model="new_token.name">
+              <label ng-repeat="scope in token_scopes" style="margin-right: 10px">
+                <input type="checkbox" ng-model="new_token.scope[scope]"> {{ scope }}
+              </label>
+              <input type="number" class="form-control" placeholder="有效天数" ng-model="new_token.expires" min="1" max="365">
+              <button class="btn btn-primary btn-square" ng-click="add_token()">新增Token</button>
+            </div>
+          </div>
+        </div>
+      </div>
+
+      <div role="tabpanel" class="tab-pane" id="audit">
+        <div class="card-body no-padding table-responsive row">
+          <div class="col-md-12">
+            <div class="form-inline">
+              <input type="text" class="form-control" placeholder="关键字" ng-model="audit_filter.q">
+              <input type="text" class="form-control" placeholder="用户" ng-model="audit_filter.user">
+              <input type="text" class="form-control" placeholder="来源IP" ng-model="audit_filter.ip">
+              <input type="text" class="form-control" placeholder="开始 2006-01-02" ng-model="audit_filter.start">
+              <input type="text" class="form-control" placeholder="结束 2006-01-02" ng-model="audit_filter.end">
+              <button class="btn btn-primary btn-square" ng-click="get_audits(1)">搜索</button>
+              <button class="btn btn-default btn-square" ng-click="export_audits('json')">导出JSON</button>
+              <button class="btn btn-default btn-square" ng-click="export_audits('csv')">导出CSV</button>
+            </div>
+            <table class="table">
+              <thead>
+                <tr><th>时间</th><th>用户</th><th>来源IP</th><th>操作</th><th>目标</th><th>结果</th></tr>
+              </thead>
+              <tbody>
+                <tr ng-repeat-start="a in audits track by $index" style="cursor: pointer" ng-click="a.show = !a.show">
+                  <td>{{ a.time | date:'yyyy-MM-dd HH:mm:ss' }}</td>
+                  <td>{{ a.user }} <span class="highlight" ng-if="a.role">{{ a.role }}</span></td>
+                  <td>{{ a.ip }}</td>
+                  <td>{{ a.method }} {{ a.endpoint }}</td>
+                  <td>{{ (a.targets || []).join(', ') }}</td>
+                  <td>
+                    <span class="badge" ng-class="a.success ? 'badge-success' : 'badge-danger'">{{ a.success ? '成功' : '失败' }}</span>
+                    {{ a.msg }}
+                  </td>
+                </tr>
+                <tr ng-repeat-end ng-if="a.show">
+                  <td colspan="6">
+                    <pre class="config-text" ng-if="a.query">{{ a.query }}</pre>
+                    <pre class="config-text" ng-if="a.body">{{ a.body }}</pre>
+                    <pre class="config-text" ng-if="a.changes">{{ a.changes | json }}</pre>
+                  </td>
+                </tr>
+              </tbody>
+            </table>
+            <button class="btn btn-default btn-square" ng-if="audit_page > 1" ng-click="get_audits(audit_page - 1)">上一页</button>
+            <button class="btn btn-default btn-square" ng-if="audits.length == 50" ng-click="get_audits(audit_page + 1)">下一页</button>
+          </div>
+        </div>
+      </div>
     </div>
   </div>
 </div>
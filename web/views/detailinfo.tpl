@@ -26,6 +26,12 @@
             <span class="badge badge-text badge-icon" ng-if="infolist.uptime">
               <i class="fa fa-clock-o" aria-hidden="true"></i>{{ infolist.uptime }}
             </span>
+            <a class="badge badge-info badge-icon" href="/#!/timeline/{{ hostip }}/">
+              <i class="fa fa-history" aria-hidden="true"></i>时间线
+            </a>
+            <a class="badge badge-info badge-icon" href="/#!/inventory?ip={{ hostip }}">
+              <i class="fa fa-exchange" aria-hidden="true"></i>信息变化
+            </a>
           </p>
       </div>
     </div>
@@ -30,21 +30,35 @@
                 <i class="fa fa-clock-o" aria-hidden="true"></i>
                 <span>{{ timeformat(host.uptime) }}</span>
               </span>
-              <span class="badge badge-info badge-icon" ng-if="host.type">
+              <span class="badge badge-info badge-icon" ng-repeat="role in host.roles">
+                <i class="fa fa-tag" aria-hidden="true"></i>
+                <span>{{ role }}</span>
+              </span>
+              <span class="badge badge-info badge-icon" ng-if="host.type && !host.roles.length">
                 <i class="fa fa-tag" aria-hidden="true"></i>
                 <span>{{ host.type }}</span>
               </span>
+              <span class="badge badge-warning badge-icon" ng-repeat="tag in host.tags" ng-click="re_search('tag:' + tag)" style="cursor: pointer">
+                <i class="fa fa-bookmark" aria-hidden="true"></i>
+                <span>{{ tag }}</span>
+              </span>
               <span class="badge badge-icon" ng-class="health_data[host.health]['style']" ng-if="host.health != undefined">
                 <i class="fa fa-leaf" aria-hidden="true"></i>
                 <span>{{ health_data[host.health]['word'] }}</span>
               </span>
             </p>
             <div class="title">{{ host.hostname }}</div>
+            <p ng-if="host.business || host.env || host.owner" class="host-owner">
+              <span ng-if="host.business">{{ host.business }}</span>
+              <span ng-if="host.env"> / {{ host.env }}</span>
+              <span ng-if="host.owner"> / {{ host.owner }}</span>
+            </p>
             <div class="value">{{ host.ip }}</div>
             <div class="btn-group">
               <a ng-href="{{ '/#!/info/'+ host.ip }}" class="btn btn-success">信息</a>
               <button data-toggle="modal" ng-click="show_monitor(host.ip)" data-target="#monitor-modal" class="btn btn-success">监控</button>
               <button class="btn  btn-success" data-host="{{ host.ip }}" data-toggle="modal" ng-click="SetHosttext(host.ip)" data-target="#newTaskModel">推送</button>
+              <button data-toggle="modal" ng-click="show_profile(host.ip)" data-target="#profile-modal" class="btn btn-success">配置</button>
             </div>
           </div>
         </div>
@@ -60,6 +74,10 @@
         <i class="fa fa-search-minus" aria-hidden="true" title="添加过滤器"></i>
     </button>
 
+    <button class="icon append-icon" id="tagbutton" ng-click="bulk_tag()">
+        <i class="fa fa-bookmark" aria-hidden="true" title="为当前过滤条件下的主机设置标签"></i>
+    </button>
+
     <button class="icon append-icon" id="fixedbutton" ng-click="get_more()">
         <i class="fa fa-caret-down" aria-hidden="true" title="加载更多"></i>
     </button>
@@ -82,6 +100,21 @@
     </div><!-- modal-dialog -->
 </div><!-- modal -->
 
+<div class="modal fade" id="profile-modal" tabindex="-1" role="dialog" aria-labelledby="profile-modal-title">
+    <div class="modal-dialog" role="document">
+        <div class="modal-content">
+            <div class="modal-header">
+                <button type="button" class="close" data-dismiss="modal" aria-label="Close"><span aria-hidden="true">&times;</span></button>
+                <h4 class="modal-title" id="profile-modal-title">{{ profile_preview.ip }} 最终生效的配置</h4>
+            </div>
+            <div class="modal-body">
+                <h5>生效的配置模板：<span class="highlight" ng-repeat="name in profile_preview.profiles">{{ name }} </span><span ng-if="!profile_preview.profiles.length">无（使用全局配置）</span></h5>
+                <pre>{{ profile_preview.config | json }}</pre>
+            </div>
+        </div>
+    </div>
+</div>
+
   <div class="modal fade" id="newTaskModel" tabindex="-1" role="dialog" aria-labelledby="newTaskModelLabel" aria-hidden="true">
     <div class="modal-dialog">
       <div class="modal-content">
@@ -114,7 +147,7 @@
               <input type="text" class="form-control" placeholder="command" check-type="required" name="command">
             </div>
             <div class="col-md-12">
-              <textarea check-type="required" id="host_list" name="host_list" rows="3" class="form-control" placeholder="host_list;每个host以逗号隔开..."></textarea>
+              <textarea check-type="required" id="host_list" name="host_list" rows="3" class="form-control" placeholder="host_list;每个host以逗号隔开，支持all、windows、linux、IP范围及 tag:标签..."></textarea>
             </div>
           </div>
         </div>
@@ -0,0 +1,218 @@
+<!-- incident.tpl -->
+<script type="text/ng-template" id="incidents">
+  <div ng-controller="incidents" class="notice">
+
+      <div class="col-md-12 top-nav">
+          <div class="col-md-6 left-title">
+              事件
+          </div>
+          <div class="col-md-6">
+            <button class="btn btn-info btn-square pull-right" data-toggle="modal" data-target="#newIncidentModel">
+                  <i class="fa fa-plus" aria-hidden="true"></i>
+                  新建事件
+              </button>
+          </div>
+      </div>
+      <div class="app-messaging-container">
+        <div class="app-messaging collapse in" aria-expanded="true">
+          <div class="chat-group col-lg-4 col-md-4 col-sm-12 col-xs-12">
+            <div class="heading item-list">
+              事件列表 |
+              <span>
+                {{ filter }}
+                <a><i ng-click="add_filter()" class="fa fa-pencil-square-o" aria-hidden="true"></i></a>
+              </span>
+              <div class="notice-type pull-right">
+                <a ng-repeat="(k, v) in list_type_words" ng-click="change_type(k)"> {{ v }}{{ $last ? '' : ' |' }}</a>
+              </div>
+            </div>
+            <ul class="group full-height">
+              <li class="section">{{ list_type_words[currenttype] }}</li>
+              <li class="message" ng-repeat="inc in incidentlist track by $index" title="{{ inc.title }}" ng-class='{active: current && inc._id == current._id}' ng-click="open(inc._id)">
+                <a href="" aria-expanded="true">
+                  <span class="{{ style.notice.level[level(inc)] }} pull-right">{{ langtem.notice.data.level[level(inc)] }}</span>
+                  <span class="badge badge-success pull-right">{{ langtem.incident.status[inc.status] }}</span>
+                  <span class="badge badge-danger pull-right" ng-if="overdue(inc)">超时</span>
+                  <div class="message">
+                    <div class="content">
+                      <div class="title">
+                        <b>{{ inc.title | cutWords:30 }}</b>
+                        <small>{{ inc.assignee || '未指派' }}</small>
+                      </div>
+                    </div>
+                  </div>
+                </a>
+              </li>
+              <li class="more" ng-click="get_more()">点击加载更多事件</li>
+            </ul>
+          </div>
+          <div class="messaging col-lg-12 col-md-12 col-sm-12 col-xs-12" ng-if="current">
+            <div class="heading">
+              <div class="title">
+                <b>事件详情:</b>  ({{ current.title | cutWords:50 }})
+                <span class="badge badge-info badge-icon">
+                  <i class="fa fa-circle" aria-hidden="true"></i>
+                  <span>{{ langtem.incident.status[current.status] }}</span>
+                </span>
+                <span class="badge badge-danger" ng-if="overdue(current)">超出SLA</span>
+              </div>
+            </div>
+            <div class="col-md-12 messagebody">
+              <table class="table table-striped table-bordered table-hover">
+                <tbody>
+                  <tr>
+                    <td class="key">{{ langtem.incident.key.description }}</td>
+                    <td class="v" style="white-space: pre-wrap;">{{ current.description }}</td>
+                  </tr>
+                  <tr>
+                    <td class="key">{{ langtem.incident.key.level }}</td>
+                    <td class="v">
+                      <span class="badge {{ style.notice.level[level(current)] }} badge-icon">
+                        <i class="fa fa-exclamation-triangle" aria-hidden="true"></i>
+                        {{ langtem.notice.data.level[level(current)] }}
+                      </span>
+                      <small ng-if="current.severity != undefined">（手动设置，告警最高等级为{{ langtem.notice.data.level[current.level] }}）</small>
+                    </td>
+                  </tr>
+                  <tr>
+                    <td class="key">{{ langtem.incident.key.assignee }}</td>
+                    <td class="v">{{ current.assignee || '未指派' }}</td>
+                  </tr>
+                  <tr>
+                    <td class="key">{{ langtem.incident.key.hosts }}</td>
+                    <td class="v">
+                      <span ng-repeat="ip in current.hosts">
+                        <a class="badge badge-success" href="/#!/info/{{ ip }}/">{{ ip }}</a>
+                        <a href="/#!/timeline/{{ ip }}/" title="时间线"><i class="fa fa-history" aria-hidden="true"></i></a>
+                      </span>
+                    </td>
+                  </tr>
+                  <tr>
+                    <td class="key">{{ langtem.incident.key.sla }}</td>
+                    <td class="v">
+                      创建 {{ timeformat(current.created) }} ({{ current.creator }})<br>
+                      响应 {{ current.responded ? timeformat(current.responded) : '-' }}，期限 {{ timeformat(current.response_due) }}<br>
+                      解决 {{ current.resolved ? timeformat(current.resolved) : '-' }}，期限 {{ timeformat(current.resolve_due) }}
+                    </td>
+                  </tr>
+                </tbody>
+              </table>
+            </div>
+            <div class="col-md-12 done-notice">
+              <div class="dropdown pull-right">
+                <button class="btn btn-default dropdown-toggle" type="button" data-toggle="dropdown" ng-class="transitions.length ? '' : 'disabled'">
+                  状态流转
+                  <span class="caret"></span>
+                </button>
+                <ul class="dropdown-menu" role="menu">
+                  <li role="presentation" ng-repeat="s in transitions">
+                    <a role="menuitem" tabindex="-1" ng-click="change_status(s)">{{ langtem.incident.status[s] }}</a>
+                  </li>
+                </ul>
+              </div>
+              <div class="dropdown pull-right">
+                <button class="btn btn-default dropdown-toggle" type="button" data-toggle="dropdown">
+                  事件等级
+                  <span class="caret"></span>
+                </button>
+                <ul class="dropdown-menu" role="menu">
+                  <li role="presentation" ng-repeat="l in [0, 1, 2]">
+                    <a role="menuitem" tabindex="-1" ng-click="post('severity', {severity: l})">{{ langtem.notice.data.level[l] }}</a>
+                  </li>
+                  <li role="presentation">
+                    <a role="menuitem" tabindex="-1" ng-click="post('severity', {severity: -1})">按告警等级</a>
+                  </li>
+                </ul>
+              </div>
+              <button class="btn btn-default pull-right" type="button" ng-click="assign()">指派</button>
+              <button class="btn btn-default pull-right" type="button" ng-click="edit()">编辑</button>
+            </div>
+
+            <div class="col-md-12">
+              <h5>关联告警（{{ notices.length }}）</h5>
+              <table class="table table-striped">
+                <tbody>
+                  <tr ng-repeat="n in notices">
+                    <td><span class="badge {{ style.notice.level[n.level] }}">{{ langtem.notice.data.level[n.level] }}</span></td>
+                    <td>{{ n.ip }}</td>
+                    <td>{{ langtem.notice.data.type[n.type] }}</td>
+                    <td title="{{ n.info }}">{{ n.info | cutWords:60 }}</td>
+                    <td>{{ langtem.notice.data.status[n.status] }}</td>
+                    <td>{{ timeformat(n.time) }}</td>
+                    <td><a ng-click="post('notice', {remove: [n._id]})"><i class="fa fa-unlink" aria-hidden="true"></i></a></td>
+                  </tr>
+                </tbody>
+              </table>
+
+              <h5>证据（{{ current.evidence.length }}）</h5>
+              <table class="table table-striped">
+                <tbody>
+                  <tr ng-repeat="e in current.evidence">
+                    <td>{{ langtem.incident.evidence[e.type] }}</td>
+                    <td>{{ e.source }}</td>
+                    <td>{{ e.ip }}</td>
+                    <td>{{ timeformat(e.time) }}</td>
+                    <td title="{{ data_text(e.data) }}">{{ data_text(e.data) | cutWords:80 }}</td>
+                    <td>{{ e.note }} <small>{{ e.user }}</small></td>
+                    <td><a ng-click="post('unlink', {evidence: e._id})"><i class="fa fa-unlink" aria-hidden="true"></i></a></td>
+                  </tr>
+                </tbody>
+              </table>
+
+              <h5>
+                关联数据
+                <div class="btn-group">
+                  <button class="btn btn-xs btn-default" ng-click="get_related('notice')">相关告警</button>
+                  <button class="btn btn-xs btn-default" ng-click="get_related('event')">相关行为数据</button>
+                  <button class="btn btn-xs btn-default" ng-click="get_related('task')">相关任务结果</button>
+                  <button class="btn btn-xs btn-default" ng-click="link_by_id()">按ID关联</button>
+                </div>
+              </h5>
+              <table class="table table-striped" ng-if="related.length">
+                <tbody>
+                  <tr ng-repeat="r in related">
+                    <td>{{ related_type == 'event' ? r._type : (related_type == 'task' ? r.name : langtem.notice.data.type[r.type]) }}</td>
+                    <td>{{ related_type == 'event' ? r._source.ip : r.ip }}</td>
+                    <td>{{ timeformat(related_type == 'event' ? r._source.time : r.time) }}</td>
+                    <td title="{{ related_text(r) }}">{{ related_text(r) | cutWords:80 }}</td>
+                    <td><a ng-click="link_related(r)"><i class="fa fa-link" aria-hidden="true"></i></a></td>
+                  </tr>
+                </tbody>
+              </table>
+              <p ng-if="related && !related.length">时间范围内没有相关数据</p>
+
+              <h5>处理记录</h5>
+              <ul class="list-unstyled">
+                <li ng-repeat="cm in current.comments | orderBy:'-time'">
+                  <small>{{ timeformat(cm.time) }} <b>{{ cm.user }}</b> {{ langtem.incident.action[cm.action] }}</small>
+                  <span style="white-space: pre-wrap;">{{ comment_text(cm) }}</span>
+                </li>
+              </ul>
+              <textarea class="form-control" rows="3" ng-model="form.comment" placeholder="添加评论"></textarea>
+              <button class="btn btn-info" style="margin-top: 5px;" ng-click="comment()">评论</button>
+            </div>
+          </div>
+        </div>
+      </div>
+
+      <div class="modal fade" id="newIncidentModel" tabindex="-1" role="dialog" aria-hidden="true">
+        <div class="modal-dialog">
+          <div class="modal-content">
+            <div class="modal-header">
+              <button type="button" class="close" data-dismiss="modal" aria-hidden="true">&times;</button>
+              <h4 class="modal-title">新建事件</h4>
+            </div>
+            <div class="modal-body">
+              <input type="text" class="form-control" ng-model="new_incident.title" placeholder="标题">
+              <textarea class="form-control" rows="4" ng-model="new_incident.description" placeholder="描述" style="margin-top: 5px;"></textarea>
+              <input type="text" class="form-control" ng-model="new_incident.assignee" placeholder="指派给（用户名，可不填）" style="margin-top: 5px;">
+            </div>
+            <div class="modal-footer">
+              <button type="button" class="btn btn-default" data-dismiss="modal">关闭</button>
+              <button type="button" class="btn btn-primary" data-dismiss="modal" ng-click="add()">创建</button>
+            </div>
+          </div>
+        </div>
+      </div>
+  </div>
+</script>
@@ -8,7 +8,10 @@
 <<< template "hostlist.tpl" >>>
 <<< template "statistics.tpl" >>>
 <<< template "detailinfo.tpl" >>>
+<<< template "timeline.tpl" >>>
+<<< template "inventory.tpl" >>>
 <<< template "notice.tpl" >>>
+<<< template "incident.tpl" >>>
 <<< template "config.tpl" >>>
 <<< template "task.tpl" >>>
 <<< template "analyze.tpl" >>>
@@ -0,0 +1,89 @@
+<!-- inventory.tpl -->
+<script type="text/ng-template" id="inventory">
+<div ng-controller="inventory" class="detailinfo">
+<div class="col-lg-12 col-md-12 col-sm-12 col-xs-12">
+  <div class="row">
+  <div class="col-lg-12">
+    <div class="app-heading">
+      <div class="app-title">
+        <div class="title">主机信息变化</div>
+        <div class="description">
+          用户、监听端口、计划任务、启动项、服务和进程的新增、删除和修改记录，默认为最近7天
+        </div>
+      </div>
+    </div>
+  </div>
+  </div>
+
+  <div class="card card-mini">
+    <div class="card-body">
+      <div class="form-inline">
+        <input type="text" class="form-control" ng-model="form.ip" placeholder="主机IP，空为全部主机">
+        <select class="form-control" ng-model="form.type">
+          <option value="">全部类型</option>
+          <option ng-repeat="(k, v) in langtem.inventory.type" value="{{ k }}">{{ v }}</option>
+        </select>
+        <select class="form-control" ng-model="form.action">
+          <option value="">全部变化</option>
+          <option ng-repeat="(k, v) in langtem.inventory.action" value="{{ k }}">{{ v }}</option>
+        </select>
+        <input type="text" class="form-control" ng-model="form.q" placeholder="关键字">
+        <input type="text" class="form-control" ng-model="form.start" placeholder="开始时间 2006-01-02 15:04:05">
+        <input type="text" class="form-control" ng-model="form.end" placeholder="结束时间 2006-01-02 15:04:05">
+        <label class="checkbox-inline"><input type="checkbox" ng-model="form.hosts"> 按主机汇总</label>
+        <button class="btn btn-info" ng-click="search()">查询</button>
+      </div>
+    </div>
+    <div class="card-body no-padding table-responsive">
+      <table class="table card-table" ng-if="!hosts">
+        <thead>
+          <tr>
+            <th>时间</th>
+            <th>主机</th>
+            <th>类型</th>
+            <th>变化</th>
+            <th>内容</th>
+          </tr>
+        </thead>
+        <tbody>
+          <tr ng-repeat="item in changelist track by $index">
+            <td>{{ timeformat(item.time) }}</td>
+            <td><a href="/#!/timeline/{{ item.ip }}/">{{ item.ip }}</a></td>
+            <td>{{ langtem.inventory.type[item.type] }}</td>
+            <td>{{ langtem.inventory.action[item.action] }}</td>
+            <td title="{{ data_text(item.data) }}">
+              {{ data_text(item.data) | cutWords:100 }}
+              <div ng-if="item.prev"><small>修改前: {{ data_text(item.prev) | cutWords:100 }}</small></div>
+            </td>
+          </tr>
+          <tr>
+            <td colspan="5" class="more" ng-click="get_more()"><a>点击加载更多</a></td>
+          </tr>
+        </tbody>
+      </table>
+      <table class="table card-table" ng-if="hosts">
+        <thead>
+          <tr>
+            <th>主机</th>
+            <th>变化数量</th>
+            <th>类型</th>
+            <th>最近变化时间</th>
+          </tr>
+        </thead>
+        <tbody>
+          <tr ng-repeat="h in changelist track by $index">
+            <td><a ng-click="show_host(h.ip)">{{ h.ip }}</a></td>
+            <td>{{ h.count }}</td>
+            <td><span class="badge badge-text" ng-repeat="t in h.types">{{ langtem.inventory.type[t] }}</span></td>
+            <td>{{ timeformat(h.last) }}</td>
+          </tr>
+          <tr>
+            <td colspan="4" class="more" ng-click="get_more()"><a>点击加载更多</a></td>
+          </tr>
+        </tbody>
+      </table>
+    </div>
+  </div>
+</div>
+</div>
+</script>
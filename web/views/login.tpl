@@ -21,6 +21,7 @@
         <input class="input is-success" name="username" id="username" type="text" placeholder="USERNAME">
         <input class="input is-success" name="password" id="password" type="password" placeholder="PASSWORD">
         <input id="loginbtn" type="submit" value="LOGIN">
+        {{if .OIDC}}<a id="ssobtn" href="/login/oidc">{{.OIDC}}</a>{{end}}
     </div>
 </div>
 
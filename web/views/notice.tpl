@@ -104,6 +104,13 @@
                         </span>
                       </td>
                   </tr>
+                  <tr ng-if="notice['technique'] || notice['tactic']">
+                    <td class="key">{{ langtem.notice.key.attack }}</td>
+                    <td class="v">
+                      <span class="badge badge-info" ng-repeat="t in notice['tactic']">{{ t }}</span>
+                      <span class="badge badge-warning" ng-repeat="t in notice['technique']">{{ t }}</span>
+                    </td>
+                  </tr>
                   <tr>
                     <td class="key">{{ langtem.notice.key.raw }}</td>
                     <td class="v">
@@ -157,6 +164,12 @@
               <button class="btn btn-info pull-right" type="button" ng-click="search_analyze(notice)">
                   搜索分析
               </button>
+              <a class="btn btn-default pull-right" ng-if="notice.incident" href="/#!/incidents?id={{ notice.incident }}">
+                  查看事件
+              </a>
+              <button class="btn btn-default pull-right" type="button" ng-if="!notice.incident" ng-click="new_incident(notice)">
+                  创建事件
+              </button>
             </div>
           </div>
         </div>
@@ -11,7 +11,11 @@
                     <i class="fa fa-cloud-download" aria-hidden="true"></i>
                     导出规则
                 </a>
-                <button class="btn btn-primary btn-square pull-right" href="#model-add-rules" data-toggle="modal" onclick="$('h4.modal-title strong').text('新增规则（多条规则请用json列表）');">
+                <button class="btn btn-default btn-square pull-right" href="#model-sigma" data-toggle="modal" ng-click="sigma_reset()">
+                    <i class="fa fa-upload" aria-hidden="true"></i>
+                    导入Sigma
+                </button>
+                <button class="btn btn-primary btn-square pull-right" href="#model-add-rules" data-toggle="modal" ng-click="new_rule()">
                     <i class="fa fa-plus" aria-hidden="true"></i>
                     添加规则
                 </button>
@@ -29,8 +33,37 @@
                     </div>
                     <div class='modal-body'>
                         <textarea class="jsoncode" ng-model="new_rules"></textarea>
+                        <div ng-if="test_result">
+                            <p>
+                                最近 {{ test_result.days }} 天共扫描 {{ test_result.scanned }} 条数据，命中 {{ test_result.matched }} 条
+                                <span ng-if="test_result.truncated">（数据过多，仅扫描了最近的部分数据）</span>
+                            </p>
+                            <table class="table" ng-if="test_result.matches.length">
+                                <thead>
+                                    <tr><th>主机</th><th>时间</th><th>触发信息</th></tr>
+                                </thead>
+                                <tbody>
+                                    <tr ng-repeat="m in test_result.matches" title="{{ m.data | json }}">
+                                        <td>{{ m.ip }}</td>
+                                        <td>{{ m.time | date:'yyyy-MM-dd HH:mm:ss' }}</td>
+                                        <td>{{ m.value }}</td>
+                                    </tr>
+                                </tbody>
+                            </table>
+                        </div>
                     </div>
                     <div class='modal-footer'>
+                        <div class="pull-left form-inline">
+                            最近 <input type="number" class="form-control input-sm" min="1" max="30" ng-model="test_days" style="width:70px;"> 天
+                            <button class="btn btn-info btn-square" ng-click="test_rule()">
+                                <i class="fa fa-flask" aria-hidden="true"></i>
+                                测试规则
+                            </button>
+                            <button class="btn btn-default btn-square" ng-click="validate_rules()">
+                                <i class="fa fa-check" aria-hidden="true"></i>
+                                校验
+                            </button>
+                        </div>
                         <button class="btn btn-primary btn-square pull-right" ng-click="add_rules()">
                             <i class="fa fa-cloud" aria-hidden="true"></i>
                             保存规则
@@ -41,6 +74,97 @@
         </div>
 
 
+        <div class="modal fade" id="model-sigma">
+            <div class='modal-dialog'>
+                <div class='modal-content'>
+                    <div class='modal-header'>
+                        <button type="button" class="close" data-dismiss="modal" aria-hidden="true">×</button>
+                        <h4 class='modal-title'>
+                            <strong>导入Sigma规则（支持process_creation、network_connection、file_event、authentication）</strong>
+                        </h4>
+                    </div>
+                    <div class='modal-body'>
+                        <input type="file" id="sigma-file" accept=".yml,.yaml" multiple>
+                        <p>或粘贴sigma规则（多条规则以---分隔）：</p>
+                        <textarea class="jsoncode" ng-model="sigma_text"></textarea>
+                        <div ng-if="sigma_result">
+                            <p>可转换 {{ sigma_result.rules.length }} 条规则<span ng-if="sigma_result.saved">，已保存（默认关闭，请测试后启用）</span>，{{ sigma_result.errors.length }} 条sigma规则无法转换</p>
+                            <table class="table" ng-if="sigma_result.rules.length">
+                                <thead>
+                                    <tr><th>规则</th><th>来源</th><th>系统</th><th>判断条件</th></tr>
+                                </thead>
+                                <tbody>
+                                    <tr ng-repeat="r in sigma_result.rules">
+                                        <td>{{ r.meta.name }}</td>
+                                        <td>{{ r.source }}</td>
+                                        <td>{{ r.system }}</td>
+                                        <td>{{ r.rules | json }}</td>
+                                    </tr>
+                                </tbody>
+                            </table>
+                            <table class="table" ng-if="sigma_result.errors.length">
+                                <thead>
+                                    <tr><th>文件</th><th>sigma规则</th><th>无法转换的原因</th></tr>
+                                </thead>
+                                <tbody>
+                                    <tr ng-repeat="e in sigma_result.errors">
+                                        <td>{{ e.file }}</td>
+                                        <td>{{ e.title }}</td>
+                                        <td><div ng-repeat="p in e.problems">{{ p }}</div></td>
+                                    </tr>
+                                </tbody>
+                            </table>
+                        </div>
+                    </div>
+                    <div class='modal-footer'>
+                        <button class="btn btn-info btn-square pull-left" ng-click="sigma_import(false)">
+                            <i class="fa fa-eye" aria-hidden="true"></i>
+                            预览
+                        </button>
+                        <button class="btn btn-primary btn-square pull-right" ng-click="sigma_import(true)">
+                            <i class="fa fa-cloud" aria-hidden="true"></i>
+                            导入规则
+                        </button>
+                    </div>
+                </div>
+            </div>
+        </div>
+
+        <a href="#model-rule-versions" data-toggle="modal" style="display:none;"></a>
+        <div class="modal fade" id="model-rule-versions">
+            <div class='modal-dialog'>
+                <div class='modal-content'>
+                    <div class='modal-header'>
+                        <button type="button" class="close" data-dismiss="modal" aria-hidden="true">×</button>
+                        <h4 class='modal-title'>
+                            <strong>{{ history_rule.meta.name }} 历史版本</strong>
+                        </h4>
+                    </div>
+                    <div class='modal-body'>
+                        <table class="table">
+                            <thead>
+                                <tr><th>版本</th><th>操作</th><th>操作人</th><th>时间</th><th></th></tr>
+                            </thead>
+                            <tbody>
+                                <tr ng-repeat="v in versions" title="{{ pettyprint(v.rule, null, 2) }}">
+                                    <td>v{{ v.version }}</td>
+                                    <td>{{ v.action }}</td>
+                                    <td>{{ v.user }}</td>
+                                    <td>{{ v.time | date:'yyyy-MM-dd HH:mm:ss' }}</td>
+                                    <td>
+                                        <span class="badge badge-warning" style="cursor: pointer" ng-if="!$first && v.action != 'del'" ng-click="rollback(v)">
+                                            <i class="fa fa-undo" aria-hidden="true"></i>
+                                            回滚
+                                        </span>
+                                    </td>
+                                </tr>
+                            </tbody>
+                        </table>
+                    </div>
+                </div>
+            </div>
+        </div>
+
         <div class="col-md-12">
             <div class="panel-group" id="accordion" role="tablist" aria-multiselectable="true">
 
@@ -70,6 +194,11 @@
                                     <i class="fa fa-bookmark-o" aria-hidden="true"></i>
                                     {{ rule.source }}
                             </span>
+                            <span class="badge badge-warning" ng-if="rule.meta.technique.length || rule.meta.tactic.length"
+                                  title="ATT&amp;CK {{ rule.meta.tactic.join(', ') }}">
+                                    <i class="fa fa-crosshairs" aria-hidden="true"></i>
+                                    {{ (rule.meta.technique.length ? rule.meta.technique : rule.meta.tactic).join(', ') }}
+                            </span>
                             <span class="badge badge-danger" style="cursor: pointer" ng-click="delete(rule._id)">
                                 <i class="fa fa-trash" aria-hidden="true"></i>
                                 删除
@@ -78,6 +207,10 @@
                                 <i class="fa fa-pencil" aria-hidden="true"></i>
                                 编辑
                             </span>
+                            <span class="badge badge-info" style="cursor: pointer" ng-click="history($index)">
+                                <i class="fa fa-history" aria-hidden="true"></i>
+                                v{{ rule.version || 1 }}
+                            </span>
                             <a role="button">
                                 <i class="more-less fa fa-plus" ng-click="open_body(rule._id)"></i>
                             </a>
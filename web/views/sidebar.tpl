@@ -40,6 +40,22 @@
           <div class="title">告警</div>
         </a>
       </li>
+      <li class="active">
+        <a no-href="/#!/incidents">
+          <div class="icon">
+            <i class="fa fa-briefcase" aria-hidden="true"></i>
+          </div>
+          <div class="title">事件</div>
+        </a>
+      </li>
+      <li class="active">
+        <a no-href="/#!/inventory">
+          <div class="icon">
+            <i class="fa fa-history" aria-hidden="true"></i>
+          </div>
+          <div class="title">信息变化</div>
+        </a>
+      </li>
       <li class="active">
         <a no-href="/#!/tasks">
           <div class="icon">
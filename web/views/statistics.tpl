@@ -115,5 +115,40 @@
         </div>
       </div>
     </div>
+    <div class="row">
+      <div class="col-md-12">
+        <div class="x_panel tile overflow_hidden">
+          <div class="x_title">
+            <h2>ATT&amp;CK 覆盖 <small>启用规则 {{attack.coverage.rules}} 条，覆盖技术 {{attack.coverage.techniques}} 个，未标记 {{attack.coverage.untagged}} 条</small></h2>
+            <div class="clearfix"></div>
+          </div>
+          <div class="x_content">
+            <div class="col-md-7" style="height: 300px;" id="chartAttack"></div>
+            <div class="col-md-5">
+              <table class="table table-striped">
+                <thead>
+                  <tr>
+                    <th>战术</th>
+                    <th>规则</th>
+                    <th>技术</th>
+                    <th>告警（7天）</th>
+                  </tr>
+                </thead>
+                <tbody>
+                  <tr ng-repeat="t in attack.tactics" ng-class="{'text-muted': t.rules == 0}">
+                    <td>{{t.id}} {{t.name}}</td>
+                    <td>{{t.rules}}</td>
+                    <td>
+                      <span class="label label-primary" ng-repeat="tech in t.techniques" style="margin-right: 2px;">{{tech}}</span>
+                    </td>
+                    <td>{{t.notices}}</td>
+                  </tr>
+                </tbody>
+              </table>
+            </div>
+          </div>
+        </div>
+      </div>
+    </div>
   </div>
 </script>
\ No newline at end of file
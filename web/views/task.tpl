@@ -87,7 +87,7 @@
               <input type="text" class="form-control" placeholder="command" check-type="required" name="command">
             </div>
             <div class="col-md-12">
-              <textarea check-type="required" id="host_list" name="host_list" rows="3" class="form-control" placeholder="host_list;每个host以逗号隔开..."></textarea>
+              <textarea check-type="required" id="host_list" name="host_list" rows="3" class="form-control" placeholder="host_list;每个host以逗号隔开，支持all、windows、linux、IP范围及 tag:标签..."></textarea>
             </div>
           </div>
         </div>
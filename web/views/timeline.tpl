@@ -0,0 +1,60 @@
+<!-- timeline.tpl -->
+<script type="text/ng-template" id="timeline">
+<div ng-controller="timeline" class="detailinfo">
+<div class="col-lg-12 col-md-12 col-sm-12 col-xs-12">
+  <div class="row">
+  <div class="col-lg-12">
+    <div class="app-heading">
+      <div class="app-title">
+        <div class="title">时间线 : '<a class="highlight" href="/#!/info/{{ hostip }}/">{{ hostip }}</a>'</div>
+        <div class="description">
+          按时间倒序显示主机的行为数据、告警、任务结果和主机信息变化，默认为最近24小时
+        </div>
+      </div>
+    </div>
+  </div>
+  </div>
+
+  <div class="card card-mini">
+    <div class="card-header">
+      <label class="checkbox-inline" ng-repeat="(k, v) in langtem.timeline.type">
+        <input type="checkbox" ng-model="types[k]"> {{ v }}
+      </label>
+    </div>
+    <div class="card-body">
+      <div class="form-inline">
+        <input type="text" class="form-control" ng-model="range.start" placeholder="开始时间 2006-01-02 15:04:05">
+        <input type="text" class="form-control" ng-model="range.end" placeholder="结束时间 2006-01-02 15:04:05">
+        <button class="btn btn-info" ng-click="search()">查询</button>
+      </div>
+    </div>
+    <div class="card-body no-padding table-responsive">
+      <table class="table card-table">
+        <thead>
+          <tr>
+            <th>时间</th>
+            <th>来源</th>
+            <th>类型</th>
+            <th>内容</th>
+          </tr>
+        </thead>
+        <tbody>
+          <tr ng-repeat="item in timeline track by $index">
+            <td>{{ timeformat(item.time) }}</td>
+            <td>{{ langtem.timeline.source[item.source] }}</td>
+            <td>{{ item.source == 'notice' ? langtem.notice.data.type[item.type] : (item.source == 'inventory' ? langtem.inventory.type[item.type] : langtem.timeline.type[item.type]) }}</td>
+            <td title="{{ data_text(item.data) }}">
+              <a ng-if="item.source == 'task'" href="/#!/taskresult/{{ item.data.task_id }}/">{{ item.summary | cutWords:100 }}</a>
+              <span ng-if="item.source != 'task'">{{ item.summary | cutWords:100 }}</span>
+            </td>
+          </tr>
+          <tr>
+            <td colspan="4" class="more" ng-click="get_more()"><a>点击加载更多</a></td>
+          </tr>
+        </tbody>
+      </table>
+    </div>
+  </div>
+</div>
+</div>
+</script>